@@ -0,0 +1,92 @@
+#ifndef __CONN_H__
+#define __CONN_H__
+
+#include "flow.h"
+
+// Identification of the TCP connections from their sockets, which is shared by the tracing
+// programs that hook on to the TCP stack.
+
+// socket address families, as defined in include/linux/socket.h
+#define AF_INET 2
+#define AF_INET6 10
+
+// Minimal definitions of the kernel structures that are read by the programs. The offsets
+// of their fields are relocated from the BTF information of the running kernel (CO-RE).
+struct in6_addr {
+    union {
+        u8 u6_addr8[IP_MAX_LEN];
+    } in6_u;
+} __attribute__((preserve_access_index));
+
+struct sock_common {
+    __be32 skc_daddr;
+    __be32 skc_rcv_saddr;
+    __be16 skc_dport;
+    __u16 skc_num;
+    unsigned short skc_family;
+    struct in6_addr skc_v6_daddr;
+    struct in6_addr skc_v6_rcv_saddr;
+} __attribute__((preserve_access_index));
+
+struct sock {
+    struct sock_common __sk_common;
+} __attribute__((preserve_access_index));
+
+struct sk_buff;
+
+// Common attributes of the flows of a TCP connection, as sent from the local to the remote
+// endpoint. They have the same values and encoding as the flow_id fields with the same name
+typedef struct conn_id_t {
+    u16 eth_protocol;
+    u8 src_ip[IP_MAX_LEN];
+    u8 dst_ip[IP_MAX_LEN];
+    u16 src_port;
+    u16 dst_port;
+    u8 transport_protocol;
+} __attribute__((packed)) conn_id;
+
+// Force emitting struct conn_id into the ELF.
+const struct conn_id_t *unused4 __attribute__((unused));
+
+// returns true if the IPv6 address is an IPv4-mapped address (::ffff:0:0/96), which is used by
+// the dual-stack sockets for their IPv4 connections
+static __always_inline bool is_ip4in6(u8 *addr) {
+    for (int i = 0; i < sizeof(ip4in6); i++) {
+        if (addr[i] != ip4in6[i]) {
+            return false;
+        }
+    }
+    return true;
+}
+
+// fills the connection identifier from the socket. Returns false if the socket family is not
+// supported
+static __always_inline bool fill_conn_id(struct sock *sk, conn_id *id) {
+    struct sock_common *skc = &sk->__sk_common;
+    switch (skc->skc_family) {
+    case AF_INET: {
+        __be32 saddr = skc->skc_rcv_saddr;
+        __be32 daddr = skc->skc_daddr;
+        id->eth_protocol = ETH_P_IP;
+        __builtin_memcpy(id->src_ip, ip4in6, sizeof(ip4in6));
+        __builtin_memcpy(id->dst_ip, ip4in6, sizeof(ip4in6));
+        __builtin_memcpy(id->src_ip + sizeof(ip4in6), &saddr, sizeof(saddr));
+        __builtin_memcpy(id->dst_ip + sizeof(ip4in6), &daddr, sizeof(daddr));
+    } break;
+    case AF_INET6:
+        __builtin_memcpy(id->src_ip, skc->skc_v6_rcv_saddr.in6_u.u6_addr8, IP_MAX_LEN);
+        __builtin_memcpy(id->dst_ip, skc->skc_v6_daddr.in6_u.u6_addr8, IP_MAX_LEN);
+        // the IPv4 connections of dual-stack sockets are sent as IPv4 packets, whose
+        // addresses have the same encoding in the flows
+        id->eth_protocol = is_ip4in6(id->dst_ip) ? ETH_P_IP : ETH_P_IPV6;
+        break;
+    default:
+        return false;
+    }
+    id->src_port = skc->skc_num;
+    id->dst_port = bpf_ntohs(skc->skc_dport);
+    id->transport_protocol = IPPROTO_TCP;
+    return true;
+}
+
+#endif /* __CONN_H__ */
@@ -0,0 +1,134 @@
+#ifndef __FILTER_H__
+#define __FILTER_H__
+
+#include "flow.h"
+#include "maps.h"
+
+// Maximum number of rules that can apply to an address: the rules of its most specific CIDR and
+// the rules of all the CIDRs that contain it
+#define MAX_FILTER_RULES 8
+
+// Actions of the filter rules
+#define FILTER_ACCEPT 0
+#define FILTER_DROP 1
+// only 1 out of "sampling" packets of the matching flows are parsed
+#define FILTER_SAMPLE 2
+
+// Key of the filter rules map: a CIDR. IPv4 CIDRs are encoded as IPv4-mapped IPv6 CIDRs, as the
+// addresses of the flow_id, so their prefix length is increased by 96 bits
+typedef struct filter_key_t {
+    u32 prefix_len;
+    u8 ip[IP_MAX_LEN];
+} __attribute__((packed)) filter_key;
+
+// Force emitting struct filter_key into the ELF.
+const struct filter_key_t *unused7 __attribute__((unused));
+
+typedef struct filter_rule_t {
+    // position of the rule in the user configuration. If several rules match a flow, the rule
+    // with the lowest priority applies
+    u16 priority;
+    u8 action;
+    // bitmask of the directions (1 << INGRESS, 1 << EGRESS) of the matching flows
+    u8 directions;
+    // transport protocol of the matching flows. 0 matches any protocol
+    u8 protocol;
+    // range of the source or destination port of the matching flows. 0-0 matches any port
+    u16 port_start;
+    u16 port_end;
+    // sampling rate of the FILTER_SAMPLE action
+    u32 sampling;
+} __attribute__((packed)) filter_rule;
+
+// Rules that apply to the addresses of a CIDR, sorted by priority
+typedef struct filter_rules_t {
+    u8 count;
+    filter_rule rules[MAX_FILTER_RULES];
+} __attribute__((packed)) filter_rules;
+
+// Force emitting struct filter_rules into the ELF.
+const struct filter_rules_t *unused8 __attribute__((unused));
+
+// Key: CIDR of the rules. Value: the rules whose CIDR contains it, including its own.
+// The longest prefix match of an address returns all the rules that apply to it.
+// The max entries are resized to the number of configured CIDRs at load time
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __uint(max_entries, 1);
+    __type(key, filter_key);
+    __type(value, filter_rules);
+} filter_rules_map SEC(".maps");
+
+// returns the first rule that matches the flow, or NULL if none matches
+static __always_inline filter_rule *first_matching_rule(filter_rules *rules, flow_id *id) {
+    for (int i = 0; i < MAX_FILTER_RULES; i++) {
+        if (i >= rules->count) {
+            break;
+        }
+        filter_rule *rule = &rules->rules[i];
+        if ((rule->directions & (1 << id->direction)) == 0) {
+            continue;
+        }
+        if (rule->protocol != 0 && rule->protocol != id->transport_protocol) {
+            continue;
+        }
+        if (rule->port_end != 0
+            && (id->src_port < rule->port_start || id->src_port > rule->port_end)
+            && (id->dst_port < rule->port_start || id->dst_port > rule->port_end)) {
+            continue;
+        }
+        return rule;
+    }
+    return NULL;
+}
+
+// returns 0 if the packet of the evaluated_flow must not be accounted, according to the first
+// matching rule of its source or destination address. Otherwise, it returns the sampling rate of
+// the rule that sampled the packet, or 1 if it was not sampled. The packets of the flows that do
+// not match any rule are accounted.
+// It is a global function, so the verifier checks it once, instead of for each of the many
+// packet parsing paths that reach it.
+__attribute__((noinline)) u32 filter_sampling() {
+    u32 zero = 0;
+    flow_id *id = bpf_map_lookup_elem(&evaluated_flow, &zero);
+    if (id == NULL) {
+        return 1;
+    }
+    filter_key key = {.prefix_len = IP_MAX_LEN * 8};
+    __builtin_memcpy(key.ip, id->src_ip, IP_MAX_LEN);
+    filter_rule *match = NULL;
+    filter_rules *rules = bpf_map_lookup_elem(&filter_rules_map, &key);
+    if (rules != NULL) {
+        match = first_matching_rule(rules, id);
+    }
+    __builtin_memcpy(key.ip, id->dst_ip, IP_MAX_LEN);
+    rules = bpf_map_lookup_elem(&filter_rules_map, &key);
+    if (rules != NULL) {
+        filter_rule *dst_match = first_matching_rule(rules, id);
+        if (dst_match != NULL && (match == NULL || dst_match->priority < match->priority)) {
+            match = dst_match;
+        }
+    }
+    if (match == NULL) {
+        return 1;
+    }
+    switch (match->action) {
+    case FILTER_DROP:
+        return 0;
+    case FILTER_SAMPLE:
+        if (match->sampling <= 1) {
+            return 1;
+        }
+        return (bpf_get_prandom_u32() % match->sampling) == 0 ? match->sampling : 0;
+    default:
+        return 1;
+    }
+}
+
+// returns true if the packet of the flow must not be accounted, according to the filter rules
+static __always_inline bool filtered_out(flow_id *id) {
+    return set_evaluated_flow(id) && filter_sampling() == 0;
+}
+
+#endif /* __FILTER_H__ */
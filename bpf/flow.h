@@ -1,10 +1,29 @@
 #ifndef __FLOW_H__
 #define __FLOW_H__
 
+// TC_ACT_UNSPEC lets the next program or filter in the TC/TCX chain to process the packet.
+// It is the default action if there are no more programs in the chain.
+#define TC_ACT_UNSPEC -1
 #define TC_ACT_OK 0
 #define TC_ACT_SHOT 2
 #define IP_MAX_LEN 16
 
+// according to field 61 in https://www.iana.org/assignments/ipfix/ipfix.xhtml
+#define INGRESS 0
+#define EGRESS 1
+
+// Tunnel types that can be decapsulated to parse the encapsulated packets
+#define TUNNEL_NONE 0
+#define TUNNEL_VXLAN 1
+#define TUNNEL_GENEVE 2
+#define TUNNEL_GRE 3
+// NVGRE tunnels are decapsulated when GRE decapsulation is enabled
+#define TUNNEL_NVGRE 4
+// IPv4 in IPv4 or IPv6
+#define TUNNEL_IPIP 5
+// IPv6 in IPv4 or IPv6 (6in4)
+#define TUNNEL_SIT 6
+
 typedef __u8 u8;
 typedef __u16 u16;
 typedef __u32 u32;
@@ -16,10 +35,36 @@ typedef struct flow_metrics_t {
     // Flow start and end times as monotomic timestamps in nanoseconds
     // as output from bpf_ktime_get_ns()
     u64 start_mono_time_ts;
+    // Timestamp of the TCP handshake packet that was seen in this flow: the SYN-ACK for
+    // server-to-client flows, or the ACK that follows the SYN for client-to-server flows.
+    // 0 if the flow didn't observe any of them
     u64 conn_mono_time_ts;
     u64 end_mono_time_ts;
     // TCP Flags from https://www.ietf.org/rfc/rfc793.txt
     u16 flags;
+    // Number of packets of the flow that are IP fragments
+    u32 fragmented_packets;
+    // Number of TCP packets with the SYN, FIN and RST flags. Only counted if the
+    // count_tcp_flags constant is set
+    u32 syn_packets;
+    u32 fin_packets;
+    u32 rst_packets;
+    // Packets and bytes of the flow that have been dropped by the kernel, and the reason
+    // (enum skb_drop_reason) of the last drop. Only tracked if the packet drops program is loaded
+    u32 dropped_packets;
+    u64 dropped_bytes;
+    u32 drop_reason;
+    // ID and flags of the last DNS message of the flow, and its timestamp. Only recorded if
+    // the enable_dns_tracking constant is set. The timestamp is 0 if no DNS message was observed
+    u16 dns_id;
+    u16 dns_flags;
+    u64 dns_mono_time_ts;
+    // Number of TCP retransmissions of the connection of the flow. It is not updated by the
+    // flows programs, but merged by the user space from the TCP retransmissions program
+    u32 retransmits;
+    // Sampling rate that was applied to the last packet of the flow: only 1 out of "sampling"
+    // packets are accounted. 0 or 1 if the packets are not sampled
+    u32 sampling;
     // The positive errno of a failed map insertion that caused a flow
     // to be sent via ringbuffer.
     // 0 otherwise
@@ -37,6 +82,9 @@ typedef struct flow_id_t {
     // L2 data link layer
     u8 src_mac[ETH_ALEN];
     u8 dst_mac[ETH_ALEN];
+    // outer and inner (for 802.1ad QinQ) VLAN IDs. 0 if the frame is not tagged
+    u16 vlan_id;
+    u16 inner_vlan_id;
     // L3 network layer
     // IPv4 addresses are encoded as IPv6 addresses with prefix ::ffff/96
     // as described in https://datatracker.ietf.org/doc/html/rfc4038#section-4.2
@@ -49,13 +97,30 @@ typedef struct flow_id_t {
     // ICMP protocol
     u8  icmp_type;
     u8  icmp_code;
+    // Set if the flow packets are non-first IP fragments whose first fragment has not been seen,
+    // so their transport header is unknown. Then the ports and the ICMP type and code are 0
+    u8 non_first_fragment;
     // OS interface index
     u32 if_index;
+    // Inode number of the network namespace of the interface. 0 for the agent's own namespace
+    u32 if_netns;
+    // Tunnel of the packet, if it has been decapsulated (see TUNNEL_* definitions).
+    // Then the rest of the fields describe the encapsulated packet, and the tunnel endpoints
+    // are the addresses of the outer IP header, with the same encoding as src_ip and dst_ip
+    u8 tunnel_type;
+    u8 tunnel_src_ip[16];
+    u8 tunnel_dst_ip[16];
+    // VXLAN or Geneve Virtual Network Identifier, NVGRE Virtual Subnet ID, or GRE key.
+    // 0 for the tunnels without ID
+    u32 tunnel_id;
 } __attribute__((packed)) flow_id;
 
 // Force emitting struct flow_id into the ELF.
 const struct flow_id_t *unused2 __attribute__((unused));
 
+// prefix of the IPv4 addresses that are encoded as IPv6 addresses in the flow_id
+const u8 ip4in6[] = {0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff};
+
 // Flow record is a tuple containing both flow identifier and metrics. It is used to send
 // a complete flow via ring buffer when only when the accounting hashmap is full.
 // Contents in this struct must match byte-by-byte with Go's pkc/flow/Record struct
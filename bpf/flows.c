@@ -2,7 +2,8 @@
     Flows v2. A Flow-metric generator using TC.
 
     This program can be hooked on to TC ingress/egress hook to monitor packets
-    to/from an interface.
+    to/from an interface. Alternatively, the ingress packets can be monitored from
+    the XDP hook.
 
     Logic:
         1) Store flow information in a per-cpu hash map.
@@ -32,14 +33,14 @@
 #include <bpf_endian.h>
 
 #include "flow.h"
+#include "parse.h"
+#include "maps.h"
+#include "filter.h"
+#include "sampling.h"
 
 #define DISCARD 1
 #define SUBMIT 0
 
-// according to field 61 in https://www.iana.org/assignments/ipfix/ipfix.xhtml
-#define INGRESS 0
-#define EGRESS 1
-
 // Flags according to RFC 9293 & https://www.iana.org/assignments/ipfix/ipfix.xhtml
 #define FIN_FLAG 0x01
 #define SYN_FLAG 0x02
@@ -63,60 +64,176 @@ struct sctphdr {
     __le32 checksum;
 };
 
-// Common Ringbuffer as a conduit for ingress/egress flows to userspace
-struct {
-    __uint(type, BPF_MAP_TYPE_RINGBUF);
-    __uint(max_entries, 1 << 24);
-} direct_flows SEC(".maps");
+// VXLAN header (RFC 7348). The VNI is stored in the 24 most significant bits of vx_vni
+struct vxlanhdr {
+    __be32 vx_flags;
+    __be32 vx_vni;
+};
+// the I flag must be set for a valid VNI
+#define VXLAN_FLAG_VNI 0x08000000
 
-// Key: the flow identifier. Value: the flow metrics for that identifier.
-// The userspace will aggregate them into a single flow.
-struct {
-    __uint(type, BPF_MAP_TYPE_PERCPU_HASH);
-    __type(key, flow_id);
-    __type(value, flow_metrics);
-} aggregated_flows SEC(".maps");
+// Geneve header (RFC 8926), followed by opt_len 4-byte words of variable-length options
+struct genevehdr {
+    // 2-bit version and 6-bit options length
+    u8 ver_opt_len;
+    u8 flags;
+    __be16 proto_type;
+    u8 vni[3];
+    u8 reserved;
+};
+#define GENEVE_OPT_LEN_MASK 0x3f
+
+// GRE header (RFC 2784 and RFC 2890), followed by the optional checksum, key and sequence number
+// fields, as indicated by its flags
+struct gre_hdr {
+    __be16 flags;
+    __be16 protocol;
+};
+#define GRE_FLAG_CSUM 0x8000
+#define GRE_FLAG_KEY 0x2000
+#define GRE_FLAG_SEQ 0x1000
+#define GRE_VERSION_MASK 0x0007
+
+// Fragmentation information of the parsed IP packet
+typedef struct fragment_info_t {
+    // IPv4 or IPv6 fragment identification, in network byte order
+    u32 identification;
+    // fragment offset in 8-octet units, and More Fragments flag. Both are 0 if the packet
+    // is not fragmented
+    u16 offset;
+    u16 more_fragments;
+} fragment_info;
 
 // Constant definitions, to be overridden by the invoker
 volatile const u32 sampling = 0;
 volatile const u8 trace_messages = 0;
+// Inode number of the agent's network namespace, whose flows are reported with a 0 namespace
+volatile const u32 agent_netns_inode = 0;
+// If set, the network namespace of the flows is read from the device of each packet, as the
+// same programs are attached to the interfaces of all the observed namespaces
+volatile const u8 enable_netns = 0;
+// Bitmask of the tunnel types (1 << TUNNEL_*) whose encapsulated packets are parsed
+volatile const u8 decap_tunnels = 0;
+// UDP destination ports of the VXLAN and Geneve tunnels
+volatile const u16 vxlan_port = 4789;
+volatile const u16 geneve_port = 6081;
+// If set, the TCP packets with the SYN, FIN and RST flags are counted for each flow
+volatile const u8 count_tcp_flags = 0;
+// If set, the ID and flags of the DNS messages that are sent from or to the DNS port are recorded
+volatile const u8 enable_dns_tracking = 0;
+volatile const u16 dns_port = 53;
+// If set, the packets are accounted according to the rules of the filter_rules_map
+volatile const u8 enable_flow_filter = 0;
+// If set, the packets are sampled according to the rates of the sampling_rules_map, the
+// interface_sampling and the default_sampling maps, instead of the sampling constant
+volatile const u8 enable_sampling_rules = 0;
+
+// Minimal definitions of the kernel structures that are read to get the network namespace of
+// the packets. The offsets of their fields are relocated from the BTF information of the running
+// kernel (CO-RE).
+struct ns_common {
+    unsigned int inum;
+} __attribute__((preserve_access_index));
 
-const u8 ip4in6[] = {0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff};
+struct net {
+    struct ns_common ns;
+} __attribute__((preserve_access_index));
 
-// sets the TCP header flags for connection information
-// returns true if connection timestamp needs to be stored
-static inline bool set_flags(struct tcphdr *th, int direction, u16 *flags) {
-    //If both ACK and SYN are set, then it is server -> client communication during 3-way handshake. 
-    if (th->ack && th->syn) {
+typedef struct {
+    struct net *net;
+} __attribute__((preserve_access_index)) possible_net_t;
+
+struct net_device {
+    possible_net_t nd_net;
+} __attribute__((preserve_access_index));
+
+// kernel structures behind the contexts of the TC and XDP programs
+struct sk_buff {
+    struct net_device *dev;
+} __attribute__((preserve_access_index));
+
+struct xdp_rxq_info {
+    struct net_device *dev;
+} __attribute__((preserve_access_index));
+
+struct xdp_buff {
+    struct xdp_rxq_info *rxq;
+} __attribute__((preserve_access_index));
+
+// TCP flags field, after the data offset and reserved bits of the header
+#define TCP_FLAGS_OFFSET 13
+
+// sets all the TCP header flags of the packet, plus the custom flags of the ACK combinations
+// that report the connection handshake and termination.
+// returns true if the packet might be part of the 3-way handshake (SYN-ACK or ACK), so the
+// connection timestamp might need to be stored
+static inline bool set_flags(struct tcphdr *th, u16 *flags) {
+    u8 tcp_flags = *((u8 *)th + TCP_FLAGS_OFFSET);
+    *flags |= tcp_flags;
+    if (!(tcp_flags & ACK_FLAG)) {
+        return false;
+    }
+    if (tcp_flags & SYN_FLAG) {
+        // server -> client communication during 3-way handshake
         *flags |= SYN_ACK_FLAG;
         return true;
-    } else if (th->ack && th->fin ) {
-        // If both ACK and FIN are set, then it is graceful termination from server.
+    }
+    if (tcp_flags & FIN_FLAG) {
+        // graceful termination
         *flags |= FIN_ACK_FLAG;
-    } else if (th->ack && th->rst ) {
-        // If both ACK and RST are set, then it is abrupt connection termination. 
+    }
+    if (tcp_flags & RST_FLAG) {
+        // abrupt connection termination
         *flags |= RST_ACK_FLAG;
-    } else if (th->fin) {
-        *flags |= FIN_FLAG;
-    } else if (th->syn) {
-        *flags |= SYN_FLAG;
-    } else if (th->ack) {
-        *flags |= ACK_FLAG;
-        if (direction == INGRESS && th->seq == 1) {
-            return true;
-        }
-    } else if (th->rst) {
-        *flags |= RST_FLAG;
-    } else if (th->psh) {
-        *flags |= PSH_FLAG;
-    } else if (th->urg) {
-        *flags |= URG_FLAG;
-    } else if (th->ece) {
-        *flags |= ECE_FLAG;
-    } else if (th->cwr) {
-        *flags |= CWR_FLAG;
-    }
-    return false;
+    }
+    // It might be the ACK that completes the 3-way handshake. The SYN of the flow might have been
+    // handled by another CPU, so the user space checks it after aggregating the per-CPU metrics.
+    return !(tcp_flags & (FIN_FLAG | RST_FLAG));
+}
+
+// DNS message header (RFC 1035). It is defined here because it is not exported by the kernel
+// headers.
+struct dns_header {
+    __be16 id;
+    __be16 flags;
+    __be16 qdcount;
+    __be16 ancount;
+    __be16 nscount;
+    __be16 arcount;
+};
+
+// DNS messages over TCP are prefixed by a two-byte length field
+#define DNS_TCP_LENGTH_LEN 2
+
+// maximum length of the transport header plus the DNS over TCP length field
+#define DNS_MAX_OFFSET 0x3f
+
+// ID and flags of the DNS message carried by the packet, if found is set
+typedef struct dns_info_t {
+    u16 id;
+    u16 flags;
+    bool found;
+} dns_info;
+
+// reads the ID and flags of the DNS message that follows the transport header, if the source or
+// destination port is the DNS port and the DNS header is in the packet data
+static __always_inline void fill_dns(void *l4_hdr_start, u32 dns_offset, void *data_end,
+                                     u16 src_port, u16 dst_port, dns_info *dns) {
+    if (src_port != dns_port && dst_port != dns_port) {
+        return;
+    }
+    // the DNS header bounds are checked from an offset that is opaque to the verifier, so they do
+    // not extend the bounds of the transport header pointer. Otherwise, the paths with and
+    // without DNS messages could not be pruned as equivalent
+    asm volatile("" : "+r"(dns_offset));
+    dns_offset &= DNS_MAX_OFFSET;
+    struct dns_header *hdr = l4_hdr_start + dns_offset;
+    if ((void *)hdr + sizeof(*hdr) > data_end) {
+        return;
+    }
+    dns->id = __bpf_ntohs(hdr->id);
+    dns->flags = __bpf_ntohs(hdr->flags);
+    dns->found = true;
 }
 
 // L4_info structure contains L4 headers parsed information.
@@ -133,18 +250,24 @@ struct l4_info_t {
     u16 flags;
 	// Connection timestamp capture
 	bool conn_tstamp; 
+    // DNS message, if DNS tracking is enabled
+    dns_info dns;
 };
 
 // Extract L4 info for the supported protocols
-static inline void fill_l4info(void *l4_hdr_start, void *data_end, u8 direction, u8 protocol,
-                               struct l4_info_t *l4_info) {
+static __always_inline void fill_l4info(void *l4_hdr_start, void *data_end, u8 direction, u8 protocol,
+                                        struct l4_info_t *l4_info) {
 	switch (protocol) {
     case IPPROTO_TCP: {
         struct tcphdr *tcp = l4_hdr_start;
         if ((void *)tcp + sizeof(*tcp) <= data_end) {
             l4_info->src_port = __bpf_ntohs(tcp->source);
             l4_info->dst_port = __bpf_ntohs(tcp->dest);
-            l4_info->conn_tstamp = set_flags(tcp, direction, &l4_info->flags);
+            l4_info->conn_tstamp = set_flags(tcp, &l4_info->flags);
+            if (enable_dns_tracking) {
+                fill_dns(tcp, tcp->doff * 4 + DNS_TCP_LENGTH_LEN, data_end,
+                         l4_info->src_port, l4_info->dst_port, &l4_info->dns);
+            }
         }
     } break;
     case IPPROTO_UDP: {
@@ -152,6 +275,10 @@ static inline void fill_l4info(void *l4_hdr_start, void *data_end, u8 direction,
         if ((void *)udp + sizeof(*udp) <= data_end) {
             l4_info->src_port = __bpf_ntohs(udp->source);
             l4_info->dst_port = __bpf_ntohs(udp->dest);
+            if (enable_dns_tracking) {
+                fill_dns(udp, sizeof(*udp), data_end, l4_info->src_port,
+                         l4_info->dst_port, &l4_info->dns);
+            }
         }
     } break;
     case IPPROTO_SCTP: {
@@ -180,12 +307,50 @@ static inline void fill_l4info(void *l4_hdr_start, void *data_end, u8 direction,
     }
 }
 
-// sets flow fields from IPv4 header information
-static inline int fill_iphdr(struct iphdr *ip, void *data_end, u8 direction, flow_id *id, u16 *flags, bool *conn_tstamp) {
+// stores the transport information of the first fragment of an IP packet, so it can be assigned
+// to the rest of its fragments
+static __always_inline void store_fragment_l4info(flow_id *id, u32 identification) {
+    fragment_key key;
+    set_fragment_key(&key, id, identification);
+    fragment_l4 l4 = {
+        .src_port = id->src_port,
+        .dst_port = id->dst_port,
+        .icmp_type = id->icmp_type,
+        .icmp_code = id->icmp_code,
+    };
+    long ret = bpf_map_update_elem(&fragments, &key, &l4, BPF_ANY);
+    if (trace_messages && ret != 0) {
+        bpf_printk("error storing fragment %d\n", ret);
+    }
+}
+
+// attributes the IP fragments to the flow of their packet. It is invoked once the packet has
+// been parsed, instead of from the IP header parsers, so the verifier does not need to check
+// the map operations for each parsing path
+static __always_inline void fill_fragment(flow_id *id, fragment_info *frag) {
+    if (frag->offset != 0) {
+        load_fragment_l4info(id, frag->identification);
+    } else if (frag->more_fragments != 0) {
+        store_fragment_l4info(id, frag->identification);
+    }
+}
+
+// sets flow fields from IPv4 header information, as well as its fragmentation information and
+// the start of the transport header, if it is available
+static __always_inline int fill_iphdr(struct iphdr *ip, void *data_end, u8 direction, flow_id *id,
+                                      u16 *flags, bool *conn_tstamp, dns_info *dns,
+                                      fragment_info *frag, void **l4_hdr) {
     struct l4_info_t l4_info;
     void *l4_hdr_start;
 
-    l4_hdr_start = (void *)ip + sizeof(*ip);
+    if ((void *)ip + sizeof(*ip) > data_end) {
+        return DISCARD;
+    }
+    // the header length is in 4-octet units, and it includes the IP options
+    if (ip->ihl < 5) {
+        return DISCARD;
+    }
+    l4_hdr_start = (void *)ip + ip->ihl * 4;
     if (l4_hdr_start > data_end) {
         return DISCARD;
     }
@@ -195,19 +360,78 @@ static inline int fill_iphdr(struct iphdr *ip, void *data_end, u8 direction, flo
     __builtin_memcpy(id->src_ip + sizeof(ip4in6), &ip->saddr, sizeof(ip->saddr));
     __builtin_memcpy(id->dst_ip + sizeof(ip4in6), &ip->daddr, sizeof(ip->daddr));
     id->transport_protocol = ip->protocol;
-    fill_l4info(l4_hdr_start, data_end, direction, ip->protocol, &l4_info);
+    u16 frag_off = __bpf_ntohs(ip->frag_off);
+    frag->identification = ip->id;
+    frag->offset = frag_off & IP_FRAG_OFFSET_MASK;
+    frag->more_fragments = frag_off & IP_FRAG_MF;
+    // the non-first fragments do not carry the transport header
+    if (frag->offset == 0) {
+        *l4_hdr = l4_hdr_start;
+        fill_l4info(l4_hdr_start, data_end, direction, ip->protocol, &l4_info);
+    }
     id->src_port = l4_info.src_port;
     id->dst_port = l4_info.dst_port;
     id->icmp_type = l4_info.icmp_type;
     id->icmp_code = l4_info.icmp_code;
     *flags = l4_info.flags;
 	*conn_tstamp = l4_info.conn_tstamp;
+    *dns = l4_info.dns;
+
+    return SUBMIT;
+}
 
+// walks the hop-by-hop, routing, fragment and destination options headers that follow the IPv6
+// fixed header, up to MAX_IPV6_EXT_HEADERS. It sets the protocol of the first header that is not
+// walked, the length of the walked headers and a copy of the fragment header, if found. If the
+// packet is a non-first fragment, the walk stops at the fragment header, since the rest of the
+// headers are in the first fragment.
+static __always_inline int walk_ip6_ext_headers(void *ext_hdr_start, void *data_end, u8 *nexthdr,
+                                                struct ipv6_frag_hdr *frag, u32 *ext_len) {
+    u32 len = 0;
+    #pragma unroll
+    for (int i = 0; i < MAX_IPV6_EXT_HEADERS; i++) {
+        u8 protocol = *nexthdr;
+        if (protocol != IPPROTO_HOPOPTS && protocol != IPPROTO_ROUTING
+            && protocol != IPPROTO_DSTOPTS && protocol != IPPROTO_FRAGMENT) {
+            break;
+        }
+        // all the extension headers are at least 8 bytes long
+        struct ipv6_opt_hdr *opt = ext_hdr_start + len;
+        if ((void *)opt + 8 > data_end) {
+            return DISCARD;
+        }
+        *nexthdr = opt->nexthdr;
+        if (protocol == IPPROTO_FRAGMENT) {
+            __builtin_memcpy(frag, opt, sizeof(*frag));
+            len += sizeof(*frag);
+            if (frag->frag_off & __bpf_htons(IPV6_FRAG_OFFSET_MASK)) {
+                break;
+            }
+        } else {
+            // length in 8-octet units, not including the first 8 octets
+            len += (opt->hdrlen + 1) * 8;
+        }
+        if (len > MAX_IPV6_EXT_HEADERS_LEN) {
+            return DISCARD;
+        }
+        // the lengths are multiple of 8, so the mask does not modify them. It sets the same
+        // bounds for all the walked paths, so the verifier can prune them as equivalent.
+        // The empty asm statement prevents the compiler from optimizing out the mask
+        asm volatile("" : "+r"(len));
+        len &= MAX_IPV6_EXT_HEADERS_LEN;
+    }
+    *ext_len = len;
     return SUBMIT;
 }
 
-// sets flow fields from IPv6 header information
-static inline int fill_ip6hdr(struct ipv6hdr *ip, void *data_end, u8 direction, flow_id *id, u16 *flags, bool *conn_tstamp) {
+// sets flow fields from IPv6 header information, as well as the start of the transport header
+// if it is available, and the fragmentation information from the fragment header. The extension
+// headers are only walked if walk_ext_headers is set, to keep the program within the verifier
+// complexity limits
+static __always_inline int fill_ip6hdr(struct ipv6hdr *ip, void *data_end, u8 direction, flow_id *id,
+                                       u16 *flags, bool *conn_tstamp, dns_info *dns,
+                                       fragment_info *frag, void **l4_hdr,
+                                       bool walk_ext_headers) {
     struct l4_info_t l4_info;
     void *l4_hdr_start;
 
@@ -215,35 +439,54 @@ static inline int fill_ip6hdr(struct ipv6hdr *ip, void *data_end, u8 direction,
     if (l4_hdr_start > data_end) {
         return DISCARD;
     }
+    u8 nexthdr = ip->nexthdr;
+    // the fragment offset and flags are 0 if the packet has no fragment header
+    struct ipv6_frag_hdr frag_hdr;
+    __builtin_memset(&frag_hdr, 0, sizeof(frag_hdr));
+    u32 ext_len = 0;
+    if (walk_ext_headers
+        && walk_ip6_ext_headers(l4_hdr_start, data_end, &nexthdr, &frag_hdr,
+                                &ext_len) == DISCARD) {
+        return DISCARD;
+    }
+    asm volatile("" : "+r"(ext_len));
+    l4_hdr_start += ext_len & MAX_IPV6_EXT_HEADERS_LEN;
     __builtin_memset(&l4_info, 0, sizeof(l4_info));
     __builtin_memcpy(id->src_ip, ip->saddr.in6_u.u6_addr8, 16);
     __builtin_memcpy(id->dst_ip, ip->daddr.in6_u.u6_addr8, 16);
-    id->transport_protocol = ip->nexthdr;
-    fill_l4info(l4_hdr_start, data_end, direction, ip->nexthdr, &l4_info);
+    id->transport_protocol = nexthdr;
+    u16 frag_off = __bpf_ntohs(frag_hdr.frag_off);
+    frag->identification = frag_hdr.identification;
+    frag->offset = (frag_off & IPV6_FRAG_OFFSET_MASK) >> 3;
+    frag->more_fragments = frag_off & IPV6_FRAG_MF;
+    // the non-first fragments do not carry the transport header
+    if (frag->offset == 0) {
+        *l4_hdr = l4_hdr_start;
+        fill_l4info(l4_hdr_start, data_end, direction, nexthdr, &l4_info);
+    }
     id->src_port = l4_info.src_port;
     id->dst_port = l4_info.dst_port;
     id->icmp_type = l4_info.icmp_type;
     id->icmp_code = l4_info.icmp_code;
     *flags = l4_info.flags;
 	*conn_tstamp = l4_info.conn_tstamp;
+    *dns = l4_info.dns;
 
     return SUBMIT;
 }
-// sets flow fields from Ethernet header information
-static inline int fill_ethhdr(struct ethhdr *eth, void *data_end, u8 direction, flow_id *id, u16 *flags, bool *conn_tstamp) {
-    if ((void *)eth + sizeof(*eth) > data_end) {
-        return DISCARD;
-    }
-    __builtin_memcpy(id->dst_mac, eth->h_dest, ETH_ALEN);
-    __builtin_memcpy(id->src_mac, eth->h_source, ETH_ALEN);
-    id->eth_protocol = __bpf_ntohs(eth->h_proto);
-
+// sets flow fields from the network layer header whose protocol is id->eth_protocol. The start
+// of the transport header is set if the network protocol is supported.
+static __always_inline int fill_l3hdr(void *l3_hdr_start, void *data_end, u8 direction, flow_id *id,
+                                      u16 *flags, bool *conn_tstamp, dns_info *dns,
+                                      fragment_info *frag, void **l4_hdr,
+                                      bool walk_ext_headers) {
     if (id->eth_protocol == ETH_P_IP) {
-        struct iphdr *ip = (void *)eth + sizeof(*eth);
-        return fill_iphdr(ip, data_end, direction, id, flags, conn_tstamp);
+        struct iphdr *ip = l3_hdr_start;
+        return fill_iphdr(ip, data_end, direction, id, flags, conn_tstamp, dns, frag, l4_hdr);
     } else if (id->eth_protocol == ETH_P_IPV6) {
-        struct ipv6hdr *ip6 = (void *)eth + sizeof(*eth);
-        return fill_ip6hdr(ip6, data_end, direction, id, flags, conn_tstamp);
+        struct ipv6hdr *ip6 = l3_hdr_start;
+        return fill_ip6hdr(ip6, data_end, direction, id, flags, conn_tstamp, dns, frag,
+                           l4_hdr, walk_ext_headers);
     } else {
         // TODO : Need to implement other specific ethertypes if needed
         // For now other parts of flow id remain zero
@@ -256,43 +499,345 @@ static inline int fill_ethhdr(struct ethhdr *eth, void *data_end, u8 direction,
     return SUBMIT;
 }
 
-static inline int flow_monitor(struct __sk_buff *skb, u8 direction) {
+// sets flow fields from Ethernet header information. The outer VLAN tag might have been
+// removed from the packet data (e.g. by the NIC), so it is provided by the invoker if present.
+// Up to MAX_VLAN_TAGS VLAN headers are walked to reach the network layer header.
+static __always_inline int fill_ethhdr(struct ethhdr *eth, void *data_end, bool vlan_present,
+                                       u16 vlan_tci, u8 direction, flow_id *id, u16 *flags,
+                                       bool *conn_tstamp, dns_info *dns, fragment_info *frag,
+                                       void **l4_hdr, bool walk_ext_headers) {
+    if ((void *)eth + sizeof(*eth) > data_end) {
+        return DISCARD;
+    }
+    __builtin_memcpy(id->dst_mac, eth->h_dest, ETH_ALEN);
+    __builtin_memcpy(id->src_mac, eth->h_source, ETH_ALEN);
+    id->eth_protocol = __bpf_ntohs(eth->h_proto);
+    void *l3_hdr_start = (void *)eth + sizeof(*eth);
+
+    u8 tags = 0;
+    if (vlan_present) {
+        set_vlan_id(id, vlan_tci, &tags);
+    }
+    #pragma unroll
+    for (int i = 0; i < MAX_VLAN_TAGS; i++) {
+        if (id->eth_protocol != ETH_P_8021Q && id->eth_protocol != ETH_P_8021AD) {
+            break;
+        }
+        struct vlan_hdr *vlan = l3_hdr_start;
+        if ((void *)vlan + sizeof(*vlan) > data_end) {
+            return DISCARD;
+        }
+        set_vlan_id(id, __bpf_ntohs(vlan->h_vlan_TCI), &tags);
+        id->eth_protocol = __bpf_ntohs(vlan->h_vlan_encapsulated_proto);
+        l3_hdr_start += sizeof(*vlan);
+    }
+
+    return fill_l3hdr(l3_hdr_start, data_end, direction, id, flags, conn_tstamp, dns, frag,
+                      l4_hdr, walk_ext_headers);
+}
+
+// If the packet belongs to a tunnel whose type is enabled for decapsulation, records
+// the tunnel type, ID and endpoints (the outer IP addresses), and replaces the rest of the flow
+// fields with the information of the encapsulated packet. The L2 fields are only replaced if
+// the tunnel encapsulates Ethernet frames. Packets with an unknown encapsulated protocol are
+// accounted as outer flows, while packets with truncated inner headers are discarded.
+// The IPv6 extension headers of the encapsulated packets are not walked.
+static inline int fill_tunnel(void *l4_hdr, void *data_end, u8 direction, flow_id *id, u16 *flags,
+                              bool *conn_tstamp, dns_info *dns, fragment_info *frag) {
+    void *inner_hdr_start = l4_hdr;
+    u16 inner_protocol;
+    u8 tunnel_type;
+    u32 tunnel_id = 0;
+    switch (id->transport_protocol) {
+    case IPPROTO_UDP:
+        if ((decap_tunnels & (1 << TUNNEL_VXLAN)) && id->dst_port == vxlan_port) {
+            struct vxlanhdr *vxlan = l4_hdr + sizeof(struct udphdr);
+            if ((void *)vxlan + sizeof(*vxlan) > data_end
+                || !(vxlan->vx_flags & __bpf_htonl(VXLAN_FLAG_VNI))) {
+                return SUBMIT;
+            }
+            tunnel_type = TUNNEL_VXLAN;
+            tunnel_id = __bpf_ntohl(vxlan->vx_vni) >> 8;
+            inner_protocol = ETH_P_TEB;
+            inner_hdr_start = (void *)vxlan + sizeof(*vxlan);
+        } else if ((decap_tunnels & (1 << TUNNEL_GENEVE)) && id->dst_port == geneve_port) {
+            struct genevehdr *geneve = l4_hdr + sizeof(struct udphdr);
+            // only version 0 is defined
+            if ((void *)geneve + sizeof(*geneve) > data_end || (geneve->ver_opt_len >> 6) != 0) {
+                return SUBMIT;
+            }
+            tunnel_type = TUNNEL_GENEVE;
+            tunnel_id = (geneve->vni[0] << 16) | (geneve->vni[1] << 8) | geneve->vni[2];
+            inner_protocol = __bpf_ntohs(geneve->proto_type);
+            inner_hdr_start = (void *)geneve + sizeof(*geneve)
+                + (geneve->ver_opt_len & GENEVE_OPT_LEN_MASK) * 4;
+        } else {
+            return SUBMIT;
+        }
+        break;
+    case IPPROTO_GRE: {
+        struct gre_hdr *gre = l4_hdr;
+        if (!(decap_tunnels & (1 << TUNNEL_GRE)) || (void *)gre + sizeof(*gre) > data_end) {
+            return SUBMIT;
+        }
+        u16 gre_flags = __bpf_ntohs(gre->flags);
+        // version 1 (enhanced GRE for PPTP) does not encapsulate network packets
+        if ((gre_flags & GRE_VERSION_MASK) != 0) {
+            return SUBMIT;
+        }
+        tunnel_type = TUNNEL_GRE;
+        inner_protocol = __bpf_ntohs(gre->protocol);
+        inner_hdr_start = (void *)gre + sizeof(*gre);
+        if (gre_flags & GRE_FLAG_CSUM) {
+            // checksum and reserved fields
+            inner_hdr_start += 4;
+        }
+        if (gre_flags & GRE_FLAG_KEY) {
+            __be32 *key = inner_hdr_start;
+            if ((void *)key + sizeof(*key) > data_end) {
+                return SUBMIT;
+            }
+            tunnel_id = __bpf_ntohl(*key);
+            inner_hdr_start += sizeof(*key);
+            if (inner_protocol == ETH_P_TEB) {
+                // NVGRE: the key holds the 24-bit Virtual Subnet ID and an 8-bit FlowID
+                tunnel_type = TUNNEL_NVGRE;
+                tunnel_id >>= 8;
+            }
+        }
+        if (gre_flags & GRE_FLAG_SEQ) {
+            inner_hdr_start += 4;
+        }
+    } break;
+    case IPPROTO_IPIP:
+        if (!(decap_tunnels & (1 << TUNNEL_IPIP))) {
+            return SUBMIT;
+        }
+        tunnel_type = TUNNEL_IPIP;
+        inner_protocol = ETH_P_IP;
+        break;
+    case IPPROTO_IPV6:
+        if (!(decap_tunnels & (1 << TUNNEL_SIT))) {
+            return SUBMIT;
+        }
+        tunnel_type = TUNNEL_SIT;
+        inner_protocol = ETH_P_IPV6;
+        break;
+    default:
+        return SUBMIT;
+    }
+    if (inner_protocol != ETH_P_TEB && inner_protocol != ETH_P_IP && inner_protocol != ETH_P_IPV6) {
+        return SUBMIT;
+    }
+
+    id->tunnel_type = tunnel_type;
+    id->tunnel_id = tunnel_id;
+    __builtin_memcpy(id->tunnel_src_ip, id->src_ip, sizeof(id->src_ip));
+    __builtin_memcpy(id->tunnel_dst_ip, id->dst_ip, sizeof(id->dst_ip));
+    void *inner_l4_hdr = NULL;
+    if (inner_protocol == ETH_P_TEB) {
+        id->vlan_id = 0;
+        id->inner_vlan_id = 0;
+        return fill_ethhdr(inner_hdr_start, data_end, false, 0, direction, id, flags, conn_tstamp,
+                           dns, frag, &inner_l4_hdr, false);
+    }
+    id->eth_protocol = inner_protocol;
+    return fill_l3hdr(inner_hdr_start, data_end, direction, id, flags, conn_tstamp, dns, frag,
+                      &inner_l4_hdr, false);
+}
+
+// packet information that the TC and XDP programs get from their respective contexts
+typedef struct pkt_info_t {
+    void *data;
+    void *data_end;
+    u64 len;
+    u32 if_index;
+    // VLAN tag that is not in the packet data (e.g. removed by the NIC), if present
+    bool vlan_present;
+    u16 vlan_tci;
+} pkt_info;
+
+// Sampling rate of the packet that is being evaluated by each CPU, as returned by evaluate_flow
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, u32);
+    __type(value, u32);
+} evaluated_rate SEC(".maps");
+
+// returns the sampling rate of the packet of the evaluated_flow, according to the filter and the
+// sampling rules, or 0 if the packet must not be accounted. Both evaluations are grouped in a
+// global function, so each packet parsing path only adds a single call to the verified programs
+__attribute__((noinline)) u32 evaluate_flow() {
+    // the rate of the filter rules is applied on top of the sampling rate
+    u32 rate = enable_flow_filter ? filter_sampling() : 1;
+    if (rate != 0 && enable_sampling_rules) {
+        rate *= sampled_rate();
+    } else if (rate != 0 && sampling > 1) {
+        rate *= sampling;
+    }
+    u32 zero = 0;
+    bpf_map_update_elem(&evaluated_rate, &zero, &rate, BPF_ANY);
+    return rate;
+}
+
+// returns the sampling rate that has been applied to the packet. It is read from the
+// evaluated_rate map instead of being kept by the caller, so the verifier can still prune the
+// states of the different packet parsing paths, whose rates would differ
+__attribute__((noinline)) u32 applied_rate() {
+    if (!enable_flow_filter && !enable_sampling_rules) {
+        return sampling;
+    }
+    u32 zero = 0;
+    u32 *rate = bpf_map_lookup_elem(&evaluated_rate, &zero);
+    return rate != NULL ? *rate : sampling;
+}
+
+// Inode number of the network namespace of the packet that is being parsed by each CPU, as read
+// from its device by the TC and XDP programs. 0 for the agent's namespace
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, u32);
+    __type(value, u32);
+} packet_netns SEC(".maps");
+
+// stores the network namespace of the device of the packet in the packet_netns map
+static __always_inline void store_packet_netns(struct net_device *dev) {
+    struct net *net = NULL;
+    u32 inode = 0;
+    if (dev != NULL && bpf_probe_read_kernel(&net, sizeof(net), &dev->nd_net.net) == 0
+        && bpf_probe_read_kernel(&inode, sizeof(inode), &net->ns.inum) == 0
+        && inode == agent_netns_inode) {
+        inode = 0;
+    }
+    u32 zero = 0;
+    bpf_map_update_elem(&packet_netns, &zero, &inode, BPF_ANY);
+}
+
+// stores the network namespace of the packet of the TC programs. The namespace is read in a
+// global function, so it does not change how the packet parsing paths are verified
+__attribute__((noinline)) int store_tc_packet_netns(struct __sk_buff *skb) {
+    // the context of the TC programs is the socket buffer of the kernel
+    struct net_device *dev = NULL;
+    bpf_probe_read_kernel(&dev, sizeof(dev), &((struct sk_buff *)skb)->dev);
+    store_packet_netns(dev);
+    return 0;
+}
+
+// stores the network namespace of the packet of the XDP program
+__attribute__((noinline)) int store_xdp_packet_netns(struct xdp_md *ctx) {
+    // the context of the XDP programs is the xdp_buff of the kernel
+    struct xdp_rxq_info *rxq = NULL;
+    struct net_device *dev = NULL;
+    if (bpf_probe_read_kernel(&rxq, sizeof(rxq), &((struct xdp_buff *)ctx)->rxq) == 0
+        && rxq != NULL) {
+        bpf_probe_read_kernel(&dev, sizeof(dev), &rxq->dev);
+    }
+    store_packet_netns(dev);
+    return 0;
+}
+
+// returns the network namespace of the packet. It is read from the packet_netns map instead of
+// being kept by the caller, so the verifier can still prune the states of the packet parsing paths
+__attribute__((noinline)) u32 parsed_packet_netns() {
+    if (!enable_netns) {
+        return 0;
+    }
+    u32 zero = 0;
+    u32 *netns = bpf_map_lookup_elem(&packet_netns, &zero);
+    return netns != NULL ? *netns : 0;
+}
+
+// parses the packet and updates its flow metrics. It is shared by the TC and XDP programs.
+// It is inlined into each program, as the verifier can't prune as many states of the packet
+// parsing paths if it is a separate function.
+static __always_inline void flow_monitor(pkt_info *pkt, u8 direction) {
     // If sampling is defined, will only parse 1 out of "sampling" flows
     if (sampling != 0 && (bpf_get_prandom_u32() % sampling) != 0) {
-        return TC_ACT_OK;
+        return;
     }
-    void *data_end = (void *)(long)skb->data_end;
-    void *data = (void *)(long)skb->data;
 
     flow_id id;
 	bool conn_tstamp = false;
     __builtin_memset(&id, 0, sizeof(id));
     u64 current_time = bpf_ktime_get_ns();
-    struct ethhdr *eth = data;
+    struct ethhdr *eth = pkt->data;
     u16 flags = 0;
-    if (fill_ethhdr(eth, data_end, direction, &id, &flags, &conn_tstamp) == DISCARD) {
-        return TC_ACT_OK;
+    // fragmentation of the IP packet whose headers identify the flow: the encapsulated packet,
+    // if it has been decapsulated
+    fragment_info frag;
+    __builtin_memset(&frag, 0, sizeof(frag));
+    dns_info dns;
+    __builtin_memset(&dns, 0, sizeof(dns));
+    void *l4_hdr = NULL;
+    if (fill_ethhdr(eth, pkt->data_end, pkt->vlan_present, pkt->vlan_tci, direction, &id, &flags,
+                    &conn_tstamp, &dns, &frag, &l4_hdr, true) == DISCARD) {
+        return;
+    }
+    if (decap_tunnels != 0 && l4_hdr != NULL
+        && fill_tunnel(l4_hdr, pkt->data_end, direction, &id, &flags, &conn_tstamp,
+                       &dns, &frag) == DISCARD) {
+        return;
+    }
+    fill_fragment(&id, &frag);
+    u32 fragmented = frag.offset != 0 || frag.more_fragments != 0;
+    u32 syn_packets = 0, fin_packets = 0, rst_packets = 0;
+    if (count_tcp_flags) {
+        syn_packets = (flags & SYN_FLAG) >> 1;
+        fin_packets = flags & FIN_FLAG;
+        rst_packets = (flags & RST_FLAG) >> 2;
     }
-    id.if_index = skb->ifindex;
+    u64 dns_ts = dns.found ? current_time : 0;
+    id.if_index = pkt->if_index;
+    id.if_netns = parsed_packet_netns();
     id.direction = direction;
+    if ((enable_flow_filter || enable_sampling_rules) && set_evaluated_flow(&id)
+        && evaluate_flow() == 0) {
+        return;
+    }
+
+    u32 active_key = 0;
+    void *aggregated_flows = bpf_map_lookup_elem(&active_flows, &active_key);
+    if (aggregated_flows == NULL) {
+        if (trace_messages) {
+            bpf_printk("no active flows map. Dropping flow");
+        }
+        return;
+    }
 
     // TODO: we need to add spinlock here when we deprecate versions prior to 5.1, or provide
     // a spinlocked alternative version and use it selectively https://lwn.net/Articles/779120/
-    flow_metrics *aggregate_flow = bpf_map_lookup_elem(&aggregated_flows, &id);
+    flow_metrics *aggregate_flow = bpf_map_lookup_elem(aggregated_flows, &id);
     if (aggregate_flow != NULL) {
         aggregate_flow->packets += 1;
-        aggregate_flow->bytes += skb->len;
+        aggregate_flow->bytes += pkt->len;
         aggregate_flow->end_mono_time_ts = current_time;
         // it might happen that start_mono_time hasn't been set due to
         // the way percpu hashmap deal with concurrent map entries
         if (aggregate_flow->start_mono_time_ts == 0) {
             aggregate_flow->start_mono_time_ts = current_time;
         }
-        if (conn_tstamp) {
+        // the first SYN-ACK or ACK of each CPU might be part of the handshake. The flow flags
+        // are not checked, as the SYN might have been handled by another CPU: the userspace
+        // takes the earliest timestamp of all the CPUs, and uses it to calculate the connection
+        // RTT if the flow contains the SYN
+        if (conn_tstamp && aggregate_flow->conn_mono_time_ts == 0) {
             aggregate_flow->conn_mono_time_ts = current_time;
         }
         aggregate_flow->flags |= flags;
-        long ret = bpf_map_update_elem(&aggregated_flows, &id, aggregate_flow, BPF_ANY);
+        aggregate_flow->fragmented_packets += fragmented;
+        aggregate_flow->syn_packets += syn_packets;
+        aggregate_flow->fin_packets += fin_packets;
+        aggregate_flow->rst_packets += rst_packets;
+        aggregate_flow->sampling = applied_rate();
+        // only the last DNS message of the flow is reported
+        if (dns_ts != 0) {
+            aggregate_flow->dns_id = dns.id;
+            aggregate_flow->dns_flags = dns.flags;
+            aggregate_flow->dns_mono_time_ts = dns_ts;
+        }
+        long ret = bpf_map_update_elem(aggregated_flows, &id, aggregate_flow, BPF_ANY);
         if (trace_messages && ret != 0) {
             // usually error -16 (-EBUSY) is printed here.
             // In this case, the flow is dropped, as submitting it to the ringbuffer would cause
@@ -305,10 +850,18 @@ static inline int flow_monitor(struct __sk_buff *skb, u8 direction) {
         // Key does not exist in the map, and will need to create a new entry.
         flow_metrics new_flow = {
             .packets = 1,
-            .bytes = skb->len,
+            .bytes = pkt->len,
             .start_mono_time_ts = current_time,
             .end_mono_time_ts = current_time,
             .flags = flags, 
+            .fragmented_packets = fragmented,
+            .syn_packets = syn_packets,
+            .fin_packets = fin_packets,
+            .rst_packets = rst_packets,
+            .dns_id = dns.id,
+            .dns_flags = dns.flags,
+            .dns_mono_time_ts = dns_ts,
+            .sampling = applied_rate(),
         };
         if (conn_tstamp) {
             new_flow.conn_mono_time_ts = current_time;
@@ -316,7 +869,7 @@ static inline int flow_monitor(struct __sk_buff *skb, u8 direction) {
 
         // even if we know that the entry is new, another CPU might be concurrently inserting a flow
         // so we need to specify BPF_ANY
-        long ret = bpf_map_update_elem(&aggregated_flows, &id, &new_flow, BPF_ANY);
+        long ret = bpf_map_update_elem(aggregated_flows, &id, &new_flow, BPF_ANY);
         if (ret != 0) {
             // usually error -16 (-EBUSY) or -7 (E2BIG) is printed here.
             // In this case, we send the single-packet flow via ringbuffer as in the worst case we can have
@@ -333,22 +886,58 @@ static inline int flow_monitor(struct __sk_buff *skb, u8 direction) {
                 if (trace_messages) {
                     bpf_printk("couldn't reserve space in the ringbuf. Dropping flow");
                 }
-                return TC_ACT_OK;
+                return;
             }
             record->id = id;
             record->metrics = new_flow;
             bpf_ringbuf_submit(record, 0);
         }
     }
-    return TC_ACT_OK;
 }
+static inline pkt_info tc_pkt_info(struct __sk_buff *skb) {
+    if (enable_netns) {
+        store_tc_packet_netns(skb);
+    }
+    pkt_info pkt = {
+        .data = (void *)(long)skb->data,
+        .data_end = (void *)(long)skb->data_end,
+        .len = skb->len,
+        .if_index = skb->ifindex,
+        .vlan_present = skb->vlan_present,
+        .vlan_tci = skb->vlan_tci,
+    };
+    return pkt;
+}
+
 SEC("tc_ingress")
 int ingress_flow_parse(struct __sk_buff *skb) {
-    return flow_monitor(skb, INGRESS);
+    pkt_info pkt = tc_pkt_info(skb);
+    flow_monitor(&pkt, INGRESS);
+    return TC_ACT_UNSPEC;
 }
 
 SEC("tc_egress")
 int egress_flow_parse(struct __sk_buff *skb) {
-    return flow_monitor(skb, EGRESS);
+    pkt_info pkt = tc_pkt_info(skb);
+    flow_monitor(&pkt, EGRESS);
+    return TC_ACT_UNSPEC;
+}
+
+// XDP alternative to the TC ingress hook, for high-rate interfaces where the packets can be
+// observed before the kernel allocates the socket buffers for them. The VLAN tags that have been
+// removed by the NIC are not available, so only the VLAN headers of the packet data are parsed
+SEC("xdp")
+int xdp_ingress_flow_parse(struct xdp_md *ctx) {
+    if (enable_netns) {
+        store_xdp_packet_netns(ctx);
+    }
+    pkt_info pkt = {
+        .data = (void *)(long)ctx->data,
+        .data_end = (void *)(long)ctx->data_end,
+        .if_index = ctx->ingress_ifindex,
+    };
+    pkt.len = pkt.data_end - pkt.data;
+    flow_monitor(&pkt, INGRESS);
+    return XDP_PASS;
 }
 char _license[] SEC("license") = "GPL";
@@ -0,0 +1,106 @@
+#ifndef __MAPS_H__
+#define __MAPS_H__
+
+#include "flow.h"
+
+// Maps that are shared by the flows and the packet drops programs. The user space creates them
+// once, and reuses them when it loads the programs of each object.
+
+// Common Ringbuffer as a conduit for ingress/egress flows to userspace
+struct {
+    __uint(type, BPF_MAP_TYPE_RINGBUF);
+    __uint(max_entries, 1 << 24);
+} direct_flows SEC(".maps");
+
+// Key: the flow identifier. Value: the flow metrics for that identifier.
+// The userspace will aggregate them into a single flow.
+// There are two aggregation maps (ping-pong buffers): while the kernel updates the active one,
+// the userspace drains the inactive one without contending with the datapath.
+struct flows_map {
+    __uint(type, BPF_MAP_TYPE_PERCPU_HASH);
+    __type(key, flow_id);
+    __type(value, flow_metrics);
+} aggregated_flows_0 SEC(".maps"), aggregated_flows_1 SEC(".maps");
+
+// Control map whose single entry is the aggregation map that is currently active.
+// The userspace flips it before each eviction. The update of a map-of-maps entry from
+// the userspace waits for an RCU grace period, so after it returns, no program is still
+// updating the previously active map.
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY_OF_MAPS);
+    __uint(max_entries, 1);
+    __type(key, u32);
+    __array(values, struct flows_map);
+} active_flows SEC(".maps") = {
+    .values = { &aggregated_flows_0 },
+};
+
+// Attributes that identify the fragments of an IP packet
+typedef struct fragment_key_t {
+    u8 src_ip[16];
+    u8 dst_ip[16];
+    // IPv4 or IPv6 fragment identification, in network byte order
+    u32 identification;
+    u8 transport_protocol;
+} __attribute__((packed)) fragment_key;
+
+// Transport information of the first fragment of an IP packet
+typedef struct fragment_l4_t {
+    u16 src_port;
+    u16 dst_port;
+    u8 icmp_type;
+    u8 icmp_code;
+} __attribute__((packed)) fragment_l4;
+
+// Key: the identification of a fragmented IP packet. Value: the transport information of its
+// first fragment, which is assigned to the non-first fragments so they are accounted in the same
+// flow. The entries of the packets whose fragments have all been seen are evicted by the LRU policy.
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 1 << 14);
+    __type(key, fragment_key);
+    __type(value, fragment_l4);
+} fragments SEC(".maps");
+
+static __always_inline void set_fragment_key(fragment_key *key, flow_id *id, u32 identification) {
+    __builtin_memset(key, 0, sizeof(*key));
+    __builtin_memcpy(key->src_ip, id->src_ip, sizeof(key->src_ip));
+    __builtin_memcpy(key->dst_ip, id->dst_ip, sizeof(key->dst_ip));
+    key->identification = identification;
+    key->transport_protocol = id->transport_protocol;
+}
+
+// sets the transport information of a non-first fragment from the first fragment of the same
+// IP packet. If the first fragment has not been seen (e.g. the fragments arrived out of order),
+// the fragment is flagged as non_first_fragment, so it is accounted in a fragment-only flow
+static __always_inline void load_fragment_l4info(flow_id *id, u32 identification) {
+    fragment_key key;
+    set_fragment_key(&key, id, identification);
+    fragment_l4 *l4 = bpf_map_lookup_elem(&fragments, &key);
+    if (l4 == NULL) {
+        id->non_first_fragment = 1;
+        return;
+    }
+    id->src_port = l4->src_port;
+    id->dst_port = l4->dst_port;
+    id->icmp_type = l4->icmp_type;
+    id->icmp_code = l4->icmp_code;
+}
+
+// Flow of the packet that is being evaluated by the global functions of each CPU (e.g. the filter
+// and the sampling rules). They read it from this map, as only scalar arguments can be passed to
+// the global functions in older kernels. Unlike the maps above, each object has its own copy
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, u32);
+    __type(value, flow_id);
+} evaluated_flow SEC(".maps");
+
+// stores the flow of the packet to be evaluated by the global functions
+static __always_inline bool set_evaluated_flow(flow_id *id) {
+    u32 zero = 0;
+    return bpf_map_update_elem(&evaluated_flow, &zero, id, BPF_ANY) == 0;
+}
+
+#endif /* __MAPS_H__ */
@@ -0,0 +1,50 @@
+#ifndef __PARSE_H__
+#define __PARSE_H__
+
+#include "flow.h"
+
+// Definitions of the packet headers that are parsed by both the flows and the packet drops
+// programs, so they identify the packets of a flow with the same key.
+
+// 802.1Q VLAN header, which follows the Ethernet header of tagged frames. It is defined here
+// because it is not exported by the kernel headers.
+struct vlan_hdr {
+    __be16 h_vlan_TCI;
+    __be16 h_vlan_encapsulated_proto;
+};
+
+#define VLAN_VID_MASK 0x0fff
+// maximum number of VLAN tags that are parsed (802.1ad QinQ)
+#define MAX_VLAN_TAGS 2
+
+// fragment offset (in 8-octet units) and More Fragments flag of the IPv4 frag_off field
+#define IP_FRAG_OFFSET_MASK 0x1fff
+#define IP_FRAG_MF 0x2000
+
+// IPv6 fragment header. It is defined here because it is not exported by the kernel headers.
+struct ipv6_frag_hdr {
+    u8 nexthdr;
+    u8 reserved;
+    __be16 frag_off;
+    __be32 identification;
+};
+// fragment offset (in 8-octet units) and More Fragments flag of the IPv6 frag_off field
+#define IPV6_FRAG_OFFSET_MASK 0xfff8
+#define IPV6_FRAG_MF 0x0001
+// maximum number and accumulated length of the IPv6 extension headers that are walked to reach
+// the transport header. Packets with longer extension headers are discarded
+#define MAX_IPV6_EXT_HEADERS 6
+#define MAX_IPV6_EXT_HEADERS_LEN 0x7f8
+
+// sets the VLAN ID in the first free VLAN field of the flow id: the outer VLAN ID, and then the
+// inner VLAN ID for double-tagged frames
+static inline void set_vlan_id(flow_id *id, u16 tci, u8 *tags) {
+    if (*tags == 0) {
+        id->vlan_id = tci & VLAN_VID_MASK;
+    } else if (*tags == 1) {
+        id->inner_vlan_id = tci & VLAN_VID_MASK;
+    }
+    (*tags)++;
+}
+
+#endif /* __PARSE_H__ */
@@ -0,0 +1,384 @@
+/*
+    Packet drops. A tracing program that attributes the packets that are dropped by the kernel
+    to their flows.
+
+    This program is hooked on to the skb:kfree_skb tracepoint, which reports the socket buffers
+    that are freed because of a drop, together with the drop reason (Kernel >= 5.17).
+
+    Logic:
+        1) Fill the flow identifier from the headers of the dropped packet and from the network
+           device where it was dropped, as the flows programs do: with the VLAN IDs, after
+           walking the IPv6 extension headers, and with the transport information of the first
+           fragment for the non-first IP fragments. The packets that are dropped after being
+           received from the device are attributed to the ingress flows. Otherwise, to the
+           egress flows.
+           The drops of the flows that are discarded by the filter rules are ignored, as well as
+           the drops of the tunnel packets that the flows programs decapsulate, since their
+           flows are identified by the encapsulated packets, which are not parsed.
+        2) Add the dropped packet and bytes to the flow of the active aggregation map, storing
+           the drop reason. If the flow has not been observed by the flows programs, a flow that
+           only reports the drops is created.
+*/
+#include <linux/bpf.h>
+#include <linux/in.h>
+#include <linux/ip.h>
+#include <linux/if_ether.h>
+#include <linux/ipv6.h>
+#include <linux/icmp.h>
+#include <linux/icmpv6.h>
+#include <linux/udp.h>
+#include <linux/tcp.h>
+#include <stdbool.h>
+
+#include <bpf_helpers.h>
+#include <bpf_endian.h>
+#include <bpf_tracing.h>
+
+#include "flow.h"
+#include "parse.h"
+#include "maps.h"
+#include "filter.h"
+
+// value of the socket buffer header offsets that have not been set
+#define HEADER_UNSET 0xffff
+
+// Inode number of the agent's network namespace, whose interfaces are identified in the flows
+// by a 0 netns inode
+volatile const u32 agent_netns_inode = 0;
+// The lowest skb_drop_reason value that reports an actual drop (SKB_DROP_REASON_NOT_SPECIFIED).
+// The lower values report the packets that have not been dropped, and they depend on the
+// kernel version
+volatile const u32 min_drop_reason = 0;
+// Whether the drops of the flows that are discarded by the filter rules are ignored, as in the
+// flows programs
+volatile const u8 enable_flow_filter = 0;
+// Bitmask of the tunnel types (1 << TUNNEL_*) that are decapsulated by the flows programs, and
+// the UDP destination ports of the VXLAN and Geneve tunnels
+volatile const u8 decap_tunnels = 0;
+volatile const u16 vxlan_port = 4789;
+volatile const u16 geneve_port = 6081;
+
+// Minimal definitions of the kernel structures that are read by the program. The offsets
+// of their fields are relocated from the BTF information of the running kernel (CO-RE).
+struct ns_common {
+    unsigned int inum;
+} __attribute__((preserve_access_index));
+
+struct net {
+    struct ns_common ns;
+} __attribute__((preserve_access_index));
+
+typedef struct {
+    struct net *net;
+} __attribute__((preserve_access_index)) possible_net_t;
+
+struct net_device {
+    int ifindex;
+    possible_net_t nd_net;
+} __attribute__((preserve_access_index));
+
+struct sk_buff {
+    struct net_device *dev;
+    unsigned int len;
+    int skb_iif;
+    __be16 protocol;
+    // VLAN tag that is not in the packet data (e.g. removed by the NIC)
+    __be16 vlan_proto;
+    __u16 vlan_tci;
+    __u16 network_header;
+    __u16 mac_header;
+    unsigned char *head;
+    unsigned char *data;
+} __attribute__((preserve_access_index));
+
+// Kernels older than 6.2 flag the presence of the VLAN tag with a bit, and do not clear the
+// rest of the tag when it is removed
+struct sk_buff___old {
+    __u8 vlan_present:1;
+} __attribute__((preserve_access_index));
+
+// CO-RE relocation kinds of __builtin_preserve_field_info (enum bpf_field_info_kind)
+#define FIELD_BYTE_OFFSET 0
+#define FIELD_BYTE_SIZE 1
+#define FIELD_EXISTS 2
+#define FIELD_LSHIFT_U64 4
+#define FIELD_RSHIFT_U64 5
+
+// returns whether the socket buffer has a VLAN tag that is not in the packet data
+static __always_inline bool skb_vlan_present(struct sk_buff *skb) {
+    struct sk_buff___old *old = (void *)skb;
+    if (!__builtin_preserve_field_info(old->vlan_present, FIELD_EXISTS)) {
+        return skb->vlan_proto != 0;
+    }
+    // reads the bitfield as the BPF_CORE_READ_BITFIELD_PROBED macro from libbpf
+    u64 val = 0;
+    u32 size = __builtin_preserve_field_info(old->vlan_present, FIELD_BYTE_SIZE);
+    void *dst = &val;
+#if __BYTE_ORDER__ == __ORDER_BIG_ENDIAN__
+    dst += 8 - size;
+#endif
+    bpf_probe_read_kernel(dst, size & 0x7,
+                          (void *)old + __builtin_preserve_field_info(old->vlan_present,
+                                                                      FIELD_BYTE_OFFSET));
+    val <<= __builtin_preserve_field_info(old->vlan_present, FIELD_LSHIFT_U64);
+    val >>= __builtin_preserve_field_info(old->vlan_present, FIELD_RSHIFT_U64);
+    return val != 0;
+}
+
+// returns the length of the dropped packet. As the flows programs, it counts the bytes from
+// the Ethernet header, if the packet has it, even if it has been already pulled
+static __always_inline u32 drop_len(struct sk_buff *skb) {
+    u32 len = skb->len;
+    u16 mac_header = skb->mac_header;
+    if (mac_header != HEADER_UNSET) {
+        long pulled = skb->data - (skb->head + mac_header);
+        if (pulled > 0) {
+            len += pulled;
+        }
+    }
+    return len;
+}
+
+// fills the transport information of the flow from the L4 header
+static __always_inline void fill_drop_l4(unsigned char *l4_hdr, flow_id *id) {
+    switch (id->transport_protocol) {
+    case IPPROTO_TCP:
+    case IPPROTO_UDP:
+    case IPPROTO_SCTP: {
+        // the source and destination ports are the first fields of the three headers
+        struct udphdr udp;
+        if (bpf_probe_read_kernel(&udp, sizeof(udp), l4_hdr) == 0) {
+            id->src_port = bpf_ntohs(udp.source);
+            id->dst_port = bpf_ntohs(udp.dest);
+        }
+    } break;
+    case IPPROTO_ICMP:
+    case IPPROTO_ICMPV6: {
+        // the type and code are the first fields of the ICMP and ICMPv6 headers
+        struct icmphdr icmp;
+        if (bpf_probe_read_kernel(&icmp, sizeof(icmp), l4_hdr) == 0) {
+            id->icmp_type = icmp.type;
+            id->icmp_code = icmp.code;
+        }
+    } break;
+    }
+}
+
+// sets the transport information of the flow. The non-first fragments get it from the first
+// fragment of their IP packet, as in the flows programs, since they do not carry the transport
+// header
+static __always_inline void fill_drop_l4_or_fragment(unsigned char *l4_hdr, flow_id *id,
+                                                     u16 frag_offset, u32 identification) {
+    if (frag_offset != 0) {
+        load_fragment_l4info(id, identification);
+    } else {
+        fill_drop_l4(l4_hdr, id);
+    }
+}
+
+// walks the IPv6 extension headers that follow the fixed header, as in the flows programs.
+// It sets the protocol of the first header that is not walked, and the fragment offset and
+// identification of the fragment header, if found. Returns the length of the walked headers, or
+// -1 if they can't be read or they are too long
+static __always_inline int walk_drop_ip6_ext_headers(unsigned char *ext_hdr_start, u8 *nexthdr,
+                                                     u16 *frag_offset, u32 *identification) {
+    u32 len = 0;
+    #pragma unroll
+    for (int i = 0; i < MAX_IPV6_EXT_HEADERS; i++) {
+        u8 protocol = *nexthdr;
+        if (protocol != IPPROTO_HOPOPTS && protocol != IPPROTO_ROUTING
+            && protocol != IPPROTO_DSTOPTS && protocol != IPPROTO_FRAGMENT) {
+            break;
+        }
+        if (protocol == IPPROTO_FRAGMENT) {
+            struct ipv6_frag_hdr frag;
+            if (bpf_probe_read_kernel(&frag, sizeof(frag), ext_hdr_start + len) != 0) {
+                return -1;
+            }
+            *nexthdr = frag.nexthdr;
+            *frag_offset = (bpf_ntohs(frag.frag_off) & IPV6_FRAG_OFFSET_MASK) >> 3;
+            *identification = frag.identification;
+            len += sizeof(frag);
+            // the rest of the headers are in the first fragment
+            if (*frag_offset != 0) {
+                break;
+            }
+        } else {
+            struct ipv6_opt_hdr opt;
+            if (bpf_probe_read_kernel(&opt, sizeof(opt), ext_hdr_start + len) != 0) {
+                return -1;
+            }
+            *nexthdr = opt.nexthdr;
+            // length in 8-octet units, not including the first 8 octets
+            len += (opt.hdrlen + 1) * 8;
+        }
+        if (len > MAX_IPV6_EXT_HEADERS_LEN) {
+            return -1;
+        }
+    }
+    return len;
+}
+
+// returns whether the packet belongs to a tunnel that the flows programs decapsulate
+static __always_inline bool decapsulated_tunnel(flow_id *id) {
+    if (decap_tunnels == 0 || id->non_first_fragment) {
+        return false;
+    }
+    switch (id->transport_protocol) {
+    case IPPROTO_UDP:
+        return ((decap_tunnels & (1 << TUNNEL_VXLAN)) && id->dst_port == vxlan_port)
+            || ((decap_tunnels & (1 << TUNNEL_GENEVE)) && id->dst_port == geneve_port);
+    case IPPROTO_GRE:
+        return decap_tunnels & (1 << TUNNEL_GRE);
+    case IPPROTO_IPIP:
+        return decap_tunnels & (1 << TUNNEL_IPIP);
+    case IPPROTO_IPV6:
+        return decap_tunnels & (1 << TUNNEL_SIT);
+    }
+    return false;
+}
+
+// fills the flow identifier from the headers of the socket buffer. Returns false if they can't
+// be read, or if the drop can't be attributed to the flow of the packet
+static __always_inline bool fill_drop_flow_id(struct sk_buff *skb, flow_id *id) {
+    unsigned char *head = skb->head;
+    u16 mac_header = skb->mac_header;
+    u16 network_header = skb->network_header;
+    id->eth_protocol = bpf_ntohs(skb->protocol);
+
+    u8 tags = 0;
+    if (skb_vlan_present(skb)) {
+        set_vlan_id(id, skb->vlan_tci, &tags);
+    }
+    // the MAC header is not set for the locally generated packets that are dropped before
+    // reaching the device
+    if (mac_header != HEADER_UNSET && mac_header < network_header) {
+        struct ethhdr eth;
+        if (bpf_probe_read_kernel(&eth, sizeof(eth), head + mac_header) == 0) {
+            __builtin_memcpy(id->src_mac, eth.h_source, ETH_ALEN);
+            __builtin_memcpy(id->dst_mac, eth.h_dest, ETH_ALEN);
+            // the VLAN tags that are in the packet data are between the Ethernet header and
+            // the network header
+            u16 proto = bpf_ntohs(eth.h_proto);
+            u32 vlan_offset = mac_header + sizeof(eth);
+            #pragma unroll
+            for (int i = 0; i < MAX_VLAN_TAGS; i++) {
+                if (proto != ETH_P_8021Q && proto != ETH_P_8021AD) {
+                    break;
+                }
+                struct vlan_hdr vlan;
+                if (bpf_probe_read_kernel(&vlan, sizeof(vlan), head + vlan_offset) != 0) {
+                    return false;
+                }
+                set_vlan_id(id, bpf_ntohs(vlan.h_vlan_TCI), &tags);
+                proto = bpf_ntohs(vlan.h_vlan_encapsulated_proto);
+                vlan_offset += sizeof(vlan);
+            }
+            if (tags > 0) {
+                id->eth_protocol = proto;
+            }
+        }
+    }
+    if (network_header == HEADER_UNSET) {
+        return true;
+    }
+
+    switch (id->eth_protocol) {
+    case ETH_P_IP: {
+        struct iphdr ip;
+        if (bpf_probe_read_kernel(&ip, sizeof(ip), head + network_header) != 0 || ip.ihl < 5) {
+            return false;
+        }
+        __builtin_memcpy(id->src_ip, ip4in6, sizeof(ip4in6));
+        __builtin_memcpy(id->dst_ip, ip4in6, sizeof(ip4in6));
+        __builtin_memcpy(id->src_ip + sizeof(ip4in6), &ip.saddr, sizeof(ip.saddr));
+        __builtin_memcpy(id->dst_ip + sizeof(ip4in6), &ip.daddr, sizeof(ip.daddr));
+        id->transport_protocol = ip.protocol;
+        fill_drop_l4_or_fragment(head + network_header + ip.ihl * 4, id,
+                                 bpf_ntohs(ip.frag_off) & IP_FRAG_OFFSET_MASK, ip.id);
+    } break;
+    case ETH_P_IPV6: {
+        struct ipv6hdr ip6;
+        if (bpf_probe_read_kernel(&ip6, sizeof(ip6), head + network_header) != 0) {
+            return false;
+        }
+        __builtin_memcpy(id->src_ip, ip6.saddr.in6_u.u6_addr8, IP_MAX_LEN);
+        __builtin_memcpy(id->dst_ip, ip6.daddr.in6_u.u6_addr8, IP_MAX_LEN);
+        u8 nexthdr = ip6.nexthdr;
+        u16 frag_offset = 0;
+        u32 identification = 0;
+        unsigned char *ext_hdr_start = head + network_header + sizeof(ip6);
+        int ext_len = walk_drop_ip6_ext_headers(ext_hdr_start, &nexthdr, &frag_offset,
+                                                &identification);
+        if (ext_len < 0) {
+            return false;
+        }
+        id->transport_protocol = nexthdr;
+        fill_drop_l4_or_fragment(ext_hdr_start + ext_len, id, frag_offset, identification);
+    } break;
+    }
+    return !decapsulated_tunnel(id);
+}
+
+SEC("tp_btf/kfree_skb")
+int BPF_PROG(kfree_skb, struct sk_buff *skb, void *location, u32 reason) {
+    if (reason < min_drop_reason) {
+        return 0;
+    }
+    struct net_device *dev = skb->dev;
+    if (dev == NULL) {
+        return 0;
+    }
+
+    flow_id id;
+    __builtin_memset(&id, 0, sizeof(id));
+    if (!fill_drop_flow_id(skb, &id)) {
+        return 0;
+    }
+    id.if_index = dev->ifindex;
+    u32 netns = dev->nd_net.net->ns.inum;
+    id.if_netns = netns == agent_netns_inode ? 0 : netns;
+    // the packets are attributed to the ingress flow of the device they have been received from
+    id.direction = skb->skb_iif == id.if_index ? INGRESS : EGRESS;
+    if (enable_flow_filter && filtered_out(&id)) {
+        return 0;
+    }
+
+    u32 active_key = 0;
+    void *aggregated_flows = bpf_map_lookup_elem(&active_flows, &active_key);
+    if (aggregated_flows == NULL) {
+        return 0;
+    }
+    u64 current_time = bpf_ktime_get_ns();
+    u32 len = drop_len(skb);
+    flow_metrics *aggregate_flow = bpf_map_lookup_elem(aggregated_flows, &id);
+    if (aggregate_flow != NULL) {
+        aggregate_flow->dropped_packets += 1;
+        aggregate_flow->dropped_bytes += len;
+        aggregate_flow->drop_reason = reason;
+        aggregate_flow->end_mono_time_ts = current_time;
+        return 0;
+    }
+    flow_metrics new_flow = {
+        .start_mono_time_ts = current_time,
+        .end_mono_time_ts = current_time,
+        .dropped_packets = 1,
+        .dropped_bytes = len,
+        .drop_reason = reason,
+    };
+    long ret = bpf_map_update_elem(aggregated_flows, &id, &new_flow, BPF_ANY);
+    if (ret != 0) {
+        // as in the flows programs, the flow is sent via ringbuffer if the map is full or busy
+        new_flow.errno = -ret;
+        flow_record *record = bpf_ringbuf_reserve(&direct_flows, sizeof(flow_record), 0);
+        if (!record) {
+            return 0;
+        }
+        record->id = id;
+        record->metrics = new_flow;
+        bpf_ringbuf_submit(record, 0);
+    }
+    return 0;
+}
+
+char _license[] SEC("license") = "GPL";
@@ -0,0 +1,118 @@
+#ifndef __SAMPLING_H__
+#define __SAMPLING_H__
+
+#include "flow.h"
+#include "maps.h"
+
+// Maximum number of rules that can apply to a destination address: the rules of its most
+// specific CIDR and the rules of all the CIDRs that contain it
+#define MAX_SAMPLING_RULES 8
+
+// Key of the sampling rules map: a destination CIDR, encoded as the filter_key CIDRs
+typedef struct sampling_key_t {
+    u32 prefix_len;
+    u8 ip[IP_MAX_LEN];
+} __attribute__((packed)) sampling_key;
+
+// Force emitting struct sampling_key into the ELF.
+const struct sampling_key_t *unused9 __attribute__((unused));
+
+typedef struct sampling_rule_t {
+    // range of the destination port of the matching flows. 0-0 matches any port
+    u16 port_start;
+    u16 port_end;
+    // only 1 out of "rate" packets of the matching flows are accounted
+    u32 rate;
+} __attribute__((packed)) sampling_rule;
+
+// Rules that apply to the destination addresses of a CIDR, sorted by priority
+typedef struct sampling_rules_t {
+    u8 count;
+    sampling_rule rules[MAX_SAMPLING_RULES];
+} __attribute__((packed)) sampling_rules;
+
+// Force emitting struct sampling_rules into the ELF.
+const struct sampling_rules_t *unused10 __attribute__((unused));
+
+typedef struct interface_key_t {
+    u32 if_index;
+    u32 if_netns;
+} interface_key;
+
+// Force emitting struct interface_key into the ELF.
+const struct interface_key_t *unused11 __attribute__((unused));
+
+// Key: destination CIDR of the rules. Value: the rules whose CIDR contains it, including its own.
+// The max entries are resized to the number of configured CIDRs at load time
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __uint(max_entries, 1);
+    __type(key, sampling_key);
+    __type(value, sampling_rules);
+} sampling_rules_map SEC(".maps");
+
+// Key: the interface of the flows, as in their flow_id. Value: the sampling rate of the flows
+// that do not match any rule of the sampling_rules_map
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 1 << 12);
+    __type(key, interface_key);
+    __type(value, u32);
+} interface_sampling SEC(".maps");
+
+// Single entry with the sampling rate of the flows that do not match any rule or interface
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, u32);
+    __type(value, u32);
+} default_sampling SEC(".maps");
+
+// returns the sampling rate of the packet of the evaluated_flow, according to the first rule
+// of its destination address and port, or to its interface, or the default rate. It returns 0
+// if the packet is not sampled, so it must not be accounted.
+// It is a global function, so the verifier checks it once, as the filter_sampling function.
+__attribute__((noinline)) u32 sampled_rate() {
+    u32 zero = 0;
+    flow_id *id = bpf_map_lookup_elem(&evaluated_flow, &zero);
+    if (id == NULL) {
+        return 1;
+    }
+    u32 rate = 0;
+    sampling_key key = {.prefix_len = IP_MAX_LEN * 8};
+    __builtin_memcpy(key.ip, id->dst_ip, IP_MAX_LEN);
+    sampling_rules *rules = bpf_map_lookup_elem(&sampling_rules_map, &key);
+    if (rules != NULL) {
+        for (int i = 0; i < MAX_SAMPLING_RULES; i++) {
+            if (i >= rules->count) {
+                break;
+            }
+            sampling_rule *rule = &rules->rules[i];
+            if (rule->port_end == 0
+                || (id->dst_port >= rule->port_start && id->dst_port <= rule->port_end)) {
+                rate = rule->rate;
+                break;
+            }
+        }
+    }
+    if (rate == 0) {
+        interface_key iface = {.if_index = id->if_index, .if_netns = id->if_netns};
+        u32 *iface_rate = bpf_map_lookup_elem(&interface_sampling, &iface);
+        if (iface_rate != NULL) {
+            rate = *iface_rate;
+        }
+    }
+    if (rate == 0) {
+        u32 *default_rate = bpf_map_lookup_elem(&default_sampling, &zero);
+        if (default_rate != NULL) {
+            rate = *default_rate;
+        }
+    }
+    if (rate <= 1) {
+        return 1;
+    }
+    return (bpf_get_prandom_u32() % rate) == 0 ? rate : 0;
+}
+
+#endif /* __SAMPLING_H__ */
@@ -0,0 +1,98 @@
+/*
+    Socket owners. Programs that attribute the TCP connections to the process that owns their
+    local socket.
+
+    The owner of a socket can only be known from the context of the process that creates it,
+    while the addresses and ports of the connection are only known once it is established.
+
+    Logic:
+        1) The sock_create program is attached to the root cgroup, so it is invoked when any
+           process creates a socket. It stores the process ID, command and cgroup ID of the
+           current process in the local storage of the socket. The storage of the listening
+           sockets is cloned into the sockets of their accepted connections, so they are
+           attributed to the process that listens for them.
+        2) The inet_sock_set_state program is hooked on to the sock:inet_sock_set_state
+           tracepoint. When a TCP connection is established, it copies the owner from the
+           socket storage into the conn_owners map, whose key is the connection identifier.
+           The user space reads this map to attribute the flows of the connection.
+*/
+#include <linux/bpf.h>
+#include <linux/in.h>
+#include <linux/if_ether.h>
+#include <stdbool.h>
+
+#include <bpf_helpers.h>
+#include <bpf_endian.h>
+#include <bpf_tracing.h>
+
+#include "conn.h"
+
+// as defined in include/net/tcp_states.h
+#define TCP_ESTABLISHED 1
+#define SOCK_STREAM 1
+#define TASK_COMM_LEN 16
+
+// Process that owns a socket
+typedef struct process_t {
+    u64 cgroup_id;
+    u32 pid;
+    u8 comm[TASK_COMM_LEN];
+} __attribute__((packed)) process;
+
+// Force emitting struct process into the ELF.
+const struct process_t *unused6 __attribute__((unused));
+
+// Owner of each TCP socket, stored in the socket local storage. It is cloned into the
+// sockets of the accepted connections
+struct {
+    __uint(type, BPF_MAP_TYPE_SK_STORAGE);
+    __uint(map_flags, BPF_F_NO_PREALLOC | BPF_F_CLONE);
+    __type(key, int);
+    __type(value, process);
+} sock_owners SEC(".maps");
+
+// Owner of the local socket of each established TCP connection. The max entries are resized to
+// the flows cache size at load time, and the least recently established connections are
+// evicted first
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __type(key, conn_id);
+    __type(value, process);
+} conn_owners SEC(".maps");
+
+SEC("cgroup/sock_create")
+int sock_create(struct bpf_sock *ctx) {
+    if ((ctx->family == AF_INET || ctx->family == AF_INET6) && ctx->type == SOCK_STREAM &&
+        ctx->protocol == IPPROTO_TCP) {
+        process *owner =
+            bpf_sk_storage_get(&sock_owners, ctx, NULL, BPF_SK_STORAGE_GET_F_CREATE);
+        if (owner != NULL) {
+            owner->pid = bpf_get_current_pid_tgid() >> 32;
+            owner->cgroup_id = bpf_get_current_cgroup_id();
+            bpf_get_current_comm(owner->comm, sizeof(owner->comm));
+        }
+    }
+    // the socket creation is always allowed
+    return 1;
+}
+
+SEC("tp_btf/inet_sock_set_state")
+int BPF_PROG(inet_sock_set_state, struct sock *sk, int oldstate, int newstate) {
+    if (newstate != TCP_ESTABLISHED) {
+        return 0;
+    }
+    process *owner = bpf_sk_storage_get(&sock_owners, sk, NULL, 0);
+    if (owner == NULL) {
+        // the socket was created before the programs were loaded
+        return 0;
+    }
+    conn_id id;
+    __builtin_memset(&id, 0, sizeof(id));
+    if (!fill_conn_id(sk, &id)) {
+        return 0;
+    }
+    bpf_map_update_elem(&conn_owners, &id, owner, BPF_ANY);
+    return 0;
+}
+
+char _license[] SEC("license") = "GPL";
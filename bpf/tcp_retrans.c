@@ -0,0 +1,58 @@
+/*
+    TCP retransmissions. A tracing program that counts the retransmitted segments of each TCP
+    connection.
+
+    This program is hooked on to the tcp:tcp_retransmit_skb tracepoint, which reports the socket
+    buffers that are retransmitted by the local TCP stack. At this point the socket buffers do
+    not carry their headers yet, so the connection is identified from the socket.
+
+    Logic:
+        1) Fill the connection identifier from the local and remote addresses and ports of the
+           socket. The retransmitted segments are sent from the local to the remote endpoint.
+        2) Increase the retransmissions counter of the connection. The user space merges the
+           counters into the flows with the same addresses, ports and protocol, regardless of
+           the interface they were captured from.
+*/
+#include <linux/bpf.h>
+#include <linux/in.h>
+#include <linux/if_ether.h>
+#include <stdbool.h>
+
+#include <bpf_helpers.h>
+#include <bpf_endian.h>
+#include <bpf_tracing.h>
+
+#include "conn.h"
+
+// Number of retransmitted segments of each connection since they were last read by the
+// user space. The max entries are resized to the flows cache size at load time
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __type(key, conn_id);
+    __type(value, u32);
+} tcp_retransmits SEC(".maps");
+
+SEC("tp_btf/tcp_retransmit_skb")
+int BPF_PROG(tcp_retransmit_skb, struct sock *sk, struct sk_buff *skb) {
+    conn_id id;
+    __builtin_memset(&id, 0, sizeof(id));
+    if (!fill_conn_id(sk, &id)) {
+        return 0;
+    }
+    u32 *retransmits = bpf_map_lookup_elem(&tcp_retransmits, &id);
+    if (retransmits != NULL) {
+        __sync_fetch_and_add(retransmits, 1);
+        return 0;
+    }
+    u32 first = 1;
+    // another CPU might have concurrently created the entry
+    if (bpf_map_update_elem(&tcp_retransmits, &id, &first, BPF_NOEXIST) != 0) {
+        retransmits = bpf_map_lookup_elem(&tcp_retransmits, &id);
+        if (retransmits != NULL) {
+            __sync_fetch_and_add(retransmits, 1);
+        }
+    }
+    return 0;
+}
+
+char _license[] SEC("license") = "GPL";
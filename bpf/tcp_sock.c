@@ -0,0 +1,132 @@
+/*
+    TCP socket sampling. A tracing program that samples the smoothed round-trip time, the
+    congestion window and the maximum segment size of the local TCP sockets.
+
+    This program is hooked on to the tcp:tcp_probe tracepoint, which is reported by the
+    tcp_rcv_established kernel function when it starts processing a segment that is received by
+    an established TCP connection. Each received segment is a sample of the state of the socket
+    after the previous one, which changes as the segments are acknowledged.
+
+    Logic:
+        1) Fill the connection identifier from the local and remote addresses and ports of the
+           socket.
+        2) Update the minimum, maximum and sum of the sampled values of the connection. The user
+           space merges them into the flows that are sent from the local to the remote endpoint,
+           regardless of the interface they were captured from.
+*/
+#include <linux/bpf.h>
+#include <linux/in.h>
+#include <linux/if_ether.h>
+#include <stdbool.h>
+
+#include <bpf_helpers.h>
+#include <bpf_endian.h>
+#include <bpf_tracing.h>
+
+#include "conn.h"
+
+// Minimal definition of the TCP socket, whose field offsets are relocated from the BTF
+// information of the running kernel (CO-RE).
+struct tcp_sock {
+    // smoothed round-trip time in microseconds, left-shifted by 3 bits
+    u32 srtt_us;
+    // congestion window, in segments
+    u32 snd_cwnd;
+    // current effective sending MSS
+    u32 mss_cache;
+} __attribute__((preserve_access_index));
+
+// Minimum, maximum and sum of the samples of each socket attribute. The smoothed round-trip
+// time is in microseconds.
+typedef struct samples_t {
+    u32 count;
+    u32 srtt_min;
+    u32 srtt_max;
+    u64 srtt_sum;
+    u32 cwnd_min;
+    u32 cwnd_max;
+    u64 cwnd_sum;
+    u32 mss_min;
+    u32 mss_max;
+    u64 mss_sum;
+} __attribute__((packed)) samples;
+
+// Force emitting struct samples into the ELF.
+const struct samples_t *unused5 __attribute__((unused));
+
+// Samples of each connection since they were last read by the user space. The segments of
+// the same connection might be concurrently received by different CPUs, so the samples are
+// stored per CPU. The max entries are resized to the flows cache size at load time
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_PERCPU_HASH);
+    __type(key, conn_id);
+    __type(value, samples);
+} tcp_sock_samples SEC(".maps");
+
+SEC("tp_btf/tcp_probe")
+int BPF_PROG(tcp_probe, struct sock *sk, struct sk_buff *skb) {
+    struct tcp_sock *tp = bpf_skc_to_tcp_sock(sk);
+    if (tp == NULL) {
+        return 0;
+    }
+    u32 srtt = tp->srtt_us >> 3;
+    // the socket has not measured its round-trip time yet
+    if (srtt == 0) {
+        return 0;
+    }
+    u32 cwnd = tp->snd_cwnd;
+    u32 mss = tp->mss_cache;
+
+    conn_id id;
+    __builtin_memset(&id, 0, sizeof(id));
+    if (!fill_conn_id(sk, &id)) {
+        return 0;
+    }
+    samples *s = bpf_map_lookup_elem(&tcp_sock_samples, &id);
+    // the entry might have been created from another CPU, without samples from this CPU
+    if (s != NULL && s->count > 0) {
+        s->count++;
+        if (srtt < s->srtt_min) {
+            s->srtt_min = srtt;
+        }
+        if (srtt > s->srtt_max) {
+            s->srtt_max = srtt;
+        }
+        s->srtt_sum += srtt;
+        if (cwnd < s->cwnd_min) {
+            s->cwnd_min = cwnd;
+        }
+        if (cwnd > s->cwnd_max) {
+            s->cwnd_max = cwnd;
+        }
+        s->cwnd_sum += cwnd;
+        if (mss < s->mss_min) {
+            s->mss_min = mss;
+        }
+        if (mss > s->mss_max) {
+            s->mss_max = mss;
+        }
+        s->mss_sum += mss;
+        return 0;
+    }
+    samples first = {
+        .count = 1,
+        .srtt_min = srtt,
+        .srtt_max = srtt,
+        .srtt_sum = srtt,
+        .cwnd_min = cwnd,
+        .cwnd_max = cwnd,
+        .cwnd_sum = cwnd,
+        .mss_min = mss,
+        .mss_max = mss,
+        .mss_sum = mss,
+    };
+    if (s != NULL) {
+        *s = first;
+    } else {
+        bpf_map_update_elem(&tcp_sock_samples, &id, &first, BPF_ANY);
+    }
+    return 0;
+}
+
+char _license[] SEC("license") = "GPL";
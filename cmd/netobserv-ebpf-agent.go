@@ -36,6 +36,9 @@ func main() {
 	if config.DeduperFCExpiry == 0 {
 		config.DeduperFCExpiry = 2 * config.CacheActiveTimeout
 	}
+	if config.BiflowMergeWindow == 0 {
+		config.BiflowMergeWindow = config.CacheActiveTimeout
+	}
 
 	logrus.WithField("configuration", fmt.Sprintf("%#v", config)).Debugf("configuration loaded")
 
@@ -44,6 +47,16 @@ func main() {
 		logrus.WithError(err).Fatal("can't instantiate NetObserv eBPF Agent")
 	}
 
+	if config.HealthPort != 0 {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/health", flowsAgent.HealthHandler())
+			logrus.WithField("port", config.HealthPort).Info("starting health HTTP listener")
+			logrus.WithError(http.ListenAndServe(fmt.Sprintf(":%d", config.HealthPort), mux)).
+				Error("health HTTP listener stopped working")
+		}()
+	}
+
 	logrus.Infof("push CTRL+C or send SIGTERM to interrupt execution")
 	ctx, canceler := context.WithCancel(context.Background())
 	// Subscribe to signals for terminating the program.
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/cilium/ebpf/ringbuf"
@@ -59,27 +62,42 @@ type Flows struct {
 	interfaces ifaces.Informer
 	filter     interfaceFilter
 	ebpf       ebpfFlowFetcher
+	// registrations keeps track of the attachment of the ebpfFetcher to each interface
+	registrations *registrationManager
 
 	// processing nodes to be wired in the buildAndStartPipeline method
 	mapTracer *flow.MapTracer
 	rbTracer  *flow.RingBufTracer
 	accounter *flow.Accounter
 	exporter  node.TerminalFunc[[]*flow.Record]
+	// flowFilter is nil if no filter expression is configured
+	flowFilter *flow.Filter
+	// sampling is nil if no target of flows per second is configured
+	sampling *samplingController
 
 	// elements used to decorate flows with extra information
 	interfaceNamer flow.InterfaceNamer
+	dropNamer      flow.DropCauseNamer
+	containerNamer flow.ContainerNamer
 	agentIP        net.IP
 
-	status Status
+	// status is accessed atomically, as it is read by the health endpoint while the agent runs
+	status int32
 }
 
 // ebpfFlowFetcher abstracts the interface of ebpf.FlowFetcher to allow dependency injection in tests
 type ebpfFlowFetcher interface {
 	io.Closer
 	Register(iface ifaces.Interface) error
+	Unregister(iface ifaces.Interface) error
 
-	LookupAndDeleteMap() map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics
+	LookupAndDeleteMap() (map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics, error)
+	LookupAndDeleteRetransmits() map[ebpf.ConnId]uint32
+	LookupAndDeleteTCPSockSamples() map[ebpf.ConnId][]ebpf.TcpSockSamples
+	LookupProcesses() map[ebpf.ConnId]ebpf.OwnerProcess
 	ReadRingBuf() (ringbuf.Record, error)
+	SetSamplingScale(scale float64) error
+	EvictionStats() ebpf.EvictionStats
 }
 
 // FlowsAgent instantiates a new agent, given a configuration.
@@ -87,19 +105,20 @@ func FlowsAgent(cfg *Config) (*Flows, error) {
 	alog.Info("initializing Flows agent")
 
 	// configure informer for new interfaces
+	discovery := netnsDiscovery(cfg)
 	var informer ifaces.Informer
 	switch cfg.ListenInterfaces {
 	case ListenPoll:
 		alog.WithField("period", cfg.ListenPollPeriod).
 			Debug("listening for new interfaces: use polling")
-		informer = ifaces.NewPoller(cfg.ListenPollPeriod, cfg.BuffersLength)
+		informer = ifaces.NewPoller(cfg.ListenPollPeriod, cfg.BuffersLength, discovery)
 	case ListenWatch:
 		alog.Debug("listening for new interfaces: use watching")
-		informer = ifaces.NewWatcher(cfg.BuffersLength)
+		informer = ifaces.NewWatcher(cfg.BuffersLength, discovery, cfg.NetworkNamespacesPollPeriod)
 	default:
 		alog.WithField("providedValue", cfg.ListenInterfaces).
 			Warn("wrong interface listen method. Using file watcher as default")
-		informer = ifaces.NewWatcher(cfg.BuffersLength)
+		informer = ifaces.NewWatcher(cfg.BuffersLength, discovery, cfg.NetworkNamespacesPollPeriod)
 	}
 
 	alog.Debug("acquiring Agent IP")
@@ -116,13 +135,49 @@ func FlowsAgent(cfg *Config) (*Flows, error) {
 	}
 
 	ingress, egress := flowDirections(cfg)
+	xdp, err := xdpModes(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tunnels, err := tunnelDecapsulation(cfg)
+	if err != nil {
+		return nil, err
+	}
+	filterRules, err := flowFilterRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sampling, err := samplingRules(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	debug := false
 	if cfg.LogLevel == logrus.TraceLevel.String() || cfg.LogLevel == logrus.DebugLevel.String() {
 		debug = true
 	}
 
-	fetcher, err := ebpf.NewFlowFetcher(debug, cfg.Sampling, cfg.CacheMaxFlows, ingress, egress)
+	fetcher, err := ebpf.NewFlowFetcher(&ebpf.FlowFetcherConfig{
+		TraceMessages:         debug,
+		Sampling:              cfg.Sampling,
+		CacheMaxSize:          cfg.CacheMaxFlows,
+		EnableIngress:         ingress,
+		EnableEgress:          egress,
+		XDPModes:              xdp,
+		Tunnels:               tunnels,
+		CountTCPFlags:         cfg.CountTCPFlags,
+		EnablePktDrops:        cfg.EnablePktDrops,
+		DNSTracking:           cfg.EnableDNSTracking,
+		DNSPort:               cfg.DNSTrackingPort,
+		EnableTCPRetransmits:  cfg.EnableTCPRetransmits,
+		EnableTCPSockSampling: cfg.EnableTCPSockSampling,
+		EnableProcessTracking: cfg.EnableProcessTracking,
+		CgroupPath:            cfg.CgroupPath,
+		FilterRules:           filterRules,
+		SamplingRules:         sampling,
+		AdaptiveSampling:      cfg.SamplingTargetFlowsPerSecond > 0,
+		ObserveNetNS:          discovery != ifaces.NetNSNone,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -145,12 +200,59 @@ func flowsAgent(cfg *Config,
 
 	registerer := ifaces.NewRegisterer(informer, cfg.BuffersLength)
 
-	interfaceNamer := func(ifIndex int) string {
-		iface, ok := registerer.IfaceNameForIndex(ifIndex)
+	interfaceNamer := func(netNS uint32, ifIndex int) (string, string) {
+		iface, ok := registerer.IfaceForIndex(netNS, ifIndex)
 		if !ok {
-			return "unknown"
+			return "unknown", ""
+		}
+		return iface.Name, iface.NetNS.Name
+	}
+
+	// the values of the packet drop reasons depend on the kernel version
+	dropReasons := map[uint32]string{}
+	if cfg.EnablePktDrops {
+		if dropReasons, err = ebpf.DropReasons(); err != nil {
+			return nil, fmt.Errorf("reading packet drop reasons: %w", err)
+		}
+	}
+	dropNamer := func(reason uint32) string {
+		if name, ok := dropReasons[reason]; ok {
+			return name
 		}
-		return iface
+		return strconv.FormatUint(uint64(reason), 10)
+	}
+
+	containers := newContainerResolver(cfg.CgroupPath, ebpf.Cgroup2Root)
+	containerNamer := containers.containerID
+
+	var flowFilter *flow.Filter
+	if cfg.FlowFilterExpression != "" {
+		if flowFilter, err = flow.NewFilter(cfg.FlowFilterExpression); err != nil {
+			return nil, fmt.Errorf("parsing FLOW_FILTER_EXPRESSION: %w", err)
+		}
+	}
+
+	if cfg.EnableBiflows && cfg.BiflowMergeWindow <= 0 {
+		return nil, fmt.Errorf("invalid BIFLOW_MERGE_WINDOW %s", cfg.BiflowMergeWindow)
+	}
+	if cfg.EnableConnectionTracking {
+		// otherwise, the connections would be ended between two evictions of their flows
+		if cfg.ConnectionInactiveTimeout <= cfg.CacheActiveTimeout {
+			return nil, fmt.Errorf("CONNECTION_INACTIVE_TIMEOUT %s must be longer than CACHE_ACTIVE_TIMEOUT %s",
+				cfg.ConnectionInactiveTimeout, cfg.CacheActiveTimeout)
+		}
+		if cfg.ConnectionActiveTimeout <= 0 {
+			return nil, fmt.Errorf("invalid CONNECTION_ACTIVE_TIMEOUT %s", cfg.ConnectionActiveTimeout)
+		}
+	}
+
+	var sampling *samplingController
+	if cfg.SamplingTargetFlowsPerSecond > 0 {
+		if cfg.SamplingAdjustPeriod <= 0 {
+			return nil, fmt.Errorf("invalid SAMPLING_ADJUST_PERIOD %s", cfg.SamplingAdjustPeriod)
+		}
+		sampling = newSamplingController(cfg.SamplingTargetFlowsPerSecond,
+			cfg.SamplingAdjustPeriod, fetcher.SetSamplingScale)
 	}
 
 	mapTracer := flow.NewMapTracer(fetcher, cfg.CacheActiveTimeout)
@@ -159,6 +261,7 @@ func flowsAgent(cfg *Config,
 		cfg.CacheMaxFlows, cfg.CacheActiveTimeout, time.Now, monotime.Now)
 	return &Flows{
 		ebpf:           fetcher,
+		registrations:  newRegistrationManager(fetcher, cfg.AttachRetryBackoff, cfg.AttachRetryMaxBackoff),
 		exporter:       exporter,
 		interfaces:     registerer,
 		filter:         filter,
@@ -166,8 +269,12 @@ func flowsAgent(cfg *Config,
 		mapTracer:      mapTracer,
 		rbTracer:       rbTracer,
 		accounter:      accounter,
+		flowFilter:     flowFilter,
+		sampling:       sampling,
 		agentIP:        agentIP,
 		interfaceNamer: interfaceNamer,
+		dropNamer:      dropNamer,
+		containerNamer: containerNamer,
 	}, nil
 }
 
@@ -185,6 +292,55 @@ func flowDirections(cfg *Config) (ingress, egress bool) {
 	}
 }
 
+func netnsDiscovery(cfg *Config) ifaces.NetNSDiscovery {
+	switch cfg.NetworkNamespaces {
+	case NetNSNone:
+		return ifaces.NetNSNone
+	case NetNSNamed:
+		return ifaces.NetNSNamed
+	case NetNSAll:
+		return ifaces.NetNSAll
+	default:
+		alog.Warnf("unknown NETWORK_NAMESPACES %q. Only tracing the agent's own namespace",
+			cfg.NetworkNamespaces)
+		return ifaces.NetNSNone
+	}
+}
+
+// xdpModes returns the XDP attach mode for each interface whose ingress traffic is observed
+// from the XDP hook
+func xdpModes(cfg *Config) (map[string]ebpf.XDPMode, error) {
+	modes := map[string]ebpf.XDPMode{}
+	for _, entry := range cfg.XDPInterfaces {
+		name, mode, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			mode = string(ebpf.XDPModeNative)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("missing interface name in XDP_INTERFACES entry %q", entry)
+		}
+		if err := ebpf.XDPMode(mode).Validate(); err != nil {
+			return nil, fmt.Errorf("XDP_INTERFACES entry %q: %w", entry, err)
+		}
+		modes[name] = ebpf.XDPMode(mode)
+	}
+	return modes, nil
+}
+
+// tunnelDecapsulation returns the overlay tunnels whose encapsulated packets are parsed by the
+// eBPF programs
+func tunnelDecapsulation(cfg *Config) (ebpf.TunnelDecapsulation, error) {
+	decap := ebpf.TunnelDecapsulation{VXLANPort: cfg.VXLANPort, GenevePort: cfg.GenevePort}
+	for _, name := range cfg.DecapsulateTunnels {
+		tunnel, err := ebpf.ParseTunnelType(strings.TrimSpace(name))
+		if err != nil {
+			return decap, fmt.Errorf("DECAPSULATE_TUNNELS: %w", err)
+		}
+		decap.Types = append(decap.Types, tunnel)
+	}
+	return decap, nil
+}
+
 func buildFlowExporter(cfg *Config) (node.TerminalFunc[[]*flow.Record], error) {
 	switch cfg.Export {
 	case "grpc":
@@ -242,7 +398,7 @@ func buildFlowExporter(cfg *Config) (node.TerminalFunc[[]*flow.Record], error) {
 			return nil, fmt.Errorf("missing target host or port: %s:%d",
 				cfg.TargetHost, cfg.TargetPort)
 		}
-		ipfix, err := exporter.StartIPFIXExporter(cfg.TargetHost, cfg.TargetPort, "udp")
+		ipfix, err := exporter.StartIPFIXExporter(cfg.TargetHost, cfg.TargetPort, "udp", uint32(cfg.Sampling), cfg.EnableBiflows)
 		if err != nil {
 			return nil, err
 		}
@@ -252,7 +408,7 @@ func buildFlowExporter(cfg *Config) (node.TerminalFunc[[]*flow.Record], error) {
 			return nil, fmt.Errorf("missing target host or port: %s:%d",
 				cfg.TargetHost, cfg.TargetPort)
 		}
-		ipfix, err := exporter.StartIPFIXExporter(cfg.TargetHost, cfg.TargetPort, "tcp")
+		ipfix, err := exporter.StartIPFIXExporter(cfg.TargetHost, cfg.TargetPort, "tcp", uint32(cfg.Sampling), cfg.EnableBiflows)
 		if err != nil {
 			return nil, err
 		}
@@ -266,19 +422,20 @@ func buildFlowExporter(cfg *Config) (node.TerminalFunc[[]*flow.Record], error) {
 // Run a Flows agent. The function will keep running in the same thread
 // until the passed context is canceled
 func (f *Flows) Run(ctx context.Context) error {
-	f.status = StatusStarting
+	f.setStatus(StatusStarting)
 	alog.Info("starting Flows agent")
 	graph, err := f.buildAndStartPipeline(ctx)
 	if err != nil {
 		return fmt.Errorf("starting processing graph: %w", err)
 	}
 
-	f.status = StatusStarted
+	f.setStatus(StatusStarted)
 	alog.Info("Flows agent successfully started")
 	<-ctx.Done()
 
-	f.status = StatusStopping
+	f.setStatus(StatusStopping)
 	alog.Info("stopping Flows agent")
+	f.registrations.stop()
 	if err := f.ebpf.Close(); err != nil {
 		alog.WithError(err).Warn("eBPF resources not correctly closed")
 	}
@@ -286,13 +443,23 @@ func (f *Flows) Run(ctx context.Context) error {
 	alog.Debug("waiting for all nodes to finish their pending work")
 	<-graph.Done()
 
-	f.status = StatusStopped
+	f.setStatus(StatusStopped)
 	alog.Info("Flows agent stopped")
 	return nil
 }
 
 func (f *Flows) Status() Status {
-	return f.status
+	return Status(atomic.LoadInt32(&f.status))
+}
+
+func (f *Flows) setStatus(status Status) {
+	atomic.StoreInt32(&f.status, int32(status))
+}
+
+// Interfaces returns the attach state of the eBPF programs in each of the network interfaces
+// that match the user configuration, sorted by interface index
+func (f *Flows) Interfaces() []InterfaceState {
+	return f.registrations.states()
 }
 
 // interfacesManager uses an informer to check new/deleted network interfaces. For each running
@@ -319,8 +486,7 @@ func (f *Flows) interfacesManager(ctx context.Context) error {
 				case ifaces.EventAdded:
 					f.onInterfaceAdded(event.Interface)
 				case ifaces.EventDeleted:
-					// qdiscs, ingress and egress filters are automatically deleted so we don't need to
-					// specifically detach them from the ebpfFetcher
+					f.onInterfaceDeleted(event.Interface)
 				default:
 					slog.WithField("event", event).Warn("unknown event type")
 				}
@@ -348,10 +514,15 @@ func (f *Flows) buildAndStartPipeline(ctx context.Context) (*node.Terminal[[]*fl
 	accounter := node.AsMiddle(f.accounter.Account,
 		node.ChannelBufferLen(f.cfg.BuffersLength))
 
+	// a handshake whose flows are not completed after two evictions is forgotten
+	rtt := node.AsMiddle(flow.HandshakeRTT(2*f.cfg.CacheActiveTimeout),
+		node.ChannelBufferLen(f.cfg.BuffersLength))
+
 	limiter := node.AsMiddle((&flow.CapacityLimiter{}).Limit,
 		node.ChannelBufferLen(f.cfg.BuffersLength))
 
-	decorator := node.AsMiddle(flow.Decorate(f.agentIP, f.interfaceNamer),
+	decorator := node.AsMiddle(
+		flow.Decorate(f.agentIP, uint32(f.cfg.Sampling), f.interfaceNamer, f.dropNamer, f.containerNamer),
 		node.ChannelBufferLen(f.cfg.BuffersLength))
 
 	ebl := f.cfg.ExporterBufferLength
@@ -363,19 +534,73 @@ func (f *Flows) buildAndStartPipeline(ctx context.Context) (*node.Terminal[[]*fl
 		node.ChannelBufferLen(ebl))
 
 	rbTracer.SendsTo(accounter)
+	if f.cfg.EnableTCPRetransmits || f.cfg.EnableTCPSockSampling || f.cfg.EnableProcessTracking {
+		// the metrics of a connection whose flows are not evicted after two evictions are
+		// forgotten
+		conns := node.AsMiddle(flow.MergeConnMetrics(f.ebpf, 2*f.cfg.CacheActiveTimeout),
+			node.ChannelBufferLen(f.cfg.BuffersLength))
+		mapTracer.SendsTo(conns)
+		accounter.SendsTo(conns)
+		conns.SendsTo(rtt)
+	} else {
+		mapTracer.SendsTo(rtt)
+		accounter.SendsTo(rtt)
+	}
+
+	// the flows are correlated before the deduplication, which might discard some of them
+	correlator := rtt
+	if f.cfg.EnableDNSTracking {
+		// a DNS transaction whose flows are not completed after two evictions is forgotten
+		dns := node.AsMiddle(flow.DNSTracker(2*f.cfg.CacheActiveTimeout),
+			node.ChannelBufferLen(f.cfg.BuffersLength))
+		rtt.SendsTo(dns)
+		correlator = dns
+	}
 
+	last := correlator
 	if f.cfg.Deduper == DeduperFirstCome {
 		deduper := node.AsMiddle(flow.Dedupe(f.cfg.DeduperFCExpiry, f.cfg.DeduperJustMark),
 			node.ChannelBufferLen(f.cfg.BuffersLength))
-		mapTracer.SendsTo(deduper)
-		accounter.SendsTo(deduper)
-		deduper.SendsTo(limiter)
-	} else {
-		mapTracer.SendsTo(limiter)
-		accounter.SendsTo(limiter)
+		last.SendsTo(deduper)
+		last = deduper
+	}
+	// the biflows are merged after the deduplication, so both directions of a biflow are
+	// duplicates or not
+	if f.cfg.EnableBiflows {
+		biflows := node.AsMiddle(flow.MergeBiflows(f.cfg.BiflowMergeWindow),
+			node.ChannelBufferLen(f.cfg.BuffersLength))
+		last.SendsTo(biflows)
+		last = biflows
 	}
+	// the connections are tracked after the biflows are merged, so the records of both
+	// directions are reported in the same events. The closed connections wait for the packets
+	// of the next eviction
+	if f.cfg.EnableConnectionTracking {
+		tracker := node.AsMiddle(flow.TrackConnections(f.cfg.ConnectionInactiveTimeout,
+			f.cfg.ConnectionActiveTimeout, f.cfg.CacheActiveTimeout),
+			node.ChannelBufferLen(f.cfg.BuffersLength))
+		last.SendsTo(tracker)
+		last = tracker
+	}
+	last.SendsTo(limiter)
 	limiter.SendsTo(decorator)
-	decorator.SendsTo(export)
+	last = decorator
+	// the filter expressions can refer to the fields that are set by the decorator
+	if f.flowFilter != nil {
+		filter := node.AsMiddle(f.flowFilter.Filter,
+			node.ChannelBufferLen(f.cfg.BuffersLength))
+		last.SendsTo(filter)
+		last = filter
+	}
+	// the sampling rates are adjusted from the flows that are actually exported
+	if f.sampling != nil {
+		counter := node.AsMiddle(f.sampling.Count,
+			node.ChannelBufferLen(f.cfg.BuffersLength))
+		last.SendsTo(counter)
+		last = counter
+		go f.sampling.run(ctx)
+	}
+	last.SendsTo(export)
 
 	alog.Debug("starting graph")
 	mapTracer.Start()
@@ -391,9 +616,15 @@ func (f *Flows) onInterfaceAdded(iface ifaces.Interface) {
 		return
 	}
 	alog.WithField("interface", iface).Info("interface detected. Registering flow ebpfFetcher")
-	if err := f.ebpf.Register(iface); err != nil {
+	f.registrations.register(iface)
+}
+
+func (f *Flows) onInterfaceDeleted(iface ifaces.Interface) {
+	alog.WithField("interface", iface).Info("interface deleted. Unregistering flow ebpfFetcher")
+	// the kernel automatically releases most of the attachments of a deleted interface, but
+	// the ebpfFetcher still needs to forget them and release the ones that remain
+	if err := f.registrations.unregister(iface); err != nil {
 		alog.WithField("interface", iface).WithError(err).
-			Warn("can't register flow ebpfFetcher. Ignoring")
-		return
+			Warn("can't unregister flow ebpfFetcher. Ignoring")
 	}
 }
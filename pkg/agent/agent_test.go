@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/caarlos0/env/v6"
 	"github.com/gavv/monotime"
 	test2 "github.com/mariomac/guara/pkg/test"
 	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
@@ -35,6 +36,19 @@ func TestFlowsAgent_InvalidConfigs(t *testing.T) {
 	}, {
 		d: "Kafka: missing brokers",
 		c: Config{Export: "kafka"},
+	}, {
+		d: "XDP: invalid mode",
+		c: Config{Export: "grpc", TargetHost: "flp", TargetPort: 3333, XDPInterfaces: []string{"eth0=foo"}},
+	}, {
+		d: "XDP: missing interface name",
+		c: Config{Export: "grpc", TargetHost: "flp", TargetPort: 3333, XDPInterfaces: []string{"=native"}},
+	}, {
+		d: "Tunnels: invalid type",
+		c: Config{Export: "grpc", TargetHost: "flp", TargetPort: 3333, DecapsulateTunnels: []string{"foo"}},
+	}, {
+		d: "Filter rules: invalid port range",
+		c: Config{Export: "grpc", TargetHost: "flp", TargetPort: 3333,
+			FlowFilterRules: FlowFilterRules{{CIDR: "10.0.0.0/8", Ports: "443-80"}}},
 	}} {
 		t.Run(tc.d, func(t *testing.T) {
 			_, err := FlowsAgent(&tc.c)
@@ -43,6 +57,67 @@ func TestFlowsAgent_InvalidConfigs(t *testing.T) {
 	}
 }
 
+func TestXDPModes(t *testing.T) {
+	modes, err := xdpModes(&Config{XDPInterfaces: []string{"eth0", "eth1=generic", " eth2=offload"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]ebpf.XDPMode{
+		"eth0": ebpf.XDPModeNative,
+		"eth1": ebpf.XDPModeGeneric,
+		"eth2": ebpf.XDPModeOffload,
+	}, modes)
+}
+
+func TestTunnelDecapsulation(t *testing.T) {
+	decap, err := tunnelDecapsulation(&Config{
+		DecapsulateTunnels: []string{"vxlan", " Geneve"},
+		VXLANPort:          8472,
+		GenevePort:         6081,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ebpf.TunnelDecapsulation{
+		Types:      []ebpf.TunnelType{ebpf.TunnelVXLAN, ebpf.TunnelGeneve},
+		VXLANPort:  8472,
+		GenevePort: 6081,
+	}, decap)
+}
+
+func TestFlowFilterRules(t *testing.T) {
+	t.Setenv("FLOW_FILTER_RULES", `[
+		{"cidr": "10.0.0.5/32", "protocol": "tcp", "ports": "8080", "action": "drop"},
+		{"cidr": "10.0.0.0/8", "ports": "443", "direction": "egress"},
+		{"cidr": "fd00::/16", "protocol": "132", "ports": "8000-8080", "action": "sample", "sampling": 10}
+	]`)
+	cfg := Config{}
+	require.NoError(t, env.Parse(&cfg))
+	rules, err := flowFilterRules(&cfg)
+	require.NoError(t, err)
+
+	_, host, _ := net.ParseCIDR("10.0.0.5/32")
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/8")
+	_, subnet6, _ := net.ParseCIDR("fd00::/16")
+	assert.Equal(t, []ebpf.FilterRule{{
+		CIDR: host, Action: ebpf.FilterDrop, Protocol: 6, PortStart: 8080, PortEnd: 8080,
+	}, {
+		CIDR: subnet, Action: ebpf.FilterAccept, PortStart: 443, PortEnd: 443,
+		Direction: ebpf.FilterEgress,
+	}, {
+		CIDR: subnet6, Action: ebpf.FilterSample, Sampling: 10, Protocol: 132,
+		PortStart: 8000, PortEnd: 8080,
+	}}, rules)
+
+	for _, invalid := range []FlowFilterRule{
+		{CIDR: "10.0.0.0"},
+		{CIDR: "10.0.0.0/8", Action: "foo"},
+		{CIDR: "10.0.0.0/8", Protocol: "foo"},
+		{CIDR: "10.0.0.0/8", Ports: "0"},
+		{CIDR: "10.0.0.0/8", Ports: "80-foo"},
+		{CIDR: "10.0.0.0/8", Direction: "foo"},
+	} {
+		_, err := flowFilterRules(&Config{FlowFilterRules: FlowFilterRules{invalid}})
+		assert.Errorf(t, err, "rule: %+v", invalid)
+	}
+}
+
 var (
 	key1 = ebpf.BpfFlowId{
 		SrcPort: 123,
@@ -200,6 +275,77 @@ func TestFlowsAgent_Decoration(t *testing.T) {
 	}
 }
 
+func TestFlowsAgent_FlowFilter(t *testing.T) {
+	export := testAgent(t, &Config{
+		CacheActiveTimeout:   10 * time.Millisecond,
+		CacheMaxFlows:        100,
+		FlowFilterExpression: `iface == "foo"`,
+	})
+
+	// the flows of the "bar" interface are filtered out after the decoration stage
+	exported := export.Get(t, timeout)
+	assert.Len(t, exported, 2)
+	for _, f := range exported {
+		assert.Equal(t, "foo", f.Interface)
+	}
+}
+
+func TestFlowsAgent_InvalidFlowFilter(t *testing.T) {
+	_, err := flowsAgent(&Config{FlowFilterExpression: `iface == foo`},
+		test.SliceInformerFake{}, test.NewTracerFake(), test.NewExporterFake().Export,
+		net.ParseIP(agentIP))
+	assert.Error(t, err)
+}
+
+func TestFlowsAgent_Biflows(t *testing.T) {
+	export := testAgent(t, &Config{
+		CacheActiveTimeout: 10 * time.Millisecond,
+		CacheMaxFlows:      100,
+		EnableBiflows:      true,
+		BiflowMergeWindow:  10 * time.Millisecond,
+	})
+
+	// the flows without reverse direction are exported as unidirectional flows after the window
+	exported := export.Get(t, timeout)
+	assert.Len(t, exported, 3)
+	for _, f := range exported {
+		assert.Nil(t, f.Reverse)
+	}
+
+	_, err := flowsAgent(&Config{EnableBiflows: true},
+		test.SliceInformerFake{}, test.NewTracerFake(), test.NewExporterFake().Export,
+		net.ParseIP(agentIP))
+	assert.Error(t, err)
+}
+
+func TestFlowsAgent_ConnectionTracking(t *testing.T) {
+	export := testAgent(t, &Config{
+		CacheActiveTimeout:        10 * time.Millisecond,
+		CacheMaxFlows:             100,
+		EnableConnectionTracking:  true,
+		ConnectionInactiveTimeout: time.Minute,
+		ConnectionActiveTimeout:   time.Minute,
+	})
+
+	// the first flows of the connections are exported immediately as start events
+	exported := export.Get(t, timeout)
+	assert.Len(t, exported, 3)
+	for _, f := range exported {
+		assert.Equal(t, flow.ConnEventStart, f.ConnEvent)
+		assert.Zero(t, f.FlowEndReason)
+	}
+
+	// the inactive timeout must be longer than the cache active timeout
+	_, err := flowsAgent(&Config{
+		CacheActiveTimeout:        time.Minute,
+		EnableConnectionTracking:  true,
+		ConnectionInactiveTimeout: 15 * time.Second,
+		ConnectionActiveTimeout:   time.Minute,
+	}, test.SliceInformerFake{}, test.NewTracerFake(), test.NewExporterFake().Export,
+		net.ParseIP(agentIP))
+	assert.Error(t, err)
+}
+
 func testAgent(t *testing.T, cfg *Config) *test.ExporterFake {
 	ebpfTracer := test.NewTracerFake()
 	export := test.NewExporterFake()
@@ -215,7 +361,7 @@ func testAgent(t *testing.T, cfg *Config) *test.ExporterFake {
 		require.NoError(t, agent.Run(context.Background()))
 	}()
 	test2.Eventually(t, timeout, func(t require.TestingT) {
-		require.Equal(t, StatusStarted, agent.status)
+		require.Equal(t, StatusStarted, agent.Status())
 	})
 
 	now := uint64(monotime.Now())
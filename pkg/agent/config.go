@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -17,9 +18,17 @@ const (
 	IPTypeIPV4 = "ipv4"
 	IPTypeIPV6 = "ipv6"
 
+	NetNSNone  = "none"
+	NetNSNamed = "named"
+	NetNSAll   = "all"
+
 	IPIfaceExternal    = "external"
 	IPIfaceLocal       = "local"
 	IPIfaceNamedPrefix = "name:"
+
+	FilterActionAccept = "accept"
+	FilterActionDrop   = "drop"
+	FilterActionSample = "sample"
 )
 
 type Config struct {
@@ -55,6 +64,69 @@ type Config struct {
 	// If an entry is enclosed by slashes (e.g. `/br-/`), it will match as regular expression,
 	// otherwise it will be matched as a case-sensitive string.
 	ExcludeInterfaces []string `env:"EXCLUDE_INTERFACES" envSeparator:"," envDefault:"lo"`
+	// XDPInterfaces contains the names of the interfaces whose ingress traffic is observed from an
+	// XDP program instead of the TC ingress hook, as a comma-separated list of name=mode entries
+	// (e.g. `eth0=native,eth1=generic`). Accepted modes: native (default if omitted), generic, or
+	// offload, which tries to offload the program into the NIC and falls back to the native and
+	// generic modes. The egress traffic of these interfaces is still observed from the TC hook.
+	XDPInterfaces []string `env:"XDP_INTERFACES" envSeparator:","`
+	// DecapsulateTunnels is a comma-separated list of the tunnel types whose encapsulated
+	// packets are parsed, so their flows are identified by the inner headers and record the
+	// tunnel type, endpoints and ID. One level of encapsulation is parsed.
+	// Accepted values: vxlan, geneve, gre (which includes NVGRE), ipip, sit (6in4). Default: none.
+	DecapsulateTunnels []string `env:"DECAPSULATE_TUNNELS" envSeparator:","`
+	// VXLANPort is the UDP destination port that identifies the VXLAN tunnels
+	VXLANPort uint16 `env:"VXLAN_PORT" envDefault:"4789"`
+	// GenevePort is the UDP destination port that identifies the Geneve tunnels
+	GenevePort uint16 `env:"GENEVE_PORT" envDefault:"6081"`
+	// CountTCPFlags enables the per-flow counters of the TCP packets with the SYN, FIN and RST
+	// flags, which are exported as the tcpSynTotalCount, tcpFinTotalCount and tcpRstTotalCount
+	// IPFIX elements, as well as the SYN and FIN retransmissions that are estimated from them.
+	// The TCP flags of the flows are always reported.
+	CountTCPFlags bool `env:"COUNT_TCP_FLAGS" envDefault:"false"`
+	// EnablePktDrops attributes the packets that are dropped by the kernel to their flows, which
+	// report the dropped packets and bytes, and the reason of the last drop. It requires a
+	// kernel with BTF information (Kernel >= 5.17).
+	EnablePktDrops bool `env:"ENABLE_PKT_DROPS" envDefault:"false"`
+	// EnableDNSTracking records the ID, flags and response code of the DNS messages of the flows,
+	// and the latency between the DNS queries and their responses.
+	EnableDNSTracking bool `env:"ENABLE_DNS_TRACKING" envDefault:"false"`
+	// DNSTrackingPort is the UDP and TCP port whose traffic is parsed as DNS messages
+	DNSTrackingPort uint16 `env:"DNS_TRACKING_PORT" envDefault:"53"`
+	// EnableTCPRetransmits counts the TCP retransmissions of the connections that are sent by the
+	// local host, and reports them in the flows of the same connection. It requires a kernel with
+	// BTF information (Kernel >= 5.5).
+	EnableTCPRetransmits bool `env:"ENABLE_TCP_RETRANSMITS" envDefault:"false"`
+	// EnableTCPSockSampling samples the smoothed round-trip time, the congestion window and the
+	// MSS of the local TCP sockets when they receive a segment, and reports their minimum, average
+	// and maximum in the flows that are sent from the local endpoint of the connection. It
+	// requires a kernel with BTF information (Kernel >= 5.9).
+	EnableTCPSockSampling bool `env:"ENABLE_TCP_SOCK_SAMPLING" envDefault:"false"`
+	// EnableProcessTracking attributes the TCP connections to the process, cgroup and container
+	// that own their local socket. Only the sockets that are created after the agent starts are
+	// attributed. It requires a kernel with BTF information (Kernel >= 5.11).
+	EnableProcessTracking bool `env:"ENABLE_PROCESS_TRACKING" envDefault:"false"`
+	// CgroupPath is the cgroup v2 directory whose processes are attributed to their connections,
+	// when EnableProcessTracking is true. If empty, the root of the cgroup v2 hierarchy is
+	// detected from the mount points, so all the processes of the host are attributed.
+	CgroupPath string `env:"CGROUP_PATH"`
+	// FlowFilterRules is a JSON list of rules that select the flows whose packets are accounted
+	// by the eBPF programs, e.g. [{"cidr":"10.0.0.0/8","ports":"443"},{"cidr":"0.0.0.0/0",
+	// "action":"drop"}]. If several rules match a flow, the first rule of the list applies.
+	// The packets of the flows that do not match any rule are accounted.
+	FlowFilterRules FlowFilterRules `env:"FLOW_FILTER_RULES"`
+	// FlowFilterExpression is a boolean expression over the fields of the flow records, e.g.
+	// `proto == 6 && dst_port in [80, 443] && !duplicate && iface =~ "^eth"`. It is evaluated
+	// in user space, after the flows are decorated, and the flows that do not match it are not
+	// exported. If empty, all the flows are exported.
+	FlowFilterExpression string `env:"FLOW_FILTER_EXPRESSION"`
+	// AttachRetryBackoff is the time to wait before retrying to attach the eBPF programs to an
+	// interface, after the first failed attempt. The time is doubled after each successive failed
+	// attempt, up to AttachRetryMaxBackoff.
+	AttachRetryBackoff time.Duration `env:"ATTACH_RETRY_BACKOFF" envDefault:"1s"`
+	// AttachRetryMaxBackoff is the maximum time to wait between attempts to attach the eBPF
+	// programs to an interface.
+	AttachRetryMaxBackoff time.Duration `env:"ATTACH_RETRY_MAX_BACKOFF" envDefault:"1m"`
 	// BuffersLength establishes the length of communication channels between the different processing
 	// stages
 	BuffersLength int `env:"BUFFERS_LENGTH" envDefault:"50"`
@@ -82,6 +154,22 @@ type Config struct {
 	DeduperFCExpiry time.Duration `env:"DEDUPER_FC_EXPIRY"`
 	// DeduperJustMark will just mark duplicates (boolean field) instead of dropping them.
 	DeduperJustMark bool `env:"DEDUPER_JUST_MARK"`
+	// EnableBiflows merges the flows of both directions of the same connection, as observed from
+	// the same interface, into bidirectional flows (RFC 5103).
+	EnableBiflows bool `env:"ENABLE_BIFLOWS"`
+	// BiflowMergeWindow is the maximum time that a flow waits for the flow of its reverse
+	// direction. After that time, it is exported as a unidirectional flow.
+	// If the value is not set, it will default to CacheActiveTimeout
+	BiflowMergeWindow time.Duration `env:"BIFLOW_MERGE_WINDOW"`
+	// EnableConnectionTracking tracks the connections of the flows across evictions, and reports
+	// their start, periodic updates and end as connection events.
+	EnableConnectionTracking bool `env:"ENABLE_CONNECTION_TRACKING"`
+	// ConnectionInactiveTimeout is the time after which a connection without new flows is
+	// reported as ended. It must be longer than CacheActiveTimeout.
+	ConnectionInactiveTimeout time.Duration `env:"CONNECTION_INACTIVE_TIMEOUT" envDefault:"15s"`
+	// ConnectionActiveTimeout is the period at which the flows of an ongoing connection are
+	// reported as connection updates.
+	ConnectionActiveTimeout time.Duration `env:"CONNECTION_ACTIVE_TIMEOUT" envDefault:"60s"`
 	// Direction allows selecting which flows to trace according to its direction. Accepted values
 	// are "ingress", "egress" or "both" (default).
 	Direction string `env:"DIRECTION" envDefault:"both"`
@@ -90,6 +178,18 @@ type Config struct {
 	// Sampling holds the rate at which packets should be sampled and sent to the target collector.
 	// E.g. if set to 100, one out of 100 packets, on average, will be sent to the target collector.
 	Sampling int `env:"SAMPLING" envDefault:"0"`
+	// SamplingRules is a JSON list of rules that set the sampling rate of the flows to some
+	// destinations, or of the flows of some interfaces, e.g. [{"cidr":"10.0.0.0/8","ports":"443",
+	// "sampling":10},{"interface":"/^veth/","sampling":50}]. The flows that do not match any rule
+	// are sampled at the Sampling rate.
+	SamplingRules SamplingRules `env:"SAMPLING_RULES"`
+	// SamplingTargetFlowsPerSecond is the maximum number of flows that should be exported per
+	// second. If set, the agent periodically multiplies all the sampling rates by the same factor,
+	// so the number of exported flows stays under the target. If 0, the rates are not adjusted.
+	SamplingTargetFlowsPerSecond int `env:"SAMPLING_TARGET_FLOWS_PER_SECOND"`
+	// SamplingAdjustPeriod is the period between each adjustment of the sampling rates, when
+	// SamplingTargetFlowsPerSecond is set.
+	SamplingAdjustPeriod time.Duration `env:"SAMPLING_ADJUST_PERIOD" envDefault:"30s"`
 	// ListenInterfaces specifies the mechanism used by the agent to listen for added or removed
 	// network interfaces. Accepted values are "watch" (default) or "poll".
 	// If the value is "watch", interfaces are traced immediately after they are created. This is
@@ -99,6 +199,16 @@ type Config struct {
 	// ListenPollPeriod specifies the periodicity to query the network interfaces when the
 	// ListenInterfaces value is set to "poll".
 	ListenPollPeriod time.Duration `env:"LISTEN_POLL_PERIOD" envDefault:"10s"`
+	// NetworkNamespaces specifies the network namespaces, other than the agent's own namespace,
+	// whose interfaces are also traced. Accepted values are "none" (default), "named" (the
+	// namespaces in /var/run/netns) or "all" (the named namespaces and the namespaces of the
+	// running processes, e.g. containers). The flows are tagged with the namespace of their
+	// interface. The agent needs access to the host's /var/run/netns and /proc directories.
+	NetworkNamespaces string `env:"NETWORK_NAMESPACES" envDefault:"none"`
+	// NetworkNamespacesPollPeriod specifies the periodicity to look for added or removed network
+	// namespaces when the ListenInterfaces value is set to "watch". If it is set to "poll", the
+	// namespaces are looked up every ListenPollPeriod.
+	NetworkNamespacesPollPeriod time.Duration `env:"NETWORK_NAMESPACES_POLL_PERIOD" envDefault:"5s"`
 	// KafkaBrokers is a comma-separated list of tha addresses of the brokers of the Kafka cluster
 	// that this agent is configured to send messages to.
 	KafkaBrokers []string `env:"KAFKA_BROKERS" envSeparator:","`
@@ -128,4 +238,59 @@ type Config struct {
 	KafkaTLSUserKeyPath string `env:"KAFKA_TLS_USER_KEY_PATH"`
 	// ProfilePort sets the listening port for Go's Pprof tool. If it is not set, profile is disabled
 	ProfilePort int `env:"PROFILE_PORT"`
+	// HealthPort sets the listening port of the health HTTP endpoint, which reports the agent
+	// status and the attach state of each network interface. If it is not set, the endpoint
+	// is disabled
+	HealthPort int `env:"HEALTH_PORT"`
+}
+
+// FlowFilterRule selects the flows whose packets are accounted, dropped or sampled by the eBPF
+// programs, before they are aggregated
+type FlowFilterRule struct {
+	// CIDR that contains the source or the destination address of the matching flows
+	CIDR string `json:"cidr"`
+	// Action over the packets of the matching flows. Accepted values are: accept (default), drop
+	// or sample.
+	Action string `json:"action,omitempty"`
+	// Sampling rate of the sample action: only 1 out of Sampling packets of the matching flows
+	// are accounted, on average. It is applied after the global Sampling rate.
+	Sampling uint32 `json:"sampling,omitempty"`
+	// Protocol is the transport protocol of the matching flows, by name (tcp, udp, sctp, icmp,
+	// icmpv6) or by number. Empty matches any protocol.
+	Protocol string `json:"protocol,omitempty"`
+	// Ports is the source or destination port of the matching flows, or a range of them
+	// (e.g. 8000-8080). Empty matches any port.
+	Ports string `json:"ports,omitempty"`
+	// Direction of the matching flows. Accepted values are: ingress, egress or both (default).
+	Direction string `json:"direction,omitempty"`
+}
+
+// FlowFilterRules is a list of filter rules that is parsed from its JSON representation
+type FlowFilterRules []FlowFilterRule
+
+func (r *FlowFilterRules) UnmarshalText(text []byte) error {
+	return json.Unmarshal(text, (*[]FlowFilterRule)(r))
+}
+
+// SamplingRule sets the sampling rate of the flows to a destination CIDR and port range, or of
+// the flows of the matching interfaces
+type SamplingRule struct {
+	// CIDR that contains the destination address of the matching flows. Empty matches any address.
+	CIDR string `json:"cidr,omitempty"`
+	// Ports is the destination port of the matching flows, or a range of them (e.g. 8000-8080).
+	// Empty matches any port.
+	Ports string `json:"ports,omitempty"`
+	// Interface name of the matching flows, or a regular expression between slashes
+	// (e.g. /^veth/). It can't be combined with a CIDR or ports.
+	Interface string `json:"interface,omitempty"`
+	// Sampling rate of the matching flows: only 1 out of Sampling packets are accounted, on
+	// average.
+	Sampling uint32 `json:"sampling"`
+}
+
+// SamplingRules is a list of sampling rules that is parsed from its JSON representation
+type SamplingRules []SamplingRule
+
+func (r *SamplingRules) UnmarshalText(text []byte) error {
+	return json.Unmarshal(text, (*[]SamplingRule)(r))
 }
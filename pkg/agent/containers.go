@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var clog = logrus.WithField("component", "agent.containerResolver")
+
+// minimum time between two scans of the cgroup hierarchy
+const cgroupRescanPeriod = 10 * time.Second
+
+// container runtimes name the cgroups of their containers after the 64 hexadecimal digits of
+// the container ID, e.g. docker-<id>.scope, cri-containerd-<id>.scope, crio-<id>.scope or
+// /docker/<id>
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// containerResolver finds the containers where the processes run, from the cgroups that the
+// runtimes create for them. The cgroup ID that is reported by the kernel is the inode number of
+// the cgroup directory in the cgroup v2 hierarchy.
+// It is not safe for concurrent access.
+type containerResolver struct {
+	// cgroupRoot is the directory of the cgroup hierarchy. If empty, the root of the cgroup v2
+	// hierarchy is detected on the first scan
+	cgroupRoot string
+	procRoot   string
+	detectRoot func() (string, error)
+	now        func() time.Time
+	lastScan   time.Time
+	// key: cgroup ID. Value: container ID, or empty if the cgroup does not belong to a container
+	containers map[uint64]string
+}
+
+func newContainerResolver(cgroupRoot string, detectRoot func() (string, error)) *containerResolver {
+	return &containerResolver{
+		cgroupRoot: cgroupRoot,
+		procRoot:   "/proc",
+		detectRoot: detectRoot,
+		now:        time.Now,
+		containers: map[uint64]string{},
+	}
+}
+
+// containerID returns the ID of the container of the given cgroup. The cgroup hierarchy is
+// scanned again if the cgroup is unknown. If the cgroup is not found (e.g. it has been already
+// removed), the container is looked up from the current cgroup of the process.
+func (c *containerResolver) containerID(cgroupID uint64, pid uint32) string {
+	if id, ok := c.containers[cgroupID]; ok {
+		return id
+	}
+	if c.now().Sub(c.lastScan) >= cgroupRescanPeriod {
+		c.scan()
+		if id, ok := c.containers[cgroupID]; ok {
+			return id
+		}
+	}
+	return c.fromProc(pid)
+}
+
+// scan rebuilds the cache from the current cgroup hierarchy. The container of each cgroup is
+// the last container ID in its path, as the nested cgroups of a container belong to it.
+func (c *containerResolver) scan() {
+	c.lastScan = c.now()
+	if c.cgroupRoot == "" {
+		root, err := c.detectRoot()
+		if err != nil {
+			clog.WithError(err).Warn("can't find the cgroup hierarchy. Ignoring containers")
+			return
+		}
+		c.cgroupRoot = root
+	}
+	containers := map[uint64]string{}
+	err := filepath.WalkDir(c.cgroupRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// the cgroup might have been removed during the walk
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			containers[stat.Ino] = lastContainerID(path)
+		}
+		return nil
+	})
+	if err != nil {
+		clog.WithError(err).Warn("can't scan the cgroup hierarchy")
+		return
+	}
+	c.containers = containers
+}
+
+// fromProc returns the container ID of the current cgroup of the process
+func (c *containerResolver) fromProc(pid uint32) string {
+	if pid == 0 {
+		return ""
+	}
+	cgroups, err := os.Open(filepath.Join(c.procRoot, strconv.FormatUint(uint64(pid), 10), "cgroup"))
+	if err != nil {
+		// the process already finished
+		return ""
+	}
+	defer cgroups.Close()
+	scanner := bufio.NewScanner(cgroups)
+	for scanner.Scan() {
+		// e.g. 0::/system.slice/docker-<id>.scope
+		if id := lastContainerID(scanner.Text()); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+func lastContainerID(path string) string {
+	ids := containerIDPattern.FindAllString(path, -1)
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[len(ids)-1]
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	containerID1 = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	containerID2 = "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+)
+
+func mkCgroup(t *testing.T, path string) uint64 {
+	require.NoError(t, os.MkdirAll(path, 0o755))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	return info.Sys().(*syscall.Stat_t).Ino
+}
+
+func TestContainerResolver(t *testing.T) {
+	root := t.TempDir()
+	hostCgroup := mkCgroup(t, filepath.Join(root, "system.slice", "sshd.service"))
+	podCgroup := mkCgroup(t, filepath.Join(root, "kubepods.slice", "kubepods-pod1.slice",
+		"cri-containerd-"+containerID1+".scope"))
+	nestedCgroup := mkCgroup(t, filepath.Join(root, "kubepods.slice", "kubepods-pod1.slice",
+		"cri-containerd-"+containerID1+".scope", "nested"))
+
+	now := time.Now()
+	cr := newContainerResolver(root, nil)
+	cr.now = func() time.Time { return now }
+
+	assert.Empty(t, cr.containerID(hostCgroup, 10))
+	assert.Equal(t, containerID1, cr.containerID(podCgroup, 11))
+	assert.Equal(t, containerID1, cr.containerID(nestedCgroup, 12))
+
+	// new cgroups are not scanned until the rescan period elapses
+	dockerCgroup := mkCgroup(t, filepath.Join(root, "system.slice", "docker-"+containerID2+".scope"))
+	assert.Empty(t, cr.containerID(dockerCgroup, 13))
+	now = now.Add(cgroupRescanPeriod)
+	assert.Equal(t, containerID2, cr.containerID(dockerCgroup, 13))
+}
+
+func TestContainerResolver_FromProc(t *testing.T) {
+	procRoot := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(procRoot, "42"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(procRoot, "42", "cgroup"),
+		[]byte("0::/system.slice/docker-"+containerID2+".scope\n"), 0o644))
+
+	cr := newContainerResolver("", func() (string, error) {
+		return "", errors.New("cgroup v2 hierarchy is not mounted")
+	})
+	cr.procRoot = procRoot
+
+	// unknown cgroups are looked up from the cgroups of the process
+	assert.Equal(t, containerID2, cr.containerID(1234, 42))
+	// unless the process does not exist anymore
+	assert.Empty(t, cr.containerID(1234, 43))
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
+)
+
+// transport protocols that can be referred by name in the filter rules
+var protocolNumbers = map[string]uint8{
+	"icmp":   1,
+	"tcp":    6,
+	"udp":    17,
+	"icmpv6": 58,
+	"sctp":   132,
+}
+
+// flowFilterRules returns the eBPF filter rules from the user-provided configuration
+func flowFilterRules(cfg *Config) ([]ebpf.FilterRule, error) {
+	rules := make([]ebpf.FilterRule, 0, len(cfg.FlowFilterRules))
+	for i := range cfg.FlowFilterRules {
+		rule, err := flowFilterRule(&cfg.FlowFilterRules[i])
+		if err != nil {
+			return nil, fmt.Errorf("FLOW_FILTER_RULES entry %d: %w", i, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func flowFilterRule(r *FlowFilterRule) (ebpf.FilterRule, error) {
+	rule := ebpf.FilterRule{Sampling: r.Sampling}
+	var err error
+	if _, rule.CIDR, err = net.ParseCIDR(r.CIDR); err != nil {
+		return rule, err
+	}
+	switch strings.ToLower(r.Action) {
+	case "", FilterActionAccept:
+		rule.Action = ebpf.FilterAccept
+	case FilterActionDrop:
+		rule.Action = ebpf.FilterDrop
+	case FilterActionSample:
+		rule.Action = ebpf.FilterSample
+	default:
+		return rule, fmt.Errorf("unknown action %q. Accepted values are: %s, %s or %s",
+			r.Action, FilterActionAccept, FilterActionDrop, FilterActionSample)
+	}
+	if r.Protocol != "" {
+		protocol, ok := protocolNumbers[strings.ToLower(r.Protocol)]
+		if !ok {
+			number, err := strconv.ParseUint(r.Protocol, 10, 8)
+			if err != nil {
+				return rule, fmt.Errorf("unknown protocol %q", r.Protocol)
+			}
+			protocol = uint8(number)
+		}
+		rule.Protocol = protocol
+	}
+	if r.Ports != "" {
+		if rule.PortStart, rule.PortEnd, err = portRange(r.Ports); err != nil {
+			return rule, err
+		}
+	}
+	switch strings.ToLower(r.Direction) {
+	case "", DirectionBoth:
+		rule.Direction = ebpf.FilterAnyDirection
+	case DirectionIngress:
+		rule.Direction = ebpf.FilterIngress
+	case DirectionEgress:
+		rule.Direction = ebpf.FilterEgress
+	default:
+		return rule, fmt.Errorf("unknown direction %q. Accepted values are: %s, %s or %s",
+			r.Direction, DirectionIngress, DirectionEgress, DirectionBoth)
+	}
+	return rule, nil
+}
+
+// portRange parses a single port (e.g. 443) or a range of ports (e.g. 8000-8080)
+func portRange(ports string) (start, end uint16, err error) {
+	first, last, isRange := strings.Cut(ports, "-")
+	s, err := strconv.ParseUint(strings.TrimSpace(first), 10, 16)
+	if err != nil || s == 0 {
+		return 0, 0, fmt.Errorf("invalid port range %q", ports)
+	}
+	if !isRange {
+		return uint16(s), uint16(s), nil
+	}
+	e, err := strconv.ParseUint(strings.TrimSpace(last), 10, 16)
+	if err != nil || e < s {
+		return 0, 0, fmt.Errorf("invalid port range %q", ports)
+	}
+	return uint16(s), uint16(e), nil
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/flow"
+)
+
+// healthReport is the JSON document returned by the health endpoint
+type healthReport struct {
+	Status string `json:"status"`
+	// FailedInterfaces is the number of interfaces where the eBPF programs couldn't be attached
+	FailedInterfaces int              `json:"failedInterfaces"`
+	Interfaces       []InterfaceState `json:"interfaces"`
+	// FlowFilter reports the number of flows that have matched, or not, the filter expression.
+	// It is omitted if no filter expression is configured
+	FlowFilter *flow.FilterStats `json:"flowFilter,omitempty"`
+	// Eviction reports the mode that is used to evict the aggregated flows map, and the number
+	// of evictions that have been performed in each mode
+	Eviction *ebpf.EvictionStats `json:"eviction,omitempty"`
+}
+
+// HealthHandler returns an HTTP handler that reports the agent status and the attach state of
+// the eBPF programs in each network interface, as well as the flow filter and the eviction
+// counters, in JSON format. It responds with a 503 (Service Unavailable) status code if the agent is not started.
+func (f *Flows) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		status := f.Status()
+		report := healthReport{
+			Status:     status.String(),
+			Interfaces: f.Interfaces(),
+		}
+		if f.flowFilter != nil {
+			stats := f.flowFilter.Stats()
+			report.FlowFilter = &stats
+		}
+		if f.ebpf != nil {
+			stats := f.ebpf.EvictionStats()
+			report.Eviction = &stats
+		}
+		for _, iface := range report.Interfaces {
+			if iface.State == AttachFailed {
+				report.FailedInterfaces++
+			}
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		if status != StatusStarted {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(rw).Encode(report); err != nil {
+			alog.WithError(err).Debug("can't write health report")
+		}
+	})
+}
@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ifaces"
+)
+
+var rlog = logrus.WithField("component", "agent.registrationManager")
+
+const (
+	defaultAttachRetryBackoff    = time.Second
+	defaultAttachRetryMaxBackoff = time.Minute
+)
+
+// AttachState of the eBPF programs in a network interface
+type AttachState int
+
+const (
+	// AttachPending means that the programs are being attached to the interface
+	AttachPending AttachState = iota
+	// AttachAttached means that the programs are successfully attached to the interface
+	AttachAttached
+	// AttachFailed means that the last attempt to attach the programs failed. The attachment
+	// will be retried later
+	AttachFailed
+)
+
+func (s AttachState) String() string {
+	switch s {
+	case AttachPending:
+		return "pending"
+	case AttachAttached:
+		return "attached"
+	case AttachFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+func (s AttachState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// InterfaceState reports the attach state of the eBPF programs in a network interface
+type InterfaceState struct {
+	Name  string `json:"name"`
+	Index int    `json:"index"`
+	// NetNS is the name of the network namespace of the interface. Empty for the agent's namespace
+	NetNS string      `json:"netns,omitempty"`
+	State AttachState `json:"state"`
+	// Reason of the last failed attempt, if the State is AttachFailed
+	Reason string `json:"reason,omitempty"`
+	// Attempts to attach the programs to the interface
+	Attempts int `json:"attempts"`
+	// NextRetry time, if the State is AttachFailed
+	NextRetry *time.Time `json:"nextRetry,omitempty"`
+}
+
+// registration of an interface, with its retry timer
+type registration struct {
+	state   InterfaceState
+	backoff time.Duration
+	retry   *time.Timer
+}
+
+// registrationManager attaches the eBPF programs to the network interfaces and keeps track of
+// their attach state. Failed attachments (e.g. due to transient netlink errors or interfaces
+// that are still coming up) are retried with exponential backoff, until they succeed or the
+// interface is removed.
+type registrationManager struct {
+	fetcher        ebpfFlowFetcher
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	// mt serializes the access to the registrations. It is not held while invoking the fetcher,
+	// which must be safe for concurrent access
+	mt            sync.Mutex
+	registrations map[ifaces.Interface]*registration
+	stopped       bool
+}
+
+func newRegistrationManager(fetcher ebpfFlowFetcher, initialBackoff, maxBackoff time.Duration) *registrationManager {
+	if initialBackoff <= 0 {
+		initialBackoff = defaultAttachRetryBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultAttachRetryMaxBackoff
+	}
+	if maxBackoff < initialBackoff {
+		maxBackoff = initialBackoff
+	}
+	return &registrationManager{
+		fetcher:        fetcher,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		registrations:  map[ifaces.Interface]*registration{},
+	}
+}
+
+// register attaches the eBPF programs to the interface, and schedules a retry if it fails
+func (rm *registrationManager) register(iface ifaces.Interface) {
+	rm.mt.Lock()
+	if rm.stopped {
+		rm.mt.Unlock()
+		return
+	}
+	if _, ok := rm.registrations[iface]; ok {
+		rm.mt.Unlock()
+		rlog.WithField("interface", iface).Debug("interface already registered. Ignoring")
+		return
+	}
+	reg := &registration{
+		state: InterfaceState{
+			Name:  iface.Name,
+			Index: iface.Index,
+			NetNS: iface.NetNS.Name,
+			State: AttachPending,
+		},
+		backoff: rm.initialBackoff,
+	}
+	rm.registrations[iface] = reg
+	rm.mt.Unlock()
+	rm.attempt(iface, reg)
+}
+
+// attempt to attach the eBPF programs to the interface. The mutex is released while the
+// programs are attached, as it might take long (e.g. when the programs are loaded for a new
+// network namespace), so the registration is discarded if the interface has been removed or
+// re-added in the meantime
+func (rm *registrationManager) attempt(iface ifaces.Interface, reg *registration) {
+	rm.mt.Lock()
+	if rm.stopped || rm.registrations[iface] != reg {
+		rm.mt.Unlock()
+		return
+	}
+	reg.state.Attempts++
+	reg.retry = nil
+	reg.state.NextRetry = nil
+	rm.mt.Unlock()
+
+	err := rm.fetcher.Register(iface)
+
+	ilog := rlog.WithField("interface", iface)
+	rm.mt.Lock()
+	current, registered := rm.registrations[iface]
+	if rm.stopped || current != reg {
+		// the interface was unregistered while the programs were being attached, so they are
+		// detached, unless the interface has been registered again or the agent is stopping
+		detach := err == nil && !registered && !rm.stopped
+		rm.mt.Unlock()
+		if detach {
+			if err := rm.fetcher.Unregister(iface); err != nil {
+				ilog.WithError(err).Debug("can't detach the eBPF programs of a removed interface")
+			}
+		}
+		return
+	}
+	defer rm.mt.Unlock()
+	if err == nil {
+		ilog.WithField("attempts", reg.state.Attempts).Debug("eBPF programs attached")
+		reg.state.State = AttachAttached
+		reg.state.Reason = ""
+		return
+	}
+	reg.state.State = AttachFailed
+	reg.state.Reason = err.Error()
+	next := time.Now().Add(reg.backoff)
+	reg.state.NextRetry = &next
+	ilog.WithError(err).WithFields(logrus.Fields{
+		"attempts": reg.state.Attempts,
+		"retryIn":  reg.backoff,
+	}).Warn("can't register flow ebpfFetcher. Retrying later")
+	reg.retry = time.AfterFunc(reg.backoff, func() {
+		rm.attempt(iface, reg)
+	})
+	reg.backoff *= 2
+	if reg.backoff > rm.maxBackoff {
+		reg.backoff = rm.maxBackoff
+	}
+}
+
+// unregister stops retrying the attachment of the interface and detaches the eBPF programs
+// from it
+func (rm *registrationManager) unregister(iface ifaces.Interface) error {
+	rm.mt.Lock()
+	reg, ok := rm.registrations[iface]
+	if !ok {
+		rm.mt.Unlock()
+		return nil
+	}
+	if reg.retry != nil {
+		reg.retry.Stop()
+	}
+	delete(rm.registrations, iface)
+	rm.mt.Unlock()
+	return rm.fetcher.Unregister(iface)
+}
+
+// stop cancels all the pending retries
+func (rm *registrationManager) stop() {
+	rm.mt.Lock()
+	defer rm.mt.Unlock()
+	rm.stopped = true
+	for _, reg := range rm.registrations {
+		if reg.retry != nil {
+			reg.retry.Stop()
+		}
+	}
+}
+
+// states returns the attach state of all the interfaces, sorted by network namespace and
+// interface index
+func (rm *registrationManager) states() []InterfaceState {
+	rm.mt.Lock()
+	defer rm.mt.Unlock()
+	states := make([]InterfaceState, 0, len(rm.registrations))
+	for _, reg := range rm.registrations {
+		state := reg.state
+		if state.NextRetry != nil {
+			next := *state.NextRetry
+			state.NextRetry = &next
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].NetNS != states[j].NetNS {
+			return states[i].NetNS < states[j].NetNS
+		}
+		if states[i].Index == states[j].Index {
+			return states[i].Name < states[j].Name
+		}
+		return states[i].Index < states[j].Index
+	})
+	return states
+}
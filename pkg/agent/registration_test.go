@@ -0,0 +1,235 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	test2 "github.com/mariomac/guara/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/flow"
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ifaces"
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/test"
+)
+
+// failingFetcher fails the first registration attempts of each interface
+type failingFetcher struct {
+	*test.TracerFake
+	// attaching, if not nil, receives the interfaces before they are registered, which is
+	// blocked until a value is sent to the attached channel
+	attaching  chan ifaces.Interface
+	attached   chan struct{}
+	mt         sync.Mutex
+	failures   map[ifaces.Interface]int
+	registered map[ifaces.Interface]int
+}
+
+func newFailingFetcher(failures map[ifaces.Interface]int) *failingFetcher {
+	return &failingFetcher{
+		TracerFake: test.NewTracerFake(),
+		failures:   failures,
+		registered: map[ifaces.Interface]int{},
+	}
+}
+
+func (f *failingFetcher) Register(iface ifaces.Interface) error {
+	if f.attaching != nil {
+		f.attaching <- iface
+		<-f.attached
+	}
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	if f.failures[iface] > 0 {
+		f.failures[iface]--
+		return errors.New("link not found")
+	}
+	f.registered[iface]++
+	return nil
+}
+
+func (f *failingFetcher) Unregister(iface ifaces.Interface) error {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	delete(f.registered, iface)
+	return nil
+}
+
+func (f *failingFetcher) registrations(iface ifaces.Interface) int {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	return f.registered[iface]
+}
+
+func TestRegistrationManager_Retries(t *testing.T) {
+	eth0 := ifaces.Interface{Name: "eth0", Index: 2}
+	veth := ifaces.Interface{Name: "veth1", Index: 3}
+	fetcher := newFailingFetcher(map[ifaces.Interface]int{veth: 2})
+	rm := newRegistrationManager(fetcher, 10*time.Millisecond, 20*time.Millisecond)
+	defer rm.stop()
+
+	rm.register(eth0)
+	rm.register(veth)
+
+	// the failed interface is reported with the failure reason
+	states := rm.states()
+	require.Len(t, states, 2)
+	assert.Equal(t, InterfaceState{Name: "eth0", Index: 2, State: AttachAttached, Attempts: 1}, states[0])
+	assert.Equal(t, "veth1", states[1].Name)
+	assert.Equal(t, AttachFailed, states[1].State)
+	assert.Equal(t, "link not found", states[1].Reason)
+	assert.Equal(t, 1, states[1].Attempts)
+	assert.NotNil(t, states[1].NextRetry)
+
+	// and eventually attached after retrying
+	test2.Eventually(t, timeout, func(t require.TestingT) {
+		states := rm.states()
+		require.Len(t, states, 2)
+		assert.Equal(t, InterfaceState{Name: "veth1", Index: 3, State: AttachAttached, Attempts: 3}, states[1])
+	})
+	assert.Equal(t, 1, fetcher.registrations(veth))
+	assert.Equal(t, 1, fetcher.registrations(eth0))
+}
+
+func TestRegistrationManager_StopRetryingDeletedInterfaces(t *testing.T) {
+	veth := ifaces.Interface{Name: "veth1", Index: 3}
+	fetcher := newFailingFetcher(map[ifaces.Interface]int{veth: 1})
+	rm := newRegistrationManager(fetcher, 50*time.Millisecond, time.Second)
+	defer rm.stop()
+
+	rm.register(veth)
+	require.NoError(t, rm.unregister(veth))
+	assert.Empty(t, rm.states())
+
+	// the interface is not registered after the retry time
+	time.Sleep(100 * time.Millisecond)
+	assert.Zero(t, fetcher.registrations(veth))
+	assert.Empty(t, rm.states())
+}
+
+func TestRegistrationManager_SlowAttachments(t *testing.T) {
+	eth0 := ifaces.Interface{Name: "eth0", Index: 2}
+	veth := ifaces.Interface{Name: "veth1", Index: 3}
+	fetcher := newFailingFetcher(map[ifaces.Interface]int{})
+	fetcher.attaching = make(chan ifaces.Interface)
+	fetcher.attached = make(chan struct{})
+	rm := newRegistrationManager(fetcher, time.Minute, time.Minute)
+	defer rm.stop()
+
+	registered := make(chan struct{})
+	go func() {
+		rm.register(eth0)
+		rm.register(veth)
+		close(registered)
+	}()
+
+	// the states can be reported, and the interfaces unregistered, while the programs are
+	// being attached
+	require.Equal(t, eth0, <-fetcher.attaching)
+	states := rm.states()
+	require.Len(t, states, 1)
+	assert.Equal(t, AttachPending, states[0].State)
+	assert.Equal(t, 1, states[0].Attempts)
+	require.NoError(t, rm.unregister(eth0))
+	assert.Empty(t, rm.states())
+	fetcher.attached <- struct{}{}
+
+	// the programs that are attached to an unregistered interface are detached
+	require.Equal(t, veth, <-fetcher.attaching)
+	states = rm.states()
+	require.Len(t, states, 1)
+	assert.Equal(t, "veth1", states[0].Name)
+	assert.Equal(t, AttachPending, states[0].State)
+	fetcher.attached <- struct{}{}
+	<-registered
+	assert.Zero(t, fetcher.registrations(eth0))
+	assert.Equal(t, 1, fetcher.registrations(veth))
+	assert.Equal(t, []InterfaceState{{Name: "veth1", Index: 3, State: AttachAttached, Attempts: 1}}, rm.states())
+}
+
+func TestHealthHandler(t *testing.T) {
+	veth := ifaces.Interface{Name: "veth1", Index: 3}
+	fetcher := newFailingFetcher(map[ifaces.Interface]int{veth: 1})
+	flows := &Flows{
+		registrations: newRegistrationManager(fetcher, time.Minute, time.Minute),
+	}
+	flows.setStatus(StatusStarted)
+	defer flows.registrations.stop()
+	flows.registrations.register(ifaces.Interface{Name: "eth0", Index: 2})
+	flows.registrations.register(veth)
+
+	rec := httptest.NewRecorder()
+	flows.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	report := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, "StatusStarted", report["status"])
+	assert.EqualValues(t, 1, report["failedInterfaces"])
+	interfaces := report["interfaces"].([]interface{})
+	require.Len(t, interfaces, 2)
+	assert.Equal(t, "attached", interfaces[0].(map[string]interface{})["state"])
+	assert.Equal(t, "failed", interfaces[1].(map[string]interface{})["state"])
+	assert.Equal(t, "link not found", interfaces[1].(map[string]interface{})["reason"])
+	// the flow filter counters are only reported if a filter expression is configured
+	assert.NotContains(t, report, "flowFilter")
+
+	flows.flowFilter, _ = flow.NewFilter("duplicate")
+	rec = httptest.NewRecorder()
+	flows.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	report = map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, map[string]interface{}{"matched": 0.0, "dropped": 0.0}, report["flowFilter"])
+	// the eviction mode and counters are reported once the eBPF maps are loaded
+	assert.NotContains(t, report, "eviction")
+
+	flows.ebpf = test.NewTracerFake()
+	rec = httptest.NewRecorder()
+	flows.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	report = map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, map[string]interface{}{"mode": "iterative", "batch": 0.0, "iterative": 0.0},
+		report["eviction"])
+
+	flows.setStatus(StatusStopping)
+	rec = httptest.NewRecorder()
+	flows.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestHealthHandler_WhileRunning(t *testing.T) {
+	// the health endpoint is queried while the agent changes its status and registers the
+	// interfaces, so this test can detect data races when it runs with the -race flag
+	agent, err := flowsAgent(&Config{CacheActiveTimeout: 10 * time.Millisecond, CacheMaxFlows: 1},
+		test.SliceInformerFake{{Name: "foo", Index: 3}, {Name: "bar", Index: 4}},
+		test.NewTracerFake(), test.NewExporterFake().Export, net.ParseIP(agentIP))
+	require.NoError(t, err)
+	handler := agent.HealthHandler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		assert.NoError(t, agent.Run(ctx))
+	}()
+	test2.Eventually(t, timeout, func(t require.TestingT) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	// the fake ring buffer never returns when the agent is closed, so the agent can't be
+	// completely stopped
+	cancel()
+	test2.Eventually(t, timeout, func(t require.TestingT) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/flow"
+)
+
+var smlog = logrus.WithField("component", "agent.samplingController")
+
+const (
+	// the sampling rates are relaxed when the exported flows per second are under this fraction
+	// of the target
+	samplingRelaxThreshold = 0.5
+	// maximum factor that multiplies the configured sampling rates
+	maxSamplingScale = 1 << 16
+)
+
+var interfaceRegexp = regexp.MustCompile("^/(.*)/$")
+
+// samplingRules returns the eBPF sampling rules from the user-provided configuration
+func samplingRules(cfg *Config) ([]ebpf.SamplingRule, error) {
+	rules := make([]ebpf.SamplingRule, 0, len(cfg.SamplingRules))
+	for i := range cfg.SamplingRules {
+		rule, err := samplingRule(&cfg.SamplingRules[i])
+		if err != nil {
+			return nil, fmt.Errorf("SAMPLING_RULES entry %d: %w", i, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func samplingRule(r *SamplingRule) (ebpf.SamplingRule, error) {
+	rule := ebpf.SamplingRule{Rate: r.Sampling}
+	var err error
+	if r.CIDR != "" {
+		if _, rule.CIDR, err = net.ParseCIDR(r.CIDR); err != nil {
+			return rule, err
+		}
+	}
+	if r.Ports != "" {
+		if rule.PortStart, rule.PortEnd, err = portRange(r.Ports); err != nil {
+			return rule, err
+		}
+	}
+	if definition := strings.TrimSpace(r.Interface); definition != "" {
+		// as in the INTERFACES property, a /regexp/ between slashes or an exact name
+		if sm := interfaceRegexp.FindStringSubmatch(definition); len(sm) > 1 {
+			if rule.Interface, err = regexp.Compile(sm[1]); err != nil {
+				return rule, fmt.Errorf("wrong interface regexp %q: %w", definition, err)
+			}
+		} else {
+			rule.Interface = regexp.MustCompile("^" + regexp.QuoteMeta(definition) + "$")
+		}
+	}
+	// the combination of the fields is validated by the eBPF tracer
+	return rule, nil
+}
+
+// samplingController periodically multiplies all the sampling rates of the eBPF programs by the
+// same scale factor, so the number of exported flows per second stays under a target
+type samplingController struct {
+	target   float64
+	period   time.Duration
+	setScale func(scale float64) error
+	scale    float64
+	// flows that have been exported since the last adjustment. It is accessed atomically
+	flows uint64
+}
+
+func newSamplingController(target int, period time.Duration, setScale func(float64) error) *samplingController {
+	return &samplingController{
+		target:   float64(target),
+		period:   period,
+		setScale: setScale,
+		scale:    1,
+	}
+}
+
+// Count forwards the flows to the next stage while counting them
+func (c *samplingController) Count(in <-chan []*flow.Record, out chan<- []*flow.Record) {
+	for records := range in {
+		atomic.AddUint64(&c.flows, uint64(len(records)))
+		out <- records
+	}
+}
+
+// run adjusts the sampling rates at every period until the context is canceled
+func (c *samplingController) run(ctx context.Context) {
+	ticker := time.NewTicker(c.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.adjust(c.period)
+		}
+	}
+}
+
+// adjust updates the scale factor from the number of flows that have been exported during the
+// elapsed time. The number of sampled packets is inversely proportional to the sampling rates,
+// but the number of flows decreases slower, so reaching the target might take several periods.
+func (c *samplingController) adjust(elapsed time.Duration) {
+	fps := float64(atomic.SwapUint64(&c.flows, 0)) / elapsed.Seconds()
+	scale := c.scale
+	switch {
+	case fps > c.target:
+		scale = math.Min(c.scale*fps/c.target, maxSamplingScale)
+	case fps < c.target*samplingRelaxThreshold:
+		scale = math.Max(c.scale/2, 1)
+	}
+	if scale == c.scale {
+		return
+	}
+	llog := smlog.WithFields(logrus.Fields{"flowsPerSecond": fps, "scale": scale})
+	if err := c.setScale(scale); err != nil {
+		llog.WithError(err).Warn("can't adjust the sampling rates")
+		return
+	}
+	llog.Info("sampling rates adjusted")
+	c.scale = scale
+}
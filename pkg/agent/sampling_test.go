@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/caarlos0/env/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/flow"
+)
+
+func TestSamplingRules(t *testing.T) {
+	t.Setenv("SAMPLING_RULES", `[
+		{"cidr": "10.0.0.0/8", "ports": "443", "sampling": 1},
+		{"ports": "8000-8080", "sampling": 20},
+		{"interface": "/^veth/", "sampling": 50},
+		{"interface": "br.0", "sampling": 5}
+	]`)
+	cfg := Config{}
+	require.NoError(t, env.Parse(&cfg))
+	rules, err := samplingRules(&cfg)
+	require.NoError(t, err)
+
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/8")
+	assert.Equal(t, []ebpf.SamplingRule{
+		{CIDR: subnet, PortStart: 443, PortEnd: 443, Rate: 1},
+		{PortStart: 8000, PortEnd: 8080, Rate: 20},
+		{Interface: regexp.MustCompile("^veth"), Rate: 50},
+		{Interface: regexp.MustCompile(`^br\.0$`), Rate: 5},
+	}, rules)
+
+	for _, invalid := range []SamplingRule{
+		{CIDR: "10.0.0.0", Sampling: 10},
+		{Ports: "0", Sampling: 10},
+		{Ports: "80-foo", Sampling: 10},
+		{Interface: "/(/", Sampling: 10},
+	} {
+		_, err := samplingRules(&Config{SamplingRules: SamplingRules{invalid}})
+		assert.Errorf(t, err, "rule: %+v", invalid)
+	}
+}
+
+func TestSamplingController_Adjust(t *testing.T) {
+	var scales []float64
+	c := newSamplingController(100, time.Second, func(scale float64) error {
+		scales = append(scales, scale)
+		return nil
+	})
+	count := func(flows int) {
+		in := make(chan []*flow.Record, 1)
+		out := make(chan []*flow.Record, 1)
+		in <- make([]*flow.Record, flows)
+		close(in)
+		c.Count(in, out)
+		assert.Len(t, <-out, flows)
+	}
+
+	// too many flows: the rates are multiplied by the excess
+	count(400)
+	c.adjust(2 * time.Second)
+	assert.Equal(t, []float64{2}, scales)
+
+	// between half the target and the target: the rates are kept
+	count(70)
+	c.adjust(time.Second)
+	assert.Equal(t, []float64{2}, scales)
+
+	// too few flows: the rates are relaxed, down to the configured ones
+	count(10)
+	c.adjust(time.Second)
+	c.adjust(time.Second)
+	assert.Equal(t, []float64{2, 1}, scales)
+
+	// the scale is not updated if the rates can't be stored
+	c.setScale = func(float64) error { return errors.New("boom") }
+	count(300)
+	c.adjust(time.Second)
+	assert.EqualValues(t, 1, c.scale)
+}
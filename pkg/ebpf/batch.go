@@ -0,0 +1,287 @@
+package ebpf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+// EvictionMode describes how the aggregated flows map is read and cleaned up from user space
+type EvictionMode string
+
+const (
+	// EvictionModeBatch reads and removes the map entries in chunks, with the
+	// BPF_MAP_LOOKUP_AND_DELETE_BATCH command (Kernel >= 5.6)
+	EvictionModeBatch EvictionMode = "batch"
+	// EvictionModeIterative iterates the map and removes its entries one by one
+	EvictionModeIterative EvictionMode = "iterative"
+)
+
+// batchSize is the maximum number of entries that are requested in a single batch syscall
+const batchSize = 4096
+
+const possibleCPUsFile = "/sys/devices/system/cpu/possible"
+
+// errENOTSUPP is the kernel-internal error that some BPF commands return when they are not
+// supported for a given map type. It is not defined in the unix package.
+const errENOTSUPP = unix.Errno(524)
+
+// nativeEndian is the byte order that the kernel uses to store the map keys and values
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	n := uint16(1)
+	if *(*byte)(unsafe.Pointer(&n)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// batchAttr mirrors the "batch" member of the bpf_attr union, from the kernel's uapi/linux/bpf.h
+type batchAttr struct {
+	inBatch   uint64
+	outBatch  uint64
+	keys      uint64
+	values    uint64
+	count     uint32
+	mapFD     uint32
+	elemFlags uint64
+	flags     uint64
+}
+
+// batchReader reads and deletes all the entries from the per-CPU aggregated flows map by
+// means of the BPF_MAP_LOOKUP_AND_DELETE_BATCH command, which the cilium/ebpf library
+// does not support for per-CPU maps.
+type batchReader struct {
+	keySize   int
+	valueSize int
+	// valueStride is the size of the value of each CPU in the batch values buffer,
+	// as the kernel aligns them to 8 bytes
+	valueStride int
+	nCPUs       int
+	keys        []byte
+	values      []byte
+	// the kernel uses the batch tokens to remember the next hash bucket to read
+	inBatch  []byte
+	outBatch []byte
+}
+
+func newBatchReader(flowMap *ebpf.Map, maxBatch int) (*batchReader, error) {
+	nCPUs, err := possibleCPUs()
+	if err != nil {
+		return nil, err
+	}
+	if maxBatch > batchSize || maxBatch <= 0 {
+		maxBatch = batchSize
+	}
+	keySize := int(flowMap.KeySize())
+	valueSize := int(flowMap.ValueSize())
+	valueStride := (valueSize + 7) &^ 7
+	return &batchReader{
+		keySize:     keySize,
+		valueSize:   valueSize,
+		valueStride: valueStride,
+		nCPUs:       nCPUs,
+		keys:        make([]byte, maxBatch*keySize),
+		values:      make([]byte, maxBatch*valueStride*nCPUs),
+		// a hash map batch token is an u32 bucket index. Allocating a full key
+		// is also safe for other map types
+		inBatch:  make([]byte, keySize),
+		outBatch: make([]byte, keySize),
+	}, nil
+}
+
+// lookupAndDelete reads and removes all the entries of the provided map, invoking the provided
+// function for each of them. The map must have the same key and value sizes as the map that
+// was used to create the batchReader.
+func (b *batchReader) lookupAndDelete(flowMap *ebpf.Map, forEach func(id *BpfFlowId, metrics []BpfFlowMetrics)) error {
+	maxCount := len(b.keys) / b.keySize
+	first := true
+	for {
+		attr := batchAttr{
+			outBatch: uint64(uintptr(unsafe.Pointer(&b.outBatch[0]))),
+			keys:     uint64(uintptr(unsafe.Pointer(&b.keys[0]))),
+			values:   uint64(uintptr(unsafe.Pointer(&b.values[0]))),
+			count:    uint32(maxCount),
+			mapFD:    uint32(flowMap.FD()),
+		}
+		if !first {
+			attr.inBatch = uint64(uintptr(unsafe.Pointer(&b.inBatch[0])))
+		}
+		_, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_MAP_LOOKUP_AND_DELETE_BATCH,
+			uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+		runtime.KeepAlive(b)
+		runtime.KeepAlive(flowMap)
+		// the kernel returns the number of read entries even if an error is returned
+		if err := b.decode(int(attr.count), forEach); err != nil {
+			return err
+		}
+		switch {
+		case errno == unix.ENOENT:
+			// the whole map has been read
+			return nil
+		case errno == unix.ENOSPC && attr.count == 0:
+			// a hash bucket has more entries than the buffers can store. Retrying
+			// from the same batch token with bigger buffers
+			b.grow()
+			maxCount = len(b.keys) / b.keySize
+			continue
+		case errno != 0:
+			return fmt.Errorf("BPF_MAP_LOOKUP_AND_DELETE_BATCH: %w", errno)
+		}
+		first = false
+		copy(b.inBatch, b.outBatch)
+	}
+}
+
+func (b *batchReader) grow() {
+	maxCount := 2 * len(b.keys) / b.keySize
+	b.keys = make([]byte, maxCount*b.keySize)
+	b.values = make([]byte, maxCount*b.valueStride*b.nCPUs)
+}
+
+func (b *batchReader) decode(count int, forEach func(id *BpfFlowId, metrics []BpfFlowMetrics)) error {
+	if count == 0 {
+		return nil
+	}
+	if b.keySize != flowIDSize || b.valueSize != flowMetricsSize {
+		return fmt.Errorf("unexpected key/value sizes %d/%d. Expected %d/%d",
+			b.keySize, b.valueSize, flowIDSize, flowMetricsSize)
+	}
+	for i := 0; i < count; i++ {
+		id := BpfFlowId{}
+		decodeFlowID(b.keys[i*b.keySize:(i+1)*b.keySize], &id)
+		metrics := make([]BpfFlowMetrics, b.nCPUs)
+		valuesOffset := i * b.valueStride * b.nCPUs
+		for c := 0; c < b.nCPUs; c++ {
+			start := valuesOffset + c*b.valueStride
+			decodeFlowMetrics(b.values[start:start+b.valueSize], &metrics[c])
+		}
+		forEach(&id, metrics)
+	}
+	return nil
+}
+
+// flowIDSize and flowMetricsSize are the sizes of the packed flow_id and flow_metrics C structs
+var (
+	flowIDSize      = binary.Size(BpfFlowId{})
+	flowMetricsSize = binary.Size(BpfFlowMetrics{})
+)
+
+// decodeFlowID reads the packed flow_id C struct. It is equivalent to binary.Read, which
+// is too slow for the large maps as it relies on reflection. It must be updated if the
+// struct changes. The provided buffer must have flowIDSize bytes.
+func decodeFlowID(b []byte, id *BpfFlowId) {
+	_ = b[flowIDSize-1]
+	id.EthProtocol = nativeEndian.Uint16(b[0:])
+	id.Direction = b[2]
+	copy(id.SrcMac[:], b[3:9])
+	copy(id.DstMac[:], b[9:15])
+	id.VlanId = nativeEndian.Uint16(b[15:])
+	id.InnerVlanId = nativeEndian.Uint16(b[17:])
+	copy(id.SrcIp[:], b[19:35])
+	copy(id.DstIp[:], b[35:51])
+	id.SrcPort = nativeEndian.Uint16(b[51:])
+	id.DstPort = nativeEndian.Uint16(b[53:])
+	id.TransportProtocol = b[55]
+	id.IcmpType = b[56]
+	id.IcmpCode = b[57]
+	id.NonFirstFragment = b[58]
+	id.IfIndex = nativeEndian.Uint32(b[59:])
+	id.IfNetns = nativeEndian.Uint32(b[63:])
+	id.TunnelType = b[67]
+	copy(id.TunnelSrcIp[:], b[68:84])
+	copy(id.TunnelDstIp[:], b[84:100])
+	id.TunnelId = nativeEndian.Uint32(b[100:])
+}
+
+// decodeFlowMetrics reads the packed flow_metrics C struct. It is equivalent to binary.Read,
+// which is too slow for the large maps as it relies on reflection. It must be updated if the
+// struct changes. The provided buffer must have flowMetricsSize bytes.
+func decodeFlowMetrics(b []byte, m *BpfFlowMetrics) {
+	_ = b[flowMetricsSize-1]
+	m.Packets = nativeEndian.Uint32(b[0:])
+	m.Bytes = nativeEndian.Uint64(b[4:])
+	m.StartMonoTimeTs = nativeEndian.Uint64(b[12:])
+	m.ConnMonoTimeTs = nativeEndian.Uint64(b[20:])
+	m.EndMonoTimeTs = nativeEndian.Uint64(b[28:])
+	m.Flags = nativeEndian.Uint16(b[36:])
+	m.FragmentedPackets = nativeEndian.Uint32(b[38:])
+	m.SynPackets = nativeEndian.Uint32(b[42:])
+	m.FinPackets = nativeEndian.Uint32(b[46:])
+	m.RstPackets = nativeEndian.Uint32(b[50:])
+	m.DroppedPackets = nativeEndian.Uint32(b[54:])
+	m.DroppedBytes = nativeEndian.Uint64(b[58:])
+	m.DropReason = nativeEndian.Uint32(b[66:])
+	m.DnsId = nativeEndian.Uint16(b[70:])
+	m.DnsFlags = nativeEndian.Uint16(b[72:])
+	m.DnsMonoTimeTs = nativeEndian.Uint64(b[74:])
+	m.Retransmits = nativeEndian.Uint32(b[82:])
+	m.Sampling = nativeEndian.Uint32(b[86:])
+	m.Errno = b[90]
+}
+
+// batchLookupAndDeleteSupported checks whether the kernel supports the batch lookup-and-delete
+// command over per-CPU hash maps, by running it against an empty test map.
+func batchLookupAndDeleteSupported() (bool, error) {
+	probe, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "batch_probe",
+		Type:       ebpf.PerCPUHash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		return false, fmt.Errorf("creating probe map: %w", err)
+	}
+	defer probe.Close()
+	reader, err := newBatchReader(probe, 1)
+	if err != nil {
+		return false, err
+	}
+	err = reader.lookupAndDelete(probe, func(_ *BpfFlowId, _ []BpfFlowMetrics) {})
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, unix.EINVAL), errors.Is(err, errENOTSUPP), errors.Is(err, unix.EOPNOTSUPP):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// possibleCPUs returns the number of CPUs that the kernel uses to size the per-CPU map values
+func possibleCPUs() (int, error) {
+	content, err := os.ReadFile(possibleCPUsFile)
+	if err != nil {
+		return 0, fmt.Errorf("reading possible CPUs: %w", err)
+	}
+	return parseCPUList(strings.TrimSpace(string(content)))
+}
+
+// parseCPUList returns the number of CPUs from a list with the format of the
+// /sys/devices/system/cpu/possible file (e.g. "0-3,6,8-11"). Since the per-CPU values
+// are indexed by CPU ID, it returns the highest ID plus one.
+func parseCPUList(list string) (int, error) {
+	highest := -1
+	for _, cpuRange := range strings.Split(list, ",") {
+		limits := strings.Split(cpuRange, "-")
+		if len(limits) > 2 {
+			return 0, fmt.Errorf("invalid CPU range %q", cpuRange)
+		}
+		last, err := strconv.Atoi(limits[len(limits)-1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid CPU range %q: %w", cpuRange, err)
+		}
+		if last > highest {
+			highest = last
+		}
+	}
+	return highest + 1, nil
+}
@@ -0,0 +1,127 @@
+package ebpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCPUList(t *testing.T) {
+	for _, tc := range []struct {
+		list string
+		cpus int
+	}{
+		{list: "0", cpus: 1},
+		{list: "0-7", cpus: 8},
+		{list: "0-3,6,8-11", cpus: 12},
+	} {
+		t.Run(tc.list, func(t *testing.T) {
+			cpus, err := parseCPUList(tc.list)
+			require.NoError(t, err)
+			assert.Equal(t, tc.cpus, cpus)
+		})
+	}
+	_, err := parseCPUList("0-3-4")
+	assert.Error(t, err)
+	_, err = parseCPUList("a-b")
+	assert.Error(t, err)
+}
+
+func TestBatchReaderDecode(t *testing.T) {
+	id1 := BpfFlowId{EthProtocol: 0x0800, SrcPort: 1234, DstPort: 80, TransportProtocol: 6, IfIndex: 3}
+	id2 := BpfFlowId{EthProtocol: 0x86dd, SrcPort: 4321, DstPort: 443, TransportProtocol: 17, IfIndex: 4}
+	metrics1 := []BpfFlowMetrics{
+		{Packets: 1, Bytes: 100, StartMonoTimeTs: 10, EndMonoTimeTs: 20, Flags: 0x12},
+		{Packets: 2, Bytes: 200, StartMonoTimeTs: 15, EndMonoTimeTs: 25, Errno: 3},
+	}
+	metrics2 := []BpfFlowMetrics{
+		{}, {Packets: 3, Bytes: 300, StartMonoTimeTs: 30, EndMonoTimeTs: 40},
+	}
+
+	// emulates the layout of the buffers that are returned by the kernel, with the
+	// per-CPU values aligned to 8 bytes
+	reader := &batchReader{
+		keySize:     binary.Size(BpfFlowId{}),
+		valueSize:   binary.Size(BpfFlowMetrics{}),
+		valueStride: (binary.Size(BpfFlowMetrics{}) + 7) &^ 7,
+		nCPUs:       2,
+	}
+	keys := bytes.Buffer{}
+	values := bytes.Buffer{}
+	for i, id := range []BpfFlowId{id1, id2} {
+		require.NoError(t, binary.Write(&keys, nativeEndian, id))
+		for _, m := range [][]BpfFlowMetrics{metrics1, metrics2}[i] {
+			require.NoError(t, binary.Write(&values, nativeEndian, m))
+			values.Write(make([]byte, reader.valueStride-reader.valueSize))
+		}
+	}
+	reader.keys = keys.Bytes()
+	reader.values = values.Bytes()
+
+	flows := map[BpfFlowId][]BpfFlowMetrics{}
+	require.NoError(t, reader.decode(2, func(id *BpfFlowId, metrics []BpfFlowMetrics) {
+		flows[*id] = metrics
+	}))
+	assert.Equal(t, map[BpfFlowId][]BpfFlowMetrics{
+		id1: metrics1,
+		id2: metrics2,
+	}, flows)
+}
+
+func TestDecodeFlow(t *testing.T) {
+	// all the fields are set, so any wrong offset is detected
+	id := BpfFlowId{
+		EthProtocol: 0x86dd, Direction: 1,
+		SrcMac: [6]uint8{1, 2, 3, 4, 5, 6}, DstMac: [6]uint8{7, 8, 9, 10, 11, 12},
+		VlanId: 13, InnerVlanId: 14,
+		SrcIp: [16]uint8{15, 16, 17}, DstIp: [16]uint8{18, 19, 20},
+		SrcPort: 21, DstPort: 22, TransportProtocol: 23, IcmpType: 24, IcmpCode: 25,
+		NonFirstFragment: 26, IfIndex: 27, IfNetns: 28, TunnelType: 29,
+		TunnelSrcIp: [16]uint8{30, 31}, TunnelDstIp: [16]uint8{32, 33}, TunnelId: 34,
+	}
+	metrics := BpfFlowMetrics{
+		Packets: 1, Bytes: 2, StartMonoTimeTs: 3, ConnMonoTimeTs: 4, EndMonoTimeTs: 5, Flags: 6,
+		FragmentedPackets: 7, SynPackets: 8, FinPackets: 9, RstPackets: 10, DroppedPackets: 11,
+		DroppedBytes: 12, DropReason: 13, DnsId: 14, DnsFlags: 15, DnsMonoTimeTs: 16,
+		Retransmits: 17, Sampling: 18, Errno: 19,
+	}
+	encoded := bytes.Buffer{}
+	require.NoError(t, binary.Write(&encoded, nativeEndian, id))
+	decodedID := BpfFlowId{}
+	decodeFlowID(encoded.Bytes(), &decodedID)
+	assert.Equal(t, id, decodedID)
+
+	encoded.Reset()
+	require.NoError(t, binary.Write(&encoded, nativeEndian, metrics))
+	decodedMetrics := BpfFlowMetrics{}
+	decodeFlowMetrics(encoded.Bytes(), &decodedMetrics)
+	assert.Equal(t, metrics, decodedMetrics)
+}
+
+func TestDecodeFlow_RandomBytes(t *testing.T) {
+	// every byte of the structs is random, so any field with a wrong offset or size is detected
+	// by comparing the decoded structs with the ones that are read by binary.Read
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < 100; i++ {
+		encoded := make([]byte, flowIDSize)
+		rnd.Read(encoded)
+		expectedID := BpfFlowId{}
+		require.NoError(t, binary.Read(bytes.NewReader(encoded), nativeEndian, &expectedID))
+		decodedID := BpfFlowId{}
+		decodeFlowID(encoded, &decodedID)
+		require.Equal(t, expectedID, decodedID, "encoded flow id: %x", encoded)
+
+		encoded = make([]byte, flowMetricsSize)
+		rnd.Read(encoded)
+		expectedMetrics := BpfFlowMetrics{}
+		require.NoError(t, binary.Read(bytes.NewReader(encoded), nativeEndian, &expectedMetrics))
+		decodedMetrics := BpfFlowMetrics{}
+		decodeFlowMetrics(encoded, &decodedMetrics)
+		require.Equal(t, expectedMetrics, decodedMetrics, "encoded flow metrics: %x", encoded)
+	}
+}
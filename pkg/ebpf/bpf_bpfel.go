@@ -13,6 +13,28 @@ import (
 	"github.com/cilium/ebpf"
 )
 
+type BpfFilterKey BpfFilterKeyT
+
+type BpfFilterKeyT struct {
+	PrefixLen uint32
+	Ip        [16]uint8
+}
+
+type BpfFilterRules BpfFilterRulesT
+
+type BpfFilterRulesT struct {
+	Count uint8
+	Rules [8]struct {
+		Priority   uint16
+		Action     uint8
+		Directions uint8
+		Protocol   uint8
+		PortStart  uint16
+		PortEnd    uint16
+		Sampling   uint32
+	}
+}
+
 type BpfFlowId BpfFlowIdT
 
 type BpfFlowIdT struct {
@@ -20,6 +42,8 @@ type BpfFlowIdT struct {
 	Direction         uint8
 	SrcMac            [6]uint8
 	DstMac            [6]uint8
+	VlanId            uint16
+	InnerVlanId       uint16
 	SrcIp             [16]uint8
 	DstIp             [16]uint8
 	SrcPort           uint16
@@ -27,19 +51,37 @@ type BpfFlowIdT struct {
 	TransportProtocol uint8
 	IcmpType          uint8
 	IcmpCode          uint8
+	NonFirstFragment  uint8
 	IfIndex           uint32
+	IfNetns           uint32
+	TunnelType        uint8
+	TunnelSrcIp       [16]uint8
+	TunnelDstIp       [16]uint8
+	TunnelId          uint32
 }
 
 type BpfFlowMetrics BpfFlowMetricsT
 
 type BpfFlowMetricsT struct {
-	Packets         uint32
-	Bytes           uint64
-	StartMonoTimeTs uint64
-	ConnMonoTimeTs  uint64
-	EndMonoTimeTs   uint64
-	Flags           uint16
-	Errno           uint8
+	Packets           uint32
+	Bytes             uint64
+	StartMonoTimeTs   uint64
+	ConnMonoTimeTs    uint64
+	EndMonoTimeTs     uint64
+	Flags             uint16
+	FragmentedPackets uint32
+	SynPackets        uint32
+	FinPackets        uint32
+	RstPackets        uint32
+	DroppedPackets    uint32
+	DroppedBytes      uint64
+	DropReason        uint32
+	DnsId             uint16
+	DnsFlags          uint16
+	DnsMonoTimeTs     uint64
+	Retransmits       uint32
+	Sampling          uint32
+	Errno             uint8
 }
 
 type BpfFlowRecordT struct {
@@ -47,6 +89,45 @@ type BpfFlowRecordT struct {
 	Metrics BpfFlowMetrics
 }
 
+type BpfFragmentKey struct {
+	SrcIp             [16]uint8
+	DstIp             [16]uint8
+	Identification    uint32
+	TransportProtocol uint8
+}
+
+type BpfFragmentL4 struct {
+	SrcPort  uint16
+	DstPort  uint16
+	IcmpType uint8
+	IcmpCode uint8
+}
+
+type BpfInterfaceKey BpfInterfaceKeyT
+
+type BpfInterfaceKeyT struct {
+	IfIndex uint32
+	IfNetns uint32
+}
+
+type BpfSamplingKey BpfSamplingKeyT
+
+type BpfSamplingKeyT struct {
+	PrefixLen uint32
+	Ip        [16]uint8
+}
+
+type BpfSamplingRules BpfSamplingRulesT
+
+type BpfSamplingRulesT struct {
+	Count uint8
+	Rules [8]struct {
+		PortStart uint16
+		PortEnd   uint16
+		Rate      uint32
+	}
+}
+
 // LoadBpf returns the embedded CollectionSpec for Bpf.
 func LoadBpf() (*ebpf.CollectionSpec, error) {
 	reader := bytes.NewReader(_BpfBytes)
@@ -88,16 +169,27 @@ type BpfSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type BpfProgramSpecs struct {
-	EgressFlowParse  *ebpf.ProgramSpec `ebpf:"egress_flow_parse"`
-	IngressFlowParse *ebpf.ProgramSpec `ebpf:"ingress_flow_parse"`
+	EgressFlowParse     *ebpf.ProgramSpec `ebpf:"egress_flow_parse"`
+	IngressFlowParse    *ebpf.ProgramSpec `ebpf:"ingress_flow_parse"`
+	XdpIngressFlowParse *ebpf.ProgramSpec `ebpf:"xdp_ingress_flow_parse"`
 }
 
 // BpfMapSpecs contains maps before they are loaded into the kernel.
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type BpfMapSpecs struct {
-	AggregatedFlows *ebpf.MapSpec `ebpf:"aggregated_flows"`
-	DirectFlows     *ebpf.MapSpec `ebpf:"direct_flows"`
+	ActiveFlows       *ebpf.MapSpec `ebpf:"active_flows"`
+	AggregatedFlows0  *ebpf.MapSpec `ebpf:"aggregated_flows_0"`
+	AggregatedFlows1  *ebpf.MapSpec `ebpf:"aggregated_flows_1"`
+	DefaultSampling   *ebpf.MapSpec `ebpf:"default_sampling"`
+	DirectFlows       *ebpf.MapSpec `ebpf:"direct_flows"`
+	EvaluatedFlow     *ebpf.MapSpec `ebpf:"evaluated_flow"`
+	EvaluatedRate     *ebpf.MapSpec `ebpf:"evaluated_rate"`
+	FilterRulesMap    *ebpf.MapSpec `ebpf:"filter_rules_map"`
+	Fragments         *ebpf.MapSpec `ebpf:"fragments"`
+	InterfaceSampling *ebpf.MapSpec `ebpf:"interface_sampling"`
+	PacketNetns       *ebpf.MapSpec `ebpf:"packet_netns"`
+	SamplingRulesMap  *ebpf.MapSpec `ebpf:"sampling_rules_map"`
 }
 
 // BpfObjects contains all objects after they have been loaded into the kernel.
@@ -119,14 +211,34 @@ func (o *BpfObjects) Close() error {
 //
 // It can be passed to LoadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type BpfMaps struct {
-	AggregatedFlows *ebpf.Map `ebpf:"aggregated_flows"`
-	DirectFlows     *ebpf.Map `ebpf:"direct_flows"`
+	ActiveFlows       *ebpf.Map `ebpf:"active_flows"`
+	AggregatedFlows0  *ebpf.Map `ebpf:"aggregated_flows_0"`
+	AggregatedFlows1  *ebpf.Map `ebpf:"aggregated_flows_1"`
+	DefaultSampling   *ebpf.Map `ebpf:"default_sampling"`
+	DirectFlows       *ebpf.Map `ebpf:"direct_flows"`
+	EvaluatedFlow     *ebpf.Map `ebpf:"evaluated_flow"`
+	EvaluatedRate     *ebpf.Map `ebpf:"evaluated_rate"`
+	FilterRulesMap    *ebpf.Map `ebpf:"filter_rules_map"`
+	Fragments         *ebpf.Map `ebpf:"fragments"`
+	InterfaceSampling *ebpf.Map `ebpf:"interface_sampling"`
+	PacketNetns       *ebpf.Map `ebpf:"packet_netns"`
+	SamplingRulesMap  *ebpf.Map `ebpf:"sampling_rules_map"`
 }
 
 func (m *BpfMaps) Close() error {
 	return _BpfClose(
-		m.AggregatedFlows,
+		m.ActiveFlows,
+		m.AggregatedFlows0,
+		m.AggregatedFlows1,
+		m.DefaultSampling,
 		m.DirectFlows,
+		m.EvaluatedFlow,
+		m.EvaluatedRate,
+		m.FilterRulesMap,
+		m.Fragments,
+		m.InterfaceSampling,
+		m.PacketNetns,
+		m.SamplingRulesMap,
 	)
 }
 
@@ -134,14 +246,16 @@ func (m *BpfMaps) Close() error {
 //
 // It can be passed to LoadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type BpfPrograms struct {
-	EgressFlowParse  *ebpf.Program `ebpf:"egress_flow_parse"`
-	IngressFlowParse *ebpf.Program `ebpf:"ingress_flow_parse"`
+	EgressFlowParse     *ebpf.Program `ebpf:"egress_flow_parse"`
+	IngressFlowParse    *ebpf.Program `ebpf:"ingress_flow_parse"`
+	XdpIngressFlowParse *ebpf.Program `ebpf:"xdp_ingress_flow_parse"`
 }
 
 func (p *BpfPrograms) Close() error {
 	return _BpfClose(
 		p.EgressFlowParse,
 		p.IngressFlowParse,
+		p.XdpIngressFlowParse,
 	)
 }
 
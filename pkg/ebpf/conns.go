@@ -0,0 +1,46 @@
+package ebpf
+
+import (
+	"errors"
+
+	"github.com/cilium/ebpf"
+)
+
+// ConnId identifies a TCP connection in the maps of the programs that hook on to the TCP stack,
+// from the local to the remote endpoint. Its fields have the same values and encoding as the
+// BpfFlowId fields with the same name.
+type ConnId = RetransConnId
+
+// lookupAndDeleteConns reads all the entries of a map whose key is the connection identifier,
+// and removes them. If the kernel supports it (Kernel>=5.14), each entry is atomically read and
+// removed. Otherwise, the updates that happen between reading and removing an entry are lost.
+func lookupAndDeleteConns[V any](connMap *ebpf.Map) map[ConnId]V {
+	// the keys are read before removing them, as deleting the current key of an iteration
+	// restarts it from the beginning of the hash map
+	var ids []ConnId
+	iterator := connMap.Iterate()
+	id := ConnId{}
+	var value V
+	for iterator.Next(&id, &value) {
+		ids = append(ids, id)
+	}
+	if err := iterator.Err(); err != nil {
+		log.WithError(err).WithField("map", connMap.String()).Warn("couldn't iterate the map")
+	}
+	entries := make(map[ConnId]V, len(ids))
+	for _, id := range ids {
+		err := connMap.LookupAndDelete(id, &value)
+		if errors.Is(err, ebpf.ErrNotSupported) {
+			if err = connMap.Lookup(id, &value); err == nil {
+				err = connMap.Delete(id)
+			}
+		}
+		if err != nil {
+			log.WithError(err).WithField("connection", id).
+				Debug("couldn't read and delete connection entry")
+			continue
+		}
+		entries[id] = value
+	}
+	return entries
+}
@@ -0,0 +1,129 @@
+package ebpf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/link"
+)
+
+// $BPF_CLANG and $BPF_CFLAGS are set by the Makefile.
+//go:generate bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS Drops ../../bpf/pkt_drops.c -- -I../../bpf/headers
+
+const (
+	// constants defined in pkt_drops.c as "volatile const"
+	constMinDropReason = "min_drop_reason"
+	// dropReasonEnum is the kernel enum whose values are the reasons of the packet drops
+	dropReasonEnum         = "skb_drop_reason"
+	dropReasonPrefix       = "SKB_DROP_REASON_"
+	dropReasonNotSpecified = dropReasonPrefix + "NOT_SPECIFIED"
+)
+
+// dropsTracer attributes the packets that are dropped by the kernel to their flows, from a
+// program that is attached to the skb:kfree_skb tracepoint
+type dropsTracer struct {
+	objects DropsObjects
+	link    link.Link
+}
+
+// newDropsTracer loads and attaches the packet drops program. It shares the flow maps with the
+// provided flows objects, including the filter rules if filterFlows is true. The drops of the
+// tunnel packets that the flows programs decapsulate are ignored.
+func newDropsTracer(
+	flows *BpfObjects, cacheMaxSize int, filterFlows bool, tunnels TunnelDecapsulation,
+) (*dropsTracer, error) {
+	reasons, err := kernelDropReasons()
+	if err != nil {
+		return nil, err
+	}
+	minReason := uint32(0)
+	for _, reason := range reasons {
+		if reason.Name == dropReasonNotSpecified {
+			minReason = uint32(reason.Value)
+		}
+	}
+	agentNetNS, err := agentNetNSInode()
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := LoadDrops()
+	if err != nil {
+		return nil, fmt.Errorf("loading packet drops BPF data: %w", err)
+	}
+	// the map specs must match the maps that are replaced by the flows maps
+	for _, name := range aggregatedFlowsMaps {
+		spec.Maps[name].MaxEntries = uint32(cacheMaxSize)
+	}
+	spec.Maps[activeFlowsMap].InnerMap.MaxEntries = uint32(cacheMaxSize)
+	constants := tunnels.constants()
+	constants[constAgentNetNSInode] = agentNetNS
+	constants[constMinDropReason] = minReason
+	constants[constEnableFlowFilter] = boolToUint8(filterFlows)
+	if err := spec.RewriteConstants(constants); err != nil {
+		return nil, fmt.Errorf("rewriting BPF constants definition: %w", err)
+	}
+
+	tracer := &dropsTracer{}
+	if err := spec.LoadAndAssign(&tracer.objects, &ebpf.CollectionOptions{
+		MapReplacements: map[string]*ebpf.Map{
+			directFlowsMap:         flows.DirectFlows,
+			aggregatedFlowsMaps[0]: flows.AggregatedFlows0,
+			aggregatedFlowsMaps[1]: flows.AggregatedFlows1,
+			activeFlowsMap:         flows.ActiveFlows,
+			fragmentsMap:           flows.Fragments,
+			filterRulesMap:         flows.FilterRulesMap,
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("loading packet drops BPF program: %w", err)
+	}
+	tracer.link, err = link.AttachTracing(link.TracingOptions{Program: tracer.objects.KfreeSkb})
+	if err != nil {
+		tracer.objects.Close()
+		return nil, fmt.Errorf("attaching packet drops BPF program: %w", err)
+	}
+	return tracer, nil
+}
+
+// Close detaches and unloads the packet drops program
+func (d *dropsTracer) Close() error {
+	var errs []error
+	if err := d.link.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	// the loaded objects hold clones of the flows maps, which are also closed
+	if err := d.objects.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return joinErrors(errs)
+}
+
+// kernelDropReasons returns the values of the skb_drop_reason enum from the BTF information of
+// the running kernel, as they depend on the kernel version
+func kernelDropReasons() ([]btf.EnumValue, error) {
+	spec, err := btf.LoadKernelSpec()
+	if err != nil {
+		return nil, fmt.Errorf("loading kernel BTF: %w", err)
+	}
+	var enum *btf.Enum
+	if err := spec.TypeByName(dropReasonEnum, &enum); err != nil {
+		return nil, fmt.Errorf("looking up %s in kernel BTF: %w", dropReasonEnum, err)
+	}
+	return enum.Values, nil
+}
+
+// DropReasons returns the names of the reasons of the packet drops, indexed by their value in
+// the running kernel. The names do not have the SKB_DROP_REASON_ prefix (e.g. NETFILTER_DROP)
+func DropReasons() (map[uint32]string, error) {
+	reasons, err := kernelDropReasons()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint32]string, len(reasons))
+	for _, reason := range reasons {
+		names[uint32(reason.Value)] = strings.TrimPrefix(reason.Name, dropReasonPrefix)
+	}
+	return names, nil
+}
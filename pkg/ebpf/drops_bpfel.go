@@ -0,0 +1,214 @@
+// Code generated by bpf2go; DO NOT EDIT.
+//go:build 386 || amd64 || amd64p32 || arm || arm64 || mips64le || mips64p32le || mipsle || ppc64le || riscv64
+// +build 386 amd64 amd64p32 arm arm64 mips64le mips64p32le mipsle ppc64le riscv64
+
+package ebpf
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+
+	"github.com/cilium/ebpf"
+)
+
+type DropsFilterKey struct {
+	PrefixLen uint32
+	Ip        [16]uint8
+}
+
+type DropsFilterRules struct {
+	Count uint8
+	Rules [8]struct {
+		Priority   uint16
+		Action     uint8
+		Directions uint8
+		Protocol   uint8
+		PortStart  uint16
+		PortEnd    uint16
+		Sampling   uint32
+	}
+}
+
+type DropsFlowId struct {
+	EthProtocol       uint16
+	Direction         uint8
+	SrcMac            [6]uint8
+	DstMac            [6]uint8
+	VlanId            uint16
+	InnerVlanId       uint16
+	SrcIp             [16]uint8
+	DstIp             [16]uint8
+	SrcPort           uint16
+	DstPort           uint16
+	TransportProtocol uint8
+	IcmpType          uint8
+	IcmpCode          uint8
+	NonFirstFragment  uint8
+	IfIndex           uint32
+	IfNetns           uint32
+	TunnelType        uint8
+	TunnelSrcIp       [16]uint8
+	TunnelDstIp       [16]uint8
+	TunnelId          uint32
+}
+
+type DropsFlowMetrics struct {
+	Packets           uint32
+	Bytes             uint64
+	StartMonoTimeTs   uint64
+	ConnMonoTimeTs    uint64
+	EndMonoTimeTs     uint64
+	Flags             uint16
+	FragmentedPackets uint32
+	SynPackets        uint32
+	FinPackets        uint32
+	RstPackets        uint32
+	DroppedPackets    uint32
+	DroppedBytes      uint64
+	DropReason        uint32
+	DnsId             uint16
+	DnsFlags          uint16
+	DnsMonoTimeTs     uint64
+	Retransmits       uint32
+	Sampling          uint32
+	Errno             uint8
+}
+
+type DropsFragmentKey struct {
+	SrcIp             [16]uint8
+	DstIp             [16]uint8
+	Identification    uint32
+	TransportProtocol uint8
+}
+
+type DropsFragmentL4 struct {
+	SrcPort  uint16
+	DstPort  uint16
+	IcmpType uint8
+	IcmpCode uint8
+}
+
+// LoadDrops returns the embedded CollectionSpec for Drops.
+func LoadDrops() (*ebpf.CollectionSpec, error) {
+	reader := bytes.NewReader(_DropsBytes)
+	spec, err := ebpf.LoadCollectionSpecFromReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("can't load Drops: %w", err)
+	}
+
+	return spec, err
+}
+
+// LoadDropsObjects loads Drops and converts it into a struct.
+//
+// The following types are suitable as obj argument:
+//
+//	*DropsObjects
+//	*DropsPrograms
+//	*DropsMaps
+//
+// See ebpf.CollectionSpec.LoadAndAssign documentation for details.
+func LoadDropsObjects(obj interface{}, opts *ebpf.CollectionOptions) error {
+	spec, err := LoadDrops()
+	if err != nil {
+		return err
+	}
+
+	return spec.LoadAndAssign(obj, opts)
+}
+
+// DropsSpecs contains maps and programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type DropsSpecs struct {
+	DropsProgramSpecs
+	DropsMapSpecs
+}
+
+// DropsSpecs contains programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type DropsProgramSpecs struct {
+	KfreeSkb *ebpf.ProgramSpec `ebpf:"kfree_skb"`
+}
+
+// DropsMapSpecs contains maps before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type DropsMapSpecs struct {
+	ActiveFlows      *ebpf.MapSpec `ebpf:"active_flows"`
+	AggregatedFlows0 *ebpf.MapSpec `ebpf:"aggregated_flows_0"`
+	AggregatedFlows1 *ebpf.MapSpec `ebpf:"aggregated_flows_1"`
+	DirectFlows      *ebpf.MapSpec `ebpf:"direct_flows"`
+	EvaluatedFlow    *ebpf.MapSpec `ebpf:"evaluated_flow"`
+	FilterRulesMap   *ebpf.MapSpec `ebpf:"filter_rules_map"`
+	Fragments        *ebpf.MapSpec `ebpf:"fragments"`
+}
+
+// DropsObjects contains all objects after they have been loaded into the kernel.
+//
+// It can be passed to LoadDropsObjects or ebpf.CollectionSpec.LoadAndAssign.
+type DropsObjects struct {
+	DropsPrograms
+	DropsMaps
+}
+
+func (o *DropsObjects) Close() error {
+	return _DropsClose(
+		&o.DropsPrograms,
+		&o.DropsMaps,
+	)
+}
+
+// DropsMaps contains all maps after they have been loaded into the kernel.
+//
+// It can be passed to LoadDropsObjects or ebpf.CollectionSpec.LoadAndAssign.
+type DropsMaps struct {
+	ActiveFlows      *ebpf.Map `ebpf:"active_flows"`
+	AggregatedFlows0 *ebpf.Map `ebpf:"aggregated_flows_0"`
+	AggregatedFlows1 *ebpf.Map `ebpf:"aggregated_flows_1"`
+	DirectFlows      *ebpf.Map `ebpf:"direct_flows"`
+	EvaluatedFlow    *ebpf.Map `ebpf:"evaluated_flow"`
+	FilterRulesMap   *ebpf.Map `ebpf:"filter_rules_map"`
+	Fragments        *ebpf.Map `ebpf:"fragments"`
+}
+
+func (m *DropsMaps) Close() error {
+	return _DropsClose(
+		m.ActiveFlows,
+		m.AggregatedFlows0,
+		m.AggregatedFlows1,
+		m.DirectFlows,
+		m.EvaluatedFlow,
+		m.FilterRulesMap,
+		m.Fragments,
+	)
+}
+
+// DropsPrograms contains all programs after they have been loaded into the kernel.
+//
+// It can be passed to LoadDropsObjects or ebpf.CollectionSpec.LoadAndAssign.
+type DropsPrograms struct {
+	KfreeSkb *ebpf.Program `ebpf:"kfree_skb"`
+}
+
+func (p *DropsPrograms) Close() error {
+	return _DropsClose(
+		p.KfreeSkb,
+	)
+}
+
+func _DropsClose(closers ...io.Closer) error {
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Do not access this directly.
+//go:embed drops_bpfel.o
+var _DropsBytes []byte
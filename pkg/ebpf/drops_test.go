@@ -0,0 +1,45 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDropsSharedMaps(t *testing.T) {
+	flows, err := LoadBpf()
+	require.NoError(t, err)
+	drops, err := LoadDrops()
+	require.NoError(t, err)
+
+	// the maps of the packet drops program are replaced by the flows maps, so they must have the
+	// same definition for the drops to be accounted in the same entries as the flows
+	assertSameMap := func(name string, flowsMap, dropsMap *ebpf.MapSpec) {
+		require.NotNil(t, flowsMap, name)
+		require.NotNil(t, dropsMap, name)
+		assert.Equal(t, flowsMap.Type, dropsMap.Type, name)
+		assert.Equal(t, flowsMap.KeySize, dropsMap.KeySize, name)
+		assert.Equal(t, flowsMap.ValueSize, dropsMap.ValueSize, name)
+		assert.Equal(t, flowsMap.Flags, dropsMap.Flags, name)
+	}
+	for _, name := range []string{directFlowsMap, aggregatedFlowsMaps[0], aggregatedFlowsMaps[1],
+		activeFlowsMap, fragmentsMap, filterRulesMap} {
+		assertSameMap(name, flows.Maps[name], drops.Maps[name])
+	}
+	assertSameMap(activeFlowsMap+" inner map",
+		flows.Maps[activeFlowsMap].InnerMap, drops.Maps[activeFlowsMap].InnerMap)
+}
+
+func TestDropsTunnelConstants(t *testing.T) {
+	drops, err := LoadDrops()
+	require.NoError(t, err)
+
+	// the drops program ignores the same tunnel packets that the flows programs decapsulate
+	assert.NoError(t, drops.RewriteConstants(TunnelDecapsulation{
+		Types:      []TunnelType{TunnelVXLAN, TunnelGeneve, TunnelGRE},
+		VXLANPort:  8472,
+		GenevePort: 6082,
+	}.constants()))
+}
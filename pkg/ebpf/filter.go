@@ -0,0 +1,181 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+const (
+	// constant defined in flows.c as "volatile const"
+	constEnableFlowFilter = "enable_flow_filter"
+	filterRulesMap        = "filter_rules_map"
+	// maxFilterRules is the MAX_FILTER_RULES definition in filter.h
+	maxFilterRules = 8
+	// prefix length of the IPv4 addresses that are encoded as IPv4-mapped IPv6 addresses
+	ip4in6PrefixLen = 96
+	// bits of the directions bitmask, according to the INGRESS and EGRESS definitions in flow.h
+	ingressBit = 1 << 0
+	egressBit  = 1 << 1
+)
+
+// FilterAction is the action of a filter rule over the packets of its matching flows.
+// The values match the FILTER_* definitions in filter.h
+type FilterAction uint8
+
+const (
+	// FilterAccept accounts all the packets of the matching flows
+	FilterAccept FilterAction = iota
+	// FilterDrop ignores all the packets of the matching flows
+	FilterDrop
+	// FilterSample accounts 1 out of FilterRule.Sampling packets of the matching flows
+	FilterSample
+)
+
+// FilterDirection is the direction of the flows that match a filter rule
+type FilterDirection uint8
+
+const (
+	FilterAnyDirection FilterDirection = iota
+	FilterIngress
+	FilterEgress
+)
+
+// FilterRule selects the flows whose packets are accounted by the eBPF programs. If several
+// rules match a flow, the first rule of the list applies. The packets of the flows that
+// do not match any rule are accounted.
+type FilterRule struct {
+	// CIDR that contains the source or the destination address of the matching flows
+	CIDR   *net.IPNet
+	Action FilterAction
+	// Sampling rate of the FilterSample action
+	Sampling uint32
+	// Protocol is the transport protocol of the matching flows. 0 matches any protocol
+	Protocol uint8
+	// PortStart and PortEnd are the range of the source or the destination port of the
+	// matching flows. Any port matches if both are 0
+	PortStart uint16
+	PortEnd   uint16
+	Direction FilterDirection
+}
+
+func (r *FilterRule) validate() error {
+	if r.CIDR == nil {
+		return errors.New("missing CIDR")
+	}
+	if r.Action > FilterSample {
+		return fmt.Errorf("unknown action %d", r.Action)
+	}
+	if r.Action == FilterSample && r.Sampling < 2 {
+		return fmt.Errorf("the sampling rate must be greater than 1. Got %d", r.Sampling)
+	}
+	if r.PortStart > r.PortEnd {
+		return fmt.Errorf("invalid port range %d-%d", r.PortStart, r.PortEnd)
+	}
+	if r.Direction > FilterEgress {
+		return fmt.Errorf("unknown direction %d", r.Direction)
+	}
+	return nil
+}
+
+// directions returns the bitmask of the matching directions
+func (r *FilterRule) directions() uint8 {
+	switch r.Direction {
+	case FilterIngress:
+		return ingressBit
+	case FilterEgress:
+		return egressBit
+	default:
+		return ingressBit | egressBit
+	}
+}
+
+// filterCIDR returns the CIDR as an IPv6 CIDR, encoding the IPv4 CIDRs as IPv4-mapped CIDRs
+func filterCIDR(cidr *net.IPNet) (ip net.IP, prefixLen int) {
+	ones, bits := cidr.Mask.Size()
+	if ip4 := cidr.IP.To4(); ip4 != nil && bits == 8*net.IPv4len {
+		return ip4.Mask(cidr.Mask).To16(), ones + ip4in6PrefixLen
+	}
+	return cidr.IP.To16().Mask(cidr.Mask), ones
+}
+
+// cidrEntry is a CIDR of the rules of an LPM trie map, together with the indices of the rules
+// whose CIDR contains it, including its own, sorted by priority
+type cidrEntry struct {
+	ip        net.IP
+	prefixLen int
+	rules     []int
+}
+
+// cidrEntries returns an entry for each unique CIDR of the rules, in their IPv6 encoding, so the
+// longest prefix match of an address returns all the rules that apply to it
+func cidrEntries(cidrs []*net.IPNet) []cidrEntry {
+	nets := make([]net.IPNet, 0, len(cidrs))
+	entries := make([]cidrEntry, 0, len(cidrs))
+	for _, c := range cidrs {
+		ip, prefixLen := filterCIDR(c)
+		nets = append(nets, net.IPNet{IP: ip, Mask: net.CIDRMask(prefixLen, 8*net.IPv6len)})
+		entries = append(entries, cidrEntry{ip: ip, prefixLen: prefixLen})
+	}
+	unique := entries[:0]
+	for i := range entries {
+		duplicate := false
+		for _, u := range unique {
+			if u.prefixLen == entries[i].prefixLen && u.ip.Equal(entries[i].ip) {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		e := entries[i]
+		for priority, container := range nets {
+			ones, _ := container.Mask.Size()
+			if ones <= e.prefixLen && e.ip.Mask(container.Mask).Equal(container.IP) {
+				e.rules = append(e.rules, priority)
+			}
+		}
+		unique = append(unique, e)
+	}
+	return unique
+}
+
+// filterEntries returns the entries of the filter rules map. The value of each CIDR contains the
+// rules whose CIDR contains it, sorted by priority, so the longest prefix match of an address
+// returns all the rules that apply to it.
+func filterEntries(rules []FilterRule) (map[BpfFilterKey]BpfFilterRules, error) {
+	if len(rules) > 1<<16 {
+		return nil, fmt.Errorf("too many filter rules: %d", len(rules))
+	}
+	cidrs := make([]*net.IPNet, 0, len(rules))
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("filter rule %d: %w", i, err)
+		}
+		cidrs = append(cidrs, rules[i].CIDR)
+	}
+	entries := map[BpfFilterKey]BpfFilterRules{}
+	for _, e := range cidrEntries(cidrs) {
+		if len(e.rules) > maxFilterRules {
+			return nil, fmt.Errorf("more than %d filter rules apply to %s/%d",
+				maxFilterRules, e.ip, e.prefixLen)
+		}
+		key := BpfFilterKey{PrefixLen: uint32(e.prefixLen)}
+		copy(key.Ip[:], e.ip)
+		value := BpfFilterRules{Count: uint8(len(e.rules))}
+		for i, priority := range e.rules {
+			rule := &rules[priority]
+			dst := &value.Rules[i]
+			dst.Priority = uint16(priority)
+			dst.Action = uint8(rule.Action)
+			dst.Directions = rule.directions()
+			dst.Protocol = rule.Protocol
+			dst.PortStart = rule.PortStart
+			dst.PortEnd = rule.PortEnd
+			dst.Sampling = rule.Sampling
+		}
+		entries[key] = value
+	}
+	return entries, nil
+}
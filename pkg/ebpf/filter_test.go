@@ -0,0 +1,85 @@
+package ebpf
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cidr(t *testing.T, s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	return n
+}
+
+func filterKey(prefixLen uint32, ip string) BpfFilterKey {
+	key := BpfFilterKey{PrefixLen: prefixLen}
+	copy(key.Ip[:], net.ParseIP(ip).To16())
+	return key
+}
+
+func TestFilterEntries(t *testing.T) {
+	entries, err := filterEntries([]FilterRule{
+		{CIDR: cidr(t, "10.0.0.5/32"), Action: FilterDrop, Protocol: 6, PortStart: 8080, PortEnd: 8080},
+		{CIDR: cidr(t, "10.0.0.0/8"), Action: FilterAccept, PortStart: 443, PortEnd: 443,
+			Direction: FilterEgress},
+		{CIDR: cidr(t, "fd00::/16"), Action: FilterSample, Sampling: 10, Direction: FilterIngress},
+		{CIDR: cidr(t, "0.0.0.0/0"), Action: FilterDrop},
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+
+	drop8080 := entries[filterKey(128, "10.0.0.5")]
+	accept443 := entries[filterKey(104, "10.0.0.0")]
+	sampleV6 := entries[filterKey(16, "fd00::")]
+	dropAll := entries[filterKey(96, "::ffff:0.0.0.0")]
+
+	// the rules of each CIDR include the rules of the CIDRs that contain it, by priority
+	require.EqualValues(t, 3, drop8080.Count)
+	assert.EqualValues(t, 0, drop8080.Rules[0].Priority)
+	assert.EqualValues(t, FilterDrop, drop8080.Rules[0].Action)
+	assert.EqualValues(t, 6, drop8080.Rules[0].Protocol)
+	assert.EqualValues(t, 8080, drop8080.Rules[0].PortStart)
+	assert.EqualValues(t, 8080, drop8080.Rules[0].PortEnd)
+	assert.EqualValues(t, ingressBit|egressBit, drop8080.Rules[0].Directions)
+	assert.EqualValues(t, 1, drop8080.Rules[1].Priority)
+	assert.EqualValues(t, 3, drop8080.Rules[2].Priority)
+
+	require.EqualValues(t, 2, accept443.Count)
+	assert.EqualValues(t, 1, accept443.Rules[0].Priority)
+	assert.EqualValues(t, FilterAccept, accept443.Rules[0].Action)
+	assert.EqualValues(t, egressBit, accept443.Rules[0].Directions)
+	assert.EqualValues(t, 3, accept443.Rules[1].Priority)
+
+	// IPv4 CIDRs do not contain IPv6 CIDRs
+	require.EqualValues(t, 1, sampleV6.Count)
+	assert.EqualValues(t, 2, sampleV6.Rules[0].Priority)
+	assert.EqualValues(t, FilterSample, sampleV6.Rules[0].Action)
+	assert.EqualValues(t, 10, sampleV6.Rules[0].Sampling)
+	assert.EqualValues(t, ingressBit, sampleV6.Rules[0].Directions)
+
+	require.EqualValues(t, 1, dropAll.Count)
+	assert.EqualValues(t, 3, dropAll.Rules[0].Priority)
+}
+
+func TestFilterEntries_Errors(t *testing.T) {
+	_, err := filterEntries([]FilterRule{{Action: FilterDrop}})
+	assert.Error(t, err, "missing CIDR")
+	_, err = filterEntries([]FilterRule{{CIDR: cidr(t, "10.0.0.0/8"), Action: FilterSample}})
+	assert.Error(t, err, "missing sampling rate")
+	_, err = filterEntries([]FilterRule{{CIDR: cidr(t, "10.0.0.0/8"), PortStart: 80, PortEnd: 10}})
+	assert.Error(t, err, "invalid port range")
+
+	tooMany := make([]FilterRule, maxFilterRules+1)
+	for i := range tooMany {
+		tooMany[i] = FilterRule{CIDR: cidr(t, "10.0.0.0/8"), PortStart: uint16(i), PortEnd: uint16(i)}
+	}
+	_, err = filterEntries(tooMany)
+	assert.Error(t, err, "too many rules for the same address")
+
+	entries, err := filterEntries(nil)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,140 @@
+// Code generated by bpf2go; DO NOT EDIT.
+//go:build arm64be || armbe || mips || mips64 || mips64p32 || ppc64 || s390 || s390x || sparc || sparc64
+// +build arm64be armbe mips mips64 mips64p32 ppc64 s390 s390x sparc sparc64
+
+package ebpf
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+
+	"github.com/cilium/ebpf"
+)
+
+type OwnerConnId struct {
+	EthProtocol       uint16
+	SrcIp             [16]uint8
+	DstIp             [16]uint8
+	SrcPort           uint16
+	DstPort           uint16
+	TransportProtocol uint8
+}
+
+type OwnerProcess struct {
+	CgroupId uint64
+	Pid      uint32
+	Comm     [16]uint8
+}
+
+// LoadOwner returns the embedded CollectionSpec for Owner.
+func LoadOwner() (*ebpf.CollectionSpec, error) {
+	reader := bytes.NewReader(_OwnerBytes)
+	spec, err := ebpf.LoadCollectionSpecFromReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("can't load Owner: %w", err)
+	}
+
+	return spec, err
+}
+
+// LoadOwnerObjects loads Owner and converts it into a struct.
+//
+// The following types are suitable as obj argument:
+//
+//	*OwnerObjects
+//	*OwnerPrograms
+//	*OwnerMaps
+//
+// See ebpf.CollectionSpec.LoadAndAssign documentation for details.
+func LoadOwnerObjects(obj interface{}, opts *ebpf.CollectionOptions) error {
+	spec, err := LoadOwner()
+	if err != nil {
+		return err
+	}
+
+	return spec.LoadAndAssign(obj, opts)
+}
+
+// OwnerSpecs contains maps and programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type OwnerSpecs struct {
+	OwnerProgramSpecs
+	OwnerMapSpecs
+}
+
+// OwnerSpecs contains programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type OwnerProgramSpecs struct {
+	InetSockSetState *ebpf.ProgramSpec `ebpf:"inet_sock_set_state"`
+	SockCreate       *ebpf.ProgramSpec `ebpf:"sock_create"`
+}
+
+// OwnerMapSpecs contains maps before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type OwnerMapSpecs struct {
+	ConnOwners *ebpf.MapSpec `ebpf:"conn_owners"`
+	SockOwners *ebpf.MapSpec `ebpf:"sock_owners"`
+}
+
+// OwnerObjects contains all objects after they have been loaded into the kernel.
+//
+// It can be passed to LoadOwnerObjects or ebpf.CollectionSpec.LoadAndAssign.
+type OwnerObjects struct {
+	OwnerPrograms
+	OwnerMaps
+}
+
+func (o *OwnerObjects) Close() error {
+	return _OwnerClose(
+		&o.OwnerPrograms,
+		&o.OwnerMaps,
+	)
+}
+
+// OwnerMaps contains all maps after they have been loaded into the kernel.
+//
+// It can be passed to LoadOwnerObjects or ebpf.CollectionSpec.LoadAndAssign.
+type OwnerMaps struct {
+	ConnOwners *ebpf.Map `ebpf:"conn_owners"`
+	SockOwners *ebpf.Map `ebpf:"sock_owners"`
+}
+
+func (m *OwnerMaps) Close() error {
+	return _OwnerClose(
+		m.ConnOwners,
+		m.SockOwners,
+	)
+}
+
+// OwnerPrograms contains all programs after they have been loaded into the kernel.
+//
+// It can be passed to LoadOwnerObjects or ebpf.CollectionSpec.LoadAndAssign.
+type OwnerPrograms struct {
+	InetSockSetState *ebpf.Program `ebpf:"inet_sock_set_state"`
+	SockCreate       *ebpf.Program `ebpf:"sock_create"`
+}
+
+func (p *OwnerPrograms) Close() error {
+	return _OwnerClose(
+		p.InetSockSetState,
+		p.SockCreate,
+	)
+}
+
+func _OwnerClose(closers ...io.Closer) error {
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Do not access this directly.
+//go:embed owner_bpfeb.o
+var _OwnerBytes []byte
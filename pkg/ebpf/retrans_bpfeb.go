@@ -0,0 +1,128 @@
+// Code generated by bpf2go; DO NOT EDIT.
+//go:build arm64be || armbe || mips || mips64 || mips64p32 || ppc64 || s390 || s390x || sparc || sparc64
+// +build arm64be armbe mips mips64 mips64p32 ppc64 s390 s390x sparc sparc64
+
+package ebpf
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+
+	"github.com/cilium/ebpf"
+)
+
+type RetransConnId struct {
+	EthProtocol       uint16
+	SrcIp             [16]uint8
+	DstIp             [16]uint8
+	SrcPort           uint16
+	DstPort           uint16
+	TransportProtocol uint8
+}
+
+// LoadRetrans returns the embedded CollectionSpec for Retrans.
+func LoadRetrans() (*ebpf.CollectionSpec, error) {
+	reader := bytes.NewReader(_RetransBytes)
+	spec, err := ebpf.LoadCollectionSpecFromReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("can't load Retrans: %w", err)
+	}
+
+	return spec, err
+}
+
+// LoadRetransObjects loads Retrans and converts it into a struct.
+//
+// The following types are suitable as obj argument:
+//
+//	*RetransObjects
+//	*RetransPrograms
+//	*RetransMaps
+//
+// See ebpf.CollectionSpec.LoadAndAssign documentation for details.
+func LoadRetransObjects(obj interface{}, opts *ebpf.CollectionOptions) error {
+	spec, err := LoadRetrans()
+	if err != nil {
+		return err
+	}
+
+	return spec.LoadAndAssign(obj, opts)
+}
+
+// RetransSpecs contains maps and programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type RetransSpecs struct {
+	RetransProgramSpecs
+	RetransMapSpecs
+}
+
+// RetransSpecs contains programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type RetransProgramSpecs struct {
+	TcpRetransmitSkb *ebpf.ProgramSpec `ebpf:"tcp_retransmit_skb"`
+}
+
+// RetransMapSpecs contains maps before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type RetransMapSpecs struct {
+	TcpRetransmits *ebpf.MapSpec `ebpf:"tcp_retransmits"`
+}
+
+// RetransObjects contains all objects after they have been loaded into the kernel.
+//
+// It can be passed to LoadRetransObjects or ebpf.CollectionSpec.LoadAndAssign.
+type RetransObjects struct {
+	RetransPrograms
+	RetransMaps
+}
+
+func (o *RetransObjects) Close() error {
+	return _RetransClose(
+		&o.RetransPrograms,
+		&o.RetransMaps,
+	)
+}
+
+// RetransMaps contains all maps after they have been loaded into the kernel.
+//
+// It can be passed to LoadRetransObjects or ebpf.CollectionSpec.LoadAndAssign.
+type RetransMaps struct {
+	TcpRetransmits *ebpf.Map `ebpf:"tcp_retransmits"`
+}
+
+func (m *RetransMaps) Close() error {
+	return _RetransClose(
+		m.TcpRetransmits,
+	)
+}
+
+// RetransPrograms contains all programs after they have been loaded into the kernel.
+//
+// It can be passed to LoadRetransObjects or ebpf.CollectionSpec.LoadAndAssign.
+type RetransPrograms struct {
+	TcpRetransmitSkb *ebpf.Program `ebpf:"tcp_retransmit_skb"`
+}
+
+func (p *RetransPrograms) Close() error {
+	return _RetransClose(
+		p.TcpRetransmitSkb,
+	)
+}
+
+func _RetransClose(closers ...io.Closer) error {
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Do not access this directly.
+//go:embed retrans_bpfeb.o
+var _RetransBytes []byte
@@ -0,0 +1,57 @@
+package ebpf
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf/link"
+)
+
+// $BPF_CLANG and $BPF_CFLAGS are set by the Makefile.
+//go:generate bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS Retrans ../../bpf/tcp_retrans.c -- -I../../bpf/headers
+
+const retransmitsMap = "tcp_retransmits"
+
+// retransmitsTracer counts the TCP retransmissions of each connection, from a program that is
+// attached to the tcp:tcp_retransmit_skb tracepoint
+type retransmitsTracer struct {
+	objects RetransObjects
+	link    link.Link
+}
+
+// newRetransmitsTracer loads and attaches the TCP retransmissions program. Its map can store
+// the counters of as many connections as flows can be stored in the aggregation maps.
+func newRetransmitsTracer(cacheMaxSize int) (*retransmitsTracer, error) {
+	spec, err := LoadRetrans()
+	if err != nil {
+		return nil, fmt.Errorf("loading TCP retransmissions BPF data: %w", err)
+	}
+	spec.Maps[retransmitsMap].MaxEntries = uint32(cacheMaxSize)
+
+	tracer := &retransmitsTracer{}
+	if err := spec.LoadAndAssign(&tracer.objects, nil); err != nil {
+		return nil, fmt.Errorf("loading TCP retransmissions BPF program: %w", err)
+	}
+	tracer.link, err = link.AttachTracing(link.TracingOptions{Program: tracer.objects.TcpRetransmitSkb})
+	if err != nil {
+		tracer.objects.Close()
+		return nil, fmt.Errorf("attaching TCP retransmissions BPF program: %w", err)
+	}
+	return tracer, nil
+}
+
+// lookupAndDelete reads all the retransmission counters and removes them from the map
+func (r *retransmitsTracer) lookupAndDelete() map[ConnId]uint32 {
+	return lookupAndDeleteConns[uint32](r.objects.TcpRetransmits)
+}
+
+// Close detaches and unloads the TCP retransmissions program
+func (r *retransmitsTracer) Close() error {
+	var errs []error
+	if err := r.link.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.objects.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return joinErrors(errs)
+}
@@ -0,0 +1,223 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"sync"
+
+	"github.com/cilium/ebpf"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ifaces"
+)
+
+const (
+	// constant defined in flows.c as "volatile const"
+	constEnableSamplingRules = "enable_sampling_rules"
+	samplingRulesMap         = "sampling_rules_map"
+	interfaceSamplingMap     = "interface_sampling"
+	defaultSamplingMap       = "default_sampling"
+	// maxSamplingRules is the MAX_SAMPLING_RULES definition in sampling.h
+	maxSamplingRules = 8
+)
+
+// SamplingRule sets the sampling rate of the flows to a destination CIDR and port range, or of
+// the flows of the interfaces whose name matches a regular expression. Only 1 out of Rate
+// packets of the matching flows are accounted.
+type SamplingRule struct {
+	// CIDR that contains the destination address of the matching flows. Any address matches
+	// if it is nil
+	CIDR *net.IPNet
+	// PortStart and PortEnd are the range of the destination port of the matching flows. Any
+	// port matches if both are 0
+	PortStart uint16
+	PortEnd   uint16
+	// Interface matches the names of the interfaces of the matching flows. The interface rules
+	// can't set a CIDR or a port range, and they only apply to the flows that do not match any
+	// CIDR or port rule
+	Interface *regexp.Regexp
+	Rate      uint32
+}
+
+func (r *SamplingRule) validate() error {
+	if r.Rate == 0 {
+		return errors.New("the sampling rate must be greater than 0")
+	}
+	if r.PortStart > r.PortEnd {
+		return fmt.Errorf("invalid port range %d-%d", r.PortStart, r.PortEnd)
+	}
+	if r.Interface != nil && (r.CIDR != nil || r.PortEnd != 0) {
+		return errors.New("the interface rules can't set a CIDR or a port range")
+	}
+	if r.Interface == nil && r.CIDR == nil && r.PortEnd == 0 {
+		return errors.New("missing CIDR, port range or interface")
+	}
+	return nil
+}
+
+// sampler stores the sampling rates of the rules in the maps of the flows programs, multiplied
+// by a scale factor that can be changed at runtime
+type sampler struct {
+	mu            sync.Mutex
+	rulesMap      *ebpf.Map
+	interfacesMap *ebpf.Map
+	defaultMap    *ebpf.Map
+	// rules with CIDR or port range, and their entries in the rules map
+	rules   []SamplingRule
+	entries []cidrEntry
+	// interface rules, and the index of the rule of each registered interface that matches one
+	interfaceRules []SamplingRule
+	interfaces     map[BpfInterfaceKey]int
+	defaultRate    uint32
+	scale          float64
+}
+
+// samplingEntries returns the CIDR entries of the rules that are not interface rules, whose
+// CIDR is any address if it is not set
+func samplingEntries(rules []SamplingRule) ([]cidrEntry, error) {
+	cidrs := make([]*net.IPNet, 0, len(rules))
+	for i := range rules {
+		cidr := rules[i].CIDR
+		if cidr == nil {
+			cidr = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 8*net.IPv6len)}
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	entries := cidrEntries(cidrs)
+	for _, e := range entries {
+		if len(e.rules) > maxSamplingRules {
+			return nil, fmt.Errorf("more than %d sampling rules apply to %s/%d",
+				maxSamplingRules, e.ip, e.prefixLen)
+		}
+	}
+	return entries, nil
+}
+
+// newSampler validates the rules and resizes the rules map of the spec, which must be loaded
+// before the sampler stores the rates with the store method
+func newSampler(spec *ebpf.CollectionSpec, rules []SamplingRule, defaultRate uint32) (*sampler, error) {
+	s := &sampler{
+		interfaces:  map[BpfInterfaceKey]int{},
+		defaultRate: defaultRate,
+		scale:       1,
+	}
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("sampling rule %d: %w", i, err)
+		}
+		if rules[i].Interface != nil {
+			s.interfaceRules = append(s.interfaceRules, rules[i])
+		} else {
+			s.rules = append(s.rules, rules[i])
+		}
+	}
+	var err error
+	if s.entries, err = samplingEntries(s.rules); err != nil {
+		return nil, err
+	}
+	if len(s.entries) > 0 {
+		spec.Maps[samplingRulesMap].MaxEntries = uint32(len(s.entries))
+	}
+	return s, nil
+}
+
+// store the scaled sampling rates of the rules in the maps of the loaded objects
+func (s *sampler) store(objects *BpfObjects) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rulesMap = objects.SamplingRulesMap
+	s.interfacesMap = objects.InterfaceSampling
+	s.defaultMap = objects.DefaultSampling
+	return s.storeRates()
+}
+
+// storeRates updates the sampling rates in the maps. It must be invoked with the mutex locked.
+func (s *sampler) storeRates() error {
+	for _, e := range s.entries {
+		key := BpfSamplingKey{PrefixLen: uint32(e.prefixLen)}
+		copy(key.Ip[:], e.ip)
+		value := BpfSamplingRules{Count: uint8(len(e.rules))}
+		for i, priority := range e.rules {
+			rule := &s.rules[priority]
+			value.Rules[i].PortStart = rule.PortStart
+			value.Rules[i].PortEnd = rule.PortEnd
+			value.Rules[i].Rate = s.scaled(rule.Rate)
+		}
+		if err := s.rulesMap.Put(key, value); err != nil {
+			return fmt.Errorf("storing sampling rules: %w", err)
+		}
+	}
+	for key, rule := range s.interfaces {
+		if err := s.interfacesMap.Put(key, s.scaled(s.interfaceRules[rule].Rate)); err != nil {
+			return fmt.Errorf("storing interface sampling rate: %w", err)
+		}
+	}
+	if err := s.defaultMap.Put(uint32(0), s.scaled(s.defaultRate)); err != nil {
+		return fmt.Errorf("storing default sampling rate: %w", err)
+	}
+	return nil
+}
+
+// scaled returns the sampling rate multiplied by the scale factor
+func (s *sampler) scaled(rate uint32) uint32 {
+	if rate == 0 {
+		rate = 1
+	}
+	return uint32(math.Min(math.Round(float64(rate)*s.scale), math.MaxUint32))
+}
+
+// setScale multiplies all the configured sampling rates by the provided factor
+func (s *sampler) setScale(scale float64) error {
+	if scale < 1 {
+		return fmt.Errorf("the sampling scale must be at least 1. Got %f", scale)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scale = scale
+	return s.storeRates()
+}
+
+// register stores the sampling rate of the flows of the interface, if it matches any
+// interface rule
+func (s *sampler) register(iface ifaces.Interface) error {
+	rule := -1
+	for i := range s.interfaceRules {
+		if s.interfaceRules[i].Interface.MatchString(iface.Name) {
+			rule = i
+			break
+		}
+	}
+	if rule < 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := interfaceKey(iface)
+	s.interfaces[key] = rule
+	if err := s.interfacesMap.Put(key, s.scaled(s.interfaceRules[rule].Rate)); err != nil {
+		return fmt.Errorf("storing interface sampling rate: %w", err)
+	}
+	return nil
+}
+
+// unregister removes the sampling rate of the flows of the interface, if any
+func (s *sampler) unregister(iface ifaces.Interface) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := interfaceKey(iface)
+	if _, ok := s.interfaces[key]; !ok {
+		return nil
+	}
+	delete(s.interfaces, key)
+	if err := s.interfacesMap.Delete(key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return fmt.Errorf("removing interface sampling rate: %w", err)
+	}
+	return nil
+}
+
+// interfaceKey returns the key of the interface, as identified in the flows
+func interfaceKey(iface ifaces.Interface) BpfInterfaceKey {
+	return BpfInterfaceKey{IfIndex: uint32(iface.Index), IfNetns: iface.NetNS.Inode}
+}
@@ -0,0 +1,58 @@
+package ebpf
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSampler(t *testing.T) {
+	spec, err := LoadBpf()
+	require.NoError(t, err)
+	s, err := newSampler(spec, []SamplingRule{
+		{CIDR: cidr(t, "10.0.0.0/8"), PortStart: 443, PortEnd: 443, Rate: 1},
+		{Interface: regexp.MustCompile("^veth"), Rate: 50},
+		{CIDR: cidr(t, "10.0.0.0/8"), Rate: 10},
+		{PortStart: 8000, PortEnd: 8080, Rate: 20},
+	}, 5)
+	require.NoError(t, err)
+
+	assert.Len(t, s.interfaceRules, 1)
+	require.Len(t, s.rules, 3)
+	// the rules without CIDR apply to any destination, and they are also included in the
+	// entries of the more specific CIDRs
+	require.Len(t, s.entries, 2)
+	assert.Equal(t, 104, s.entries[0].prefixLen)
+	assert.Equal(t, []int{0, 1, 2}, s.entries[0].rules)
+	assert.Equal(t, 0, s.entries[1].prefixLen)
+	assert.Equal(t, []int{2}, s.entries[1].rules)
+	assert.EqualValues(t, 2, spec.Maps[samplingRulesMap].MaxEntries)
+}
+
+func TestNewSampler_Errors(t *testing.T) {
+	spec, err := LoadBpf()
+	require.NoError(t, err)
+	for _, rule := range []SamplingRule{
+		{CIDR: cidr(t, "10.0.0.0/8")},
+		{Rate: 10},
+		{CIDR: cidr(t, "10.0.0.0/8"), PortStart: 443, PortEnd: 80, Rate: 10},
+		{Interface: regexp.MustCompile("^veth"), CIDR: cidr(t, "10.0.0.0/8"), Rate: 10},
+		{Interface: regexp.MustCompile("^veth"), PortStart: 443, PortEnd: 443, Rate: 10},
+	} {
+		_, err := newSampler(spec, []SamplingRule{rule}, 0)
+		assert.Error(t, err)
+	}
+}
+
+func TestSampler_Scaled(t *testing.T) {
+	s := &sampler{scale: 1}
+	assert.EqualValues(t, 1, s.scaled(0))
+	assert.EqualValues(t, 10, s.scaled(10))
+	s.scale = 2.5
+	assert.EqualValues(t, 3, s.scaled(1))
+	assert.EqualValues(t, 25, s.scaled(10))
+	s.scale = 1e10
+	assert.EqualValues(t, uint32(0xffffffff), s.scaled(10))
+}
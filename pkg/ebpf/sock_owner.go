@@ -0,0 +1,112 @@
+package ebpf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// $BPF_CLANG and $BPF_CFLAGS are set by the Makefile.
+//go:generate bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS Owner ../../bpf/sock_owner.c -- -I../../bpf/headers
+
+const (
+	connOwnersMap = "conn_owners"
+	mountsFile    = "/proc/self/mounts"
+	cgroup2FSType = "cgroup2"
+)
+
+// ownerTracer attributes the TCP connections to the processes that own their local socket
+type ownerTracer struct {
+	objects OwnerObjects
+	links   []link.Link
+}
+
+// newOwnerTracer loads the socket owner programs and attaches them to the given cgroup and to
+// the sock:inet_sock_set_state tracepoint. Its map can store the owners of as many connections
+// as flows can be stored in the aggregation maps.
+func newOwnerTracer(cgroupPath string, cacheMaxSize int) (*ownerTracer, error) {
+	spec, err := LoadOwner()
+	if err != nil {
+		return nil, fmt.Errorf("loading socket owners BPF data: %w", err)
+	}
+	spec.Maps[connOwnersMap].MaxEntries = uint32(cacheMaxSize)
+
+	tracer := &ownerTracer{}
+	if err := spec.LoadAndAssign(&tracer.objects, nil); err != nil {
+		return nil, fmt.Errorf("loading socket owners BPF programs: %w", err)
+	}
+	cgroupLink, err := link.AttachCgroup(link.CgroupOptions{
+		Path:    cgroupPath,
+		Attach:  ebpf.AttachCGroupInetSockCreate,
+		Program: tracer.objects.SockCreate,
+	})
+	if err != nil {
+		tracer.objects.Close()
+		return nil, fmt.Errorf("attaching socket owners BPF program to cgroup %s: %w", cgroupPath, err)
+	}
+	tracer.links = append(tracer.links, cgroupLink)
+	tpLink, err := link.AttachTracing(link.TracingOptions{Program: tracer.objects.InetSockSetState})
+	if err != nil {
+		tracer.Close()
+		return nil, fmt.Errorf("attaching socket owners BPF program: %w", err)
+	}
+	tracer.links = append(tracer.links, tpLink)
+	return tracer, nil
+}
+
+// lookup reads the owners of all the established connections. They are not removed, as the
+// connections might be still active in the next invocations.
+func (o *ownerTracer) lookup() map[ConnId]OwnerProcess {
+	owners := map[ConnId]OwnerProcess{}
+	iterator := o.objects.ConnOwners.Iterate()
+	id := ConnId{}
+	owner := OwnerProcess{}
+	for iterator.Next(&id, &owner) {
+		owners[id] = owner
+	}
+	if err := iterator.Err(); err != nil {
+		log.WithError(err).Warn("couldn't iterate the connection owners map")
+	}
+	return owners
+}
+
+// Close detaches and unloads the socket owner programs
+func (o *ownerTracer) Close() error {
+	var errs []error
+	for _, l := range o.links {
+		if err := l.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := o.objects.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return joinErrors(errs)
+}
+
+// Cgroup2Root returns the mount point of the cgroup v2 hierarchy, whose root cgroup contains
+// all the processes of the host
+func Cgroup2Root() (string, error) {
+	mounts, err := os.Open(mountsFile)
+	if err != nil {
+		return "", fmt.Errorf("reading mount points: %w", err)
+	}
+	defer mounts.Close()
+	scanner := bufio.NewScanner(mounts)
+	for scanner.Scan() {
+		// e.g. cgroup2 /sys/fs/cgroup cgroup2 rw,nosuid,nodev,noexec,relatime 0 0
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 2 && fields[2] == cgroup2FSType {
+			return fields[1], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("reading mount points: %w", err)
+	}
+	return "", errors.New("cgroup v2 hierarchy is not mounted")
+}
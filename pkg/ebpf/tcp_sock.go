@@ -0,0 +1,57 @@
+package ebpf
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf/link"
+)
+
+// $BPF_CLANG and $BPF_CFLAGS are set by the Makefile.
+//go:generate bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS TcpSock ../../bpf/tcp_sock.c -- -I../../bpf/headers
+
+const tcpSockSamplesMap = "tcp_sock_samples"
+
+// tcpSockTracer samples the smoothed round-trip time, the congestion window and the MSS of the
+// local TCP sockets, from a program that is attached to the tcp:tcp_probe tracepoint
+type tcpSockTracer struct {
+	objects TcpSockObjects
+	link    link.Link
+}
+
+// newTCPSockTracer loads and attaches the TCP socket sampling program. Its map can store the
+// samples of as many connections as flows can be stored in the aggregation maps.
+func newTCPSockTracer(cacheMaxSize int) (*tcpSockTracer, error) {
+	spec, err := LoadTcpSock()
+	if err != nil {
+		return nil, fmt.Errorf("loading TCP socket sampling BPF data: %w", err)
+	}
+	spec.Maps[tcpSockSamplesMap].MaxEntries = uint32(cacheMaxSize)
+
+	tracer := &tcpSockTracer{}
+	if err := spec.LoadAndAssign(&tracer.objects, nil); err != nil {
+		return nil, fmt.Errorf("loading TCP socket sampling BPF program: %w", err)
+	}
+	tracer.link, err = link.AttachTracing(link.TracingOptions{Program: tracer.objects.TcpProbe})
+	if err != nil {
+		tracer.objects.Close()
+		return nil, fmt.Errorf("attaching TCP socket sampling BPF program: %w", err)
+	}
+	return tracer, nil
+}
+
+// lookupAndDelete reads all the per-CPU samples of the connections and removes them from the map
+func (s *tcpSockTracer) lookupAndDelete() map[ConnId][]TcpSockSamples {
+	return lookupAndDeleteConns[[]TcpSockSamples](s.objects.TcpSockSamples)
+}
+
+// Close detaches and unloads the TCP socket sampling program
+func (s *tcpSockTracer) Close() error {
+	var errs []error
+	if err := s.link.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.objects.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return joinErrors(errs)
+}
@@ -0,0 +1,141 @@
+// Code generated by bpf2go; DO NOT EDIT.
+//go:build 386 || amd64 || amd64p32 || arm || arm64 || mips64le || mips64p32le || mipsle || ppc64le || riscv64
+// +build 386 amd64 amd64p32 arm arm64 mips64le mips64p32le mipsle ppc64le riscv64
+
+package ebpf
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+
+	"github.com/cilium/ebpf"
+)
+
+type TcpSockConnId struct {
+	EthProtocol       uint16
+	SrcIp             [16]uint8
+	DstIp             [16]uint8
+	SrcPort           uint16
+	DstPort           uint16
+	TransportProtocol uint8
+}
+
+type TcpSockSamples struct {
+	Count   uint32
+	SrttMin uint32
+	SrttMax uint32
+	SrttSum uint64
+	CwndMin uint32
+	CwndMax uint32
+	CwndSum uint64
+	MssMin  uint32
+	MssMax  uint32
+	MssSum  uint64
+}
+
+// LoadTcpSock returns the embedded CollectionSpec for TcpSock.
+func LoadTcpSock() (*ebpf.CollectionSpec, error) {
+	reader := bytes.NewReader(_TcpSockBytes)
+	spec, err := ebpf.LoadCollectionSpecFromReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("can't load TcpSock: %w", err)
+	}
+
+	return spec, err
+}
+
+// LoadTcpSockObjects loads TcpSock and converts it into a struct.
+//
+// The following types are suitable as obj argument:
+//
+//	*TcpSockObjects
+//	*TcpSockPrograms
+//	*TcpSockMaps
+//
+// See ebpf.CollectionSpec.LoadAndAssign documentation for details.
+func LoadTcpSockObjects(obj interface{}, opts *ebpf.CollectionOptions) error {
+	spec, err := LoadTcpSock()
+	if err != nil {
+		return err
+	}
+
+	return spec.LoadAndAssign(obj, opts)
+}
+
+// TcpSockSpecs contains maps and programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type TcpSockSpecs struct {
+	TcpSockProgramSpecs
+	TcpSockMapSpecs
+}
+
+// TcpSockSpecs contains programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type TcpSockProgramSpecs struct {
+	TcpProbe *ebpf.ProgramSpec `ebpf:"tcp_probe"`
+}
+
+// TcpSockMapSpecs contains maps before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type TcpSockMapSpecs struct {
+	TcpSockSamples *ebpf.MapSpec `ebpf:"tcp_sock_samples"`
+}
+
+// TcpSockObjects contains all objects after they have been loaded into the kernel.
+//
+// It can be passed to LoadTcpSockObjects or ebpf.CollectionSpec.LoadAndAssign.
+type TcpSockObjects struct {
+	TcpSockPrograms
+	TcpSockMaps
+}
+
+func (o *TcpSockObjects) Close() error {
+	return _TcpSockClose(
+		&o.TcpSockPrograms,
+		&o.TcpSockMaps,
+	)
+}
+
+// TcpSockMaps contains all maps after they have been loaded into the kernel.
+//
+// It can be passed to LoadTcpSockObjects or ebpf.CollectionSpec.LoadAndAssign.
+type TcpSockMaps struct {
+	TcpSockSamples *ebpf.Map `ebpf:"tcp_sock_samples"`
+}
+
+func (m *TcpSockMaps) Close() error {
+	return _TcpSockClose(
+		m.TcpSockSamples,
+	)
+}
+
+// TcpSockPrograms contains all programs after they have been loaded into the kernel.
+//
+// It can be passed to LoadTcpSockObjects or ebpf.CollectionSpec.LoadAndAssign.
+type TcpSockPrograms struct {
+	TcpProbe *ebpf.Program `ebpf:"tcp_probe"`
+}
+
+func (p *TcpSockPrograms) Close() error {
+	return _TcpSockClose(
+		p.TcpProbe,
+	)
+}
+
+func _TcpSockClose(closers ...io.Closer) error {
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Do not access this directly.
+//go:embed tcpsock_bpfel.o
+var _TcpSockBytes []byte
@@ -3,10 +3,15 @@ package ebpf
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/link"
 	"github.com/cilium/ebpf/ringbuf"
 	"github.com/cilium/ebpf/rlimit"
 	"github.com/netobserv/netobserv-ebpf-agent/pkg/ifaces"
@@ -16,38 +21,180 @@ import (
 )
 
 // $BPF_CLANG and $BPF_CFLAGS are set by the Makefile.
-//go:generate bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS -type flow_metrics_t -type flow_id_t -type flow_record_t Bpf ../../bpf/flows.c -- -I../../bpf/headers
+//go:generate bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS -type flow_metrics_t -type flow_id_t -type flow_record_t -type filter_key_t -type filter_rules_t -type sampling_key_t -type sampling_rules_t -type interface_key_t Bpf ../../bpf/flows.c -- -I../../bpf/headers
 
 const (
 	qdiscType = "clsact"
 	// constants defined in flows.c as "volatile const"
 	constSampling      = "sampling"
 	constTraceMessages = "trace_messages"
-	aggregatedFlowsMap = "aggregated_flows"
+	constEnableNetNS   = "enable_netns"
+	constCountTCPFlags = "count_tcp_flags"
+	constEnableDNS     = "enable_dns_tracking"
+	constDNSPort       = "dns_port"
+	// also defined in pkt_drops.c
+	constAgentNetNSInode = "agent_netns_inode"
+	activeFlowsMap       = "active_flows"
+	directFlowsMap       = "direct_flows"
+	fragmentsMap         = "fragments"
+	agentNetNSFile       = "/proc/self/ns/net"
+	// names of the legacy TC filters, used to find leftovers from previous executions
+	egressFilterName  = "tc/egress_flow_parse"
+	ingressFilterName = "tc/ingress_flow_parse"
+	// TCX attach types (Kernel >= 6.6), not yet defined in the cilium/ebpf library
+	attachTCXIngress = ebpf.AttachType(46)
+	attachTCXEgress  = ebpf.AttachType(47)
+	// bpfFBefore attaches a TCX program before all the programs that are already attached
+	bpfFBefore = 1 << 3
 )
 
+// aggregatedFlowsMaps are the two flow aggregation maps that alternate as active map.
+// While the kernel space updates the active map, the user space evicts the other.
+var aggregatedFlowsMaps = [2]string{"aggregated_flows_0", "aggregated_flows_1"}
+
 var log = logrus.WithField("component", "ebpf.FlowFetcher")
 
+// XDPMode is the mode used to attach the XDP ingress program to an interface
+type XDPMode string
+
+const (
+	// XDPModeNative attaches the program into the driver's receive path
+	XDPModeNative XDPMode = "native"
+	// XDPModeGeneric attaches the program after the socket buffer allocation, for drivers
+	// that do not support native XDP
+	XDPModeGeneric XDPMode = "generic"
+	// XDPModeOffload tries to offload the program into the NIC hardware, falling back to
+	// the native and then the generic mode if the NIC or the program do not support it
+	XDPModeOffload XDPMode = "offload"
+)
+
+// Validate returns an error if the XDP mode is not one of the accepted values
+func (m XDPMode) Validate() error {
+	_, err := m.attachFlags()
+	return err
+}
+
+// attachFlags returns the XDP attach flags to try, in order of preference
+func (m XDPMode) attachFlags() ([]link.XDPAttachFlags, error) {
+	switch m {
+	case XDPModeNative:
+		return []link.XDPAttachFlags{link.XDPDriverMode}, nil
+	case XDPModeGeneric:
+		return []link.XDPAttachFlags{link.XDPGenericMode}, nil
+	case XDPModeOffload:
+		return []link.XDPAttachFlags{link.XDPOffloadMode, link.XDPDriverMode, link.XDPGenericMode}, nil
+	default:
+		return nil, fmt.Errorf("unknown XDP mode %q. Accepted values: %s, %s, %s",
+			m, XDPModeNative, XDPModeGeneric, XDPModeOffload)
+	}
+}
+
 // FlowFetcher reads and forwards the Flows from the Traffic Control hooks in the eBPF kernel space.
 // It provides access both to flows that are aggregated in the kernel space (via PerfCPU hashmap)
 // and to flows that are forwarded by the kernel via ringbuffer because could not be aggregated
 // in the map
 type FlowFetcher struct {
-	objects        *BpfObjects
-	qdiscs         map[ifaces.Interface]*netlink.GenericQdisc
-	egressFilters  map[ifaces.Interface]*netlink.BpfFilter
-	ingressFilters map[ifaces.Interface]*netlink.BpfFilter
-	ringbufReader  *ringbuf.Reader
-	cacheMaxSize   int
-	enableIngress  bool
-	enableEgress   bool
-}
-
-func NewFlowFetcher(
-	traceMessages bool,
-	sampling, cacheMaxSize int,
-	ingress, egress bool,
-) (*FlowFetcher, error) {
+	objects *BpfObjects
+	// drops is nil if the packet drops tracking is disabled
+	drops *dropsTracer
+	// retransmits is nil if the TCP retransmissions tracking is disabled
+	retransmits *retransmitsTracer
+	// tcpSock is nil if the TCP socket sampling is disabled
+	tcpSock *tcpSockTracer
+	// owners is nil if the process attribution is disabled
+	owners *ownerTracer
+	// sampler is nil if the sampling rules are disabled
+	sampler *sampler
+	// flowMaps holds the two aggregation maps. activeMap is the index of the map that is
+	// currently updated by the kernel space
+	flowMaps  [2]*ebpf.Map
+	activeMap int
+	// attachments of the eBPF programs to each registered interface
+	attachments   map[ifaces.Interface]*attachment
+	attachmentsMu sync.Mutex
+	// legacyTC is true if the kernel does not support TCX, so the programs are attached as
+	// clsact qdisc filters via netlink. It is checked once, when the FlowFetcher is created
+	legacyTC      bool
+	ringbufReader *ringbuf.Reader
+	cacheMaxSize  int
+	enableIngress bool
+	enableEgress  bool
+	// xdpModes maps the names of the interfaces whose ingress traffic is observed from the XDP
+	// hook, instead of TC, to their XDP attach mode
+	xdpModes map[string]XDPMode
+	// batchReader is nil if the kernel does not support batch operations over per-CPU maps
+	batchReader *batchReader
+	// batchEnabled is atomically set to 0 if the batch eviction mode is disabled at runtime
+	batchEnabled       int32
+	batchEvictions     uint64
+	iterativeEvictions uint64
+}
+
+// EvictionStats reports the eviction mode that is currently in use, as well as the number of
+// evictions that have been performed in each mode
+type EvictionStats struct {
+	Mode      EvictionMode `json:"mode"`
+	Batch     uint64       `json:"batch"`
+	Iterative uint64       `json:"iterative"`
+}
+
+// FlowFetcherConfig configures the eBPF programs and maps of the FlowFetcher
+type FlowFetcherConfig struct {
+	// TraceMessages enables the debug messages of the eBPF programs
+	TraceMessages bool
+	// Sampling rate of the observed packets. 0 or 1 to observe all the packets
+	Sampling     int
+	CacheMaxSize int
+	// EnableIngress and EnableEgress select the traffic directions to observe
+	EnableIngress bool
+	EnableEgress  bool
+	// XDPModes maps the names of the interfaces whose ingress traffic is observed from the XDP
+	// hook to the XDP attach mode
+	XDPModes map[string]XDPMode
+	Tunnels  TunnelDecapsulation
+	// CountTCPFlags enables the counting of the TCP packets with the SYN, FIN and RST flags
+	CountTCPFlags bool
+	// EnablePktDrops attributes the packets that are dropped by the kernel to their flows,
+	// from a program that is attached to the skb:kfree_skb tracepoint (Kernel >= 5.17)
+	EnablePktDrops bool
+	// DNSTracking records the ID and flags of the last DNS message of the flows that are sent
+	// from or to the DNSPort, over UDP or TCP. The default DNS port is used if DNSPort is 0
+	DNSTracking bool
+	DNSPort     uint16
+	// EnableTCPRetransmits counts the TCP retransmissions of each connection, from a program
+	// that is attached to the tcp:tcp_retransmit_skb tracepoint (Kernel >= 5.5)
+	EnableTCPRetransmits bool
+	// EnableTCPSockSampling samples the smoothed round-trip time, the congestion window and
+	// the MSS of the local TCP sockets, from a program that is attached to the tcp:tcp_probe
+	// tracepoint (Kernel >= 5.9)
+	EnableTCPSockSampling bool
+	// EnableProcessTracking attributes the TCP connections to the processes that own their local
+	// socket, from a program that is attached to the CgroupPath cgroup, and a program that is
+	// attached to the sock:inet_sock_set_state tracepoint (Kernel >= 5.11). The root of the cgroup
+	// v2 hierarchy is used if CgroupPath is empty
+	EnableProcessTracking bool
+	CgroupPath            string
+	// FilterRules select the flows whose packets are accounted. All the packets are accounted
+	// if empty
+	FilterRules []FilterRule
+	// SamplingRules set the sampling rate of the flows to some destinations, or of the flows
+	// of some interfaces. The flows that do not match any rule are sampled at the Sampling rate
+	SamplingRules []SamplingRule
+	// AdaptiveSampling allows multiplying the sampling rates at runtime, with SetSamplingScale.
+	// It is implicitly enabled if there are SamplingRules
+	AdaptiveSampling bool
+	// ObserveNetNS tags the flows of the interfaces from other network namespaces with the inode
+	// number of their namespace, which is read from the device of each packet. It requires a
+	// kernel with BTF information
+	ObserveNetNS bool
+}
+
+func NewFlowFetcher(cfg *FlowFetcherConfig) (*FlowFetcher, error) {
+	for iface, mode := range cfg.XDPModes {
+		if err := mode.Validate(); err != nil {
+			return nil, fmt.Errorf("interface %s: %w", iface, err)
+		}
+	}
 	if err := rlimit.RemoveMemlock(); err != nil {
 		log.WithError(err).
 			Warn("can't remove mem lock. The agent could not be able to start eBPF programs")
@@ -59,20 +206,59 @@ func NewFlowFetcher(
 		return nil, fmt.Errorf("loading BPF data: %w", err)
 	}
 
-	// Resize aggregated flows map according to user-provided configuration
-	spec.Maps[aggregatedFlowsMap].MaxEntries = uint32(cacheMaxSize)
+	// Resize aggregated flows maps according to user-provided configuration
+	for _, name := range aggregatedFlowsMaps {
+		spec.Maps[name].MaxEntries = uint32(cfg.CacheMaxSize)
+	}
+	// the inner map spec must match the maps that are stored in the control map
+	spec.Maps[activeFlowsMap].InnerMap.MaxEntries = uint32(cfg.CacheMaxSize)
 
-	traceMsgs := 0
-	if traceMessages {
-		traceMsgs = 1
+	filters, err := filterEntries(cfg.FilterRules)
+	if err != nil {
+		return nil, err
 	}
-	if err := spec.RewriteConstants(map[string]interface{}{
-		constSampling:      uint32(sampling),
-		constTraceMessages: uint8(traceMsgs),
-	}); err != nil {
+	if len(filters) > 0 {
+		spec.Maps[filterRulesMap].MaxEntries = uint32(len(filters))
+	}
+	var sampling *sampler
+	if len(cfg.SamplingRules) > 0 || cfg.AdaptiveSampling {
+		if sampling, err = newSampler(spec, cfg.SamplingRules, uint32(cfg.Sampling)); err != nil {
+			return nil, err
+		}
+	}
+
+	constants := cfg.Tunnels.constants()
+	constants[constSampling] = uint32(cfg.Sampling)
+	// the sampling rules replace the sampling of all the packets before they are parsed
+	if sampling != nil {
+		constants[constSampling] = uint32(0)
+	}
+	constants[constEnableSamplingRules] = boolToUint8(sampling != nil)
+	constants[constTraceMessages] = boolToUint8(cfg.TraceMessages)
+	constants[constCountTCPFlags] = boolToUint8(cfg.CountTCPFlags)
+	constants[constEnableDNS] = boolToUint8(cfg.DNSTracking)
+	constants[constEnableFlowFilter] = boolToUint8(len(filters) > 0)
+	constants[constEnableNetNS] = boolToUint8(cfg.ObserveNetNS)
+	if cfg.ObserveNetNS {
+		if constants[constAgentNetNSInode], err = agentNetNSInode(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.DNSPort != 0 {
+		constants[constDNSPort] = cfg.DNSPort
+	}
+	if err := spec.RewriteConstants(constants); err != nil {
 		return nil, fmt.Errorf("rewriting BPF constants definition: %w", err)
 	}
-	if err := spec.LoadAndAssign(&objects, nil); err != nil {
+	var opts *ebpf.CollectionOptions
+	if !cfg.ObserveNetNS {
+		if _, err := btf.LoadKernelSpec(); err != nil {
+			// the namespace of the packets is not read, so the relocations of the kernel
+			// structures are resolved from the BTF of the programs if the kernel has none
+			opts = &ebpf.CollectionOptions{Programs: ebpf.ProgramOptions{KernelTypes: spec.Types}}
+		}
+	}
+	if err := spec.LoadAndAssign(&objects, opts); err != nil {
 		var ve *ebpf.VerifierError
 		if errors.As(err, &ve) {
 			// Using %+v will print the whole verifier error, not just the last
@@ -82,28 +268,325 @@ func NewFlowFetcher(
 		return nil, fmt.Errorf("loading and assigning BPF objects: %w", err)
 	}
 
+	for key, rules := range filters {
+		if err := objects.FilterRulesMap.Put(key, rules); err != nil {
+			objects.Close()
+			return nil, fmt.Errorf("storing filter rules: %w", err)
+		}
+	}
+	if len(filters) > 0 {
+		log.WithField("rules", len(cfg.FilterRules)).Info("flow filter rules loaded")
+	}
+	if sampling != nil {
+		if err := sampling.store(&objects); err != nil {
+			objects.Close()
+			return nil, err
+		}
+		log.WithField("rules", len(cfg.SamplingRules)).Info("sampling rules loaded")
+	}
+
+	// the optional tracers that are loaded before a failing one are closed with the objects
+	var optionalTracers []io.Closer
+	closeAll := func() {
+		for _, tracer := range optionalTracers {
+			tracer.Close()
+		}
+		objects.Close()
+	}
+	var drops *dropsTracer
+	if cfg.EnablePktDrops {
+		if drops, err = newDropsTracer(&objects, cfg.CacheMaxSize, len(filters) > 0, cfg.Tunnels); err != nil {
+			closeAll()
+			return nil, err
+		}
+		optionalTracers = append(optionalTracers, drops)
+		log.Info("packet drops program attached to the skb:kfree_skb tracepoint")
+	}
+	var retransmits *retransmitsTracer
+	if cfg.EnableTCPRetransmits {
+		if retransmits, err = newRetransmitsTracer(cfg.CacheMaxSize); err != nil {
+			closeAll()
+			return nil, err
+		}
+		optionalTracers = append(optionalTracers, retransmits)
+		log.Info("TCP retransmissions program attached to the tcp:tcp_retransmit_skb tracepoint")
+	}
+	var tcpSock *tcpSockTracer
+	if cfg.EnableTCPSockSampling {
+		if tcpSock, err = newTCPSockTracer(cfg.CacheMaxSize); err != nil {
+			closeAll()
+			return nil, err
+		}
+		optionalTracers = append(optionalTracers, tcpSock)
+		log.Info("TCP socket sampling program attached to the tcp:tcp_probe tracepoint")
+	}
+	var owners *ownerTracer
+	if cfg.EnableProcessTracking {
+		cgroupPath := cfg.CgroupPath
+		if cgroupPath == "" {
+			cgroupPath, err = Cgroup2Root()
+		}
+		if err == nil {
+			owners, err = newOwnerTracer(cgroupPath, cfg.CacheMaxSize)
+		}
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		optionalTracers = append(optionalTracers, owners)
+		log.WithField("cgroup", cgroupPath).
+			Info("socket owners programs attached to the cgroup and the sock:inet_sock_set_state tracepoint")
+	}
+
 	// read events from igress+egress ringbuffer
 	flows, err := ringbuf.NewReader(objects.DirectFlows)
 	if err != nil {
+		closeAll()
 		return nil, fmt.Errorf("accessing to ringbuffer: %w", err)
 	}
+	var batch *batchReader
+	if supported, err := batchLookupAndDeleteSupported(); err != nil {
+		log.WithError(err).Warn("can't check support for batch operations. Evicting flows iteratively")
+	} else if supported {
+		if batch, err = newBatchReader(objects.AggregatedFlows0, cfg.CacheMaxSize); err != nil {
+			log.WithError(err).Warn("can't create batch reader. Evicting flows iteratively")
+		}
+	}
+	if batch != nil {
+		log.Info("kernel supports batch lookup-and-delete. Evicting flows in batches")
+	} else {
+		log.Info("kernel does not support batch lookup-and-delete. Evicting flows iteratively")
+	}
+
+	legacyTC := false
+	if supported, err := tcxSupported(objects.EgressFlowParse); err != nil {
+		log.WithError(err).Warn("can't check support for TCX. Attaching to clsact qdiscs via netlink")
+		legacyTC = true
+	} else if !supported {
+		log.Info("kernel does not support TCX. Attaching to clsact qdiscs via netlink")
+		legacyTC = true
+	}
+
 	return &FlowFetcher{
-		objects:        &objects,
-		ringbufReader:  flows,
-		egressFilters:  map[ifaces.Interface]*netlink.BpfFilter{},
-		ingressFilters: map[ifaces.Interface]*netlink.BpfFilter{},
-		qdiscs:         map[ifaces.Interface]*netlink.GenericQdisc{},
-		cacheMaxSize:   cacheMaxSize,
-		enableIngress:  ingress,
-		enableEgress:   egress,
+		objects:       &objects,
+		drops:         drops,
+		retransmits:   retransmits,
+		tcpSock:       tcpSock,
+		owners:        owners,
+		sampler:       sampling,
+		flowMaps:      [2]*ebpf.Map{objects.AggregatedFlows0, objects.AggregatedFlows1},
+		legacyTC:      legacyTC,
+		ringbufReader: flows,
+		batchReader:   batch,
+		batchEnabled:  boolToInt32(batch != nil),
+		attachments:   map[ifaces.Interface]*attachment{},
+		cacheMaxSize:  cfg.CacheMaxSize,
+		enableIngress: cfg.EnableIngress,
+		enableEgress:  cfg.EnableEgress,
+		xdpModes:      cfg.XDPModes,
 	}, nil
 }
 
+// attachment keeps the resources that attach the eBPF programs to an interface, so they can be
+// released when the interface is unregistered
+type attachment struct {
+	ifIndex int
+	// links of the TCX and XDP attachments
+	links []link.Link
+	// qdisc is nil if the clsact qdisc already existed before the agent attached its filters
+	qdisc   *netlink.GenericQdisc
+	filters []*netlink.BpfFilter
+}
+
 // Register and links the eBPF fetcher into the system. The program should invoke Unregister
-// before exiting.
+// or Close before exiting.
+// If the interface is configured to observe its ingress traffic from the XDP hook, the XDP
+// program is attached instead of the TC ingress program.
+// If the kernel supports it, the programs are attached through TCX links, which coexist with
+// the programs that other tools might have attached to the same interface. Otherwise, it falls
+// back to attach them as clsact qdisc filters, without removing the qdiscs and filters from
+// other tools.
+// The interfaces from other network namespaces are attached from their namespace, to the same
+// programs as the rest of interfaces.
 func (m *FlowFetcher) Register(iface ifaces.Interface) error {
 	ilog := log.WithField("iface", iface)
-	// Load pre-compiled programs and maps into the kernel, and rewrites the configuration
+	m.attachmentsMu.Lock()
+	defer m.attachmentsMu.Unlock()
+	if _, ok := m.attachments[iface]; ok {
+		ilog.Debug("interface already registered. Ignoring")
+		return nil
+	}
+	att := &attachment{ifIndex: iface.Index}
+	if err := ifaces.InNetNS(iface.NetNS, func() error {
+		if err := m.attachTC(iface, att); err != nil {
+			return err
+		}
+		if err := m.attachXDP(iface, att); err != nil {
+			for _, err := range att.detach(ilog) {
+				ilog.WithError(err).Debug("can't release TC attachment")
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if m.sampler != nil {
+		if err := m.sampler.register(iface); err != nil {
+			// the flows of the interface are sampled at the default rate
+			ilog.WithError(err).Warn("can't set the sampling rate of the interface")
+		}
+	}
+	m.attachments[iface] = att
+	return nil
+}
+
+// attachTC attaches the TC programs via TCX or, if the kernel does not support it, via netlink.
+// If it fails, the partial attachments are released.
+func (m *FlowFetcher) attachTC(iface ifaces.Interface, att *attachment) error {
+	attach := m.attachTCX
+	if m.legacyTC {
+		attach = m.attachLegacyTC
+	}
+	if err := attach(iface, att); err != nil {
+		ilog := log.WithField("iface", iface)
+		for _, err := range att.detach(ilog) {
+			ilog.WithError(err).Debug("can't release TC attachment")
+		}
+		return err
+	}
+	return nil
+}
+
+// Unregister detaches the eBPF programs from the given interface and releases the resources
+// that were created to attach them.
+func (m *FlowFetcher) Unregister(iface ifaces.Interface) error {
+	m.attachmentsMu.Lock()
+	defer m.attachmentsMu.Unlock()
+	att, ok := m.attachments[iface]
+	if !ok {
+		return nil
+	}
+	delete(m.attachments, iface)
+	errs := m.detach(iface, att)
+	if m.sampler != nil {
+		if err := m.sampler.unregister(iface); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// detach releases the attachment of the interface from its network namespace. It must be
+// invoked with the attachments mutex locked.
+func (m *FlowFetcher) detach(iface ifaces.Interface, att *attachment) []error {
+	ilog := log.WithField("iface", iface)
+	var errs []error
+	if err := ifaces.InNetNS(iface.NetNS, func() error {
+		errs = att.detach(ilog)
+		return nil
+	}); err != nil {
+		// the kernel already released the filters and qdiscs of a removed namespace
+		ilog.WithError(err).Debug("can't enter network namespace. Only closing links")
+		att.filters = nil
+		att.qdisc = nil
+		errs = att.detach(ilog)
+	}
+	return errs
+}
+
+func (m *FlowFetcher) attachTCX(iface ifaces.Interface, att *attachment) error {
+	ilog := log.WithField("iface", iface)
+	hooks := []struct {
+		enabled   bool
+		direction string
+		program   *ebpf.Program
+		attach    ebpf.AttachType
+	}{
+		{enabled: m.enableEgress, direction: "egress", program: m.objects.EgressFlowParse, attach: attachTCXEgress},
+		{enabled: m.tcIngress(iface), direction: "ingress", program: m.objects.IngressFlowParse, attach: attachTCXIngress},
+	}
+	for _, hook := range hooks {
+		if !hook.enabled {
+			ilog.Debugf("ignoring %s traffic, according to user configuration", hook.direction)
+			continue
+		}
+		// the programs are attached first, so they observe the traffic before other programs
+		// might drop or redirect it. They always let the next program in the chain to run
+		l, err := link.AttachRawLink(link.RawLinkOptions{
+			Target:  iface.Index,
+			Program: hook.program,
+			Attach:  hook.attach,
+			Flags:   bpfFBefore,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to attach TCX %s program on %d (%s): %w",
+				hook.direction, iface.Index, iface.Name, err)
+		}
+		att.links = append(att.links, l)
+	}
+	return nil
+}
+
+// tcIngress returns whether the ingress traffic of the interface is observed from the TC hook
+func (m *FlowFetcher) tcIngress(iface ifaces.Interface) bool {
+	_, xdp := m.xdpModes[iface.Name]
+	return m.enableIngress && !xdp
+}
+
+// attachXDP attaches the XDP ingress program, if it is configured for the provided interface
+func (m *FlowFetcher) attachXDP(iface ifaces.Interface, att *attachment) error {
+	mode, ok := m.xdpModes[iface.Name]
+	if !ok || !m.enableIngress {
+		return nil
+	}
+	ilog := log.WithField("iface", iface)
+	// the mode is already validated when the FlowFetcher is created
+	flags, _ := mode.attachFlags()
+	var err error
+	for _, flag := range flags {
+		var l link.Link
+		l, err = link.AttachXDP(link.XDPOptions{
+			Program:   m.objects.XdpIngressFlowParse,
+			Interface: iface.Index,
+			Flags:     flag,
+		})
+		if err == nil {
+			ilog.WithField("flags", flag).Debug("XDP ingress program attached")
+			att.links = append(att.links, l)
+			return nil
+		}
+		ilog.WithError(err).WithField("flags", flag).Debug("can't attach XDP program with the given flags")
+	}
+	return fmt.Errorf("failed to attach XDP program on %d (%s) in %s mode: %w",
+		iface.Index, iface.Name, mode, err)
+}
+
+// tcxSupported checks whether the kernel supports TCX links, by linking the program to an
+// interface index that does not exist. The kernels that support TCX fail to find the interface,
+// while the older kernels reject the attach type or do not support BPF links at all.
+func tcxSupported(program *ebpf.Program) (bool, error) {
+	l, err := link.AttachRawLink(link.RawLinkOptions{
+		Target:  0,
+		Program: program,
+		Attach:  attachTCXIngress,
+	})
+	switch {
+	case err == nil:
+		_ = l.Close()
+		return true, nil
+	case errors.Is(err, unix.ENODEV):
+		return true, nil
+	case errors.Is(err, ebpf.ErrNotSupported), errors.Is(err, unix.EINVAL),
+		errors.Is(err, unix.EOPNOTSUPP), errors.Is(err, errENOTSUPP):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (m *FlowFetcher) attachLegacyTC(iface ifaces.Interface, att *attachment) error {
+	ilog := log.WithField("iface", iface)
 	ipvlan, err := netlink.LinkByIndex(iface.Index)
 	if err != nil {
 		return fmt.Errorf("failed to lookup ipvlan device %d (%s): %w", iface.Index, iface.Name, err)
@@ -117,100 +600,139 @@ func (m *FlowFetcher) Register(iface ifaces.Interface) error {
 		QdiscAttrs: qdiscAttrs,
 		QdiscType:  qdiscType,
 	}
-	if err := netlink.QdiscDel(qdisc); err == nil {
-		ilog.Warn("qdisc clsact already existed. Deleted it")
-	}
 	if err := netlink.QdiscAdd(qdisc); err != nil {
-		if errors.Is(err, fs.ErrExist) {
-			ilog.WithError(err).Warn("qdisc clsact already exists. Ignoring")
-		} else {
+		if !errors.Is(err, fs.ErrExist) {
 			return fmt.Errorf("failed to create clsact qdisc on %d (%s): %T %w", iface.Index, iface.Name, err, err)
 		}
+		// the qdisc might belong to other tools, so we just add our filters to it
+		ilog.Debug("qdisc clsact already exists. Reusing it")
+	} else {
+		att.qdisc = qdisc
 	}
-	m.qdiscs[iface] = qdisc
 
-	if err := m.registerEgress(iface, ipvlan); err != nil {
-		return err
+	if m.enableEgress {
+		filter, err := addFilter(ipvlan, netlink.HANDLE_MIN_EGRESS, m.objects.EgressFlowParse, egressFilterName, ilog)
+		if err != nil {
+			return fmt.Errorf("failed to create egress filter: %w", err)
+		}
+		att.filters = append(att.filters, filter)
+	} else {
+		ilog.Debug("ignoring egress traffic, according to user configuration")
 	}
 
-	if err := m.registerIngress(iface, ipvlan); err != nil {
-		return err
+	if m.tcIngress(iface) {
+		filter, err := addFilter(ipvlan, netlink.HANDLE_MIN_INGRESS, m.objects.IngressFlowParse, ingressFilterName, ilog)
+		if err != nil {
+			return fmt.Errorf("failed to create ingress filter: %w", err)
+		}
+		att.filters = append(att.filters, filter)
+	} else {
+		ilog.Debug("ignoring ingress traffic, according to user configuration")
 	}
-
 	return nil
 }
 
-func (m *FlowFetcher) registerEgress(iface ifaces.Interface, ipvlan netlink.Link) error {
-	ilog := log.WithField("iface", iface)
-	if !m.enableEgress {
-		ilog.Debug("ignoring egress traffic, according to user configuration")
-		return nil
+// addFilter attaches the program as a direct-action BPF filter of the provided clsact parent.
+// Filters with the same name are leftovers from previous executions of the agent, so they are
+// removed. Filters from other tools are kept, and the program is attached with the lowest
+// priority that they don't use, so it observes the traffic before it is dropped or redirected.
+func addFilter(
+	ipvlan netlink.Link, parent uint32, program *ebpf.Program, name string, ilog *logrus.Entry,
+) (*netlink.BpfFilter, error) {
+	existing, err := netlink.FilterList(ipvlan, parent)
+	if err != nil {
+		return nil, fmt.Errorf("listing filters: %w", err)
+	}
+	usedPriorities := map[uint16]struct{}{}
+	for _, f := range existing {
+		if bf, ok := f.(*netlink.BpfFilter); ok && bf.Name == name {
+			ilog.WithField("filter", name).Warn("filter from a previous execution already existed. Deleting it")
+			if err := netlink.FilterDel(bf); err != nil {
+				return nil, fmt.Errorf("deleting filter %s: %w", name, err)
+			}
+			continue
+		}
+		usedPriorities[f.Attrs().Priority] = struct{}{}
 	}
-	// Fetch events on egress
-	egressAttrs := netlink.FilterAttrs{
-		LinkIndex: ipvlan.Attrs().Index,
-		Parent:    netlink.HANDLE_MIN_EGRESS,
-		Handle:    netlink.MakeHandle(0, 1),
-		Protocol:  3,
-		Priority:  1,
-	}
-	egressFilter := &netlink.BpfFilter{
-		FilterAttrs:  egressAttrs,
-		Fd:           m.objects.EgressFlowParse.FD(),
-		Name:         "tc/egress_flow_parse",
+	priority := uint16(1)
+	for {
+		if _, ok := usedPriorities[priority]; !ok {
+			break
+		}
+		priority++
+	}
+	filter := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: ipvlan.Attrs().Index,
+			Parent:    parent,
+			Handle:    netlink.MakeHandle(0, 1),
+			Protocol:  unix.ETH_P_ALL,
+			Priority:  priority,
+		},
+		Fd:           program.FD(),
+		Name:         name,
 		DirectAction: true,
 	}
-	if err := netlink.FilterDel(egressFilter); err == nil {
-		ilog.Warn("egress filter already existed. Deleted it")
-	}
-	if err := netlink.FilterAdd(egressFilter); err != nil {
-		if errors.Is(err, fs.ErrExist) {
-			ilog.WithError(err).Warn("egress filter already exists. Ignoring")
-		} else {
-			return fmt.Errorf("failed to create egress filter: %w", err)
-		}
+	if err := netlink.FilterAdd(filter); err != nil {
+		return nil, err
 	}
-	m.egressFilters[iface] = egressFilter
-	return nil
+	return filter, nil
 }
 
-func (m *FlowFetcher) registerIngress(iface ifaces.Interface, ipvlan netlink.Link) error {
-	ilog := log.WithField("iface", iface)
-	if !m.enableIngress {
-		ilog.Debug("ignoring ingress traffic, according to user configuration")
-		return nil
+// detach releases the resources of the attachment. If the interface does not exist
+// anymore, its filters and qdisc are not deleted since the kernel already released them.
+// The programs are still detached if the interface exists (e.g. it was only set down).
+func (a *attachment) detach(ilog *logrus.Entry) []error {
+	var errs []error
+	for _, l := range a.links {
+		ilog.Debug("closing link")
+		if err := l.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing link: %w", err))
+		}
 	}
-	// Fetch events on ingress
-	ingressAttrs := netlink.FilterAttrs{
-		LinkIndex: ipvlan.Attrs().Index,
-		Parent:    netlink.HANDLE_MIN_INGRESS,
-		Handle:    netlink.MakeHandle(0, 1),
-		Protocol:  unix.ETH_P_ALL,
-		Priority:  1,
-	}
-	ingressFilter := &netlink.BpfFilter{
-		FilterAttrs:  ingressAttrs,
-		Fd:           m.objects.IngressFlowParse.FD(),
-		Name:         "tc/ingress_flow_parse",
-		DirectAction: true,
+	a.links = nil
+	if len(a.filters) > 0 || a.qdisc != nil {
+		if _, err := netlink.LinkByIndex(a.ifIndex); err != nil {
+			ilog.WithError(err).Debug("interface does not exist anymore. Skipping filters deletion")
+			a.filters = nil
+			a.qdisc = nil
+			return errs
+		}
 	}
-	if err := netlink.FilterDel(ingressFilter); err == nil {
-		ilog.Warn("ingress filter already existed. Deleted it")
+	for _, f := range a.filters {
+		ilog.WithField("filter", f.Name).Debug("deleting filter")
+		if err := doIgnoreNoDev(netlink.FilterDel, netlink.Filter(f), ilog); err != nil {
+			errs = append(errs, fmt.Errorf("deleting filter %s: %w", f.Name, err))
+		}
 	}
-	if err := netlink.FilterAdd(ingressFilter); err != nil {
-		if errors.Is(err, fs.ErrExist) {
-			ilog.WithError(err).Warn("ingress filter already exists. Ignoring")
-		} else {
-			return fmt.Errorf("failed to create ingress filter: %w", err)
+	a.filters = nil
+	// the qdisc is only deleted if it was created by the agent and no other tool attached
+	// filters to it in the meantime
+	if a.qdisc != nil && !qdiscHasFilters(a.qdisc) {
+		ilog.Debug("deleting Qdisc")
+		if err := doIgnoreNoDev(netlink.QdiscDel, netlink.Qdisc(a.qdisc), ilog); err != nil {
+			errs = append(errs, fmt.Errorf("deleting qdisc: %w", err))
 		}
 	}
-	m.ingressFilters[iface] = ingressFilter
-	return nil
+	a.qdisc = nil
+	return errs
 }
 
-// Close the eBPF fetcher from the system.
-// We don't need an "Close(iface)" method because the filters and qdiscs
-// are automatically removed when the interface is down
+func qdiscHasFilters(qdisc *netlink.GenericQdisc) bool {
+	ipvlan, err := netlink.LinkByIndex(qdisc.LinkIndex)
+	if err != nil {
+		return false
+	}
+	for _, parent := range []uint32{netlink.HANDLE_MIN_EGRESS, netlink.HANDLE_MIN_INGRESS} {
+		if filters, err := netlink.FilterList(ipvlan, parent); err == nil && len(filters) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Close the eBPF fetcher from the system, detaching the programs from all the
+// registered interfaces.
 func (m *FlowFetcher) Close() error {
 	log.Debug("unregistering eBPF objects")
 
@@ -223,45 +745,64 @@ func (m *FlowFetcher) Close() error {
 			errs = append(errs, err)
 		}
 	}
+	m.attachmentsMu.Lock()
+	for iface, att := range m.attachments {
+		errs = append(errs, m.detach(iface, att)...)
+	}
+	m.attachments = map[ifaces.Interface]*attachment{}
+	m.attachmentsMu.Unlock()
+	if m.drops != nil {
+		if err := m.drops.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		m.drops = nil
+	}
+	if m.retransmits != nil {
+		if err := m.retransmits.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		m.retransmits = nil
+	}
+	if m.tcpSock != nil {
+		if err := m.tcpSock.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		m.tcpSock = nil
+	}
+	if m.owners != nil {
+		if err := m.owners.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		m.owners = nil
+	}
 	if m.objects != nil {
 		if err := m.objects.EgressFlowParse.Close(); err != nil {
 			errs = append(errs, err)
 		}
-		if err := m.objects.IngressFlowParse.Close(); err != nil {
+		if err := m.objects.XdpIngressFlowParse.Close(); err != nil {
 			errs = append(errs, err)
 		}
-		if err := m.objects.AggregatedFlows.Close(); err != nil {
+		if err := m.objects.IngressFlowParse.Close(); err != nil {
 			errs = append(errs, err)
 		}
-		if err := m.objects.DirectFlows.Close(); err != nil {
+		if err := m.objects.ActiveFlows.Close(); err != nil {
 			errs = append(errs, err)
 		}
-		m.objects = nil
-	}
-	for iface, ef := range m.egressFilters {
-		log := log.WithField("interface", iface)
-		log.Debug("deleting egress filter")
-		if err := doIgnoreNoDev(netlink.FilterDel, netlink.Filter(ef), log); err != nil {
-			errs = append(errs, fmt.Errorf("deleting egress filter: %w", err))
+		if err := m.objects.AggregatedFlows0.Close(); err != nil {
+			errs = append(errs, err)
 		}
-	}
-	m.egressFilters = map[ifaces.Interface]*netlink.BpfFilter{}
-	for iface, igf := range m.ingressFilters {
-		log := log.WithField("interface", iface)
-		log.Debug("deleting ingress filter")
-		if err := doIgnoreNoDev(netlink.FilterDel, netlink.Filter(igf), log); err != nil {
-			errs = append(errs, fmt.Errorf("deleting ingress filter: %w", err))
+		if err := m.objects.AggregatedFlows1.Close(); err != nil {
+			errs = append(errs, err)
 		}
-	}
-	m.ingressFilters = map[ifaces.Interface]*netlink.BpfFilter{}
-	for iface, qd := range m.qdiscs {
-		log := log.WithField("interface", iface)
-		log.Debug("deleting Qdisc")
-		if err := doIgnoreNoDev(netlink.QdiscDel, netlink.Qdisc(qd), log); err != nil {
-			errs = append(errs, fmt.Errorf("deleting qdisc: %w", err))
+		if err := m.objects.DirectFlows.Close(); err != nil {
+			errs = append(errs, err)
 		}
+		m.objects = nil
 	}
-	m.qdiscs = map[ifaces.Interface]*netlink.GenericQdisc{}
+	return joinErrors(errs)
+}
+
+func joinErrors(errs []error) error {
 	if len(errs) == 0 {
 		return nil
 	}
@@ -299,25 +840,84 @@ func (m *FlowFetcher) ReadRingBuf() (ringbuf.Record, error) {
 	return m.ringbufReader.Read()
 }
 
-// LookupAndDeleteMap reads all the entries from the eBPF map and removes them from it.
-// It returns a map where the key
-// For synchronization purposes, we get/delete a whole snapshot of the flows map.
-// This way we avoid missing packets that could be updated on the
-// ebpf side while we process/aggregate them here
-// Changing this method invocation by BatchLookupAndDelete could improve performance
-// TODO: detect whether BatchLookupAndDelete is supported (Kernel>=5.6) and use it selectively
+// LookupAndDeleteMap reads all the entries from the eBPF aggregation maps and removes them.
+// It returns a map where the key is the flow identifier and the value is the list of
+// per-CPU metrics of the flow.
+// The kernel space aggregates the flows in two alternating (ping-pong) maps: before reading
+// the currently active map, it makes the other map active. Since the kernel waits for all the
+// running eBPF programs to finish before returning from the control map update, the
+// previously active map can be read and cleaned up without missing or duplicating any packet
+// that is concurrently updated by the datapath.
+// If the maps can't be flipped, it returns an error without reading any map, since the active
+// map is still updated by the kernel. Its flows are evicted once the maps are flipped in a
+// later invocation, or forwarded through the ring buffer if the map gets full in the meantime.
+// If the kernel supports it (Kernel>=5.6), the map is read and cleaned up in batches, which
+// is faster. Otherwise, it falls back to iterate the map and delete its entries one by one.
 // Supported Lookup/Delete operations by kernel: https://github.com/iovisor/bcc/blob/master/docs/kernel-versions.md
-// Race conditions here causes that some flows are lost in high-load scenarios
-func (m *FlowFetcher) LookupAndDeleteMap() map[BpfFlowId][]BpfFlowMetrics {
-	flowMap := m.objects.AggregatedFlows
+func (m *FlowFetcher) LookupAndDeleteMap() (map[BpfFlowId][]BpfFlowMetrics, error) {
+	evicted := m.flowMaps[m.activeMap]
+	next := (m.activeMap + 1) % len(m.flowMaps)
+	if err := m.objects.ActiveFlows.Put(uint32(0), m.flowMaps[next]); err != nil {
+		return nil, fmt.Errorf("switching the active flows map: %w", err)
+	}
+	m.activeMap = next
 
-	iterator := flowMap.Iterate()
 	flows := make(map[BpfFlowId][]BpfFlowMetrics, m.cacheMaxSize)
+	if atomic.LoadInt32(&m.batchEnabled) == 1 {
+		err := m.batchReader.lookupAndDelete(evicted, func(id *BpfFlowId, metrics []BpfFlowMetrics) {
+			flows[*id] = append(flows[*id], metrics...)
+		})
+		if err == nil {
+			atomic.AddUint64(&m.batchEvictions, 1)
+			return flows, nil
+		}
+		// the flows that were read before the error are already removed from the map,
+		// so we keep them and continue evicting iteratively
+		log.WithError(err).Warn("can't evict flows in batches. Falling back to iterative eviction")
+		atomic.StoreInt32(&m.batchEnabled, 0)
+	}
+	iterateAndDelete(evicted, flows)
+	atomic.AddUint64(&m.iterativeEvictions, 1)
+	return flows, nil
+}
+
+// LookupAndDeleteRetransmits reads all the TCP retransmission counters and removes them.
+// It returns a map where the key identifies the connection, as sent from the local endpoint,
+// and the value is the number of retransmissions since the previous invocation. It returns
+// nil if the TCP retransmissions tracking is disabled.
+func (m *FlowFetcher) LookupAndDeleteRetransmits() map[ConnId]uint32 {
+	if m.retransmits == nil {
+		return nil
+	}
+	return m.retransmits.lookupAndDelete()
+}
+
+// LookupAndDeleteTCPSockSamples reads all the samples of the local TCP sockets and removes them.
+// It returns a map where the key identifies the connection, as sent from the local endpoint,
+// and the value is the list of per-CPU samples since the previous invocation. It returns nil if
+// the TCP socket sampling is disabled.
+func (m *FlowFetcher) LookupAndDeleteTCPSockSamples() map[ConnId][]TcpSockSamples {
+	if m.tcpSock == nil {
+		return nil
+	}
+	return m.tcpSock.lookupAndDelete()
+}
 
+// LookupProcesses reads the processes that own the local socket of the established TCP
+// connections. It returns a map where the key identifies the connection, as sent from the local
+// endpoint. It returns nil if the process attribution is disabled.
+func (m *FlowFetcher) LookupProcesses() map[ConnId]OwnerProcess {
+	if m.owners == nil {
+		return nil
+	}
+	return m.owners.lookup()
+}
+
+// iterateAndDelete iterates the eBPF map and removes its entries one by one.
+func iterateAndDelete(flowMap *ebpf.Map, flows map[BpfFlowId][]BpfFlowMetrics) {
+	iterator := flowMap.Iterate()
 	id := BpfFlowId{}
 	var metrics []BpfFlowMetrics
-	// Changing Iterate+Delete by LookupAndDelete would prevent some possible race conditions
-	// TODO: detect whether LookupAndDelete is supported (Kernel>=4.20) and use it selectively
 	for iterator.Next(&id, &metrics) {
 		if err := flowMap.Delete(id); err != nil {
 			log.WithError(err).WithField("flowId", id).
@@ -328,5 +928,51 @@ func (m *FlowFetcher) LookupAndDeleteMap() map[BpfFlowId][]BpfFlowMetrics {
 		// TODO: instrument how many times the keys are is repeated in the same eviction
 		flows[id] = append(flows[id], metrics...)
 	}
-	return flows
+}
+
+// SetSamplingScale multiplies the sampling rates of the rules, the interfaces and the default
+// sampling rate by the provided factor, which must be at least 1. It requires the sampling rules
+// or the adaptive sampling to be enabled.
+func (m *FlowFetcher) SetSamplingScale(scale float64) error {
+	if m.sampler == nil {
+		return errors.New("the sampling rules are not enabled")
+	}
+	return m.sampler.setScale(scale)
+}
+
+// EvictionStats returns the eviction mode in use and the number of evictions performed so far
+func (m *FlowFetcher) EvictionStats() EvictionStats {
+	stats := EvictionStats{
+		Mode:      EvictionModeIterative,
+		Batch:     atomic.LoadUint64(&m.batchEvictions),
+		Iterative: atomic.LoadUint64(&m.iterativeEvictions),
+	}
+	if atomic.LoadInt32(&m.batchEnabled) == 1 {
+		stats.Mode = EvictionModeBatch
+	}
+	return stats
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// agentNetNSInode returns the inode number of the agent's network namespace, whose flows are
+// reported without namespace
+func agentNetNSInode() (uint32, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(agentNetNSFile, &st); err != nil {
+		return 0, fmt.Errorf("can't get the agent network namespace: %w", err)
+	}
+	return uint32(st.Ino), nil
+}
+
+func boolToUint8(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,92 @@
+package ebpf
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// constants defined in flows.c as "volatile const"
+	constDecapTunnels = "decap_tunnels"
+	constVXLANPort    = "vxlan_port"
+	constGenevePort   = "geneve_port"
+)
+
+// TunnelType of a tunnel whose encapsulated packets can be parsed by the eBPF programs.
+// The values match the TUNNEL_* definitions in flow.h
+type TunnelType uint8
+
+const (
+	// TunnelNone is the tunnel type of the flows that have not been decapsulated
+	TunnelNone TunnelType = iota
+	TunnelVXLAN
+	TunnelGeneve
+	TunnelGRE
+	// TunnelNVGRE tunnels are decapsulated when the TunnelGRE decapsulation is enabled
+	TunnelNVGRE
+	// TunnelIPIP encapsulates IPv4 packets into IPv4 or IPv6 packets
+	TunnelIPIP
+	// TunnelSIT encapsulates IPv6 packets into IPv4 (6in4) or IPv6 packets
+	TunnelSIT
+)
+
+var tunnelNames = map[TunnelType]string{
+	TunnelNone:   "none",
+	TunnelVXLAN:  "vxlan",
+	TunnelGeneve: "geneve",
+	TunnelGRE:    "gre",
+	TunnelNVGRE:  "nvgre",
+	TunnelIPIP:   "ipip",
+	TunnelSIT:    "sit",
+}
+
+// decapsulableTunnels are the tunnel types whose decapsulation can be enabled
+var decapsulableTunnels = []TunnelType{TunnelVXLAN, TunnelGeneve, TunnelGRE, TunnelIPIP, TunnelSIT}
+
+func (t TunnelType) String() string {
+	if name, ok := tunnelNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseTunnelType returns the decapsulable tunnel type with the given name (e.g. vxlan or gre)
+func ParseTunnelType(name string) (TunnelType, error) {
+	accepted := make([]string, 0, len(decapsulableTunnels))
+	for _, t := range decapsulableTunnels {
+		if strings.EqualFold(name, tunnelNames[t]) {
+			return t, nil
+		}
+		accepted = append(accepted, tunnelNames[t])
+	}
+	return TunnelNone, fmt.Errorf("unknown tunnel type %q. Accepted values: %s",
+		name, strings.Join(accepted, ", "))
+}
+
+// TunnelDecapsulation configures the tunnels whose encapsulated packets are parsed by
+// the eBPF programs. The flows of these packets are identified by their inner headers, and
+// record the tunnel type, ID and endpoints.
+type TunnelDecapsulation struct {
+	// Types of the tunnels to decapsulate. No tunnels are decapsulated if empty
+	Types []TunnelType
+	// VXLANPort and GenevePort are the UDP destination ports that identify the VXLAN and
+	// Geneve tunnels. The IANA-assigned ports are used if they are 0
+	VXLANPort  uint16
+	GenevePort uint16
+}
+
+// constants returns the values of the eBPF constants that configure the tunnel decapsulation
+func (d TunnelDecapsulation) constants() map[string]interface{} {
+	mask := uint8(0)
+	for _, t := range d.Types {
+		mask |= 1 << t
+	}
+	consts := map[string]interface{}{constDecapTunnels: mask}
+	if d.VXLANPort != 0 {
+		consts[constVXLANPort] = d.VXLANPort
+	}
+	if d.GenevePort != 0 {
+		consts[constGenevePort] = d.GenevePort
+	}
+	return consts
+}
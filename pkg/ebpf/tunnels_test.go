@@ -0,0 +1,39 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTunnelType(t *testing.T) {
+	tunnel, err := ParseTunnelType("vxlan")
+	require.NoError(t, err)
+	assert.Equal(t, TunnelVXLAN, tunnel)
+	tunnel, err = ParseTunnelType("GENEVE")
+	require.NoError(t, err)
+	assert.Equal(t, TunnelGeneve, tunnel)
+	tunnel, err = ParseTunnelType("sit")
+	require.NoError(t, err)
+	assert.Equal(t, TunnelSIT, tunnel)
+	_, err = ParseTunnelType("none")
+	assert.Error(t, err)
+	// NVGRE is decapsulated as part of GRE
+	_, err = ParseTunnelType("nvgre")
+	assert.Error(t, err)
+	_, err = ParseTunnelType("foo")
+	assert.Error(t, err)
+}
+
+func TestTunnelDecapsulationConstants(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{constDecapTunnels: uint8(0)},
+		TunnelDecapsulation{}.constants())
+	assert.Equal(t, map[string]interface{}{
+		constDecapTunnels: uint8(0b110),
+		constVXLANPort:    uint16(8472),
+	}, TunnelDecapsulation{
+		Types:     []TunnelType{TunnelVXLAN, TunnelGeneve},
+		VXLANPort: 8472,
+	}.constants())
+}
@@ -2,7 +2,10 @@ package exporter
 
 import (
 	"net"
+	"strings"
+	"time"
 
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
 	"github.com/netobserv/netobserv-ebpf-agent/pkg/flow"
 	"github.com/netobserv/netobserv-ebpf-agent/pkg/utils"
 	"github.com/sirupsen/logrus"
@@ -24,13 +27,71 @@ type IPFIX struct {
 	templateIDv6 uint16
 	entitiesV4   []entities.InfoElementWithValue
 	entitiesV6   []entities.InfoElementWithValue
+	// samplingOptions are resent every templateRefresh. It is 0 if the templates are not
+	// refreshed (TCP)
+	samplingOptions *SamplingOptions
+	templateRefresh time.Duration
+}
+
+// templateRefreshPeriod is the period at which the templates are resent to the UDP collectors,
+// so the collectors that start after the agent can decode the records
+const templateRefreshPeriod = time.Second
+
+// observationDomainID identifies the observation domain of the exported flows in the IPFIX messages
+const observationDomainID uint32 = 1
+
+// NetObservEnterpriseID is the private enterprise number under which the information elements
+// that are not defined by IANA are exported (Red Hat, Inc.)
+const NetObservEnterpriseID uint32 = 2312
+
+// netObservElements are the information elements that do not have an IANA-defined equivalent
+var netObservElements = map[string]*entities.InfoElement{
+	"timeFlowRttNs":  entities.NewInfoElement("timeFlowRttNs", 1, entities.Unsigned64, NetObservEnterpriseID, 8),
+	"interfaceNetns": entities.NewInfoElement("interfaceNetns", 2, entities.String, NetObservEnterpriseID, 65535),
+	// outer addresses of the tunnels, which might have a different IP version than the
+	// encapsulated flow. IPv4 addresses are encoded as IPv4-mapped IPv6 addresses
+	"tunnelSourceAddress":      entities.NewInfoElement("tunnelSourceAddress", 3, entities.Ipv6Address, NetObservEnterpriseID, 16),
+	"tunnelDestinationAddress": entities.NewInfoElement("tunnelDestinationAddress", 4, entities.Ipv6Address, NetObservEnterpriseID, 16),
+	"tunnelId":                 entities.NewInfoElement("tunnelId", 5, entities.Unsigned32, NetObservEnterpriseID, 4),
+	// whether the flow packets are non-first IP fragments whose first fragment has not been
+	// observed, so the transport ports are not known
+	"nonFirstFragment":  entities.NewInfoElement("nonFirstFragment", 6, entities.Boolean, NetObservEnterpriseID, 1),
+	"fragmentedPackets": entities.NewInfoElement("fragmentedPackets", 7, entities.Unsigned64, NetObservEnterpriseID, 8),
+	// kernel reason of the last dropped packet of the flow
+	"dropCause": entities.NewInfoElement("dropCause", 8, entities.String, NetObservEnterpriseID, 65535),
+	// transaction ID, header flags and response code of the last DNS message of the flow, and
+	// the latency between the DNS query and its response. All of them are 0 if unknown
+	"dnsId":        entities.NewInfoElement("dnsId", 9, entities.Unsigned16, NetObservEnterpriseID, 2),
+	"dnsFlags":     entities.NewInfoElement("dnsFlags", 10, entities.Unsigned16, NetObservEnterpriseID, 2),
+	"dnsRcode":     entities.NewInfoElement("dnsRcode", 11, entities.Unsigned8, NetObservEnterpriseID, 1),
+	"dnsLatencyNs": entities.NewInfoElement("dnsLatencyNs", 12, entities.Unsigned64, NetObservEnterpriseID, 8),
+	// TCP retransmissions of the connection of the flow since it was last reported
+	"tcpRetransmissionDeltaCount": entities.NewInfoElement("tcpRetransmissionDeltaCount", 13, entities.Unsigned64, NetObservEnterpriseID, 8),
+	// process that owns the local socket of the TCP connection of the flow. All of them are 0
+	// or empty if unknown
+	"processId":   entities.NewInfoElement("processId", 14, entities.Unsigned32, NetObservEnterpriseID, 4),
+	"processName": entities.NewInfoElement("processName", 15, entities.String, NetObservEnterpriseID, 65535),
+	"cgroupId":    entities.NewInfoElement("cgroupId", 16, entities.Unsigned64, NetObservEnterpriseID, 8),
+	"containerId": entities.NewInfoElement("containerId", 17, entities.String, NetObservEnterpriseID, 65535),
+	// lifecycle event of the tracked connection of the flow: 1 start, 2 update, 3 end. 0 if the
+	// connections are not tracked
+	"connectionEvent": entities.NewInfoElement("connectionEvent", 18, entities.Unsigned8, NetObservEnterpriseID, 1),
 }
 
 func addElementToTemplate(log *logrus.Entry, elementName string, value []byte, elements *[]entities.InfoElementWithValue) error {
-	element, err := registry.GetInfoElement(elementName, registry.IANAEnterpriseID)
-	if err != nil {
-		log.WithError(err).Errorf("Did not find the element with name %s", elementName)
-		return err
+	element, ok := netObservElements[elementName]
+	if !ok {
+		var err error
+		enterpriseID := registry.IANAEnterpriseID
+		if strings.HasPrefix(elementName, "reverse") {
+			// reverse information elements of the biflows (RFC 5103)
+			enterpriseID = registry.IANAReversedEnterpriseID
+		}
+		element, err = registry.GetInfoElement(elementName, enterpriseID)
+		if err != nil {
+			log.WithError(err).Errorf("Did not find the element with name %s", elementName)
+			return err
+		}
 	}
 	ie, err := entities.DecodeAndCreateInfoElementWithValue(element, value)
 	if err != nil {
@@ -41,7 +102,9 @@ func addElementToTemplate(log *logrus.Entry, elementName string, value []byte, e
 	return nil
 }
 
-func AddRecordValuesToTemplate(log *logrus.Entry, elements *[]entities.InfoElementWithValue) error {
+// AddRecordValuesToTemplate adds the elements of the flow metrics to the template. If biflows is
+// true, it also adds the reverse elements of the biflow metrics (RFC 5103)
+func AddRecordValuesToTemplate(log *logrus.Entry, elements *[]entities.InfoElementWithValue, biflows bool) error {
 	err := addElementToTemplate(log, "octetDeltaCount", nil, elements)
 	if err != nil {
 		return err
@@ -74,10 +137,121 @@ func AddRecordValuesToTemplate(log *logrus.Entry, elements *[]entities.InfoEleme
 	if err != nil {
 		return err
 	}
+	err = addElementToTemplate(log, "timeFlowRttNs", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "interfaceNetns", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "tunnelTechnology", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "tunnelSourceAddress", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "tunnelDestinationAddress", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "tunnelId", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "nonFirstFragment", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "fragmentedPackets", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "tcpSynTotalCount", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "tcpFinTotalCount", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "tcpRstTotalCount", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "droppedPacketDeltaCount", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "droppedOctetDeltaCount", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "dropCause", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "dnsId", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "dnsFlags", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "dnsRcode", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "dnsLatencyNs", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "tcpRetransmissionDeltaCount", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "processId", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "processName", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "cgroupId", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "containerId", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "samplingPacketInterval", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "connectionEvent", nil, elements)
+	if err != nil {
+		return err
+	}
+	err = addElementToTemplate(log, "flowEndReason", nil, elements)
+	if err != nil {
+		return err
+	}
+	if biflows {
+		for _, name := range []string{"reverseOctetDeltaCount", "reversePacketDeltaCount", "reverseTcpControlBits"} {
+			if err := addElementToTemplate(log, name, nil, elements); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
-func SendTemplateRecordv4(log *logrus.Entry, exporter *ipfixExporter.ExportingProcess) (uint16, []entities.InfoElementWithValue, error) {
+func SendTemplateRecordv4(log *logrus.Entry, exporter *ipfixExporter.ExportingProcess, biflows bool) (uint16, []entities.InfoElementWithValue, error) {
 	templateID := exporter.NewTemplateID()
 	templateSet := entities.NewSet(false)
 	err := templateSet.PrepareSet(entities.Template, templateID)
@@ -102,6 +276,14 @@ func SendTemplateRecordv4(log *logrus.Entry, exporter *ipfixExporter.ExportingPr
 	if err != nil {
 		return 0, nil, err
 	}
+	err = addElementToTemplate(log, "vlanId", nil, &elements)
+	if err != nil {
+		return 0, nil, err
+	}
+	err = addElementToTemplate(log, "dot1qCustomerVlanId", nil, &elements)
+	if err != nil {
+		return 0, nil, err
+	}
 	err = addElementToTemplate(log, "sourceIPv4Address", nil, &elements)
 	if err != nil {
 		return 0, nil, err
@@ -130,7 +312,7 @@ func SendTemplateRecordv4(log *logrus.Entry, exporter *ipfixExporter.ExportingPr
 	if err != nil {
 		return 0, nil, err
 	}
-	err = AddRecordValuesToTemplate(log, &elements)
+	err = AddRecordValuesToTemplate(log, &elements, biflows)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -146,7 +328,7 @@ func SendTemplateRecordv4(log *logrus.Entry, exporter *ipfixExporter.ExportingPr
 	return templateID, elements, nil
 }
 
-func SendTemplateRecordv6(log *logrus.Entry, exporter *ipfixExporter.ExportingProcess) (uint16, []entities.InfoElementWithValue, error) {
+func SendTemplateRecordv6(log *logrus.Entry, exporter *ipfixExporter.ExportingProcess, biflows bool) (uint16, []entities.InfoElementWithValue, error) {
 	templateID := exporter.NewTemplateID()
 	templateSet := entities.NewSet(false)
 	err := templateSet.PrepareSet(entities.Template, templateID)
@@ -171,6 +353,14 @@ func SendTemplateRecordv6(log *logrus.Entry, exporter *ipfixExporter.ExportingPr
 	if err != nil {
 		return 0, nil, err
 	}
+	err = addElementToTemplate(log, "vlanId", nil, &elements)
+	if err != nil {
+		return 0, nil, err
+	}
+	err = addElementToTemplate(log, "dot1qCustomerVlanId", nil, &elements)
+	if err != nil {
+		return 0, nil, err
+	}
 	err = addElementToTemplate(log, "sourceIPv6Address", nil, &elements)
 	if err != nil {
 		return 0, nil, err
@@ -199,7 +389,7 @@ func SendTemplateRecordv6(log *logrus.Entry, exporter *ipfixExporter.ExportingPr
 	if err != nil {
 		return 0, nil, err
 	}
-	err = AddRecordValuesToTemplate(log, &elements)
+	err = AddRecordValuesToTemplate(log, &elements, biflows)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -216,8 +406,10 @@ func SendTemplateRecordv6(log *logrus.Entry, exporter *ipfixExporter.ExportingPr
 	return templateID, elements, nil
 }
 
-// Sends out Template record to the IPFIX collector
-func StartIPFIXExporter(hostIP string, hostPort int, transportProto string) (*IPFIX, error) {
+// Sends out Template record to the IPFIX collector. The sampling argument is the rate of the
+// flows that do not report their own sampling rate, which is announced as an option. If biflows
+// is true, the templates contain the reverse elements of the bidirectional flows.
+func StartIPFIXExporter(hostIP string, hostPort int, transportProto string, sampling uint32, biflows bool) (*IPFIX, error) {
 	socket := utils.GetSocket(hostIP, hostPort)
 	log := ilog.WithField("collector", socket)
 
@@ -226,8 +418,8 @@ func StartIPFIXExporter(hostIP string, hostPort int, transportProto string) (*IP
 	input := ipfixExporter.ExporterInput{
 		CollectorAddress:    socket,
 		CollectorProtocol:   transportProto,
-		ObservationDomainID: 1,
-		TempRefTimeout:      1,
+		ObservationDomainID: observationDomainID,
+		TempRefTimeout:      uint32(templateRefreshPeriod / time.Second),
 	}
 	exporter, err := ipfixExporter.InitExportingProcess(input)
 	if err != nil {
@@ -236,17 +428,26 @@ func StartIPFIXExporter(hostIP string, hostPort int, transportProto string) (*IP
 	}
 	log.Infof("Created exporter connecting to local server with address: %s", socket)
 
-	templateIDv4, entitiesV4, err := SendTemplateRecordv4(log, exporter)
+	templateIDv4, entitiesV4, err := SendTemplateRecordv4(log, exporter, biflows)
 	if err != nil {
 		log.WithError(err).Error("Failed in send IPFIX template v4 record")
 		return nil, err
 	}
 
-	templateIDv6, entitiesV6, err := SendTemplateRecordv6(log, exporter)
+	templateIDv6, entitiesV6, err := SendTemplateRecordv6(log, exporter, biflows)
 	if err != nil {
 		log.WithError(err).Error("Failed in send IPFIX template v6 record")
 		return nil, err
 	}
+	samplingOptions, err := SendSamplingOptions(log, exporter, sampling)
+	if err != nil {
+		log.WithError(err).Error("Failed in send IPFIX sampling options")
+		return nil, err
+	}
+	var templateRefresh time.Duration
+	if transportProto == "udp" {
+		templateRefresh = templateRefreshPeriod
+	}
 	log.Infof("entities v4 %+v", entitiesV4)
 	log.Infof("entities v6 %+v", entitiesV6)
 
@@ -258,6 +459,9 @@ func StartIPFIXExporter(hostIP string, hostPort int, transportProto string) (*IP
 		templateIDv6: templateIDv6,
 		entitiesV4:   entitiesV4,
 		entitiesV6:   entitiesV6,
+
+		samplingOptions: samplingOptions,
+		templateRefresh: templateRefresh,
 	}, nil
 }
 
@@ -269,6 +473,14 @@ func setIPv4Address(ieValPtr *entities.InfoElementWithValue, ipAddress net.IP) {
 		ieVal.SetIPAddressValue(ipAddress)
 	}
 }
+
+// tunnelTechnology returns an empty string if the flow packets have not been decapsulated
+func tunnelTechnology(record *flow.Record) string {
+	if record.Id.TunnelType == 0 {
+		return ""
+	}
+	return ebpf.TunnelType(record.Id.TunnelType).String()
+}
 func setIERecordValue(record *flow.Record, ieValPtr *entities.InfoElementWithValue) {
 	ieVal := *ieValPtr
 	switch ieVal.GetName() {
@@ -288,6 +500,92 @@ func setIERecordValue(record *flow.Record, ieValPtr *entities.InfoElementWithVal
 		ieVal.SetUnsigned64Value(uint64(record.Metrics.Packets))
 	case "interfaceName":
 		ieVal.SetStringValue(record.Interface)
+	case "timeFlowRttNs":
+		ieVal.SetUnsigned64Value(uint64(record.TimeFlowRtt.Nanoseconds()))
+	case "interfaceNetns":
+		ieVal.SetStringValue(record.NetNS)
+	case "tunnelTechnology":
+		ieVal.SetStringValue(tunnelTechnology(record))
+	case "tunnelSourceAddress":
+		ieVal.SetIPAddressValue(record.Id.TunnelSrcIp[:])
+	case "tunnelDestinationAddress":
+		ieVal.SetIPAddressValue(record.Id.TunnelDstIp[:])
+	case "tunnelId":
+		ieVal.SetUnsigned32Value(record.Id.TunnelId)
+	case "nonFirstFragment":
+		ieVal.SetBooleanValue(record.Id.NonFirstFragment != 0)
+	case "fragmentedPackets":
+		ieVal.SetUnsigned64Value(uint64(record.Metrics.FragmentedPackets))
+	case "tcpSynTotalCount":
+		ieVal.SetUnsigned64Value(uint64(record.Metrics.SynPackets))
+	case "tcpFinTotalCount":
+		ieVal.SetUnsigned64Value(uint64(record.Metrics.FinPackets))
+	case "tcpRstTotalCount":
+		ieVal.SetUnsigned64Value(uint64(record.Metrics.RstPackets))
+	case "droppedPacketDeltaCount":
+		ieVal.SetUnsigned64Value(uint64(record.Metrics.DroppedPackets))
+	case "droppedOctetDeltaCount":
+		ieVal.SetUnsigned64Value(record.Metrics.DroppedBytes)
+	case "dropCause":
+		ieVal.SetStringValue(record.DropCause)
+	case "dnsId":
+		ieVal.SetUnsigned16Value(record.Metrics.DnsId)
+	case "dnsFlags":
+		ieVal.SetUnsigned16Value(record.Metrics.DnsFlags)
+	case "dnsRcode":
+		ieVal.SetUnsigned8Value(uint8(record.Metrics.DnsFlags & flow.DNSRcodeMask))
+	case "dnsLatencyNs":
+		ieVal.SetUnsigned64Value(uint64(record.DNSLatency.Nanoseconds()))
+	case "tcpRetransmissionDeltaCount":
+		ieVal.SetUnsigned64Value(uint64(record.Metrics.Retransmits))
+	case "processId":
+		if record.Process != nil {
+			ieVal.SetUnsigned32Value(record.Process.PID)
+		} else {
+			ieVal.SetUnsigned32Value(0)
+		}
+	case "processName":
+		if record.Process != nil {
+			ieVal.SetStringValue(record.Process.Command)
+		} else {
+			ieVal.SetStringValue("")
+		}
+	case "cgroupId":
+		if record.Process != nil {
+			ieVal.SetUnsigned64Value(record.Process.CgroupID)
+		} else {
+			ieVal.SetUnsigned64Value(0)
+		}
+	case "containerId":
+		if record.Process != nil {
+			ieVal.SetStringValue(record.Process.ContainerID)
+		} else {
+			ieVal.SetStringValue("")
+		}
+	case "samplingPacketInterval":
+		ieVal.SetUnsigned32Value(record.Metrics.Sampling)
+	case "connectionEvent":
+		ieVal.SetUnsigned8Value(uint8(record.ConnEvent))
+	case "flowEndReason":
+		ieVal.SetUnsigned8Value(uint8(record.FlowEndReason))
+	case "reverseOctetDeltaCount":
+		if record.Reverse != nil {
+			ieVal.SetUnsigned64Value(record.Reverse.Bytes)
+		} else {
+			ieVal.SetUnsigned64Value(0)
+		}
+	case "reversePacketDeltaCount":
+		if record.Reverse != nil {
+			ieVal.SetUnsigned64Value(uint64(record.Reverse.Packets))
+		} else {
+			ieVal.SetUnsigned64Value(0)
+		}
+	case "reverseTcpControlBits":
+		if record.Reverse != nil {
+			ieVal.SetUnsigned16Value(record.Reverse.Flags)
+		} else {
+			ieVal.SetUnsigned16Value(0)
+		}
 	}
 }
 func setIEValue(record *flow.Record, ieValPtr *entities.InfoElementWithValue) {
@@ -301,6 +599,10 @@ func setIEValue(record *flow.Record, ieValPtr *entities.InfoElementWithValue) {
 		ieVal.SetMacAddressValue(record.Id.SrcMac[:])
 	case "destinationMacAddress":
 		ieVal.SetMacAddressValue(record.Id.DstMac[:])
+	case "vlanId":
+		ieVal.SetUnsigned16Value(record.Id.VlanId)
+	case "dot1qCustomerVlanId":
+		ieVal.SetUnsigned16Value(record.Id.InnerVlanId)
 	case "sourceIPv4Address":
 		setIPv4Address(ieValPtr, flow.IP(record.Id.SrcIp).To4())
 	case "destinationIPv4Address":
@@ -365,6 +667,11 @@ func (ipf *IPFIX) ExportFlows(input <-chan []*flow.Record) {
 	socket := utils.GetSocket(ipf.hostIP, ipf.hostPort)
 	log := ilog.WithField("collector", socket)
 	for inputRecords := range input {
+		if ipf.templateRefresh > 0 {
+			if err := ipf.samplingOptions.Resend(ipf.exporter, ipf.templateRefresh); err != nil {
+				log.WithError(err).Error("Failed in resend IPFIX sampling options")
+			}
+		}
 		for _, record := range inputRecords {
 			if record.Id.EthProtocol == flow.IPv6Type {
 				err := ipf.sendDataRecord(log, record, true)
@@ -0,0 +1,174 @@
+package exporter
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware/go-ipfix/pkg/entities"
+	ipfixExporter "github.com/vmware/go-ipfix/pkg/exporter"
+)
+
+const (
+	// optionsTemplateSetID is the set ID of the options template sets (RFC 7011, section 3.3.2)
+	optionsTemplateSetID uint16 = 3
+	// optionsContentType identifies the sets that go-ipfix does not support, so it sends them
+	// without registering them as templates nor checking them as data records
+	optionsContentType entities.ContentType = 100
+	// samplingAlgorithmRandom is the "random sampling" value of the samplingAlgorithm element:
+	// each packet is accounted with a probability of 1/samplingPacketInterval
+	samplingAlgorithmRandom uint8 = 2
+)
+
+// optionsSet wraps a template or data set of go-ipfix, so it is sent as an options template set
+// or as the data set of an options template
+type optionsSet struct {
+	entities.Set
+	header  []byte
+	records []entities.Record
+}
+
+func (s *optionsSet) GetSetType() entities.ContentType {
+	return optionsContentType
+}
+
+func (s *optionsSet) GetHeaderBuffer() []byte {
+	return s.header
+}
+
+func (s *optionsSet) GetRecords() []entities.Record {
+	return s.records
+}
+
+func (s *optionsSet) GetSetLength() int {
+	length := entities.SetHeaderLen
+	for _, record := range s.records {
+		length += record.GetRecordLength()
+	}
+	return length
+}
+
+func (s *optionsSet) UpdateLenInHeader() {
+	binary.BigEndian.PutUint16(s.header[2:4], uint16(s.GetSetLength()))
+}
+
+// optionsTemplateRecord is a template record whose header also contains the number of scope
+// fields, which are the first fields of the record
+type optionsTemplateRecord struct {
+	entities.Record
+	buffer []byte
+}
+
+func (r *optionsTemplateRecord) GetBuffer() []byte {
+	return r.buffer
+}
+
+func (r *optionsTemplateRecord) GetRecordLength() int {
+	return len(r.buffer)
+}
+
+// newOptionsTemplateSet returns an options template set with a single template, whose first
+// scopeCount elements are its scope
+func newOptionsTemplateSet(templateID, scopeCount uint16, elements []entities.InfoElementWithValue) (entities.Set, error) {
+	set := entities.NewSet(false)
+	if err := set.PrepareSet(entities.Template, templateID); err != nil {
+		return nil, err
+	}
+	if err := set.AddRecord(elements, templateID); err != nil {
+		return nil, err
+	}
+	record := set.GetRecords()[0]
+	// the scope field count follows the template ID and the field count of the record header
+	template := record.GetBuffer()
+	buffer := make([]byte, 0, len(template)+2)
+	buffer = append(buffer, template[:4]...)
+	buffer = append(buffer, byte(scopeCount>>8), byte(scopeCount))
+	buffer = append(buffer, template[4:]...)
+	header := make([]byte, entities.SetHeaderLen)
+	binary.BigEndian.PutUint16(header[0:2], optionsTemplateSetID)
+	return &optionsSet{
+		Set:     set,
+		header:  header,
+		records: []entities.Record{&optionsTemplateRecord{Record: record, buffer: buffer}},
+	}, nil
+}
+
+// newOptionsDataSet returns the data set of an options template, with a single record
+func newOptionsDataSet(templateID uint16, elements []entities.InfoElementWithValue) (entities.Set, error) {
+	set := entities.NewSet(false)
+	if err := set.PrepareSet(entities.Data, templateID); err != nil {
+		return nil, err
+	}
+	if err := set.AddRecord(elements, templateID); err != nil {
+		return nil, err
+	}
+	return &optionsSet{Set: set, header: set.GetHeaderBuffer(), records: set.GetRecords()}, nil
+}
+
+// SamplingOptions are the options template and data sets that announce the sampling rate
+type SamplingOptions struct {
+	templateSet entities.Set
+	dataSet     entities.Set
+	lastSent    time.Time
+}
+
+// SendSamplingOptions announces the sampling rate of the flows that do not report their own
+// rate, and the sampling algorithm, through an options template whose scope is the observation
+// domain of the exporter. The flows report their actual rate in the samplingPacketInterval
+// element of their records.
+// go-ipfix does not refresh the options templates, so the returned SamplingOptions must be
+// resent periodically over UDP.
+func SendSamplingOptions(log *logrus.Entry, exporter *ipfixExporter.ExportingProcess, sampling uint32) (*SamplingOptions, error) {
+	if sampling == 0 {
+		sampling = 1
+	}
+	names := []string{"observationDomainId", "samplingPacketInterval", "samplingAlgorithm"}
+	templateElements := make([]entities.InfoElementWithValue, 0, len(names))
+	dataElements := make([]entities.InfoElementWithValue, 0, len(names))
+	for _, name := range names {
+		if err := addElementToTemplate(log, name, nil, &templateElements); err != nil {
+			return nil, err
+		}
+		if err := addElementToTemplate(log, name, nil, &dataElements); err != nil {
+			return nil, err
+		}
+	}
+	dataElements[0].SetUnsigned32Value(observationDomainID)
+	dataElements[1].SetUnsigned32Value(sampling)
+	dataElements[2].SetUnsigned8Value(samplingAlgorithmRandom)
+
+	templateID := exporter.NewTemplateID()
+	templateSet, err := newOptionsTemplateSet(templateID, 1, templateElements)
+	if err != nil {
+		return nil, err
+	}
+	dataSet, err := newOptionsDataSet(templateID, dataElements)
+	if err != nil {
+		return nil, err
+	}
+	options := &SamplingOptions{templateSet: templateSet, dataSet: dataSet}
+	if err := options.send(exporter); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// Resend sends again the options template and its data record if they were last sent before the
+// provided refresh period
+func (o *SamplingOptions) Resend(exporter *ipfixExporter.ExportingProcess, refresh time.Duration) error {
+	if time.Since(o.lastSent) < refresh {
+		return nil
+	}
+	return o.send(exporter)
+}
+
+func (o *SamplingOptions) send(exporter *ipfixExporter.ExportingProcess) error {
+	if _, err := exporter.SendSet(o.templateSet); err != nil {
+		return err
+	}
+	if _, err := exporter.SendSet(o.dataSet); err != nil {
+		return err
+	}
+	o.lastSent = time.Now()
+	return nil
+}
@@ -0,0 +1,192 @@
+package exporter
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware/go-ipfix/pkg/entities"
+	ipfixExporter "github.com/vmware/go-ipfix/pkg/exporter"
+	"github.com/vmware/go-ipfix/pkg/registry"
+)
+
+func TestSendSamplingOptions(t *testing.T) {
+	collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer collector.Close()
+
+	registry.LoadRegistry()
+	exporter, err := ipfixExporter.InitExportingProcess(ipfixExporter.ExporterInput{
+		CollectorAddress:    collector.LocalAddr().String(),
+		CollectorProtocol:   "udp",
+		ObservationDomainID: observationDomainID,
+	})
+	require.NoError(t, err)
+	defer exporter.CloseConnToCollector()
+
+	_, err = SendSamplingOptions(ilog, exporter, 50)
+	require.NoError(t, err)
+
+	// skipping the 16 bytes of the message header
+	template := readSet(t, collector)
+	assert.Equal(t, []byte{
+		0, 3, 0, 22, // options template set ID and set length
+		1, 0, 0, 3, 0, 1, // template ID, field count and scope field count
+		0, 149, 0, 4, // observationDomainId
+		1, 49, 0, 4, // samplingPacketInterval
+		0, 35, 0, 1, // samplingAlgorithm
+	}, template)
+
+	data := readSet(t, collector)
+	assert.Equal(t, []byte{
+		1, 0, 0, 13, // template ID and set length
+		0, 0, 0, 1, // observation domain
+		0, 0, 0, 50, // sampling rate
+		2, // random sampling
+	}, data)
+}
+
+func TestSamplingOptions_Resend(t *testing.T) {
+	collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer collector.Close()
+
+	registry.LoadRegistry()
+	exporter, err := ipfixExporter.InitExportingProcess(ipfixExporter.ExporterInput{
+		CollectorAddress:    collector.LocalAddr().String(),
+		CollectorProtocol:   "udp",
+		ObservationDomainID: observationDomainID,
+	})
+	require.NoError(t, err)
+	defer exporter.CloseConnToCollector()
+
+	options, err := SendSamplingOptions(ilog, exporter, 50)
+	require.NoError(t, err)
+	sent := [][]byte{readSet(t, collector), readSet(t, collector)}
+
+	// the options are not resent before the refresh period
+	require.NoError(t, options.Resend(exporter, time.Hour))
+	options.lastSent = options.lastSent.Add(-2 * time.Hour)
+	require.NoError(t, options.Resend(exporter, time.Hour))
+	assert.Equal(t, sent, [][]byte{readSet(t, collector), readSet(t, collector)})
+	require.NoError(t, collector.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, _, err = collector.ReadFrom(make([]byte, 1024))
+	assert.Error(t, err, "no more sets are expected")
+}
+
+func readSet(t *testing.T, conn net.PacketConn) []byte {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Greater(t, n, 16)
+	assert.EqualValues(t, 10, binary.BigEndian.Uint16(buf[0:2]), "IPFIX version")
+	assert.EqualValues(t, n, binary.BigEndian.Uint16(buf[2:4]), "message length")
+	return buf[16:n]
+}
+
+// fieldSpecifier of a template record (RFC 7011, section 3.2)
+type fieldSpecifier struct {
+	id           uint16
+	length       uint16
+	enterpriseID uint32
+}
+
+// optionsTemplate decoded from an options template record (RFC 7011, section 3.4.2.2)
+type optionsTemplate struct {
+	id         uint16
+	scopeCount int
+	fields     []fieldSpecifier
+}
+
+// decodeOptionsTemplateSet decodes an options template set with a single template record
+func decodeOptionsTemplateSet(t *testing.T, set []byte) optionsTemplate {
+	require.GreaterOrEqual(t, len(set), 10)
+	require.EqualValues(t, 3, binary.BigEndian.Uint16(set[0:2]), "options template set ID")
+	require.EqualValues(t, len(set), binary.BigEndian.Uint16(set[2:4]), "set length")
+	template := optionsTemplate{id: binary.BigEndian.Uint16(set[4:6])}
+	fieldCount := int(binary.BigEndian.Uint16(set[6:8]))
+	template.scopeCount = int(binary.BigEndian.Uint16(set[8:10]))
+	require.NotZero(t, template.scopeCount, "the scope field count must not be zero")
+	require.LessOrEqual(t, template.scopeCount, fieldCount)
+	fields := set[10:]
+	for i := 0; i < fieldCount; i++ {
+		require.GreaterOrEqual(t, len(fields), 4)
+		field := fieldSpecifier{
+			id:     binary.BigEndian.Uint16(fields[0:2]),
+			length: binary.BigEndian.Uint16(fields[2:4]),
+		}
+		fields = fields[4:]
+		// the enterprise bit is followed by the enterprise number
+		if field.id&0x8000 != 0 {
+			require.GreaterOrEqual(t, len(fields), 4)
+			field.id &^= 0x8000
+			field.enterpriseID = binary.BigEndian.Uint32(fields[0:4])
+			fields = fields[4:]
+		}
+		template.fields = append(template.fields, field)
+	}
+	assert.Empty(t, fields, "unexpected bytes after the template record")
+	return template
+}
+
+// decodeDataSet decodes a data set with a single record of the provided template, and returns
+// the values of its fields, by element name
+func decodeDataSet(t *testing.T, set []byte, template optionsTemplate) map[string][]byte {
+	require.GreaterOrEqual(t, len(set), 4)
+	require.Equal(t, template.id, binary.BigEndian.Uint16(set[0:2]), "data set ID")
+	require.EqualValues(t, len(set), binary.BigEndian.Uint16(set[2:4]), "set length")
+	record := set[4:]
+	values := map[string][]byte{}
+	for _, field := range template.fields {
+		require.GreaterOrEqual(t, len(record), int(field.length))
+		element, err := registry.GetInfoElementFromID(field.id, field.enterpriseID)
+		require.NoError(t, err)
+		values[element.Name] = record[:field.length]
+		record = record[field.length:]
+	}
+	assert.Empty(t, record, "unexpected bytes after the data record")
+	return values
+}
+
+func TestSendSamplingOptions_Decode(t *testing.T) {
+	// go-ipfix only sends the sets of its unknown content types as they are
+	require.NotContains(t, []entities.ContentType{entities.Template, entities.Data, entities.Undefined},
+		optionsContentType)
+
+	collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer collector.Close()
+
+	registry.LoadRegistry()
+	exporter, err := ipfixExporter.InitExportingProcess(ipfixExporter.ExporterInput{
+		CollectorAddress:    collector.LocalAddr().String(),
+		CollectorProtocol:   "udp",
+		ObservationDomainID: observationDomainID,
+	})
+	require.NoError(t, err)
+	defer exporter.CloseConnToCollector()
+
+	_, err = SendSamplingOptions(ilog, exporter, 50)
+	require.NoError(t, err)
+
+	// the sets are decoded as a collector would do, so the test does not depend on the way the
+	// options sets are built on top of go-ipfix, which does not support them
+	template := decodeOptionsTemplateSet(t, readSet(t, collector))
+	assert.GreaterOrEqual(t, template.id, uint16(256), "data set IDs start at 256")
+	assert.Equal(t, 1, template.scopeCount)
+	require.Len(t, template.fields, 3)
+	scope, err := registry.GetInfoElementFromID(template.fields[0].id, template.fields[0].enterpriseID)
+	require.NoError(t, err)
+	assert.Equal(t, "observationDomainId", scope.Name)
+
+	values := decodeDataSet(t, readSet(t, collector), template)
+	assert.Equal(t, map[string][]byte{
+		"observationDomainId":    {0, 0, 0, 1},
+		"samplingPacketInterval": {0, 0, 0, 50},
+		"samplingAlgorithm":      {2},
+	}, values)
+}
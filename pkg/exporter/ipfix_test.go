@@ -0,0 +1,57 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware/go-ipfix/pkg/entities"
+	"github.com/vmware/go-ipfix/pkg/registry"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/flow"
+)
+
+func TestAddRecordValuesToTemplate_Biflows(t *testing.T) {
+	registry.LoadRegistry()
+	var uniflow, biflow []entities.InfoElementWithValue
+	require.NoError(t, AddRecordValuesToTemplate(ilog, &uniflow, false))
+	require.NoError(t, AddRecordValuesToTemplate(ilog, &biflow, true))
+	require.Len(t, biflow, len(uniflow)+3)
+
+	record := &flow.Record{Reverse: &flow.ReverseMetrics{Packets: 7, Bytes: 8900, Flags: 0x12}}
+	reverse := biflow[len(uniflow):]
+	for i := range reverse {
+		setIERecordValue(record, &reverse[i])
+		assert.Equal(t, registry.IANAReversedEnterpriseID, reverse[i].GetInfoElement().EnterpriseId)
+	}
+	assert.Equal(t, "reverseOctetDeltaCount", reverse[0].GetName())
+	assert.EqualValues(t, 8900, reverse[0].GetUnsigned64Value())
+	assert.Equal(t, "reversePacketDeltaCount", reverse[1].GetName())
+	assert.EqualValues(t, 7, reverse[1].GetUnsigned64Value())
+	assert.Equal(t, "reverseTcpControlBits", reverse[2].GetName())
+	assert.EqualValues(t, 0x12, reverse[2].GetUnsigned16Value())
+}
+
+func TestAddRecordValuesToTemplate_ConnectionEvents(t *testing.T) {
+	registry.LoadRegistry()
+	var elements []entities.InfoElementWithValue
+	require.NoError(t, AddRecordValuesToTemplate(ilog, &elements, false))
+
+	record := &flow.Record{ConnEvent: flow.ConnEventUpdate, FlowEndReason: flow.FlowEndActiveTimeout}
+	found := 0
+	for i := range elements {
+		switch elements[i].GetName() {
+		case "connectionEvent":
+			setIERecordValue(record, &elements[i])
+			assert.EqualValues(t, NetObservEnterpriseID, elements[i].GetInfoElement().EnterpriseId)
+			assert.EqualValues(t, 2, elements[i].GetUnsigned8Value())
+			found++
+		case "flowEndReason":
+			setIERecordValue(record, &elements[i])
+			assert.Equal(t, registry.IANAEnterpriseID, elements[i].GetInfoElement().EnterpriseId)
+			assert.EqualValues(t, 2, elements[i].GetUnsigned8Value())
+			found++
+		}
+	}
+	assert.Equal(t, 2, found)
+}
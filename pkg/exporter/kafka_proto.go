@@ -51,4 +51,6 @@ type JSONRecord struct {
 	TimeFlowEnd     int64
 	TimeFlowStartMs int64
 	TimeFlowEndMs   int64
+	// Sampling rate of the flow packets. 1 if the packets are not sampled
+	Sampling uint32
 }
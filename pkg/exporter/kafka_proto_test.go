@@ -30,6 +30,8 @@ func TestProtoConversion(t *testing.T) {
 	record.Id.Direction = 1
 	record.Id.SrcMac = [...]byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
 	record.Id.DstMac = [...]byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}
+	record.Id.VlanId = 100
+	record.Id.InnerVlanId = 200
 	record.Id.SrcIp = IPAddrFromNetIP(net.ParseIP("192.1.2.3"))
 	record.Id.DstIp = IPAddrFromNetIP(net.ParseIP("127.3.2.1"))
 	record.Id.SrcPort = 4321
@@ -42,6 +44,33 @@ func TestProtoConversion(t *testing.T) {
 	record.Metrics.Packets = 987
 	record.Metrics.Flags = uint16(1)
 	record.Interface = "veth0"
+	record.TimeFlowRtt = 10 * time.Millisecond
+	record.NetNS = "ns1"
+	record.Id.TunnelType = 1
+	record.Id.TunnelSrcIp = IPAddrFromNetIP(net.ParseIP("10.0.0.1"))
+	record.Id.TunnelDstIp = IPAddrFromNetIP(net.ParseIP("fd00::2"))
+	record.Id.TunnelId = 4242
+	record.Id.NonFirstFragment = 1
+	record.Metrics.FragmentedPackets = 3
+	record.Metrics.SynPackets = 1
+	record.Metrics.FinPackets = 2
+	record.Metrics.RstPackets = 1
+	record.Metrics.DroppedPackets = 2
+	record.Metrics.DroppedBytes = 200
+	record.DropCause = "NETFILTER_DROP"
+	record.Metrics.DnsId = 0x1234
+	record.Metrics.DnsFlags = 0x8183
+	record.Metrics.DnsMonoTimeTs = 1000
+	record.DNSLatency = 5 * time.Millisecond
+	record.Metrics.Retransmits = 3
+	record.Metrics.Sampling = 20
+	record.Reverse = &flow.ReverseMetrics{Packets: 7, Bytes: 8900, Flags: 0x12}
+	record.ConnEvent = flow.ConnEventEnd
+	record.FlowEndReason = flow.FlowEndDetected
+	record.TCPSock = &flow.TCPSockStats{Samples: 2, MinSRTT: time.Millisecond,
+		AvgSRTT: 2 * time.Millisecond, MaxSRTT: 3 * time.Millisecond, MinCwnd: 10, AvgCwnd: 12,
+		MaxCwnd: 14, MinMSS: 1448, AvgMSS: 1448, MaxMSS: 1448}
+	record.Process = &flow.Process{PID: 4242, Command: "curl", CgroupID: 5678, ContainerID: "2f7f3a4b"}
 
 	input <- []*flow.Record{&record}
 	close(input)
@@ -54,6 +83,8 @@ func TestProtoConversion(t *testing.T) {
 	assert.EqualValues(t, 1, r.Direction)
 	assert.EqualValues(t, uint64(0xaabbccddeeff), r.DataLink.SrcMac)
 	assert.EqualValues(t, uint64(0x112233445566), r.DataLink.DstMac)
+	assert.EqualValues(t, 100, r.DataLink.VlanId)
+	assert.EqualValues(t, 200, r.DataLink.InnerVlanId)
 	assert.EqualValues(t, uint64(0xC0010203) /* 192.1.2.3 */, r.Network.SrcAddr.GetIpv4())
 	assert.EqualValues(t, 0x7F030201 /* 127.3.2.1 */, r.Network.DstAddr.GetIpv4())
 	assert.EqualValues(t, 4321, r.Transport.SrcPort)
@@ -66,6 +97,39 @@ func TestProtoConversion(t *testing.T) {
 	assert.EqualValues(t, 987, r.Packets)
 	assert.EqualValues(t, uint16(1), r.Flags)
 	assert.Equal(t, "veth0", r.Interface)
+	assert.Equal(t, 10*time.Millisecond, r.TimeFlowRtt.AsDuration())
+	assert.Equal(t, "ns1", r.Netns)
+	assert.Equal(t, pbflow.TunnelType_VXLAN, r.Tunnel.Type)
+	assert.EqualValues(t, 0x0A000001 /* 10.0.0.1 */, r.Tunnel.SrcAddr.GetIpv4())
+	assert.Equal(t, net.ParseIP("fd00::2").To16(), net.IP(r.Tunnel.DstAddr.GetIpv6()))
+	assert.EqualValues(t, 4242, r.Tunnel.Id)
+	assert.True(t, r.NonFirstFragment)
+	assert.EqualValues(t, 3, r.FragmentedPackets)
+	assert.EqualValues(t, 1, r.SynPackets)
+	assert.EqualValues(t, 2, r.FinPackets)
+	assert.EqualValues(t, 1, r.RstPackets)
+	assert.EqualValues(t, 2, r.DroppedPackets)
+	assert.EqualValues(t, 200, r.DroppedBytes)
+	assert.Equal(t, "NETFILTER_DROP", r.DropCause)
+	assert.EqualValues(t, 0x1234, r.Dns.Id)
+	assert.EqualValues(t, 0x8183, r.Dns.Flags)
+	assert.EqualValues(t, 3, r.Dns.Rcode)
+	assert.Equal(t, 5*time.Millisecond, r.Dns.Latency.AsDuration())
+	assert.EqualValues(t, 3, r.Retransmits)
+	assert.EqualValues(t, 20, r.Sampling)
+	assert.EqualValues(t, 7, r.Reverse.Packets)
+	assert.EqualValues(t, 8900, r.Reverse.Bytes)
+	assert.EqualValues(t, 0x12, r.Reverse.Flags)
+	assert.Equal(t, pbflow.ConnectionEvent_CONNECTION_END, r.ConnectionEvent)
+	assert.Equal(t, pbflow.FlowEndReason_END_OF_FLOW_DETECTED, r.FlowEndReason)
+	assert.EqualValues(t, 2, r.TcpSocket.Samples)
+	assert.Equal(t, 2*time.Millisecond, r.TcpSocket.SrttAvg.AsDuration())
+	assert.EqualValues(t, 14, r.TcpSocket.CwndMax)
+	assert.EqualValues(t, 1448, r.TcpSocket.MssMin)
+	assert.EqualValues(t, 4242, r.Process.Pid)
+	assert.Equal(t, "curl", r.Process.Command)
+	assert.EqualValues(t, 5678, r.Process.CgroupId)
+	assert.Equal(t, "2f7f3a4b", r.Process.ContainerId)
 }
 
 type writerCapturer struct {
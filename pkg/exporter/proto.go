@@ -3,9 +3,11 @@ package exporter
 import (
 	"encoding/binary"
 	"net"
+	"time"
 
 	"github.com/netobserv/netobserv-ebpf-agent/pkg/flow"
 	"github.com/netobserv/netobserv-ebpf-agent/pkg/pbflow"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -42,8 +44,10 @@ func v4FlowToPB(fr *flow.Record) *pbflow.Record {
 		EthProtocol: uint32(fr.Id.EthProtocol),
 		Direction:   pbflow.Direction(fr.Id.Direction),
 		DataLink: &pbflow.DataLink{
-			SrcMac: macToUint64(&fr.Id.SrcMac),
-			DstMac: macToUint64(&fr.Id.DstMac),
+			SrcMac:      macToUint64(&fr.Id.SrcMac),
+			DstMac:      macToUint64(&fr.Id.DstMac),
+			VlanId:      uint32(fr.Id.VlanId),
+			InnerVlanId: uint32(fr.Id.InnerVlanId),
 		},
 		Network: &pbflow.Network{
 			SrcAddr: &pbflow.IP{IpFamily: &pbflow.IP_Ipv4{Ipv4: flow.IntEncodeV4(fr.Id.SrcIp)}},
@@ -67,11 +71,30 @@ func v4FlowToPB(fr *flow.Record) *pbflow.Record {
 			Seconds: fr.TimeFlowEnd.Unix(),
 			Nanos:   int32(fr.TimeFlowEnd.Nanosecond()),
 		},
-		Packets:   uint64(fr.Metrics.Packets),
-		Duplicate: fr.Duplicate,
-		AgentIp:   agentIP(fr.AgentIP),
-		Flags:     uint32(fr.Metrics.Flags),
-		Interface: string(fr.Interface),
+		Packets:           uint64(fr.Metrics.Packets),
+		Duplicate:         fr.Duplicate,
+		AgentIp:           ipToPB(fr.AgentIP),
+		Flags:             uint32(fr.Metrics.Flags),
+		Interface:         string(fr.Interface),
+		TimeFlowRtt:       durationToPB(fr.TimeFlowRtt),
+		Netns:             fr.NetNS,
+		Tunnel:            tunnelToPB(fr),
+		NonFirstFragment:  fr.Id.NonFirstFragment != 0,
+		FragmentedPackets: uint64(fr.Metrics.FragmentedPackets),
+		SynPackets:        uint64(fr.Metrics.SynPackets),
+		FinPackets:        uint64(fr.Metrics.FinPackets),
+		RstPackets:        uint64(fr.Metrics.RstPackets),
+		DroppedPackets:    uint64(fr.Metrics.DroppedPackets),
+		DroppedBytes:      fr.Metrics.DroppedBytes,
+		DropCause:         fr.DropCause,
+		Dns:               dnsToPB(fr),
+		Retransmits:       uint64(fr.Metrics.Retransmits),
+		TcpSocket:         tcpSockToPB(fr.TCPSock),
+		Process:           processToPB(fr.Process),
+		Sampling:          fr.Metrics.Sampling,
+		Reverse:           reverseToPB(fr.Reverse),
+		ConnectionEvent:   pbflow.ConnectionEvent(fr.ConnEvent),
+		FlowEndReason:     pbflow.FlowEndReason(fr.FlowEndReason),
 	}
 }
 
@@ -80,8 +103,10 @@ func v6FlowToPB(fr *flow.Record) *pbflow.Record {
 		EthProtocol: uint32(fr.Id.EthProtocol),
 		Direction:   pbflow.Direction(fr.Id.Direction),
 		DataLink: &pbflow.DataLink{
-			SrcMac: macToUint64(&fr.Id.SrcMac),
-			DstMac: macToUint64(&fr.Id.DstMac),
+			SrcMac:      macToUint64(&fr.Id.SrcMac),
+			DstMac:      macToUint64(&fr.Id.DstMac),
+			VlanId:      uint32(fr.Id.VlanId),
+			InnerVlanId: uint32(fr.Id.InnerVlanId),
 		},
 		Network: &pbflow.Network{
 			SrcAddr: &pbflow.IP{IpFamily: &pbflow.IP_Ipv6{Ipv6: fr.Id.SrcIp[:]}},
@@ -105,11 +130,30 @@ func v6FlowToPB(fr *flow.Record) *pbflow.Record {
 			Seconds: fr.TimeFlowEnd.Unix(),
 			Nanos:   int32(fr.TimeFlowEnd.Nanosecond()),
 		},
-		Packets:   uint64(fr.Metrics.Packets),
-		Flags:     uint32(fr.Metrics.Flags),
-		Interface: fr.Interface,
-		Duplicate: fr.Duplicate,
-		AgentIp:   agentIP(fr.AgentIP),
+		Packets:           uint64(fr.Metrics.Packets),
+		Flags:             uint32(fr.Metrics.Flags),
+		Interface:         fr.Interface,
+		Duplicate:         fr.Duplicate,
+		AgentIp:           ipToPB(fr.AgentIP),
+		TimeFlowRtt:       durationToPB(fr.TimeFlowRtt),
+		Netns:             fr.NetNS,
+		Tunnel:            tunnelToPB(fr),
+		NonFirstFragment:  fr.Id.NonFirstFragment != 0,
+		FragmentedPackets: uint64(fr.Metrics.FragmentedPackets),
+		SynPackets:        uint64(fr.Metrics.SynPackets),
+		FinPackets:        uint64(fr.Metrics.FinPackets),
+		RstPackets:        uint64(fr.Metrics.RstPackets),
+		DroppedPackets:    uint64(fr.Metrics.DroppedPackets),
+		DroppedBytes:      fr.Metrics.DroppedBytes,
+		DropCause:         fr.DropCause,
+		Dns:               dnsToPB(fr),
+		Retransmits:       uint64(fr.Metrics.Retransmits),
+		TcpSocket:         tcpSockToPB(fr.TCPSock),
+		Process:           processToPB(fr.Process),
+		Sampling:          fr.Metrics.Sampling,
+		Reverse:           reverseToPB(fr.Reverse),
+		ConnectionEvent:   pbflow.ConnectionEvent(fr.ConnEvent),
+		FlowEndReason:     pbflow.FlowEndReason(fr.FlowEndReason),
 	}
 }
 
@@ -124,7 +168,84 @@ func macToUint64(m *[flow.MacLen]uint8) uint64 {
 		(uint64(m[0]) << 40)
 }
 
-func agentIP(nip net.IP) *pbflow.IP {
+// durationToPB returns nil if the duration (e.g. the RTT) hasn't been calculated, so the field
+// is not encoded
+func durationToPB(d time.Duration) *durationpb.Duration {
+	if d == 0 {
+		return nil
+	}
+	return durationpb.New(d)
+}
+
+// tunnelToPB returns nil if the flow packets have not been decapsulated, so the field is not encoded
+func tunnelToPB(fr *flow.Record) *pbflow.Tunnel {
+	if fr.Id.TunnelType == 0 {
+		return nil
+	}
+	return &pbflow.Tunnel{
+		Type:    pbflow.TunnelType(fr.Id.TunnelType),
+		SrcAddr: ipToPB(flow.IP(fr.Id.TunnelSrcIp)),
+		DstAddr: ipToPB(flow.IP(fr.Id.TunnelDstIp)),
+		Id:      fr.Id.TunnelId,
+	}
+}
+
+// dnsToPB returns nil if the flow did not carry any DNS message, so the field is not encoded
+func dnsToPB(fr *flow.Record) *pbflow.Dns {
+	if fr.Metrics.DnsMonoTimeTs == 0 {
+		return nil
+	}
+	return &pbflow.Dns{
+		Id:      uint32(fr.Metrics.DnsId),
+		Flags:   uint32(fr.Metrics.DnsFlags),
+		Rcode:   uint32(fr.Metrics.DnsFlags & flow.DNSRcodeMask),
+		Latency: durationToPB(fr.DNSLatency),
+	}
+}
+
+func tcpSockToPB(s *flow.TCPSockStats) *pbflow.TcpSocket {
+	if s == nil {
+		return nil
+	}
+	return &pbflow.TcpSocket{
+		Samples: s.Samples,
+		SrttMin: durationpb.New(s.MinSRTT),
+		SrttAvg: durationpb.New(s.AvgSRTT),
+		SrttMax: durationpb.New(s.MaxSRTT),
+		CwndMin: s.MinCwnd,
+		CwndAvg: s.AvgCwnd,
+		CwndMax: s.MaxCwnd,
+		MssMin:  s.MinMSS,
+		MssAvg:  s.AvgMSS,
+		MssMax:  s.MaxMSS,
+	}
+}
+
+func processToPB(p *flow.Process) *pbflow.Process {
+	if p == nil {
+		return nil
+	}
+	return &pbflow.Process{
+		Pid:         p.PID,
+		Command:     p.Command,
+		CgroupId:    p.CgroupID,
+		ContainerId: p.ContainerID,
+	}
+}
+
+// reverseToPB returns nil for the unidirectional flows, so the field is not encoded
+func reverseToPB(r *flow.ReverseMetrics) *pbflow.Reverse {
+	if r == nil {
+		return nil
+	}
+	return &pbflow.Reverse{
+		Bytes:   r.Bytes,
+		Packets: uint64(r.Packets),
+		Flags:   uint32(r.Flags),
+	}
+}
+
+func ipToPB(nip net.IP) *pbflow.IP {
 	if ip := nip.To4(); ip != nil {
 		return &pbflow.IP{IpFamily: &pbflow.IP_Ipv4{Ipv4: binary.BigEndian.Uint32(ip)}}
 	}
@@ -0,0 +1,278 @@
+package flow
+
+import (
+	"bytes"
+	"container/list"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var bflog = logrus.WithField("component", "flow/BiflowMerger")
+
+// ReverseMetrics are the metrics of the reverse direction of a bidirectional flow (RFC 5103),
+// this is, of the packets that are sent by the responder of the flow
+type ReverseMetrics struct {
+	Packets uint32
+	Bytes   uint64
+	Flags   uint16
+}
+
+// biflowKey identifies the flows of both directions of a connection, as observed from a given
+// interface. The endpoints are sorted, so the flows of both directions have the same key
+type biflowKey struct {
+	ifIndex     uint32
+	ifNetns     uint32
+	ethProtocol uint16
+	transport   uint8
+	vlanID      uint16
+	innerVlanID uint16
+	tunnelType  uint8
+	tunnelID    uint32
+	duplicate   bool
+	lowIP       IPAddr
+	highIP      IPAddr
+	lowPort     uint16
+	highPort    uint16
+}
+
+// pendingFlow is a record that is waiting for the record of its reverse direction
+type pendingFlow struct {
+	key        *biflowKey
+	record     *Record
+	expiryTime time.Time
+}
+
+// biflowCache stores the records whose reverse direction has not been received yet.
+// Its entries are forwarded as unidirectional flows if they are not paired during the window.
+// It is not safe for concurrent access.
+type biflowCache struct {
+	window time.Duration
+	// key: biflow key
+	// value: listElement pointing to a pendingFlow struct
+	pending map[biflowKey]*list.Element
+	// element: pendingFlow structs of the pending map ordered by expiry time
+	entries *list.List
+}
+
+// MergeBiflows pairs the records of both directions of the same connection, as observed from the
+// same interface, and forwards them as a single bidirectional flow (RFC 5103). The merged record
+// describes the direction of the initiator, and its Reverse field describes the direction of the
+// responder. Its time range covers both directions. The rest of its metrics (e.g. the dropped
+// packets) only describe the direction of the initiator, except the fields that describe the
+// whole connection (RTT, DNS latency, TCP socket and process), which are taken from any of them.
+//
+// The initiator is the endpoint that sent the TCP SYN packet. If it is not known (e.g. for the
+// connections that started before the last eviction or for other protocols), it is the endpoint
+// whose flow started first.
+//
+// The records are forwarded once they are paired. The records whose reverse direction is not
+// received during the window are forwarded as unidirectional flows when it expires, so they are
+// delayed up to the window duration.
+func MergeBiflows(window time.Duration) func(in <-chan []*Record, out chan<- []*Record) {
+	cache := newBiflowCache(window)
+	return func(in <-chan []*Record, out chan<- []*Record) {
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+		for {
+			select {
+			case records, ok := <-in:
+				if !ok {
+					if flushed := cache.flush(); len(flushed) > 0 {
+						out <- flushed
+					}
+					return
+				}
+				if merged := cache.merge(records); len(merged) > 0 {
+					out <- merged
+				}
+			case <-ticker.C:
+				if expired := cache.removeExpired(nil); len(expired) > 0 {
+					out <- expired
+				}
+			}
+		}
+	}
+}
+
+func newBiflowCache(window time.Duration) *biflowCache {
+	return &biflowCache{
+		window:  window,
+		entries: list.New(),
+		pending: map[biflowKey]*list.Element{},
+	}
+}
+
+// merge returns the biflows of the records whose reverse direction has been already received,
+// and the expired records that have not been paired
+func (c *biflowCache) merge(records []*Record) []*Record {
+	merged := c.removeExpired(make([]*Record, 0, len(records)))
+	// the records of the same batch expire at the same time, so they are forwarded together if
+	// they are not paired
+	expiryTime := timeNow().Add(c.window)
+	for _, record := range records {
+		key := biflowKeyOf(record)
+		ele, ok := c.pending[key]
+		if !ok {
+			c.add(key, record, expiryTime)
+			continue
+		}
+		pending := ele.Value.(*pendingFlow).record
+		c.entries.Remove(ele)
+		delete(c.pending, key)
+		if isReverse(pending, record) {
+			merged = append(merged, mergeBiflow(pending, record))
+		} else {
+			// a newer record of the same direction: the pending one won't be paired
+			merged = append(merged, pending)
+			c.add(key, record, expiryTime)
+		}
+	}
+	return merged
+}
+
+func (c *biflowCache) add(key biflowKey, record *Record, expiryTime time.Time) {
+	c.pending[key] = c.entries.PushFront(&pendingFlow{
+		key:        &key,
+		record:     record,
+		expiryTime: expiryTime,
+	})
+}
+
+// removeExpired appends to the provided slice the records that have not been paired during the
+// window, and returns it
+func (c *biflowCache) removeExpired(expired []*Record) []*Record {
+	now := timeNow()
+	evicted := 0
+	ele := c.entries.Back()
+	for ele != nil && now.After(ele.Value.(*pendingFlow).expiryTime) {
+		evicted++
+		pf := ele.Value.(*pendingFlow)
+		expired = append(expired, pf.record)
+		c.entries.Remove(ele)
+		delete(c.pending, *pf.key)
+		ele = c.entries.Back()
+	}
+	if evicted > 0 {
+		bflog.WithFields(logrus.Fields{
+			"current": c.entries.Len(),
+			"evicted": evicted,
+			"window":  c.window,
+		}).Debug("unpaired flows forwarded as unidirectional flows")
+	}
+	return expired
+}
+
+// flush returns all the records that are waiting to be paired
+func (c *biflowCache) flush() []*Record {
+	records := make([]*Record, 0, c.entries.Len())
+	for ele := c.entries.Back(); ele != nil; ele = ele.Prev() {
+		records = append(records, ele.Value.(*pendingFlow).record)
+	}
+	c.entries.Init()
+	c.pending = map[biflowKey]*list.Element{}
+	return records
+}
+
+func biflowKeyOf(r *Record) biflowKey {
+	key := biflowKey{
+		ifIndex:     r.Id.IfIndex,
+		ifNetns:     r.Id.IfNetns,
+		ethProtocol: r.Id.EthProtocol,
+		transport:   r.Id.TransportProtocol,
+		vlanID:      r.Id.VlanId,
+		innerVlanID: r.Id.InnerVlanId,
+		tunnelType:  r.Id.TunnelType,
+		tunnelID:    r.Id.TunnelId,
+		duplicate:   r.Duplicate,
+		lowIP:       r.Id.SrcIp,
+		highIP:      r.Id.DstIp,
+		lowPort:     r.Id.SrcPort,
+		highPort:    r.Id.DstPort,
+	}
+	if cmp := bytes.Compare(key.lowIP[:], key.highIP[:]); cmp > 0 ||
+		(cmp == 0 && key.lowPort > key.highPort) {
+		key.lowIP, key.highIP = key.highIP, key.lowIP
+		key.lowPort, key.highPort = key.highPort, key.lowPort
+	}
+	return key
+}
+
+// isReverse returns whether the records have the same key and the endpoints of one of them are
+// swapped with respect to the other
+func isReverse(a, b *Record) bool {
+	return a.Id.SrcIp == b.Id.DstIp && a.Id.SrcPort == b.Id.DstPort &&
+		a.Id.DstIp == b.Id.SrcIp && a.Id.DstPort == b.Id.SrcPort
+}
+
+// isInitiator returns whether the record a is sent by the initiator of the connection, given b,
+// the record of its reverse direction
+func isInitiator(a, b *Record) bool {
+	aSyn := a.Metrics.Flags&TCPSynFlag != 0 && a.Metrics.Flags&TCPSynAckFlag == 0
+	bSyn := b.Metrics.Flags&TCPSynFlag != 0 && b.Metrics.Flags&TCPSynAckFlag == 0
+	if aSyn != bSyn {
+		return aSyn
+	}
+	return a.Metrics.StartMonoTimeTs <= b.Metrics.StartMonoTimeTs
+}
+
+// mergeBiflow returns the record of the initiator, with the metrics of the responder in its
+// Reverse field
+func mergeBiflow(a, b *Record) *Record {
+	fwd, rev := a, b
+	if !isInitiator(a, b) {
+		fwd, rev = b, a
+	}
+	fwd.Reverse = &ReverseMetrics{
+		Packets: rev.Metrics.Packets,
+		Bytes:   rev.Metrics.Bytes,
+		Flags:   rev.Metrics.Flags,
+	}
+	if rev.Metrics.StartMonoTimeTs < fwd.Metrics.StartMonoTimeTs {
+		fwd.Metrics.StartMonoTimeTs = rev.Metrics.StartMonoTimeTs
+		fwd.TimeFlowStart = rev.TimeFlowStart
+	}
+	if rev.Metrics.EndMonoTimeTs > fwd.Metrics.EndMonoTimeTs {
+		fwd.Metrics.EndMonoTimeTs = rev.Metrics.EndMonoTimeTs
+		fwd.TimeFlowEnd = rev.TimeFlowEnd
+	}
+	if fwd.TimeFlowRtt == 0 {
+		fwd.TimeFlowRtt = rev.TimeFlowRtt
+	}
+	if fwd.DNSLatency == 0 {
+		fwd.DNSLatency = rev.DNSLatency
+	}
+	if fwd.TCPSock == nil {
+		fwd.TCPSock = rev.TCPSock
+	}
+	if fwd.Process == nil {
+		fwd.Process = rev.Process
+	}
+	return fwd
+}
+
+// reverseBiflow swaps the direction of the initiator with the direction of the responder of the
+// biflow. The metrics that are only reported for the direction of the initiator (e.g. the dropped
+// packets) are discarded, as they describe the responder after the swap
+func reverseBiflow(r *Record) {
+	r.Id.SrcIp, r.Id.DstIp = r.Id.DstIp, r.Id.SrcIp
+	r.Id.SrcPort, r.Id.DstPort = r.Id.DstPort, r.Id.SrcPort
+	r.Id.SrcMac, r.Id.DstMac = r.Id.DstMac, r.Id.SrcMac
+	r.Id.TunnelSrcIp, r.Id.TunnelDstIp = r.Id.TunnelDstIp, r.Id.TunnelSrcIp
+	if r.Id.Direction == DirectionIngress {
+		r.Id.Direction = DirectionEgress
+	} else {
+		r.Id.Direction = DirectionIngress
+	}
+	r.Metrics.Packets, r.Reverse.Packets = r.Reverse.Packets, r.Metrics.Packets
+	r.Metrics.Bytes, r.Reverse.Bytes = r.Reverse.Bytes, r.Metrics.Bytes
+	r.Metrics.Flags, r.Reverse.Flags = r.Reverse.Flags, r.Metrics.Flags
+	r.Metrics.FragmentedPackets = 0
+	r.Metrics.SynPackets = 0
+	r.Metrics.FinPackets = 0
+	r.Metrics.RstPackets = 0
+	r.Metrics.DroppedPackets = 0
+	r.Metrics.DroppedBytes = 0
+	r.Metrics.DropReason = 0
+	r.DropCause = ""
+}
@@ -0,0 +1,89 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
+)
+
+func biflowRecords(clientFlags, serverFlags uint16, clientStart, serverStart uint64) (client, server *Record) {
+	client = &Record{RawRecord: RawRecord{Id: ebpf.BpfFlowId{
+		Direction: DirectionEgress, TransportProtocol: TCPProtocol, IfIndex: 3,
+		SrcIp: srcAddr1, DstIp: dstAddr1, SrcPort: 34567, DstPort: 443,
+	}, Metrics: ebpf.BpfFlowMetrics{
+		Packets: 10, Bytes: 1000, Flags: clientFlags,
+		StartMonoTimeTs: clientStart, EndMonoTimeTs: clientStart + 500,
+	}}}
+	server = &Record{RawRecord: RawRecord{Id: ebpf.BpfFlowId{
+		Direction: DirectionIngress, TransportProtocol: TCPProtocol, IfIndex: 3,
+		SrcIp: dstAddr1, DstIp: srcAddr1, SrcPort: 443, DstPort: 34567,
+	}, Metrics: ebpf.BpfFlowMetrics{
+		Packets: 20, Bytes: 30000, Flags: serverFlags,
+		StartMonoTimeTs: serverStart, EndMonoTimeTs: serverStart + 1000,
+	}}}
+	client.TimeFlowRtt = 300 * time.Microsecond
+	server.Process = &Process{PID: 42}
+	return client, server
+}
+
+func TestMergeBiflows(t *testing.T) {
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+	go MergeBiflows(time.Minute)(input, output)
+
+	// the SYN sender is the initiator, even if the server flow started first
+	client, server := biflowRecords(TCPSynFlag|0x10, TCPSynAckFlag|0x10, 1000, 900)
+	input <- []*Record{server, client}
+	received := receiveTimeout(t, output)
+	require.Equal(t, []*Record{client}, received)
+	assert.Equal(t, &ReverseMetrics{Packets: 20, Bytes: 30000, Flags: TCPSynAckFlag | 0x10}, client.Reverse)
+	assert.EqualValues(t, 10, client.Metrics.Packets)
+	assert.EqualValues(t, 1000, client.Metrics.Bytes)
+	// the time range covers both directions
+	assert.EqualValues(t, 900, client.Metrics.StartMonoTimeTs)
+	assert.EqualValues(t, 1900, client.Metrics.EndMonoTimeTs)
+	// the connection fields are taken from any direction
+	assert.Equal(t, 300*time.Microsecond, client.TimeFlowRtt)
+	assert.Equal(t, &Process{PID: 42}, client.Process)
+}
+
+func TestMergeBiflows_NoHandshake(t *testing.T) {
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+	go MergeBiflows(time.Minute)(input, output)
+
+	// without handshake, the first flow is the initiator. The flows are paired across batches
+	client, server := biflowRecords(0x10, 0x10, 1000, 1100)
+	input <- []*Record{server}
+	input <- []*Record{client}
+	received := receiveTimeout(t, output)
+	require.Equal(t, []*Record{client}, received)
+	assert.EqualValues(t, 30000, client.Reverse.Bytes)
+}
+
+func TestMergeBiflows_Unpaired(t *testing.T) {
+	tm := mockTimeNow(t)
+	cache := newBiflowCache(time.Hour)
+
+	client, server := biflowRecords(0x10, 0x10, 1000, 1100)
+	// flows from other interfaces or marked as duplicates are not paired
+	otherIface := *server
+	otherIface.Id.IfIndex = 4
+	duplicate := *server
+	duplicate.Duplicate = true
+	assert.Empty(t, cache.merge([]*Record{client, &otherIface, &duplicate}))
+
+	// after the window, the unpaired records are forwarded as unidirectional flows
+	tm.now = tm.now.Add(2 * time.Hour)
+	assert.Equal(t, []*Record{client, &otherIface, &duplicate}, cache.merge([]*Record{server}))
+	assert.Nil(t, client.Reverse)
+
+	// the pending records are forwarded when the input is closed
+	assert.Equal(t, []*Record{server}, cache.flush())
+	assert.Nil(t, server.Reverse)
+	assert.Empty(t, cache.pending)
+}
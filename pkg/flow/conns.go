@@ -0,0 +1,271 @@
+package flow
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
+)
+
+var cmlog = logrus.WithField("component", "flow/ConnMetrics")
+
+// connMerger merges the metrics of the TCP connections, which are reported by the programs that
+// hook on to the TCP stack without being attached to any interface, into the flows of the same
+// connection. It is not safe for concurrent access.
+type connMerger[T any] struct {
+	// expiry is the time during which the metrics of the connections without flows are kept, as
+	// their packets might be evicted later
+	expiry time.Duration
+	// pending stores the metrics of the connections whose flows were not found in the
+	// previous merges
+	pending map[ebpf.ConnId]pendingConn[T]
+	// accumulate adds the src metrics to the dst metrics of the same connection
+	accumulate func(dst *T, src *T)
+	// set stores the metrics of the connection into one of its flows
+	set func(record *Record, metrics *T)
+}
+
+// pendingConn stores the metrics of a connection whose flows have not been found yet
+type pendingConn[T any] struct {
+	metrics    T
+	expiryTime time.Time
+}
+
+// connMetricsFetcher provides the metrics of the TCP connections from the eBPF maps
+type connMetricsFetcher interface {
+	LookupAndDeleteRetransmits() map[ebpf.ConnId]uint32
+	LookupAndDeleteTCPSockSamples() map[ebpf.ConnId][]ebpf.TcpSockSamples
+	LookupProcesses() map[ebpf.ConnId]ebpf.OwnerProcess
+}
+
+// MergeConnMetrics sets the TCP retransmissions, the TCP socket samples and the owner process
+// of the TCP connections into their flows, which are either evicted from the eBPF maps or
+// accounted from the ring buffer. The metrics are read from the fetcher for each group of
+// flows, and the metrics of the connections without flows are kept for the expiry duration.
+func MergeConnMetrics(
+	fetcher connMetricsFetcher, expiry time.Duration,
+) func(in <-chan []*Record, out chan<- []*Record) {
+	retransmits := newRetransmitsMerger(expiry)
+	tcpSock := newTCPSockMerger(expiry)
+	return func(in <-chan []*Record, out chan<- []*Record) {
+		for records := range in {
+			retransmits.merge(records, fetcher.LookupAndDeleteRetransmits())
+			tcpSock.merge(records, aggregateTCPSockSamples(fetcher.LookupAndDeleteTCPSockSamples()))
+			setProcesses(records, fetcher.LookupProcesses())
+			out <- records
+		}
+	}
+}
+
+// connID returns the identifier of the TCP connection whose packets are accounted in the flow
+func connID(id *ebpf.BpfFlowId) ebpf.ConnId {
+	return ebpf.ConnId{
+		EthProtocol:       id.EthProtocol,
+		SrcIp:             id.SrcIp,
+		DstIp:             id.DstIp,
+		SrcPort:           id.SrcPort,
+		DstPort:           id.DstPort,
+		TransportProtocol: id.TransportProtocol,
+	}
+}
+
+// merge sets the metrics of the connections into the TCP flows with the same addresses, ports
+// and direction as the connection. If the connection packets were observed from multiple
+// interfaces, the metrics are set in all their flows, as the other flow metrics are.
+// The metrics that can't be merged are kept for the next invocations, until they expire.
+func (m *connMerger[T]) merge(records []*Record, metrics map[ebpf.ConnId]T) {
+	if len(metrics) == 0 && len(m.pending) == 0 {
+		return
+	}
+	now := timeNow()
+	// the pending metrics are accumulated with the new metrics of the same connection
+	combined := make(map[ebpf.ConnId]pendingConn[T], len(metrics)+len(m.pending))
+	discarded := 0
+	for id, pending := range m.pending {
+		if now.After(pending.expiryTime) {
+			discarded++
+			continue
+		}
+		combined[id] = pending
+	}
+	for id, current := range metrics {
+		if pending, ok := combined[id]; ok {
+			m.accumulate(&pending.metrics, &current)
+			combined[id] = pending
+		} else {
+			combined[id] = pendingConn[T]{metrics: current, expiryTime: now.Add(m.expiry)}
+		}
+	}
+	merged := map[ebpf.ConnId]struct{}{}
+	for _, record := range records {
+		if record.Id.TransportProtocol != TCPProtocol {
+			continue
+		}
+		id := connID(&record.Id)
+		if conn, ok := combined[id]; ok {
+			m.set(record, &conn.metrics)
+			merged[id] = struct{}{}
+		}
+	}
+	if discarded > 0 {
+		cmlog.WithField("connections", discarded).
+			Debug("discarding TCP connection metrics without flows")
+	}
+	m.pending = map[ebpf.ConnId]pendingConn[T]{}
+	for id, conn := range combined {
+		if _, ok := merged[id]; !ok {
+			m.pending[id] = conn
+		}
+	}
+}
+
+// setProcesses sets the process that owns the local socket of the TCP connection of each flow.
+// The flows that are sent from the local endpoint are attributed to the owner of the
+// connection, and the flows that are received by the local endpoint to the owner of the reverse
+// connection. As the connections stay established across multiple evictions, the owners are
+// not removed after being set.
+func setProcesses(records []*Record, owners map[ebpf.ConnId]ebpf.OwnerProcess) {
+	if len(owners) == 0 {
+		return
+	}
+	for _, record := range records {
+		if record.Id.TransportProtocol != TCPProtocol {
+			continue
+		}
+		id := connID(&record.Id)
+		owner, ok := owners[id]
+		if !ok {
+			id.SrcIp, id.DstIp = id.DstIp, id.SrcIp
+			id.SrcPort, id.DstPort = id.DstPort, id.SrcPort
+			if owner, ok = owners[id]; !ok {
+				continue
+			}
+		}
+		record.Process = &Process{
+			PID:      owner.Pid,
+			Command:  commandName(owner.Comm[:]),
+			CgroupID: owner.CgroupId,
+		}
+	}
+}
+
+// commandName returns the process command from its null-terminated kernel representation
+func commandName(comm []uint8) string {
+	if end := bytes.IndexByte(comm, 0); end >= 0 {
+		comm = comm[:end]
+	}
+	return string(comm)
+}
+
+// newRetransmitsMerger adds the TCP retransmission counters of the connections to their flows
+func newRetransmitsMerger(expiry time.Duration) connMerger[uint32] {
+	return connMerger[uint32]{
+		expiry: expiry,
+		accumulate: func(dst *uint32, src *uint32) {
+			*dst += *src
+		},
+		set: func(record *Record, retransmits *uint32) {
+			record.Metrics.Retransmits += *retransmits
+		},
+	}
+}
+
+// TCPSockStats summarizes the samples of the state of the local socket of a TCP connection,
+// taken when it receives a segment
+type TCPSockStats struct {
+	Samples uint32
+	// smoothed round-trip time, as estimated by the TCP stack
+	MinSRTT time.Duration
+	AvgSRTT time.Duration
+	MaxSRTT time.Duration
+	// congestion window, in segments
+	MinCwnd uint32
+	AvgCwnd uint32
+	MaxCwnd uint32
+	// maximum segment size of the sent segments
+	MinMSS uint32
+	AvgMSS uint32
+	MaxMSS uint32
+}
+
+// newTCPSockMerger sets the summary of the TCP socket samples of the connections in their flows
+func newTCPSockMerger(expiry time.Duration) connMerger[ebpf.TcpSockSamples] {
+	return connMerger[ebpf.TcpSockSamples]{
+		expiry:     expiry,
+		accumulate: accumulateTCPSockSamples,
+		set: func(record *Record, samples *ebpf.TcpSockSamples) {
+			record.TCPSock = tcpSockStats(samples)
+		},
+	}
+}
+
+// accumulateTCPSockSamples adds the src samples to the dst samples of the same connection
+func accumulateTCPSockSamples(dst *ebpf.TcpSockSamples, src *ebpf.TcpSockSamples) {
+	if src.Count == 0 {
+		return
+	}
+	if dst.Count == 0 {
+		*dst = *src
+		return
+	}
+	dst.Count += src.Count
+	dst.SrttMin = minUint32(dst.SrttMin, src.SrttMin)
+	dst.SrttMax = maxUint32(dst.SrttMax, src.SrttMax)
+	dst.SrttSum += src.SrttSum
+	dst.CwndMin = minUint32(dst.CwndMin, src.CwndMin)
+	dst.CwndMax = maxUint32(dst.CwndMax, src.CwndMax)
+	dst.CwndSum += src.CwndSum
+	dst.MssMin = minUint32(dst.MssMin, src.MssMin)
+	dst.MssMax = maxUint32(dst.MssMax, src.MssMax)
+	dst.MssSum += src.MssSum
+}
+
+// aggregateTCPSockSamples accumulates the per-CPU samples of each connection
+func aggregateTCPSockSamples(conns map[ebpf.ConnId][]ebpf.TcpSockSamples) map[ebpf.ConnId]ebpf.TcpSockSamples {
+	aggregated := make(map[ebpf.ConnId]ebpf.TcpSockSamples, len(conns))
+	for id, perCPU := range conns {
+		aggr := ebpf.TcpSockSamples{}
+		for i := range perCPU {
+			accumulateTCPSockSamples(&aggr, &perCPU[i])
+		}
+		if aggr.Count > 0 {
+			aggregated[id] = aggr
+		}
+	}
+	return aggregated
+}
+
+func tcpSockStats(s *ebpf.TcpSockSamples) *TCPSockStats {
+	if s.Count == 0 {
+		return nil
+	}
+	count := uint64(s.Count)
+	return &TCPSockStats{
+		Samples: s.Count,
+		MinSRTT: time.Duration(s.SrttMin) * time.Microsecond,
+		AvgSRTT: time.Duration(s.SrttSum/count) * time.Microsecond,
+		MaxSRTT: time.Duration(s.SrttMax) * time.Microsecond,
+		MinCwnd: s.CwndMin,
+		AvgCwnd: uint32(s.CwndSum / count),
+		MaxCwnd: s.CwndMax,
+		MinMSS:  s.MssMin,
+		AvgMSS:  uint32(s.MssSum / count),
+		MaxMSS:  s.MssMax,
+	}
+}
+
+func minUint32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxUint32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
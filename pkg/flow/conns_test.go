@@ -0,0 +1,155 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
+)
+
+func tcpRecord(id ebpf.BpfFlowId, ifIndex uint32) *Record {
+	id.TransportProtocol = TCPProtocol
+	id.IfIndex = ifIndex
+	return &Record{RawRecord: RawRecord{Id: id}}
+}
+
+func TestConnMerger_Retransmits(t *testing.T) {
+	tm := mockTimeNow(t)
+	m := newRetransmitsMerger(time.Minute)
+	// the same connection observed from two interfaces, and its reverse direction
+	fromHost := tcpRecord(k1, 1)
+	fromPod := tcpRecord(k1, 2)
+	reverse := tcpRecord(ebpf.BpfFlowId{
+		SrcIp: k1.DstIp, DstIp: k1.SrcIp, SrcPort: k1.DstPort, DstPort: k1.SrcPort}, 1)
+	// a non-TCP flow with the same addresses and ports
+	udp := &Record{RawRecord: RawRecord{Id: k1}}
+	udp.Id.TransportProtocol = udpProtocol
+	other := tcpRecord(k2, 1)
+
+	k1Conn := connID(&fromHost.Id)
+	k3Conn := connID(&tcpRecord(k3, 0).Id)
+	m.merge([]*Record{fromHost, fromPod, reverse, udp, other},
+		map[ebpf.ConnId]uint32{k1Conn: 3, k3Conn: 2})
+
+	assert.EqualValues(t, 3, fromHost.Metrics.Retransmits)
+	assert.EqualValues(t, 3, fromPod.Metrics.Retransmits)
+	assert.Zero(t, reverse.Metrics.Retransmits)
+	assert.Zero(t, udp.Metrics.Retransmits)
+	assert.Zero(t, other.Metrics.Retransmits)
+
+	// the retransmissions of connections without flows are merged in the next invocations,
+	// together with the new ones
+	m.merge([]*Record{other}, nil)
+	tm.now = tm.now.Add(30 * time.Second)
+	k3Flow := tcpRecord(k3, 1)
+	m.merge([]*Record{k3Flow}, map[ebpf.ConnId]uint32{k3Conn: 1})
+	assert.EqualValues(t, 3, k3Flow.Metrics.Retransmits)
+
+	// and discarded once they expire
+	m.merge(nil, map[ebpf.ConnId]uint32{k1Conn: 4})
+	tm.now = tm.now.Add(2 * time.Minute)
+	k1Flow := tcpRecord(k1, 1)
+	m.merge([]*Record{k1Flow}, nil)
+	assert.Zero(t, k1Flow.Metrics.Retransmits)
+	assert.Empty(t, m.pending)
+}
+
+func TestConnMerger_TCPSock(t *testing.T) {
+	m := newTCPSockMerger(time.Minute)
+	conn := connID(&tcpRecord(k1, 0).Id)
+	// the samples from different CPUs are aggregated
+	samples := aggregateTCPSockSamples(map[ebpf.ConnId][]ebpf.TcpSockSamples{conn: {
+		{Count: 2, SrttMin: 100, SrttMax: 300, SrttSum: 400,
+			CwndMin: 10, CwndMax: 10, CwndSum: 20, MssMin: 1448, MssMax: 1448, MssSum: 2896},
+		{},
+		{Count: 1, SrttMin: 50, SrttMax: 50, SrttSum: 50,
+			CwndMin: 4, CwndMax: 4, CwndSum: 4, MssMin: 1448, MssMax: 1448, MssSum: 1448},
+	}})
+	record := tcpRecord(k1, 1)
+	reverse := tcpRecord(ebpf.BpfFlowId{
+		SrcIp: k1.DstIp, DstIp: k1.SrcIp, SrcPort: k1.DstPort, DstPort: k1.SrcPort}, 1)
+	m.merge([]*Record{record, reverse}, samples)
+
+	assert.Equal(t, &TCPSockStats{
+		Samples: 3,
+		MinSRTT: 50 * time.Microsecond,
+		AvgSRTT: 150 * time.Microsecond,
+		MaxSRTT: 300 * time.Microsecond,
+		MinCwnd: 4,
+		AvgCwnd: 8,
+		MaxCwnd: 10,
+		MinMSS:  1448,
+		AvgMSS:  1448,
+		MaxMSS:  1448,
+	}, record.TCPSock)
+	assert.Nil(t, reverse.TCPSock)
+}
+
+func TestSetProcesses(t *testing.T) {
+	record := tcpRecord(k1, 1)
+	reverse := tcpRecord(ebpf.BpfFlowId{
+		SrcIp: k1.DstIp, DstIp: k1.SrcIp, SrcPort: k1.DstPort, DstPort: k1.SrcPort}, 2)
+	udp := &Record{RawRecord: RawRecord{Id: k1}}
+	udp.Id.TransportProtocol = udpProtocol
+	other := tcpRecord(k2, 1)
+
+	owner := ebpf.OwnerProcess{CgroupId: 5678, Pid: 4242}
+	copy(owner.Comm[:], "curl")
+	setProcesses([]*Record{record, reverse, udp, other},
+		map[ebpf.ConnId]ebpf.OwnerProcess{connID(&record.Id): owner})
+
+	// both directions of the connection are attributed to the owner of the local socket
+	assert.Equal(t, &Process{PID: 4242, Command: "curl", CgroupID: 5678}, record.Process)
+	assert.Equal(t, &Process{PID: 4242, Command: "curl", CgroupID: 5678}, reverse.Process)
+	assert.Nil(t, udp.Process)
+	assert.Nil(t, other.Process)
+}
+
+// connMetricsFetcherFake returns the retransmissions of the connections once, and the processes
+// in every lookup
+type connMetricsFetcherFake struct {
+	retransmits map[ebpf.ConnId]uint32
+	processes   map[ebpf.ConnId]ebpf.OwnerProcess
+}
+
+func (f *connMetricsFetcherFake) LookupAndDeleteRetransmits() map[ebpf.ConnId]uint32 {
+	retransmits := f.retransmits
+	f.retransmits = nil
+	return retransmits
+}
+
+func (f *connMetricsFetcherFake) LookupAndDeleteTCPSockSamples() map[ebpf.ConnId][]ebpf.TcpSockSamples {
+	return nil
+}
+
+func (f *connMetricsFetcherFake) LookupProcesses() map[ebpf.ConnId]ebpf.OwnerProcess {
+	return f.processes
+}
+
+func TestMergeConnMetrics(t *testing.T) {
+	mapFlow := tcpRecord(k1, 1)
+	ringBufFlow := tcpRecord(k2, 1)
+	owner := ebpf.OwnerProcess{CgroupId: 5678, Pid: 4242}
+	fetcher := &connMetricsFetcherFake{
+		retransmits: map[ebpf.ConnId]uint32{connID(&mapFlow.Id): 3, connID(&ringBufFlow.Id): 2},
+		processes:   map[ebpf.ConnId]ebpf.OwnerProcess{connID(&ringBufFlow.Id): owner},
+	}
+	input := make(chan []*Record, 10)
+	output := make(chan []*Record, 10)
+	go MergeConnMetrics(fetcher, time.Minute)(input, output)
+
+	// the flows are received from both the map tracer and the accounter of the ring buffer
+	// flows, so the metrics of a connection are merged into the first group of flows that
+	// contains the connection
+	input <- []*Record{mapFlow}
+	assert.Equal(t, []*Record{mapFlow}, receiveTimeout(t, output))
+	assert.EqualValues(t, 3, mapFlow.Metrics.Retransmits)
+	assert.Nil(t, mapFlow.Process)
+
+	input <- []*Record{ringBufFlow}
+	assert.Equal(t, []*Record{ringBufFlow}, receiveTimeout(t, output))
+	assert.EqualValues(t, 2, ringBufFlow.Metrics.Retransmits)
+	assert.Equal(t, &Process{PID: 4242, CgroupID: 5678}, ringBufFlow.Process)
+}
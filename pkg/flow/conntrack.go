@@ -0,0 +1,327 @@
+package flow
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
+)
+
+var ctlog = logrus.WithField("component", "flow/ConnTracker")
+
+// ConnEvent is the event of the lifecycle of a connection that a record reports
+type ConnEvent uint8
+
+const (
+	// ConnEventNone is reported by the records whose connection is not tracked
+	ConnEventNone ConnEvent = iota
+	// ConnEventStart is reported by the first record of a connection
+	ConnEventStart
+	// ConnEventUpdate is reported periodically by the records of an ongoing connection
+	ConnEventUpdate
+	// ConnEventEnd is reported by the last records of a connection
+	ConnEventEnd
+)
+
+// FlowEndReason tells why the records of a connection have been reported. Values according to
+// field 136 in https://www.iana.org/assignments/ipfix/ipfix.xhtml. It is 0 for the records that
+// start a connection and for the records whose connection is not tracked
+type FlowEndReason uint8
+
+const (
+	FlowEndIdleTimeout   FlowEndReason = 1
+	FlowEndActiveTimeout FlowEndReason = 2
+	FlowEndDetected      FlowEndReason = 3
+	FlowEndForced        FlowEndReason = 4
+)
+
+// trackedConn is a connection whose end has not been reported yet
+type trackedConn struct {
+	// last record of the connection, which is copied to report its end if no other record has
+	// been received since the last report
+	last Record
+	// records of the connection that have been received since the last report, in arrival
+	// order. There is a record for each direction, or a single record for the biflows
+	pending []*Record
+	// index of the pending records, by flow ID
+	index      map[ebpf.BpfFlowId]int
+	lastSeen   time.Time
+	lastReport time.Time
+	// whether the lower and the higher endpoint of the connection key have sent a FIN packet
+	lowFin  bool
+	highFin bool
+	// closed is true if a RST packet, or the FIN packets of both endpoints, have been observed
+	closed   bool
+	closedAt time.Time
+	// initiator is the source endpoint of the first biflow of the connection. The initiator of
+	// the biflows that do not contain the handshake might differ, so they are reversed to keep
+	// the same orientation during the whole connection
+	hasInitiator  bool
+	initiatorIP   IPAddr
+	initiatorPort uint16
+}
+
+// connTracker stores the connections whose end has not been reported yet.
+// It is not safe for concurrent access.
+type connTracker struct {
+	inactiveTimeout time.Duration
+	activeTimeout   time.Duration
+	closeGrace      time.Duration
+	conns           map[biflowKey]*trackedConn
+}
+
+// TrackConnections tracks the connections of the flows across evictions, and reports their
+// lifecycle in the ConnEvent and FlowEndReason fields of the records. A connection is identified
+// by the addresses, ports and protocols of both directions, as observed from a given interface,
+// so the records of both directions (or their biflow) belong to the same connection. The biflows
+// keep the orientation of the first biflow of the connection.
+//   - The first record of a connection is forwarded immediately as a start event.
+//   - The next records are accumulated, by flow direction, and forwarded as update events every
+//     active timeout, with the active timeout end reason.
+//   - The accumulated records are forwarded as end events when the connection has been closed by a
+//     RST packet or by the FIN packets of both endpoints, with the end of flow detected reason, or
+//     when no record of the connection is received during the inactive timeout, with the idle
+//     timeout reason. If no record is pending, an end record without packets is forwarded.
+//   - The pending records are forwarded as end events with the forced end reason when the agent
+//     stops.
+//
+// The closed connections are ended after the closeGrace period, which must cover at least an
+// eviction period, so their last packets (e.g. the ACK of the last FIN, or the retransmissions
+// during the TIME-WAIT state) are included in their end records instead of starting a new
+// connection. The timeouts are checked periodically, at the smaller timeout, so the events might
+// be reported up to that time later.
+func TrackConnections(inactiveTimeout, activeTimeout, closeGrace time.Duration) func(in <-chan []*Record, out chan<- []*Record) {
+	tracker := newConnTracker(inactiveTimeout, activeTimeout, closeGrace)
+	period := inactiveTimeout
+	if activeTimeout < period {
+		period = activeTimeout
+	}
+	return func(in <-chan []*Record, out chan<- []*Record) {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case records, ok := <-in:
+				if !ok {
+					if ended := tracker.flush(); len(ended) > 0 {
+						out <- ended
+					}
+					return
+				}
+				if started := tracker.track(records); len(started) > 0 {
+					out <- started
+				}
+			case <-ticker.C:
+				if reported := tracker.expire(); len(reported) > 0 {
+					out <- reported
+				}
+			}
+		}
+	}
+}
+
+func newConnTracker(inactiveTimeout, activeTimeout, closeGrace time.Duration) *connTracker {
+	return &connTracker{
+		inactiveTimeout: inactiveTimeout,
+		activeTimeout:   activeTimeout,
+		closeGrace:      closeGrace,
+		conns:           map[biflowKey]*trackedConn{},
+	}
+}
+
+// track accumulates the records into their connections, and returns the records that start a
+// connection, and the end records of the closed connections that are reused by a new connection
+func (t *connTracker) track(records []*Record) []*Record {
+	now := timeNow()
+	var reported []*Record
+	for _, record := range records {
+		key := biflowKeyOf(record)
+		conn, ok := t.conns[key]
+		if ok && conn.closed && isConnStart(record) {
+			// the ports of a closed connection are reused by a new connection
+			reported = append(reported, conn.report(ConnEventEnd, FlowEndDetected)...)
+			ok = false
+		}
+		if !ok {
+			conn = &trackedConn{index: map[ebpf.BpfFlowId]int{}, lastReport: now}
+			t.conns[key] = conn
+			conn.orient(record)
+			record.ConnEvent = ConnEventStart
+			reported = append(reported, record)
+		} else {
+			conn.orient(record)
+			conn.add(record)
+		}
+		conn.last = *record
+		conn.lastSeen = now
+		conn.updateClosed(&key, record, now)
+	}
+	return reported
+}
+
+// expire returns the records of the connections whose timeouts have expired, and of the closed
+// connections whose grace period has expired
+func (t *connTracker) expire() []*Record {
+	now := timeNow()
+	var reported []*Record
+	ended := 0
+	for key, conn := range t.conns {
+		switch {
+		case conn.closed:
+			if now.Sub(conn.closedAt) < t.closeGrace {
+				continue
+			}
+			reported = append(reported, conn.report(ConnEventEnd, FlowEndDetected)...)
+		case now.Sub(conn.lastSeen) >= t.inactiveTimeout:
+			reported = append(reported, conn.report(ConnEventEnd, FlowEndIdleTimeout)...)
+		case now.Sub(conn.lastReport) >= t.activeTimeout && len(conn.pending) > 0:
+			reported = append(reported, conn.report(ConnEventUpdate, FlowEndActiveTimeout)...)
+			conn.lastReport = now
+			continue
+		default:
+			continue
+		}
+		ended++
+		delete(t.conns, key)
+	}
+	if ended > 0 {
+		ctlog.WithFields(logrus.Fields{
+			"current": len(t.conns),
+			"ended":   ended,
+		}).Debug("connections ended")
+	}
+	return reported
+}
+
+// flush returns the end records of all the tracked connections
+func (t *connTracker) flush() []*Record {
+	var reported []*Record
+	for _, conn := range t.conns {
+		reported = append(reported, conn.report(ConnEventEnd, FlowEndForced)...)
+	}
+	t.conns = map[biflowKey]*trackedConn{}
+	return reported
+}
+
+// isConnStart returns whether the record contains the SYN packet of a TCP connection
+func isConnStart(r *Record) bool {
+	return r.Id.TransportProtocol == TCPProtocol &&
+		r.Metrics.Flags&TCPSynFlag != 0 && r.Metrics.Flags&TCPSynAckFlag == 0
+}
+
+// orient reverses the biflow if its initiator is not the initiator of the first biflow of the
+// connection
+func (c *trackedConn) orient(r *Record) {
+	if r.Reverse == nil {
+		return
+	}
+	if !c.hasInitiator {
+		c.hasInitiator = true
+		c.initiatorIP = r.Id.SrcIp
+		c.initiatorPort = r.Id.SrcPort
+		return
+	}
+	if r.Id.SrcIp != c.initiatorIP || r.Id.SrcPort != c.initiatorPort {
+		reverseBiflow(r)
+	}
+}
+
+// add accumulates the record with the pending record of the same flow ID, if any
+func (c *trackedConn) add(record *Record) {
+	if i, ok := c.index[record.Id]; ok {
+		accumulateRecord(c.pending[i], record)
+		return
+	}
+	c.index[record.Id] = len(c.pending)
+	c.pending = append(c.pending, record)
+}
+
+// updateClosed tells whether the connection has been closed by the packets of the record, and
+// stores when it was closed
+func (c *trackedConn) updateClosed(key *biflowKey, r *Record, now time.Time) {
+	if c.closed || r.Id.TransportProtocol != TCPProtocol {
+		return
+	}
+	flags := r.Metrics.Flags
+	var reverse uint16
+	if r.Reverse != nil {
+		reverse = r.Reverse.Flags
+	}
+	fromLow := r.Id.SrcIp == key.lowIP && r.Id.SrcPort == key.lowPort
+	if flags&TCPFinFlag != 0 {
+		c.lowFin = c.lowFin || fromLow
+		c.highFin = c.highFin || !fromLow
+	}
+	if reverse&TCPFinFlag != 0 {
+		c.lowFin = c.lowFin || !fromLow
+		c.highFin = c.highFin || fromLow
+	}
+	if (flags|reverse)&TCPRstFlag != 0 || (c.lowFin && c.highFin) {
+		c.closed = true
+		c.closedAt = now
+	}
+}
+
+// report returns the pending records with the provided event and reason, and forgets them. If
+// there are no pending records, it returns a record without packets that is a copy of the last
+// record of the connection
+func (c *trackedConn) report(event ConnEvent, reason FlowEndReason) []*Record {
+	records := c.pending
+	if len(records) == 0 {
+		if event != ConnEventEnd {
+			return nil
+		}
+		empty := c.last
+		empty.Metrics = ebpf.BpfFlowMetrics{
+			StartMonoTimeTs: c.last.Metrics.EndMonoTimeTs,
+			EndMonoTimeTs:   c.last.Metrics.EndMonoTimeTs,
+			Sampling:        c.last.Metrics.Sampling,
+		}
+		empty.TimeFlowStart = c.last.TimeFlowEnd
+		empty.DNSLatency = 0
+		empty.DropCause = ""
+		if empty.Reverse != nil {
+			empty.Reverse = &ReverseMetrics{}
+		}
+		records = []*Record{&empty}
+	}
+	for _, r := range records {
+		r.ConnEvent = event
+		r.FlowEndReason = reason
+	}
+	c.pending = nil
+	c.index = map[ebpf.BpfFlowId]int{}
+	return records
+}
+
+// accumulateRecord adds the metrics of the src record to the dst record of the same flow
+func accumulateRecord(dst, src *Record) {
+	Accumulate(&dst.Metrics, &src.Metrics)
+	if src.TimeFlowStart.Before(dst.TimeFlowStart) {
+		dst.TimeFlowStart = src.TimeFlowStart
+	}
+	if src.TimeFlowEnd.After(dst.TimeFlowEnd) {
+		dst.TimeFlowEnd = src.TimeFlowEnd
+	}
+	if src.Reverse != nil {
+		if dst.Reverse == nil {
+			dst.Reverse = &ReverseMetrics{}
+		}
+		dst.Reverse.Packets += src.Reverse.Packets
+		dst.Reverse.Bytes += src.Reverse.Bytes
+		dst.Reverse.Flags |= src.Reverse.Flags
+	}
+	if src.TimeFlowRtt != 0 {
+		dst.TimeFlowRtt = src.TimeFlowRtt
+	}
+	if src.DNSLatency != 0 {
+		dst.DNSLatency = src.DNSLatency
+	}
+	if src.TCPSock != nil {
+		dst.TCPSock = src.TCPSock
+	}
+	if src.Process != nil {
+		dst.Process = src.Process
+	}
+}
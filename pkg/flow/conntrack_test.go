@@ -0,0 +1,139 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnTracker_Lifecycle(t *testing.T) {
+	tm := mockTimeNow(t)
+	tracker := newConnTracker(time.Minute, 30*time.Second, 5*time.Second)
+
+	// the first record of the connection starts it
+	client, server := biflowRecords(TCPSynFlag, TCPSynAckFlag|0x10, 1000, 1100)
+	require.Equal(t, []*Record{client}, tracker.track([]*Record{client, server}))
+	assert.Equal(t, ConnEventStart, client.ConnEvent)
+	assert.Zero(t, client.FlowEndReason)
+
+	// the next records are accumulated by direction until the active timeout
+	tm.now = tm.now.Add(10 * time.Second)
+	client2, server2 := biflowRecords(0x10, 0x10, 2000, 2100)
+	assert.Empty(t, tracker.track([]*Record{client2, server2}))
+	assert.Empty(t, tracker.expire())
+	tm.now = tm.now.Add(10 * time.Second)
+	client3, _ := biflowRecords(0x10, 0x10, 3000, 3100)
+	assert.Empty(t, tracker.track([]*Record{client3}))
+	assert.Empty(t, tracker.expire())
+
+	tm.now = tm.now.Add(15 * time.Second)
+	updated := tracker.expire()
+	require.Equal(t, []*Record{server, client2}, updated)
+	for _, r := range updated {
+		assert.Equal(t, ConnEventUpdate, r.ConnEvent)
+		assert.Equal(t, FlowEndActiveTimeout, r.FlowEndReason)
+	}
+	// the server records are accumulated into the first one
+	assert.EqualValues(t, 40, server.Metrics.Packets)
+	assert.EqualValues(t, TCPSynAckFlag|0x10, server.Metrics.Flags)
+	assert.EqualValues(t, 1100, server.Metrics.StartMonoTimeTs)
+	assert.EqualValues(t, 3100, server.Metrics.EndMonoTimeTs)
+	assert.EqualValues(t, 20, client2.Metrics.Packets)
+	assert.EqualValues(t, 3500, client2.Metrics.EndMonoTimeTs)
+
+	// without new records, the connection ends after the inactive timeout, with an empty record
+	assert.Empty(t, tracker.expire())
+	tm.now = tm.now.Add(50 * time.Second)
+	ended := tracker.expire()
+	require.Len(t, ended, 1)
+	assert.Equal(t, ConnEventEnd, ended[0].ConnEvent)
+	assert.Equal(t, FlowEndIdleTimeout, ended[0].FlowEndReason)
+	assert.Equal(t, client3.Id, ended[0].Id)
+	assert.Zero(t, ended[0].Metrics.Packets)
+	assert.Empty(t, tracker.conns)
+}
+
+func TestConnTracker_Close(t *testing.T) {
+	tm := mockTimeNow(t)
+	tracker := newConnTracker(15*time.Second, time.Minute, 5*time.Second)
+
+	client, server := biflowRecords(0x10, 0x10, 1000, 1100)
+	require.Equal(t, []*Record{client}, tracker.track([]*Record{client}))
+
+	// a FIN from a single endpoint does not close the connection
+	_, serverFin := biflowRecords(0x10, TCPFinFlag|0x10, 2000, 2100)
+	assert.Empty(t, tracker.track([]*Record{server, serverFin}))
+	assert.Empty(t, tracker.expire())
+
+	// the closed connection is ended after the grace period
+	clientFin, _ := biflowRecords(TCPFinFlag|0x10, 0, 3000, 3100)
+	assert.Empty(t, tracker.track([]*Record{clientFin}))
+	assert.Empty(t, tracker.expire())
+
+	// the packets that are evicted after the connection is closed (e.g. the ACK of the last FIN)
+	// do not start a new connection, and they are included in the end records
+	tm.now = tm.now.Add(3 * time.Second)
+	lastAck, _ := biflowRecords(0x10, 0, 3600, 0)
+	assert.Empty(t, tracker.track([]*Record{lastAck}))
+	assert.Empty(t, tracker.expire())
+	tm.now = tm.now.Add(3 * time.Second)
+	ended := tracker.expire()
+	require.Equal(t, []*Record{server, clientFin}, ended)
+	for _, r := range ended {
+		assert.Equal(t, ConnEventEnd, r.ConnEvent)
+		assert.Equal(t, FlowEndDetected, r.FlowEndReason)
+	}
+	assert.EqualValues(t, 20, clientFin.Metrics.Packets)
+	assert.EqualValues(t, 4100, clientFin.Metrics.EndMonoTimeTs)
+	assert.Empty(t, tracker.conns)
+
+	// a RST from any direction of a biflow closes the connection, and the SYN of a new
+	// connection with the same ports ends the closed one immediately
+	biflow, reverse := biflowRecords(0x10, TCPRstFlag, 4000, 4100)
+	biflow = mergeBiflow(biflow, reverse)
+	require.Equal(t, []*Record{biflow}, tracker.track([]*Record{biflow}))
+	newConn, _ := biflowRecords(TCPSynFlag, 0, 5000, 5100)
+	reported := tracker.track([]*Record{newConn})
+	require.Len(t, reported, 2)
+	assert.Equal(t, ConnEventEnd, reported[0].ConnEvent)
+	assert.Equal(t, FlowEndDetected, reported[0].FlowEndReason)
+	assert.Equal(t, &ReverseMetrics{}, reported[0].Reverse)
+	assert.Same(t, newConn, reported[1])
+	assert.Equal(t, ConnEventStart, newConn.ConnEvent)
+
+	// the tracked connections are ended when the input is closed
+	flushed := tracker.flush()
+	require.Len(t, flushed, 1)
+	assert.Equal(t, ConnEventEnd, flushed[0].ConnEvent)
+	assert.Equal(t, FlowEndForced, flushed[0].FlowEndReason)
+	assert.Empty(t, tracker.conns)
+}
+
+func TestConnTracker_BiflowOrientation(t *testing.T) {
+	tm := mockTimeNow(t)
+	tracker := newConnTracker(time.Minute, 30*time.Second, 5*time.Second)
+
+	// the SYN sender is the initiator of the first biflow
+	client, server := biflowRecords(TCPSynFlag, TCPSynAckFlag|0x10, 1000, 1100)
+	first := mergeBiflow(client, server)
+	require.Equal(t, []*Record{first}, tracker.track([]*Record{first}))
+
+	// without handshake, the responder might be chosen as the initiator of the next biflows, as
+	// its flow started first. They are reversed and accumulated into a single record
+	for _, start := range []uint64{2000, 3000} {
+		client, server := biflowRecords(0x10, 0x12, start+100, start)
+		biflow := mergeBiflow(client, server)
+		require.Same(t, server, biflow)
+		assert.Empty(t, tracker.track([]*Record{biflow}))
+	}
+	tm.now = tm.now.Add(30 * time.Second)
+	updated := tracker.expire()
+	require.Len(t, updated, 1)
+	assert.Equal(t, first.Id, updated[0].Id)
+	assert.EqualValues(t, 20, updated[0].Metrics.Packets)
+	assert.EqualValues(t, 0x10, updated[0].Metrics.Flags)
+	assert.Equal(t, &ReverseMetrics{Packets: 40, Bytes: 60000, Flags: 0x12}, updated[0].Reverse)
+	assert.EqualValues(t, 2000, updated[0].Metrics.StartMonoTimeTs)
+}
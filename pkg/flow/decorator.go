@@ -4,17 +4,51 @@ import (
 	"net"
 )
 
-type InterfaceNamer func(ifIndex int) string
+// InterfaceNamer returns the names of the interface and its network namespace, given the inode
+// number of the namespace and the interface index
+type InterfaceNamer func(netNS uint32, ifIndex int) (iface, netNSName string)
+
+// DropCauseNamer returns the name of a kernel packet drop reason, given its value
+type DropCauseNamer func(reason uint32) string
+
+// ContainerNamer returns the ID of the container of a process, given its cgroup ID and its
+// process ID. It returns an empty string if the process does not run in a container
+type ContainerNamer func(cgroupID uint64, pid uint32) string
 
 // Decorate adds to the flows extra metadata fields that are not directly fetched by eBPF:
 // - The interface name (corresponding to the interface index in the flow).
+// - The name of the network namespace of the interface.
 // - The IP address of the agent host.
-func Decorate(agentIP net.IP, ifaceNamer InterfaceNamer) func(in <-chan []*Record, out chan<- []*Record) {
+// - The name of the reason of the last dropped packet, if any.
+// - The container of the process that owns the flow socket, if any.
+// - The provided sampling rate, if the kernel did not report the rate of the flow. A rate of 0 is
+// reported as 1 (no sampling). The flows that only account dropped packets report a rate of 1,
+// as all the drops are accounted, regardless of the sampling.
+func Decorate(
+	agentIP net.IP, sampling uint32,
+	ifaceNamer InterfaceNamer, dropNamer DropCauseNamer, containerNamer ContainerNamer,
+) func(in <-chan []*Record, out chan<- []*Record) {
+	if sampling == 0 {
+		sampling = 1
+	}
 	return func(in <-chan []*Record, out chan<- []*Record) {
 		for flows := range in {
 			for _, flow := range flows {
-				flow.Interface = ifaceNamer(int(flow.Id.IfIndex))
+				flow.Interface, flow.NetNS = ifaceNamer(flow.Id.IfNetns, int(flow.Id.IfIndex))
 				flow.AgentIP = agentIP
+				if flow.Metrics.Sampling == 0 {
+					if flow.Metrics.Packets == 0 && flow.Metrics.DroppedPackets > 0 {
+						flow.Metrics.Sampling = 1
+					} else {
+						flow.Metrics.Sampling = sampling
+					}
+				}
+				if flow.Metrics.DroppedPackets > 0 {
+					flow.DropCause = dropNamer(flow.Metrics.DropReason)
+				}
+				if flow.Process != nil {
+					flow.Process.ContainerID = containerNamer(flow.Process.CgroupID, flow.Process.PID)
+				}
 			}
 			out <- flows
 		}
@@ -0,0 +1,61 @@
+package flow
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecorate(t *testing.T) {
+	ifaceNamer := func(netNS uint32, ifIndex int) (string, string) {
+		if netNS == 0 {
+			return "eth0", ""
+		}
+		return "veth0", "ns1"
+	}
+	dropNamer := func(reason uint32) string {
+		if reason == 12 {
+			return "NETFILTER_DROP"
+		}
+		return "unknown"
+	}
+	containerNamer := func(cgroupID uint64, pid uint32) string {
+		if cgroupID == 5678 {
+			return "2f7f3a4b"
+		}
+		return ""
+	}
+	dropped := &Record{}
+	dropped.Id.IfNetns = 1234
+	dropped.Metrics.DroppedPackets = 2
+	dropped.Metrics.DropReason = 12
+	sampledDrops := &Record{}
+	sampledDrops.Metrics.Packets = 3
+	sampledDrops.Metrics.DroppedPackets = 1
+	notDropped := &Record{}
+	notDropped.Process = &Process{PID: 42, Command: "curl", CgroupID: 5678}
+	notDropped.Metrics.Sampling = 50
+
+	in := make(chan []*Record, 1)
+	out := make(chan []*Record, 1)
+	in <- []*Record{dropped, notDropped, sampledDrops}
+	close(in)
+	Decorate(net.ParseIP("10.0.0.1"), 10, ifaceNamer, dropNamer, containerNamer)(in, out)
+	decorated := <-out
+
+	assert.Equal(t, "veth0", decorated[0].Interface)
+	assert.Equal(t, "ns1", decorated[0].NetNS)
+	assert.Equal(t, "NETFILTER_DROP", decorated[0].DropCause)
+	assert.Equal(t, "10.0.0.1", decorated[0].AgentIP.String())
+	assert.Equal(t, "eth0", decorated[1].Interface)
+	// the drop cause is only reported for the flows with dropped packets
+	assert.Empty(t, decorated[1].DropCause)
+	assert.Nil(t, decorated[0].Process)
+	assert.Equal(t, "2f7f3a4b", decorated[1].Process.ContainerID)
+	// the default sampling rate only applies if the kernel did not report any, and the flows
+	// that only report drops are not sampled
+	assert.EqualValues(t, 1, decorated[0].Metrics.Sampling)
+	assert.EqualValues(t, 50, decorated[1].Metrics.Sampling)
+	assert.EqualValues(t, 10, decorated[2].Metrics.Sampling)
+}
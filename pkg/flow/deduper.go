@@ -27,6 +27,7 @@ type deduperCache struct {
 type entry struct {
 	key        *ebpf.BpfFlowId
 	ifIndex    uint32
+	ifNetns    uint32
 	expiryTime time.Time
 }
 
@@ -68,8 +69,18 @@ func (c *deduperCache) isDupe(key *ebpf.BpfFlowId) bool {
 	rk := *key
 	// zeroes fields from key that should be ignored from the flow comparison
 	rk.IfIndex = 0
+	rk.IfNetns = 0
 	rk.SrcMac = [MacLen]uint8{0, 0, 0, 0, 0, 0}
 	rk.DstMac = [MacLen]uint8{0, 0, 0, 0, 0, 0}
+	// the VLAN tags depend on the interface (e.g. a trunk interface and its VLAN sub-interface)
+	rk.VlanId = 0
+	rk.InnerVlanId = 0
+	// the same flow is seen encapsulated from the underlay interfaces, and decapsulated from the
+	// overlay interfaces
+	rk.TunnelType = 0
+	rk.TunnelSrcIp = IPAddr{}
+	rk.TunnelDstIp = IPAddr{}
+	rk.TunnelId = 0
 	rk.Direction = 0
 	// If a flow has been accounted previously, whatever its interface was,
 	// it updates the expiry time for that flow
@@ -79,13 +90,14 @@ func (c *deduperCache) isDupe(key *ebpf.BpfFlowId) bool {
 		c.entries.MoveToFront(ele)
 		// The input flow is duplicate if its interface is different to the interface
 		// of the non-duplicate flow that was first registered in the cache
-		return fEntry.ifIndex != key.IfIndex
+		return fEntry.ifIndex != key.IfIndex || fEntry.ifNetns != key.IfNetns
 	}
 	// The flow has not been accounted previously (or was forgotten after expiration)
 	// so we register it for that concrete interface
 	e := entry{
 		key:        &rk,
 		ifIndex:    key.IfIndex,
+		ifNetns:    key.IfNetns,
 		expiryTime: timeNow().Add(c.expire),
 	}
 	c.ifaces[rk] = c.entries.PushFront(&e)
@@ -62,9 +62,37 @@ func TestDedupe(t *testing.T) {
 	assert.Equal(t, []*Record{oneIf2}, deduped)
 }
 
+func TestDedupe_NetNS(t *testing.T) {
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+
+	go Dedupe(time.Minute, false)(input, output)
+
+	// the same flow from an interface with the same index but in another network namespace
+	oneNetNS := *oneIf1
+	oneNetNS.Id.IfNetns = 4026532205
+	input <- []*Record{oneIf1, &oneNetNS, oneIf1}
+	assert.Equal(t, []*Record{oneIf1, oneIf1}, receiveTimeout(t, output))
+}
+
+func TestDedupe_Tunnel(t *testing.T) {
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+
+	go Dedupe(time.Minute, false)(input, output)
+
+	// the same flow, decapsulated from the underlay interface
+	oneTunnel := *oneIf2
+	oneTunnel.Id.TunnelType = uint8(ebpf.TunnelVXLAN)
+	oneTunnel.Id.TunnelSrcIp = IPAddr{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 192, 168, 0, 1}
+	oneTunnel.Id.TunnelDstIp = IPAddr{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 192, 168, 0, 2}
+	oneTunnel.Id.TunnelId = 42
+	input <- []*Record{oneIf1, &oneTunnel}
+	assert.Equal(t, []*Record{oneIf1}, receiveTimeout(t, output))
+}
+
 func TestDedupe_EvictFlows(t *testing.T) {
-	tm := &timerMock{now: time.Now()}
-	timeNow = tm.Now
+	tm := mockTimeNow(t)
 	input := make(chan []*Record, 100)
 	output := make(chan []*Record, 100)
 
@@ -106,3 +134,14 @@ type timerMock struct {
 func (tm *timerMock) Now() time.Time {
 	return tm.now
 }
+
+// mockTimeNow replaces the timeNow function by a timerMock, which is restored when the test ends
+func mockTimeNow(t *testing.T) *timerMock {
+	tm := &timerMock{now: time.Now()}
+	originalTimeNow := timeNow
+	t.Cleanup(func() {
+		timeNow = originalTimeNow
+	})
+	timeNow = tm.Now
+	return tm
+}
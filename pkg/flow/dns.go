@@ -0,0 +1,169 @@
+package flow
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var dnsLog = logrus.WithField("component", "flow/DNSTracker")
+
+// DNS header flags, as recorded by the eBPF tracer. Values according to RFC 1035
+const (
+	// DNSQRFlag is set in the responses and unset in the queries
+	DNSQRFlag = uint16(0x8000)
+	// DNSRcodeMask selects the response code from the flags
+	DNSRcodeMask = uint16(0x000f)
+)
+
+// dnsKey identifies a DNS transaction as observed from a given interface, regardless of the
+// direction of the query and response flows
+type dnsKey struct {
+	ifIndex    uint32
+	ifNetns    uint32
+	client     IPAddr
+	server     IPAddr
+	clientPort uint16
+	serverPort uint16
+	transport  uint8
+	id         uint16
+}
+
+// dnsTransaction stores the monotonic timestamps of the query and the response of a DNS
+// transaction, as they are received from the client-to-server and the server-to-client flows.
+type dnsTransaction struct {
+	key        *dnsKey
+	queryTs    uint64
+	responseTs uint64
+	expiryTime time.Time
+}
+
+// dnsCache stores the DNS transactions whose flows have been only partially received.
+// Its entries are evicted if they are not completed during the expire duration.
+// It is not safe for concurrent access.
+type dnsCache struct {
+	expire time.Duration
+	// key: transaction key
+	// value: listElement pointing to a dnsTransaction struct
+	transactions map[dnsKey]*list.Element
+	// element: dnsTransaction structs of the transactions map ordered by expiry time
+	entries *list.List
+}
+
+// DNSTracker correlates the flows that carry a DNS query with the flows that carry its
+// response, and sets their DNSLatency field to the time between the query and the response,
+// as observed from the interface where the flows were captured.
+//
+// The latency is set in the records that complete the transaction information. As the eBPF
+// tracer only records the last DNS message of each flow, the latency is calculated for the last
+// transaction of the flows. Incomplete transactions are forgotten after the expiry time.
+func DNSTracker(expireTime time.Duration) func(in <-chan []*Record, out chan<- []*Record) {
+	cache := &dnsCache{
+		expire:       expireTime,
+		entries:      list.New(),
+		transactions: map[dnsKey]*list.Element{},
+	}
+	return func(in <-chan []*Record, out chan<- []*Record) {
+		for records := range in {
+			cache.removeExpired()
+			// records from the current batch that belong to a still-uncompleted transaction
+			pending := map[dnsKey][]*Record{}
+			for _, record := range records {
+				key, ok := cache.update(record)
+				if !ok {
+					continue
+				}
+				pending[key] = append(pending[key], record)
+				if latency, ok := cache.latency(key); ok {
+					for _, r := range pending[key] {
+						r.DNSLatency = latency
+					}
+					delete(pending, key)
+				}
+			}
+			out <- records
+		}
+	}
+}
+
+// update stores the DNS message timestamp of the record. It returns false if the record does
+// not contain any DNS message
+func (c *dnsCache) update(record *Record) (dnsKey, bool) {
+	if record.Metrics.DnsMonoTimeTs == 0 {
+		return dnsKey{}, false
+	}
+	key := dnsKey{
+		ifIndex:   record.Id.IfIndex,
+		ifNetns:   record.Id.IfNetns,
+		transport: record.Id.TransportProtocol,
+		id:        record.Metrics.DnsId,
+	}
+	isResponse := record.Metrics.DnsFlags&DNSQRFlag != 0
+	if isResponse {
+		key.client, key.clientPort = record.Id.DstIp, record.Id.DstPort
+		key.server, key.serverPort = record.Id.SrcIp, record.Id.SrcPort
+	} else {
+		key.client, key.clientPort = record.Id.SrcIp, record.Id.SrcPort
+		key.server, key.serverPort = record.Id.DstIp, record.Id.DstPort
+	}
+	tr := c.get(key)
+	if isResponse {
+		tr.responseTs = record.Metrics.DnsMonoTimeTs
+	} else {
+		tr.queryTs = record.Metrics.DnsMonoTimeTs
+	}
+	return key, true
+}
+
+// latency returns the time between the query and the response of the transaction, if both
+// have been already received. In that case, the transaction is removed from the cache.
+func (c *dnsCache) latency(key dnsKey) (time.Duration, bool) {
+	ele, ok := c.transactions[key]
+	if !ok {
+		return 0, false
+	}
+	tr := ele.Value.(*dnsTransaction)
+	if tr.queryTs == 0 || tr.responseTs == 0 {
+		return 0, false
+	}
+	c.entries.Remove(ele)
+	delete(c.transactions, key)
+	if tr.responseTs < tr.queryTs {
+		dnsLog.WithField("transaction", key).Debug("DNS timestamps are out of order. Ignoring")
+		return 0, false
+	}
+	return time.Duration(tr.responseTs - tr.queryTs), true
+}
+
+// get returns the transaction for the given key, creating a new one if it does not exist yet.
+func (c *dnsCache) get(key dnsKey) *dnsTransaction {
+	if ele, ok := c.transactions[key]; ok {
+		return ele.Value.(*dnsTransaction)
+	}
+	tr := &dnsTransaction{
+		key:        &key,
+		expiryTime: timeNow().Add(c.expire),
+	}
+	c.transactions[key] = c.entries.PushFront(tr)
+	return tr
+}
+
+func (c *dnsCache) removeExpired() {
+	now := timeNow()
+	ele := c.entries.Back()
+	evicted := 0
+	for ele != nil && now.After(ele.Value.(*dnsTransaction).expiryTime) {
+		evicted++
+		c.entries.Remove(ele)
+		delete(c.transactions, *ele.Value.(*dnsTransaction).key)
+		ele = c.entries.Back()
+	}
+	if evicted > 0 {
+		dnsLog.WithFields(logrus.Fields{
+			"current":    c.entries.Len(),
+			"evicted":    evicted,
+			"expiryTime": c.expire,
+		}).Debug("incomplete transactions evicted from the DNS cache")
+	}
+}
@@ -0,0 +1,104 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
+)
+
+const udpProtocol = 17
+
+func dnsRecords(dnsID uint16, queryTs, responseTs uint64) (query, response *Record) {
+	query = &Record{RawRecord: RawRecord{Id: ebpf.BpfFlowId{
+		Direction: DirectionEgress, TransportProtocol: udpProtocol, IfIndex: 3,
+		SrcIp: srcAddr1, DstIp: dstAddr1, SrcPort: 34567, DstPort: 53,
+	}, Metrics: ebpf.BpfFlowMetrics{
+		DnsId: dnsID, DnsFlags: 0x0100, DnsMonoTimeTs: queryTs,
+	}}}
+	response = &Record{RawRecord: RawRecord{Id: ebpf.BpfFlowId{
+		Direction: DirectionIngress, TransportProtocol: udpProtocol, IfIndex: 3,
+		SrcIp: dstAddr1, DstIp: srcAddr1, SrcPort: 53, DstPort: 34567,
+	}, Metrics: ebpf.BpfFlowMetrics{
+		DnsId: dnsID, DnsFlags: DNSQRFlag | 0x0180, DnsMonoTimeTs: responseTs,
+	}}}
+	return query, response
+}
+
+func TestDNSTracker(t *testing.T) {
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+	go DNSTracker(time.Minute)(input, output)
+
+	query, response := dnsRecords(0x1234, 1000, 1700)
+	input <- []*Record{response, query}
+	received := receiveTimeout(t, output)
+	assert.Equal(t, []*Record{response, query}, received)
+	assert.Equal(t, 700*time.Nanosecond, query.DNSLatency)
+	assert.Equal(t, 700*time.Nanosecond, response.DNSLatency)
+}
+
+func TestDNSTracker_DifferentBatches(t *testing.T) {
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+	go DNSTracker(time.Minute)(input, output)
+
+	query, response := dnsRecords(0x1234, 1000, 1700)
+	// the query flow is forwarded without latency, as its response is not received yet
+	input <- []*Record{query}
+	receiveTimeout(t, output)
+	assert.Zero(t, query.DNSLatency)
+
+	// the latency is set in the record that completes the transaction
+	input <- []*Record{response}
+	receiveTimeout(t, output)
+	assert.Equal(t, 700*time.Nanosecond, response.DNSLatency)
+
+	// a new response for the same transaction is not updated, as the transaction
+	// was already removed from the cache
+	_, response2 := dnsRecords(0x1234, 1000, 1700)
+	input <- []*Record{response2}
+	receiveTimeout(t, output)
+	assert.Zero(t, response2.DNSLatency)
+}
+
+func TestDNSTracker_IgnoredFlows(t *testing.T) {
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+	go DNSTracker(time.Minute)(input, output)
+
+	// flows without DNS messages are ignored
+	noDNS := &Record{RawRecord: RawRecord{Id: ebpf.BpfFlowId{TransportProtocol: udpProtocol}}}
+	// responses to other transactions are not correlated
+	query, response := dnsRecords(0x1234, 1000, 1700)
+	response.Metrics.DnsId = 0x4321
+	// neither are the flows from different interfaces
+	query2, response2 := dnsRecords(0x5678, 2000, 2300)
+	response2.Id.IfIndex = 4
+	input <- []*Record{noDNS, query, response, query2, response2}
+	receiveTimeout(t, output)
+	assert.Zero(t, noDNS.DNSLatency)
+	assert.Zero(t, query.DNSLatency)
+	assert.Zero(t, response.DNSLatency)
+	assert.Zero(t, query2.DNSLatency)
+	assert.Zero(t, response2.DNSLatency)
+}
+
+func TestDNSTracker_Expiry(t *testing.T) {
+	tm := mockTimeNow(t)
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+	go DNSTracker(15*time.Second)(input, output)
+
+	query, response := dnsRecords(0x1234, 1000, 1700)
+	input <- []*Record{query}
+	receiveTimeout(t, output)
+
+	// after the expiry time, the incomplete transaction is forgotten
+	tm.now = tm.now.Add(20 * time.Second)
+	input <- []*Record{response}
+	receiveTimeout(t, output)
+	assert.Zero(t, response.DNSLatency)
+}
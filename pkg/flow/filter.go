@@ -0,0 +1,56 @@
+package flow
+
+import (
+	"sync/atomic"
+)
+
+// Filter forwards only the flows that match a boolean expression over the fields of the flow
+// records, e.g. `proto == 6 && dst_port in [80, 443] && !duplicate && iface =~ "^eth"`.
+// See the FLOW_FILTER_EXPRESSION entry of docs/config.md for the fields and operators of
+// the expressions.
+type Filter struct {
+	match   predicate
+	matched uint64
+	dropped uint64
+}
+
+// FilterStats are the number of flows that have been forwarded or dropped by a Filter
+type FilterStats struct {
+	Matched uint64 `json:"matched"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// NewFilter compiles the provided expression into a Filter. It returns an error if the
+// expression is not valid.
+func NewFilter(expression string) (*Filter, error) {
+	match, err := parseFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{match: match}, nil
+}
+
+// Filter is the pipeline node function that drops the flows that do not match the expression
+func (f *Filter) Filter(in <-chan []*Record, out chan<- []*Record) {
+	for records := range in {
+		fwd := make([]*Record, 0, len(records))
+		for _, record := range records {
+			if f.match(record) {
+				fwd = append(fwd, record)
+			}
+		}
+		atomic.AddUint64(&f.matched, uint64(len(fwd)))
+		atomic.AddUint64(&f.dropped, uint64(len(records)-len(fwd)))
+		if len(fwd) > 0 {
+			out <- fwd
+		}
+	}
+}
+
+// Stats returns the number of flows that have matched, or not, the expression so far
+func (f *Filter) Stats() FilterStats {
+	return FilterStats{
+		Matched: atomic.LoadUint64(&f.matched),
+		Dropped: atomic.LoadUint64(&f.dropped),
+	}
+}
@@ -0,0 +1,561 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// predicate evaluates a filter expression over a flow record
+type predicate func(r *Record) bool
+
+type fieldKind int
+
+const (
+	kindNumber fieldKind = iota
+	kindString
+	kindIP
+	kindBool
+)
+
+func (k fieldKind) String() string {
+	switch k {
+	case kindNumber:
+		return "number"
+	case kindString:
+		return "string"
+	case kindIP:
+		return "IP"
+	default:
+		return "boolean"
+	}
+}
+
+// filterField is a flow record field that can be referred from the filter expressions. Only the
+// getter of its kind is set
+type filterField struct {
+	kind    fieldKind
+	number  func(r *Record) uint64
+	str     func(r *Record) string
+	ip      func(r *Record) net.IP
+	boolean func(r *Record) bool
+}
+
+func numberField(get func(r *Record) uint64) filterField {
+	return filterField{kind: kindNumber, number: get}
+}
+
+func stringField(get func(r *Record) string) filterField {
+	return filterField{kind: kindString, str: get}
+}
+
+func ipField(get func(r *Record) net.IP) filterField {
+	return filterField{kind: kindIP, ip: get}
+}
+
+// filterFields are the flow record fields that can be referred from the filter expressions,
+// by their name
+var filterFields = map[string]filterField{
+	"proto":           numberField(func(r *Record) uint64 { return uint64(r.Id.TransportProtocol) }),
+	"src_port":        numberField(func(r *Record) uint64 { return uint64(r.Id.SrcPort) }),
+	"dst_port":        numberField(func(r *Record) uint64 { return uint64(r.Id.DstPort) }),
+	"eth_type":        numberField(func(r *Record) uint64 { return uint64(r.Id.EthProtocol) }),
+	"icmp_type":       numberField(func(r *Record) uint64 { return uint64(r.Id.IcmpType) }),
+	"icmp_code":       numberField(func(r *Record) uint64 { return uint64(r.Id.IcmpCode) }),
+	"vlan_id":         numberField(func(r *Record) uint64 { return uint64(r.Id.VlanId) }),
+	"if_index":        numberField(func(r *Record) uint64 { return uint64(r.Id.IfIndex) }),
+	"packets":         numberField(func(r *Record) uint64 { return uint64(r.Metrics.Packets) }),
+	"bytes":           numberField(func(r *Record) uint64 { return r.Metrics.Bytes }),
+	"tcp_flags":       numberField(func(r *Record) uint64 { return uint64(r.Metrics.Flags) }),
+	"dropped_packets": numberField(func(r *Record) uint64 { return uint64(r.Metrics.DroppedPackets) }),
+	"dropped_bytes":   numberField(func(r *Record) uint64 { return r.Metrics.DroppedBytes }),
+	"retransmits":     numberField(func(r *Record) uint64 { return uint64(r.Metrics.Retransmits) }),
+	"sampling":        numberField(func(r *Record) uint64 { return uint64(r.Metrics.Sampling) }),
+	"reverse_packets": numberField(func(r *Record) uint64 {
+		if r.Reverse == nil {
+			return 0
+		}
+		return uint64(r.Reverse.Packets)
+	}),
+	"reverse_bytes": numberField(func(r *Record) uint64 {
+		if r.Reverse == nil {
+			return 0
+		}
+		return r.Reverse.Bytes
+	}),
+	"pid": numberField(func(r *Record) uint64 {
+		if r.Process == nil {
+			return 0
+		}
+		return uint64(r.Process.PID)
+	}),
+	"src_ip":   ipField(func(r *Record) net.IP { return IP(r.Id.SrcIp) }),
+	"dst_ip":   ipField(func(r *Record) net.IP { return IP(r.Id.DstIp) }),
+	"agent_ip": ipField(func(r *Record) net.IP { return r.AgentIP }),
+	"src_mac": stringField(func(r *Record) string {
+		mac := MacAddr(r.Id.SrcMac)
+		return mac.String()
+	}),
+	"dst_mac": stringField(func(r *Record) string {
+		mac := MacAddr(r.Id.DstMac)
+		return mac.String()
+	}),
+	"direction": stringField(func(r *Record) string {
+		if r.Id.Direction == DirectionEgress {
+			return "egress"
+		}
+		return "ingress"
+	}),
+	"iface":      stringField(func(r *Record) string { return r.Interface }),
+	"netns":      stringField(func(r *Record) string { return r.NetNS }),
+	"drop_cause": stringField(func(r *Record) string { return r.DropCause }),
+	"command": stringField(func(r *Record) string {
+		if r.Process == nil {
+			return ""
+		}
+		return r.Process.Command
+	}),
+	"container_id": stringField(func(r *Record) string {
+		if r.Process == nil {
+			return ""
+		}
+		return r.Process.ContainerID
+	}),
+	"duplicate": {kind: kindBool, boolean: func(r *Record) bool { return r.Duplicate }},
+}
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type token struct {
+	typ  tokenType
+	text string
+	// position of the token in the expression, for the error messages
+	pos int
+}
+
+// operators of the expression language. The two-character operators go first, so they are
+// matched before their one-character prefixes
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")", "[", "]", ","}
+
+// tokenize splits a filter expression into its tokens, ending with a tokenEOF token
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	pos := 0
+	for pos < len(expr) {
+		c := rune(expr[pos])
+		switch {
+		case unicode.IsSpace(c):
+			pos++
+		case c == '_' || unicode.IsLetter(c):
+			end := pos + 1
+			for end < len(expr) && (expr[end] == '_' || unicode.IsLetter(rune(expr[end])) ||
+				unicode.IsDigit(rune(expr[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{typ: tokenIdent, text: expr[pos:end], pos: pos})
+			pos = end
+		case unicode.IsDigit(c):
+			end := pos + 1
+			for end < len(expr) && (unicode.IsDigit(rune(expr[end])) || unicode.IsLetter(rune(expr[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{typ: tokenNumber, text: expr[pos:end], pos: pos})
+			pos = end
+		case c == '"':
+			end := pos + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at position %d", pos)
+			}
+			text, err := strconv.Unquote(expr[pos : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %w", pos, err)
+			}
+			tokens = append(tokens, token{typ: tokenString, text: text, pos: pos})
+			pos = end + 1
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(expr[pos:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, pos)
+			}
+			tokens = append(tokens, token{typ: tokenOperator, text: op, pos: pos})
+			pos += len(op)
+		}
+	}
+	return append(tokens, token{typ: tokenEOF, pos: pos}), nil
+}
+
+// parser is a recursive descent parser of the filter expressions, which compiles them into
+// predicates. The grammar is:
+//
+//	or         := and ( "||" and )*
+//	and        := unary ( "&&" unary )*
+//	unary      := "!" unary | "(" or ")" | "true" | "false" | comparison
+//	comparison := field [ op value | "in" "[" value ( "," value )* "]" ]
+//
+// where a field without comparison must be a boolean field
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parseFilter compiles a filter expression into a predicate
+func parseFilter(expr string) (predicate, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{tokens: tokens}
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.typ != tokenEOF {
+		return nil, p.unexpected(next)
+	}
+	return pred, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the provided operator
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.typ == tokenOperator && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		return fmt.Errorf("expected %q: %w", op, p.unexpected(p.peek()))
+	}
+	return nil
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.typ == tokenEOF {
+		return errors.New("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+func (p *parser) parseOr() (predicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r *Record) bool { return l(r) || right(r) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (predicate, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r *Record) bool { return l(r) && right(r) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (predicate, error) {
+	if p.accept("!") {
+		pred, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(r *Record) bool { return !pred(r) }, nil
+	}
+	if p.accept("(") {
+		pred, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return pred, nil
+	}
+	t := p.next()
+	if t.typ != tokenIdent {
+		return nil, p.unexpected(t)
+	}
+	switch t.text {
+	case "true":
+		return func(*Record) bool { return true }, nil
+	case "false":
+		return func(*Record) bool { return false }, nil
+	}
+	field, ok := filterFields[t.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q at position %d", t.text, t.pos)
+	}
+	return p.parseComparison(t, field)
+}
+
+func (p *parser) parseComparison(name token, field filterField) (predicate, error) {
+	op := p.peek()
+	if op.typ == tokenIdent && op.text == "in" {
+		p.next()
+		return p.parseIn(name, field)
+	}
+	if op.typ != tokenOperator || !isComparison(op.text) {
+		if field.kind == kindBool {
+			return field.boolean, nil
+		}
+		return nil, fmt.Errorf("missing comparison for %s field %q at position %d",
+			field.kind, name.text, name.pos)
+	}
+	p.next()
+	value := p.next()
+	switch field.kind {
+	case kindNumber:
+		n, err := p.number(value)
+		if err != nil {
+			return nil, err
+		}
+		return compareNumber(field.number, op, n)
+	case kindString:
+		s, err := p.string(value)
+		if err != nil {
+			return nil, err
+		}
+		return compareString(field.str, op, s)
+	case kindIP:
+		s, err := p.string(value)
+		if err != nil {
+			return nil, err
+		}
+		return compareIP(field.ip, op, value, s)
+	default:
+		if value.typ != tokenIdent || (value.text != "true" && value.text != "false") {
+			return nil, fmt.Errorf("expected a boolean value: %w", p.unexpected(value))
+		}
+		expected := value.text == "true"
+		switch op.text {
+		case "==":
+			return func(r *Record) bool { return field.boolean(r) == expected }, nil
+		case "!=":
+			return func(r *Record) bool { return field.boolean(r) != expected }, nil
+		}
+	}
+	return nil, fmt.Errorf("operator %q at position %d can't be applied to %s fields",
+		op.text, op.pos, field.kind)
+}
+
+func (p *parser) parseIn(name token, field filterField) (predicate, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	var values []token
+	for {
+		values = append(values, p.next())
+		if p.accept("]") {
+			break
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+	switch field.kind {
+	case kindNumber:
+		set := map[uint64]struct{}{}
+		for _, v := range values {
+			n, err := p.number(v)
+			if err != nil {
+				return nil, err
+			}
+			set[n] = struct{}{}
+		}
+		return func(r *Record) bool {
+			_, ok := set[field.number(r)]
+			return ok
+		}, nil
+	case kindString:
+		set := map[string]struct{}{}
+		for _, v := range values {
+			s, err := p.string(v)
+			if err != nil {
+				return nil, err
+			}
+			set[s] = struct{}{}
+		}
+		return func(r *Record) bool {
+			_, ok := set[field.str(r)]
+			return ok
+		}, nil
+	case kindIP:
+		cidrs := make([]*net.IPNet, 0, len(values))
+		for _, v := range values {
+			s, err := p.string(v)
+			if err != nil {
+				return nil, err
+			}
+			cidr, err := parseIPOrCIDR(v, s)
+			if err != nil {
+				return nil, err
+			}
+			cidrs = append(cidrs, cidr)
+		}
+		return func(r *Record) bool {
+			ip := field.ip(r)
+			for _, cidr := range cidrs {
+				if cidr.Contains(ip) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	return nil, fmt.Errorf("operator \"in\" can't be applied to %s field %q at position %d",
+		field.kind, name.text, name.pos)
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+		return true
+	}
+	return false
+}
+
+func (p *parser) number(t token) (uint64, error) {
+	if t.typ != tokenNumber {
+		return 0, fmt.Errorf("expected a number: %w", p.unexpected(t))
+	}
+	// base 0 also accepts hexadecimal values, which are handy for the TCP flags
+	n, err := strconv.ParseUint(t.text, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q at position %d", t.text, t.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) string(t token) (string, error) {
+	if t.typ != tokenString {
+		return "", fmt.Errorf("expected a quoted string: %w", p.unexpected(t))
+	}
+	return t.text, nil
+}
+
+func compareNumber(get func(r *Record) uint64, op token, n uint64) (predicate, error) {
+	switch op.text {
+	case "==":
+		return func(r *Record) bool { return get(r) == n }, nil
+	case "!=":
+		return func(r *Record) bool { return get(r) != n }, nil
+	case "<":
+		return func(r *Record) bool { return get(r) < n }, nil
+	case "<=":
+		return func(r *Record) bool { return get(r) <= n }, nil
+	case ">":
+		return func(r *Record) bool { return get(r) > n }, nil
+	case ">=":
+		return func(r *Record) bool { return get(r) >= n }, nil
+	}
+	return nil, fmt.Errorf("operator %q at position %d can't be applied to number fields",
+		op.text, op.pos)
+}
+
+func compareString(get func(r *Record) string, op token, s string) (predicate, error) {
+	switch op.text {
+	case "==":
+		return func(r *Record) bool { return get(r) == s }, nil
+	case "!=":
+		return func(r *Record) bool { return get(r) != s }, nil
+	case "=~", "!~":
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression at position %d: %w", op.pos, err)
+		}
+		if op.text == "!~" {
+			return func(r *Record) bool { return !re.MatchString(get(r)) }, nil
+		}
+		return func(r *Record) bool { return re.MatchString(get(r)) }, nil
+	}
+	return nil, fmt.Errorf("operator %q at position %d can't be applied to string fields",
+		op.text, op.pos)
+}
+
+// compareIP compares an IP field with an address, or checks whether it belongs to a CIDR
+func compareIP(get func(r *Record) net.IP, op, value token, s string) (predicate, error) {
+	cidr, err := parseIPOrCIDR(value, s)
+	if err != nil {
+		return nil, err
+	}
+	switch op.text {
+	case "==":
+		return func(r *Record) bool { return cidr.Contains(get(r)) }, nil
+	case "!=":
+		return func(r *Record) bool { return !cidr.Contains(get(r)) }, nil
+	}
+	return nil, fmt.Errorf("operator %q at position %d can't be applied to IP fields",
+		op.text, op.pos)
+}
+
+// parseIPOrCIDR parses a CIDR, or an IP address as a single-address CIDR
+func parseIPOrCIDR(t token, s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, cidr, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q at position %d", s, t.pos)
+		}
+		return cidr, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q at position %d", s, t.pos)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)}, nil
+}
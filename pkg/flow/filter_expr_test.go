@@ -0,0 +1,103 @@
+package flow
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
+)
+
+func TestParseFilter(t *testing.T) {
+	record := &Record{
+		RawRecord: RawRecord{
+			Id: ebpf.BpfFlowId{
+				Direction:         DirectionEgress,
+				SrcIp:             IPAddr{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 10, 0, 0, 1},
+				DstIp:             IPAddr{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 192, 168, 0, 7},
+				SrcPort:           34567,
+				DstPort:           443,
+				TransportProtocol: 6,
+				SrcMac:            MacAddr{0x0a, 0x58, 0, 0, 0, 1},
+			},
+			Metrics: ebpf.BpfFlowMetrics{Packets: 12, Bytes: 3456, Flags: 0x12, Sampling: 10},
+		},
+		Interface: "eth0",
+		Process:   &Process{PID: 42, Command: "curl"},
+		AgentIP:   net.ParseIP("10.0.0.100"),
+	}
+	for _, tc := range []struct {
+		expr  string
+		match bool
+	}{
+		{`proto == 6`, true},
+		{`proto != 6`, false},
+		{`dst_port in [80, 443]`, true},
+		{`dst_port in [80,8080]`, false},
+		{`bytes > 1000 && packets <= 12`, true},
+		{`bytes >= 3457 || packets < 12`, false},
+		{`tcp_flags == 0x12`, true},
+		{`sampling > 1`, true},
+		{`reverse_bytes > 0`, false},
+		{`iface =~ "^eth"`, true},
+		{`iface !~ "^eth"`, false},
+		{`iface in ["br0", "eth0"]`, true},
+		{`netns == ""`, true},
+		{`direction == "egress"`, true},
+		{`src_mac == "0a:58:00:00:00:01"`, true},
+		{`src_ip == "10.0.0.1"`, true},
+		{`src_ip != "10.0.0.1"`, false},
+		{`dst_ip == "192.168.0.0/16"`, true},
+		{`dst_ip in ["10.0.0.0/8", "fd00::/8"]`, false},
+		{`agent_ip in ["10.0.0.0/24"]`, true},
+		{`command == "curl" && pid == 42`, true},
+		{`container_id == ""`, true},
+		{`duplicate`, false},
+		{`!duplicate`, true},
+		{`duplicate == false`, true},
+		{`!(proto == 6 && dst_port == 443)`, false},
+		{`proto == 17 || proto == 6 && dst_port == 443`, true},
+		{`(proto == 17 || proto == 6) && dst_port == 80`, false},
+		{`true`, true},
+		{`!true || false`, false},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			match, err := parseFilter(tc.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.match, match(record))
+		})
+	}
+}
+
+func TestParseFilter_Errors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`proto`,
+		`proto == `,
+		`proto == "tcp"`,
+		`proto =~ "6"`,
+		`port == 443`,
+		`dst_port in [80, 443`,
+		`dst_port in []`,
+		`iface == eth0`,
+		`iface < "eth0"`,
+		`iface =~ "("`,
+		`src_ip == "10.0.0.300"`,
+		`src_ip in ["10.0.0.0/33"]`,
+		`src_ip > "10.0.0.1"`,
+		`duplicate == 1`,
+		`(proto == 6`,
+		`proto == 6)`,
+		`proto == 6 &&`,
+		`proto == 6 & dst_port == 443`,
+		`iface == "eth0`,
+		`dst_port == 99999999999999999999`,
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := parseFilter(expr)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package flow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
+)
+
+func TestFilter(t *testing.T) {
+	filter, err := NewFilter(`proto == 6 && dst_port in [80, 443] && !duplicate && iface =~ "^eth"`)
+	require.NoError(t, err)
+
+	https := &Record{RawRecord: RawRecord{Id: ebpf.BpfFlowId{TransportProtocol: 6, DstPort: 443}},
+		Interface: "eth0"}
+	duplicate := &Record{RawRecord: RawRecord{Id: ebpf.BpfFlowId{TransportProtocol: 6, DstPort: 443}},
+		Interface: "eth1", Duplicate: true}
+	dns := &Record{RawRecord: RawRecord{Id: ebpf.BpfFlowId{TransportProtocol: 17, DstPort: 53}},
+		Interface: "eth0"}
+	veth := &Record{RawRecord: RawRecord{Id: ebpf.BpfFlowId{TransportProtocol: 6, DstPort: 80}},
+		Interface: "veth0"}
+
+	in := make(chan []*Record, 2)
+	out := make(chan []*Record, 2)
+	in <- []*Record{https, duplicate, dns}
+	// the batches without any matching flow are not forwarded
+	in <- []*Record{veth}
+	close(in)
+	filter.Filter(in, out)
+	close(out)
+
+	var forwarded [][]*Record
+	for records := range out {
+		forwarded = append(forwarded, records)
+	}
+	assert.Equal(t, [][]*Record{{https}}, forwarded)
+	assert.Equal(t, FilterStats{Matched: 1, Dropped: 3}, filter.Stats())
+}
+
+func TestNewFilter_Invalid(t *testing.T) {
+	_, err := NewFilter(`proto = 6`)
+	assert.Error(t, err)
+}
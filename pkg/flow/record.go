@@ -17,6 +17,18 @@ const (
 )
 const MacLen = 6
 
+// TCP flags, as set by the eBPF tracer. Values according to RFC 9293 & field 6 in
+// https://www.iana.org/assignments/ipfix/ipfix.xhtml, plus some custom flags.
+const (
+	TCPFinFlag    = uint16(0x01)
+	TCPSynFlag    = uint16(0x02)
+	TCPRstFlag    = uint16(0x04)
+	TCPSynAckFlag = uint16(0x100)
+)
+
+// TCPProtocol value as defined in https://www.iana.org/assignments/protocol-numbers
+const TCPProtocol = 6
+
 // IPv6Type value as defined in IEEE 802: https://www.iana.org/assignments/ieee-802-numbers/ieee-802-numbers.xhtml
 const IPv6Type = 0x86DD
 
@@ -39,7 +51,36 @@ type Record struct {
 	// TODO: redundant field from RecordMetrics. Reorganize structs
 	TimeFlowStart time.Time
 	TimeFlowEnd   time.Time
+	// TimeFlowRtt is the round-trip time of the TCP handshake, as observed from the interface
+	// where the flow was captured. It is 0 if it couldn't be calculated.
+	TimeFlowRtt time.Duration
+	// DNSLatency is the time between the last DNS query of the flow and its response, as
+	// observed from the interface where the flow was captured. It is 0 if it couldn't be
+	// calculated.
+	DNSLatency time.Duration
+	// TCPSock summarizes the samples of the local socket of the TCP connection of the flow, if
+	// the flow is sent from the local endpoint. It is nil if the socket was not sampled
+	TCPSock *TCPSockStats
+	// Process that owns the local socket of the TCP connection of the flow. It is nil if the
+	// connection is not attributed to any local process
+	Process *Process
+	// Reverse contains the metrics of the reverse direction of the flow, if the records of both
+	// directions have been merged into a bidirectional flow. In that case, the rest of the record
+	// describes the direction of the initiator. It is nil for the unidirectional flows
+	Reverse *ReverseMetrics
+	// ConnEvent is the lifecycle event of the connection of the flow that this record reports.
+	// It is ConnEventNone if the connections are not tracked
+	ConnEvent ConnEvent
+	// FlowEndReason tells why the record of a tracked connection has been reported. It is 0 for
+	// the records that start a connection
+	FlowEndReason FlowEndReason
 	Interface     string
+	// NetNS is the name of the network namespace of the interface. It is empty for the agent's
+	// own namespace
+	NetNS string
+	// DropCause is the name of the kernel reason of the last dropped packet of the flow (e.g.
+	// NETFILTER_DROP). It is empty if no packets have been dropped
+	DropCause string
 	// Duplicate tells whether this flow has another duplicate so it has to be excluded from
 	// any metrics' aggregation (e.g. bytes/second rates between two pods).
 	// The reason for this field is that the same flow can be observed from multiple interfaces,
@@ -52,6 +93,17 @@ type Record struct {
 	AgentIP net.IP
 }
 
+// Process that owns a socket
+type Process struct {
+	PID     uint32
+	Command string
+	// CgroupID is the inode number of the cgroup v2 of the process
+	CgroupID uint64
+	// ContainerID is the ID of the container whose cgroup contains the process. It is empty if
+	// the process does not run in a container
+	ContainerID string
+}
+
 func NewRecord(
 	key ebpf.BpfFlowId,
 	metrics ebpf.BpfFlowMetrics,
@@ -71,6 +123,11 @@ func NewRecord(
 }
 
 func Accumulate(r *ebpf.BpfFlowMetrics, src *ebpf.BpfFlowMetrics) {
+	// the sampling rate might change during the flow, so the rate of its last packet is reported.
+	// The metrics that only report dropped packets do not have any sampling rate
+	if src.Packets > 0 && src.EndMonoTimeTs >= r.EndMonoTimeTs {
+		r.Sampling = src.Sampling
+	}
 	// time == 0 if the value has not been yet set
 	if r.StartMonoTimeTs == 0 || r.StartMonoTimeTs > src.StartMonoTimeTs {
 		r.StartMonoTimeTs = src.StartMonoTimeTs
@@ -78,9 +135,31 @@ func Accumulate(r *ebpf.BpfFlowMetrics, src *ebpf.BpfFlowMetrics) {
 	if r.EndMonoTimeTs == 0 || r.EndMonoTimeTs < src.EndMonoTimeTs {
 		r.EndMonoTimeTs = src.EndMonoTimeTs
 	}
+	// the handshake timestamp is only set in the per-CPU metrics of the CPU that handled it.
+	// If the handshake packets were handled by many CPUs, the earliest one is reported
+	if src.ConnMonoTimeTs != 0 && (r.ConnMonoTimeTs == 0 || r.ConnMonoTimeTs > src.ConnMonoTimeTs) {
+		r.ConnMonoTimeTs = src.ConnMonoTimeTs
+	}
 	r.Bytes += src.Bytes
 	r.Packets += src.Packets
 	r.Flags |= src.Flags
+	r.FragmentedPackets += src.FragmentedPackets
+	r.SynPackets += src.SynPackets
+	r.FinPackets += src.FinPackets
+	r.RstPackets += src.RstPackets
+	r.DroppedPackets += src.DroppedPackets
+	r.DroppedBytes += src.DroppedBytes
+	// the per-CPU metrics do not tell which drop was the last, so any reason is reported
+	if src.DroppedPackets > 0 {
+		r.DropReason = src.DropReason
+	}
+	// the per-CPU metrics might have observed different DNS messages, so the last one is reported
+	if src.DnsMonoTimeTs > r.DnsMonoTimeTs {
+		r.DnsId = src.DnsId
+		r.DnsFlags = src.DnsFlags
+		r.DnsMonoTimeTs = src.DnsMonoTimeTs
+	}
+	r.Retransmits += src.Retransmits
 }
 
 // IP returns the net.IP equivalent object
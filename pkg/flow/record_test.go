@@ -18,6 +18,8 @@ func TestRecordBinaryEncoding(t *testing.T) {
 		0x03,                               // u16 direction
 		0x04, 0x05, 0x06, 0x07, 0x08, 0x09, // data_link: u8[6] src_mac
 		0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, // data_link: u8[6] dst_mac
+		0x64, 0x00, // data_link: u16 vlan_id
+		0xc8, 0x00, // data_link: u16 inner_vlan_id
 		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x06, 0x07, 0x08, 0x09, // network: u8[16] src_ip
 		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x0a, 0x0b, 0x0c, 0x0d, // network: u32 dst_ip
 		0x0e, 0x0f, // transport: u16 src_port
@@ -25,13 +27,31 @@ func TestRecordBinaryEncoding(t *testing.T) {
 		0x12,                   // transport: u8 transport_protocol
 		0x00,                   // icmp: u8 icmp_type
 		0x00,                   // icmp: u8 icmp_code
+		0x01,                   // u8 non_first_fragment
 		0x13, 0x14, 0x15, 0x16, // interface index
+		0x17, 0x18, 0x19, 0x1a, // interface network namespace
+		0x01,                                                                                           // u8 tunnel_type
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xc0, 0xa8, 0x00, 0x01, // u8[16] tunnel_src_ip
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xc0, 0xa8, 0x00, 0x02, // u8[16] tunnel_dst_ip
+		0x1b, 0x1c, 0x1d, 0x00, // u32 tunnel_id
 		0x06, 0x07, 0x08, 0x09, // u32 packets
 		0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, // u64 bytes
 		0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, // u64 flow_start_time
 		0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, // u64 conn_time
 		0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, // u64 flow_end_time
 		0x13, 0x14, //flags
+		0x02, 0x00, 0x00, 0x00, // u32 fragmented_packets
+		0x03, 0x00, 0x00, 0x00, // u32 syn_packets
+		0x04, 0x00, 0x00, 0x00, // u32 fin_packets
+		0x05, 0x00, 0x00, 0x00, // u32 rst_packets
+		0x06, 0x00, 0x00, 0x00, // u32 dropped_packets
+		0x07, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // u64 dropped_bytes
+		0x0c, 0x00, 0x00, 0x00, // u32 drop_reason
+		0x34, 0x12, // u16 dns_id
+		0x80, 0x81, // u16 dns_flags
+		0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, // u64 dns_mono_time_ts
+		0x08, 0x00, 0x00, 0x00, // u32 retransmits
+		0x0a, 0x00, 0x00, 0x00, // u32 sampling
 		0x33, // u8 errno
 
 	}))
@@ -43,6 +63,8 @@ func TestRecordBinaryEncoding(t *testing.T) {
 			Direction:         0x03,
 			SrcMac:            MacAddr{0x04, 0x05, 0x06, 0x07, 0x08, 0x09},
 			DstMac:            MacAddr{0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f},
+			VlanId:            100,
+			InnerVlanId:       200,
 			SrcIp:             IPAddr{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x06, 0x07, 0x08, 0x09},
 			DstIp:             IPAddr{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x0a, 0x0b, 0x0c, 0x0d},
 			SrcPort:           0x0f0e,
@@ -50,19 +72,53 @@ func TestRecordBinaryEncoding(t *testing.T) {
 			TransportProtocol: 0x12,
 			IcmpType:          0x00,
 			IcmpCode:          0x00,
+			NonFirstFragment:  0x01,
 			IfIndex:           0x16151413,
+			IfNetns:           0x1a191817,
+			TunnelType:        0x01,
+			TunnelSrcIp:       IPAddr{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xc0, 0xa8, 0x00, 0x01},
+			TunnelDstIp:       IPAddr{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xc0, 0xa8, 0x00, 0x02},
+			TunnelId:          0x1d1c1b,
 		},
 		Metrics: ebpf.BpfFlowMetrics{
-			Packets:         0x09080706,
-			Bytes:           0x1a19181716151413,
-			StartMonoTimeTs: 0x1a19181716151413,
-			ConnMonoTimeTs:  0x1a19181716151413,
-			EndMonoTimeTs:   0x1a19181716151413,
-			Flags:           0x1413,
-			Errno:           0x33,
+			Packets:           0x09080706,
+			Bytes:             0x1a19181716151413,
+			StartMonoTimeTs:   0x1a19181716151413,
+			ConnMonoTimeTs:    0x1a19181716151413,
+			EndMonoTimeTs:     0x1a19181716151413,
+			Flags:             0x1413,
+			FragmentedPackets: 0x02,
+			SynPackets:        0x03,
+			FinPackets:        0x04,
+			RstPackets:        0x05,
+			DroppedPackets:    0x06,
+			DroppedBytes:      0x07,
+			DropReason:        0x0c,
+			DnsId:             0x1234,
+			DnsFlags:          0x8180,
+			DnsMonoTimeTs:     0x1a19181716151413,
+			Retransmits:       0x08,
+			Sampling:          0x0a,
+			Errno:             0x33,
 		},
 	}, *fr)
 	// assert that IP addresses are interpreted as IPv4 addresses
 	assert.Equal(t, "6.7.8.9", IP(fr.Id.SrcIp).String())
 	assert.Equal(t, "10.11.12.13", IP(fr.Id.DstIp).String())
+	assert.Equal(t, "192.168.0.1", IP(fr.Id.TunnelSrcIp).String())
+	assert.Equal(t, "192.168.0.2", IP(fr.Id.TunnelDstIp).String())
+}
+
+func TestAccumulate_Sampling(t *testing.T) {
+	metrics := ebpf.BpfFlowMetrics{}
+	// the rate of the last packet of the flow is reported
+	Accumulate(&metrics, &ebpf.BpfFlowMetrics{Packets: 1, EndMonoTimeTs: 20, Sampling: 10})
+	Accumulate(&metrics, &ebpf.BpfFlowMetrics{Packets: 1, EndMonoTimeTs: 10, Sampling: 5})
+	assert.EqualValues(t, 10, metrics.Sampling)
+	// the metrics without packets, which only report drops, are not sampled
+	Accumulate(&metrics, &ebpf.BpfFlowMetrics{DroppedPackets: 1, EndMonoTimeTs: 30})
+	assert.EqualValues(t, 10, metrics.Sampling)
+	Accumulate(&metrics, &ebpf.BpfFlowMetrics{Packets: 1, EndMonoTimeTs: 40, Sampling: 20})
+	assert.EqualValues(t, 20, metrics.Sampling)
+	assert.EqualValues(t, 3, metrics.Packets)
 }
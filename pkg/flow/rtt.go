@@ -0,0 +1,188 @@
+package flow
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var rlog = logrus.WithField("component", "flow/HandshakeRTT")
+
+// handshakeKey identifies a TCP connection as observed from a given interface, regardless of
+// the direction of each of its flows
+type handshakeKey struct {
+	ifIndex    uint32
+	ifNetns    uint32
+	client     IPAddr
+	server     IPAddr
+	clientPort uint16
+	serverPort uint16
+}
+
+// handshake stores the monotonic timestamps of the 3-way handshake packets of a connection,
+// as they are received from both the client-to-server and the server-to-client flows.
+type handshake struct {
+	key *handshakeKey
+	// synDirection is the direction (ingress/egress) of the client-to-server flow, which
+	// tells whether the agent observes the handshake from the client or the server side
+	synDirection uint8
+	synTs        uint64
+	synAckTs     uint64
+	ackTs        uint64
+	expiryTime   time.Time
+}
+
+// rttCache stores the handshakes whose flows have been only partially received.
+// Its entries are evicted if they are not completed during the expire duration.
+// It is not safe for concurrent access.
+type rttCache struct {
+	expire time.Duration
+	// key: connection key
+	// value: listElement pointing to a handshake struct
+	handshakes map[handshakeKey]*list.Element
+	// element: handshake structs of the handshakes map ordered by expiry time
+	entries *list.List
+}
+
+// HandshakeRTT correlates the client-to-server and server-to-client flows of the TCP
+// connections whose 3-way handshake has been observed, and sets their TimeFlowRtt field:
+//   - From the client side, the RTT is the time between the egress SYN and the ingress SYN-ACK.
+//   - From the server side, the RTT is the time between the egress SYN-ACK and the ingress ACK.
+//
+// The RTT is set in the records that complete the handshake information. Incomplete handshakes
+// are forgotten after the expiry time.
+func HandshakeRTT(expireTime time.Duration) func(in <-chan []*Record, out chan<- []*Record) {
+	cache := &rttCache{
+		expire:     expireTime,
+		entries:    list.New(),
+		handshakes: map[handshakeKey]*list.Element{},
+	}
+	return func(in <-chan []*Record, out chan<- []*Record) {
+		for records := range in {
+			cache.removeExpired()
+			// records from the current batch that belong to a still-uncompleted handshake
+			pending := map[handshakeKey][]*Record{}
+			for _, record := range records {
+				key, ok := cache.update(record)
+				if !ok {
+					continue
+				}
+				pending[key] = append(pending[key], record)
+				if rtt, ok := cache.rtt(key); ok {
+					for _, r := range pending[key] {
+						r.TimeFlowRtt = rtt
+					}
+					delete(pending, key)
+				}
+			}
+			out <- records
+		}
+	}
+}
+
+// update stores the handshake timestamps of the record. It returns false if the record does
+// not contain any handshake information
+func (c *rttCache) update(record *Record) (handshakeKey, bool) {
+	if record.Id.TransportProtocol != TCPProtocol {
+		return handshakeKey{}, false
+	}
+	var key handshakeKey
+	var hs *handshake
+	switch {
+	case record.Metrics.Flags&TCPSynAckFlag != 0:
+		if record.Metrics.ConnMonoTimeTs == 0 {
+			return key, false
+		}
+		key = handshakeKey{
+			ifIndex:    record.Id.IfIndex,
+			ifNetns:    record.Id.IfNetns,
+			client:     record.Id.DstIp,
+			server:     record.Id.SrcIp,
+			clientPort: record.Id.DstPort,
+			serverPort: record.Id.SrcPort,
+		}
+		hs = c.get(key)
+		hs.synAckTs = record.Metrics.ConnMonoTimeTs
+	case record.Metrics.Flags&TCPSynFlag != 0:
+		key = handshakeKey{
+			ifIndex:    record.Id.IfIndex,
+			ifNetns:    record.Id.IfNetns,
+			client:     record.Id.SrcIp,
+			server:     record.Id.DstIp,
+			clientPort: record.Id.SrcPort,
+			serverPort: record.Id.DstPort,
+		}
+		hs = c.get(key)
+		hs.synDirection = record.Id.Direction
+		hs.synTs = record.Metrics.StartMonoTimeTs
+		hs.ackTs = record.Metrics.ConnMonoTimeTs
+	default:
+		return key, false
+	}
+	return key, true
+}
+
+// rtt returns the round-trip time of the handshake, if all the required information has
+// been already received. In that case, the handshake is removed from the cache.
+func (c *rttCache) rtt(key handshakeKey) (time.Duration, bool) {
+	ele, ok := c.handshakes[key]
+	if !ok {
+		return 0, false
+	}
+	hs := ele.Value.(*handshake)
+	if hs.synTs == 0 || hs.synAckTs == 0 {
+		return 0, false
+	}
+	var start, end uint64
+	if hs.synDirection == DirectionEgress {
+		// client side: SYN is sent and SYN-ACK is received
+		start, end = hs.synTs, hs.synAckTs
+	} else {
+		// server side: SYN-ACK is sent and ACK is received
+		if hs.ackTs == 0 {
+			return 0, false
+		}
+		start, end = hs.synAckTs, hs.ackTs
+	}
+	c.entries.Remove(ele)
+	delete(c.handshakes, key)
+	if end < start {
+		rlog.WithField("connection", key).Debug("handshake timestamps are out of order. Ignoring")
+		return 0, false
+	}
+	return time.Duration(end - start), true
+}
+
+// get returns the handshake for the given connection key, creating a new one if it does
+// not exist yet.
+func (c *rttCache) get(key handshakeKey) *handshake {
+	if ele, ok := c.handshakes[key]; ok {
+		return ele.Value.(*handshake)
+	}
+	hs := &handshake{
+		key:        &key,
+		expiryTime: timeNow().Add(c.expire),
+	}
+	c.handshakes[key] = c.entries.PushFront(hs)
+	return hs
+}
+
+func (c *rttCache) removeExpired() {
+	now := timeNow()
+	ele := c.entries.Back()
+	evicted := 0
+	for ele != nil && now.After(ele.Value.(*handshake).expiryTime) {
+		evicted++
+		c.entries.Remove(ele)
+		delete(c.handshakes, *ele.Value.(*handshake).key)
+		ele = c.entries.Back()
+	}
+	if evicted > 0 {
+		rlog.WithFields(logrus.Fields{
+			"current":    c.entries.Len(),
+			"evicted":    evicted,
+			"expiryTime": c.expire,
+		}).Debug("incomplete handshakes evicted from the RTT cache")
+	}
+}
@@ -0,0 +1,117 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
+)
+
+func handshakeRecords(clientDir uint8, synTs, synAckTs, ackTs uint64) (syn, synAck *Record) {
+	serverDir := DirectionIngress
+	if clientDir == DirectionIngress {
+		serverDir = DirectionEgress
+	}
+	syn = &Record{RawRecord: RawRecord{Id: ebpf.BpfFlowId{
+		Direction: clientDir, TransportProtocol: TCPProtocol, IfIndex: 3,
+		SrcIp: srcAddr1, DstIp: dstAddr1, SrcPort: 333, DstPort: 8080,
+	}, Metrics: ebpf.BpfFlowMetrics{
+		StartMonoTimeTs: synTs, ConnMonoTimeTs: ackTs, Flags: TCPSynFlag | 0x10,
+	}}}
+	synAck = &Record{RawRecord: RawRecord{Id: ebpf.BpfFlowId{
+		Direction: serverDir, TransportProtocol: TCPProtocol, IfIndex: 3,
+		SrcIp: dstAddr1, DstIp: srcAddr1, SrcPort: 8080, DstPort: 333,
+	}, Metrics: ebpf.BpfFlowMetrics{
+		StartMonoTimeTs: synAckTs, ConnMonoTimeTs: synAckTs, Flags: TCPSynAckFlag | 0x10,
+	}}}
+	return syn, synAck
+}
+
+func TestHandshakeRTT_ClientSide(t *testing.T) {
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+	go HandshakeRTT(time.Minute)(input, output)
+
+	// client side: SYN is egress and SYN-ACK is ingress
+	syn, synAck := handshakeRecords(DirectionEgress, 1000, 1300, 1310)
+	input <- []*Record{syn, synAck}
+	received := receiveTimeout(t, output)
+	assert.Equal(t, []*Record{syn, synAck}, received)
+	assert.Equal(t, 300*time.Nanosecond, syn.TimeFlowRtt)
+	assert.Equal(t, 300*time.Nanosecond, synAck.TimeFlowRtt)
+}
+
+func TestHandshakeRTT_ServerSide(t *testing.T) {
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+	go HandshakeRTT(time.Minute)(input, output)
+
+	// server side: SYN-ACK is egress and ACK is ingress
+	syn, synAck := handshakeRecords(DirectionIngress, 1000, 1010, 1500)
+	input <- []*Record{syn, synAck}
+	receiveTimeout(t, output)
+	assert.Equal(t, 490*time.Nanosecond, syn.TimeFlowRtt)
+	assert.Equal(t, 490*time.Nanosecond, synAck.TimeFlowRtt)
+}
+
+func TestHandshakeRTT_DifferentBatches(t *testing.T) {
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+	go HandshakeRTT(time.Minute)(input, output)
+
+	syn, synAck := handshakeRecords(DirectionEgress, 1000, 1300, 1310)
+	// the SYN flow is forwarded without RTT, as the handshake is not completed yet
+	input <- []*Record{syn}
+	receiveTimeout(t, output)
+	assert.Zero(t, syn.TimeFlowRtt)
+
+	// the RTT is set in the record that completes the handshake
+	input <- []*Record{synAck}
+	receiveTimeout(t, output)
+	assert.Equal(t, 300*time.Nanosecond, synAck.TimeFlowRtt)
+
+	// a new SYN-ACK record for the same connection is not updated, as the handshake
+	// was already removed from the cache
+	_, synAck2 := handshakeRecords(DirectionEgress, 1000, 1300, 1310)
+	input <- []*Record{synAck2}
+	receiveTimeout(t, output)
+	assert.Zero(t, synAck2.TimeFlowRtt)
+}
+
+func TestHandshakeRTT_IgnoredFlows(t *testing.T) {
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+	go HandshakeRTT(time.Minute)(input, output)
+
+	// non-TCP flows are ignored
+	udp := &Record{RawRecord: RawRecord{Id: ebpf.BpfFlowId{TransportProtocol: 17}, Metrics: ebpf.BpfFlowMetrics{
+		StartMonoTimeTs: 1000, ConnMonoTimeTs: 1300, Flags: TCPSynAckFlag,
+	}}}
+	// flows from different interfaces are not correlated
+	syn, synAck := handshakeRecords(DirectionEgress, 1000, 1300, 1310)
+	synAck.Id.IfIndex = 4
+	input <- []*Record{udp, syn, synAck}
+	receiveTimeout(t, output)
+	assert.Zero(t, udp.TimeFlowRtt)
+	assert.Zero(t, syn.TimeFlowRtt)
+	assert.Zero(t, synAck.TimeFlowRtt)
+}
+
+func TestHandshakeRTT_Expiry(t *testing.T) {
+	tm := mockTimeNow(t)
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+	go HandshakeRTT(15*time.Second)(input, output)
+
+	syn, synAck := handshakeRecords(DirectionEgress, 1000, 1300, 1310)
+	input <- []*Record{syn}
+	receiveTimeout(t, output)
+
+	// after the expiry time, the incomplete handshake is forgotten
+	tm.now = tm.now.Add(20 * time.Second)
+	input <- []*Record{synAck}
+	receiveTimeout(t, output)
+	assert.Zero(t, synAck.TimeFlowRtt)
+}
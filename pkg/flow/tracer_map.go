@@ -20,19 +20,23 @@ type MapTracer struct {
 	mapFetcher      mapFetcher
 	evictionTimeout time.Duration
 	// manages the access to the eviction routines, avoiding two evictions happening at the same time
-	evictionCond   *sync.Cond
-	lastEvictionNs uint64
+	evictionCond *sync.Cond
+	// staleBeforeNs is the time before which the per-CPU values of the evicted map are stale
+	staleBeforeNs uint64
+	// lastEvictionsNs are the end times of the latest flows of the two previous evictions, which
+	// drained the other map and the evicted map, respectively
+	lastEvictionsNs [2]uint64
 }
 
 type mapFetcher interface {
-	LookupAndDeleteMap() map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics
+	LookupAndDeleteMap() (map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics, error)
 }
 
 func NewMapTracer(fetcher mapFetcher, evictionTimeout time.Duration) *MapTracer {
 	return &MapTracer{
 		mapFetcher:      fetcher,
 		evictionTimeout: evictionTimeout,
-		lastEvictionNs:  uint64(monotime.Now()),
+		lastEvictionsNs: [2]uint64{uint64(monotime.Now()), uint64(monotime.Now())},
 		evictionCond:    sync.NewCond(&sync.Mutex{}),
 	}
 }
@@ -89,9 +93,19 @@ func (m *MapTracer) evictFlows(ctx context.Context, forwardFlows chan<- []*Recor
 	monotonicTimeNow := monotime.Now()
 	currentTime := time.Now()
 
+	evicted, err := m.mapFetcher.LookupAndDeleteMap()
+	if err != nil {
+		// the maps have not been flipped, so the active map is kept, with the times of the
+		// previous evictions, until it is evicted by the next successful flip
+		mtlog.WithError(err).Warn("can't evict flows. Retrying in the next eviction")
+		return
+	}
+	// the kernel alternates between two maps, so the evicted map was last drained two evictions
+	// ago, and it has only been updated since the previous eviction
+	m.staleBeforeNs = m.lastEvictionsNs[0]
 	var forwardingFlows []*Record
 	laterFlowNs := uint64(0)
-	for flowKey, flowMetrics := range m.mapFetcher.LookupAndDeleteMap() {
+	for flowKey, flowMetrics := range evicted {
 		aggregatedMetrics := m.aggregate(flowMetrics)
 		// we ignore metrics that haven't been aggregated (e.g. all the mapped values are ignored)
 		if aggregatedMetrics.EndMonoTimeTs == 0 {
@@ -108,7 +122,12 @@ func (m *MapTracer) evictFlows(ctx context.Context, forwardFlows chan<- []*Recor
 			uint64(monotonicTimeNow),
 		))
 	}
-	m.lastEvictionNs = laterFlowNs
+	// an empty eviction does not tell anything about the stale values, so the previous time is
+	// kept
+	if laterFlowNs < m.lastEvictionsNs[1] {
+		laterFlowNs = m.lastEvictionsNs[1]
+	}
+	m.lastEvictionsNs = [2]uint64{m.lastEvictionsNs[1], laterFlowNs}
 	select {
 	case <-ctx.Done():
 		mtlog.Debug("skipping flow eviction as agent is being stopped")
@@ -125,10 +144,10 @@ func (m *MapTracer) aggregate(metrics []ebpf.BpfFlowMetrics) ebpf.BpfFlowMetrics
 	}
 	aggr := ebpf.BpfFlowMetrics{}
 	for _, mt := range metrics {
-		// eBPF hashmap values are not zeroed when the entry is removed. That causes that we
-		// might receive entries from previous collect-eviction timeslots.
-		// We need to check the flow time and discard old flows.
-		if mt.StartMonoTimeTs <= m.lastEvictionNs || mt.EndMonoTimeTs <= m.lastEvictionNs {
+		// eBPF hashmap values are not zeroed when the entry is removed (Kernel < 5.10). That
+		// causes that we might receive entries from previous collect-eviction timeslots of the
+		// same map. We need to check the flow time and discard old flows.
+		if mt.StartMonoTimeTs <= m.staleBeforeNs || mt.EndMonoTimeTs <= m.staleBeforeNs {
 			continue
 		}
 		Accumulate(&aggr, &mt)
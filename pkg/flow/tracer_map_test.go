@@ -1,10 +1,14 @@
 package flow
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
 )
@@ -44,3 +48,142 @@ func TestPacketAggregation(t *testing.T) {
 		})
 	}
 }
+
+func TestPacketAggregation_HandshakeRTT(t *testing.T) {
+	ft := MapTracer{}
+	syn, synAck := handshakeRecords(DirectionEgress, 0, 0, 0)
+	// the SYN and the ACK of the client are handled by different CPUs, so only the per-CPU
+	// metrics of the ACK have the handshake timestamp
+	syn.Metrics = ft.aggregate([]ebpf.BpfFlowMetrics{
+		{Packets: 1, Bytes: 60, StartMonoTimeTs: 1000, EndMonoTimeTs: 1000, Flags: TCPSynFlag},
+		{Packets: 2, Bytes: 104, StartMonoTimeTs: 1310, EndMonoTimeTs: 1400, Flags: 0x10, ConnMonoTimeTs: 1310},
+		{},
+	})
+	synAck.Metrics = ft.aggregate([]ebpf.BpfFlowMetrics{
+		{},
+		{Packets: 1, Bytes: 60, StartMonoTimeTs: 1300, EndMonoTimeTs: 1300, Flags: TCPSynAckFlag | 0x10, ConnMonoTimeTs: 1300},
+	})
+	assert.EqualValues(t, 1310, syn.Metrics.ConnMonoTimeTs)
+	assert.EqualValues(t, 1300, synAck.Metrics.ConnMonoTimeTs)
+
+	input := make(chan []*Record, 100)
+	output := make(chan []*Record, 100)
+	go HandshakeRTT(time.Minute)(input, output)
+	input <- []*Record{syn, synAck}
+	receiveTimeout(t, output)
+	assert.Equal(t, 300*time.Nanosecond, syn.TimeFlowRtt)
+	assert.Equal(t, 300*time.Nanosecond, synAck.TimeFlowRtt)
+}
+
+// mapFetcherFake returns the lookups in order. A nil lookup fails as if the maps couldn't be
+// flipped
+type mapFetcherFake struct {
+	lookups []map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics
+}
+
+func (f *mapFetcherFake) LookupAndDeleteMap() (map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics, error) {
+	lookup := f.lookups[0]
+	f.lookups = f.lookups[1:]
+	if lookup == nil {
+		return nil, errors.New("can't switch the active flows map")
+	}
+	return lookup, nil
+}
+
+func TestMapTracer_StaleValues(t *testing.T) {
+	id := ebpf.BpfFlowId{TransportProtocol: TCPProtocol, SrcPort: 1234, DstPort: 80}
+	fetcher := &mapFetcherFake{lookups: []map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics{
+		// first map
+		{id: {{Packets: 1, StartMonoTimeTs: 1100, EndMonoTimeTs: 1200}}},
+		// second map. The values of other CPUs that have been updated after the previous
+		// eviction, but whose timestamps are older than its flows, are not discarded
+		{id: {
+			{Packets: 2, StartMonoTimeTs: 2100, EndMonoTimeTs: 2200},
+			{Packets: 3, StartMonoTimeTs: 1150, EndMonoTimeTs: 2300},
+		}},
+		// first map again: the values that are older than its previous eviction are stale
+		{id: {
+			{Packets: 4, StartMonoTimeTs: 3100, EndMonoTimeTs: 3200},
+			{Packets: 1, StartMonoTimeTs: 1100, EndMonoTimeTs: 1200},
+		}},
+	}}
+	tracer := NewMapTracer(fetcher, time.Minute)
+	tracer.lastEvictionsNs = [2]uint64{1000, 1000}
+	out := make(chan []*Record, 10)
+	for _, packets := range []uint32{1, 5, 4} {
+		tracer.evictFlows(context.Background(), out)
+		records := <-out
+		if assert.Len(t, records, 1) {
+			assert.Equal(t, packets, records[0].Metrics.Packets)
+		}
+	}
+}
+
+func TestMapTracer_FailedFlip(t *testing.T) {
+	id := ebpf.BpfFlowId{TransportProtocol: TCPProtocol, SrcPort: 1234, DstPort: 80}
+	fetcher := &mapFetcherFake{lookups: []map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics{
+		// first map
+		{id: {{Packets: 1, StartMonoTimeTs: 1100, EndMonoTimeTs: 1200}}},
+		// the maps are not flipped, so the second map keeps being updated
+		nil,
+		// second map. It was last drained before the first eviction, so only the values that
+		// are older than that eviction are stale
+		{id: {
+			{Packets: 2, StartMonoTimeTs: 2100, EndMonoTimeTs: 2200},
+			{Packets: 3, StartMonoTimeTs: 1050, EndMonoTimeTs: 2300},
+		}},
+		// first map again
+		{id: {
+			{Packets: 4, StartMonoTimeTs: 3100, EndMonoTimeTs: 3200},
+			{Packets: 1, StartMonoTimeTs: 1100, EndMonoTimeTs: 1200},
+		}},
+	}}
+	tracer := NewMapTracer(fetcher, time.Minute)
+	tracer.lastEvictionsNs = [2]uint64{1000, 1000}
+	out := make(chan []*Record, 10)
+	for _, packets := range []uint32{1, 0, 5, 4} {
+		tracer.evictFlows(context.Background(), out)
+		if packets == 0 {
+			assert.Empty(t, out, "no flows must be forwarded if the maps are not flipped")
+			assert.Equal(t, [2]uint64{1000, 1200}, tracer.lastEvictionsNs)
+			continue
+		}
+		records := <-out
+		if assert.Len(t, records, 1) {
+			assert.Equal(t, packets, records[0].Metrics.Packets)
+		}
+	}
+}
+
+func TestMapTracer_Drops(t *testing.T) {
+	// the packet drops program accounts the drops in the same per-CPU entries as the flows
+	// programs, so they are aggregated with the packets of the flow that are handled by other CPUs
+	id := ebpf.BpfFlowId{EthProtocol: IPv6Type, TransportProtocol: 17, VlanId: 100,
+		SrcPort: 1234, DstPort: 53}
+	dropOnly := ebpf.BpfFlowId{EthProtocol: IPv6Type, TransportProtocol: 17,
+		SrcPort: 4321, DstPort: 53}
+	fetcher := &mapFetcherFake{lookups: []map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics{{
+		id: {
+			{Packets: 3, Bytes: 300, StartMonoTimeTs: 1100, EndMonoTimeTs: 1300},
+			{DroppedPackets: 1, DropReason: 12, StartMonoTimeTs: 1200, EndMonoTimeTs: 1200},
+			{},
+		},
+		dropOnly: {
+			{},
+			{DroppedPackets: 2, DropReason: 3, StartMonoTimeTs: 1150, EndMonoTimeTs: 1250},
+		},
+	}}}
+	tracer := NewMapTracer(fetcher, time.Minute)
+	tracer.lastEvictionsNs = [2]uint64{1000, 1000}
+	out := make(chan []*Record, 10)
+	tracer.evictFlows(context.Background(), out)
+	records := map[ebpf.BpfFlowId]*Record{}
+	for _, record := range <-out {
+		records[record.Id] = record
+	}
+	require.Len(t, records, 2)
+	assert.Equal(t, ebpf.BpfFlowMetrics{Packets: 3, Bytes: 300, StartMonoTimeTs: 1100, EndMonoTimeTs: 1300,
+		DroppedPackets: 1, DropReason: 12}, records[id].Metrics)
+	assert.Equal(t, ebpf.BpfFlowMetrics{StartMonoTimeTs: 1150, EndMonoTimeTs: 1250,
+		DroppedPackets: 2, DropReason: 3}, records[dropOnly].Metrics)
+}
@@ -38,6 +38,8 @@ type Event struct {
 type Interface struct {
 	Name  string
 	Index int
+	// NetNS of the interface. Its zero value refers to the agent's own network namespace
+	NetNS NetNS
 }
 
 // Informer provides notifications about each network interface that is added or removed
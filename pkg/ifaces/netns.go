@@ -0,0 +1,280 @@
+package ifaces
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// NetNSDiscovery selects the network namespaces, other than the agent's own namespace, whose
+// interfaces are reported by the informers
+type NetNSDiscovery int
+
+const (
+	// NetNSNone only reports the interfaces of the agent's own network namespace
+	NetNSNone NetNSDiscovery = iota
+	// NetNSNamed also reports the interfaces of the named namespaces in /var/run/netns
+	NetNSNamed
+	// NetNSAll also reports the interfaces of the namespaces of the running processes
+	// (e.g. containers), even if they are not named
+	NetNSAll
+)
+
+// netnsDir and procDir are variables to allow overriding them in unit tests
+var (
+	netnsDir = "/var/run/netns"
+	procDir  = "/proc"
+)
+
+// unnamedPrefix is the prefix of the names given to the namespaces that are not in netnsDir.
+// It follows the format that the kernel uses to represent them (e.g. net:[4026531840])
+const unnamedPrefix = "net:["
+
+// NetNS identifies a network namespace. Its zero value refers to the agent's own namespace.
+type NetNS struct {
+	// Name of the namespace file in /var/run/netns, or net:[<inode>] for the namespaces that
+	// have been found from running processes
+	Name string
+	// Inode number of the namespace, which identifies it in the system
+	Inode uint32
+}
+
+func (ns NetNS) String() string {
+	return ns.Name
+}
+
+// netnsPath is a discovered network namespace, with a path from where it can be opened
+type netnsPath struct {
+	NetNS
+	path string
+}
+
+// listNetNS returns the network namespaces selected by the discovery mode, excluding the
+// agent's own namespace
+func listNetNS(discovery NetNSDiscovery) ([]netnsPath, error) {
+	if discovery == NetNSNone {
+		return nil, nil
+	}
+	own, err := netnsInode(filepath.Join(procDir, "self", "ns", "net"))
+	if err != nil {
+		return nil, fmt.Errorf("can't get the agent network namespace: %w", err)
+	}
+	found := map[uint32]struct{}{own: {}}
+	var namespaces []netnsPath
+
+	entries, err := os.ReadDir(netnsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("can't read named network namespaces: %w", err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(netnsDir, entry.Name())
+		// ignoring the namespace files that are not mounted anymore
+		if !isNetNSMount(path) {
+			continue
+		}
+		inode, err := netnsInode(path)
+		if err != nil {
+			ilog.WithError(err).WithField("path", path).Debug("can't get network namespace. Ignoring")
+			continue
+		}
+		if _, ok := found[inode]; ok {
+			continue
+		}
+		found[inode] = struct{}{}
+		namespaces = append(namespaces, netnsPath{NetNS: NetNS{Name: entry.Name(), Inode: inode}, path: path})
+	}
+	if discovery != NetNSAll {
+		return namespaces, nil
+	}
+
+	err = forEachProcessNetNS(func(path string, inode uint32) bool {
+		if _, ok := found[inode]; !ok {
+			found[inode] = struct{}{}
+			namespaces = append(namespaces, netnsPath{NetNS: unnamedNetNS(inode), path: path})
+		}
+		return true
+	})
+	return namespaces, err
+}
+
+// forEachProcessNetNS invokes the provided function for the network namespace of each running
+// process, until the function returns false. The processes that finish during the iteration
+// are ignored.
+func forEachProcessNetNS(fn func(path string, inode uint32) bool) error {
+	procs, err := os.ReadDir(procDir)
+	if err != nil {
+		return fmt.Errorf("can't read processes: %w", err)
+	}
+	for _, proc := range procs {
+		if _, err := strconv.Atoi(proc.Name()); err != nil {
+			continue
+		}
+		path := filepath.Join(procDir, proc.Name(), "ns", "net")
+		inode, err := netnsInode(path)
+		if err != nil {
+			continue
+		}
+		if !fn(path, inode) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func unnamedNetNS(inode uint32) NetNS {
+	return NetNS{Name: fmt.Sprintf("%s%d]", unnamedPrefix, inode), Inode: inode}
+}
+
+func netnsInode(path string) (uint32, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, err
+	}
+	return uint32(st.Ino), nil
+}
+
+func isNetNSMount(path string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false
+	}
+	return st.Type == unix.NSFS_MAGIC
+}
+
+// OpenNetNS returns a handle to the provided network namespace, which must be closed after
+// its usage. The namespaces that are not named are looked up from the running processes.
+func OpenNetNS(ns NetNS) (netns.NsHandle, error) {
+	path := ""
+	if !strings.HasPrefix(ns.Name, unnamedPrefix) {
+		path = filepath.Join(netnsDir, ns.Name)
+	} else if err := forEachProcessNetNS(func(procPath string, inode uint32) bool {
+		if inode == ns.Inode {
+			path = procPath
+		}
+		return path == ""
+	}); err != nil {
+		return netns.None(), err
+	}
+	if path == "" {
+		return netns.None(), fmt.Errorf("network namespace %s not found", ns)
+	}
+	handle, err := netns.GetFromPath(path)
+	if err != nil {
+		return netns.None(), fmt.Errorf("opening network namespace %s: %w", ns, err)
+	}
+	// the namespace could have been replaced by another with the same name, or the process
+	// could have been replaced by another with the same PID
+	var st unix.Stat_t
+	if err := unix.Fstat(int(handle), &st); err != nil || uint32(st.Ino) != ns.Inode {
+		handle.Close()
+		return netns.None(), fmt.Errorf("network namespace %s not found", ns)
+	}
+	return handle, nil
+}
+
+// InNetNS runs the provided function from the given network namespace. The goroutines that
+// are created by the function do not run in the namespace.
+func InNetNS(ns NetNS, fn func() error) error {
+	if ns.Inode == 0 {
+		return fn()
+	}
+	handle, err := OpenNetNS(ns)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	// the function runs in its own goroutine, since the thread is discarded if it can't be
+	// restored to the original namespace
+	result := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		original, err := netns.Get()
+		if err != nil {
+			runtime.UnlockOSThread()
+			result <- fmt.Errorf("getting current network namespace: %w", err)
+			return
+		}
+		defer original.Close()
+		if err := netns.Set(handle); err != nil {
+			runtime.UnlockOSThread()
+			result <- fmt.Errorf("entering network namespace %s: %w", ns, err)
+			return
+		}
+		fnErr := fn()
+		if err := netns.Set(original); err != nil {
+			// the thread is kept locked, so it terminates with the goroutine
+			result <- fmt.Errorf("restoring network namespace: %w", err)
+			return
+		}
+		runtime.UnlockOSThread()
+		result <- fnErr
+	}()
+	return <-result
+}
+
+// netnsInterfaces returns the interfaces of the given network namespace
+func netnsInterfaces(ns netnsPath) ([]Interface, error) {
+	handle, err := netns.GetFromPath(ns.path)
+	if err != nil {
+		return nil, fmt.Errorf("opening network namespace %s: %w", ns.NetNS, err)
+	}
+	defer handle.Close()
+	nlHandle, err := netlink.NewHandleAt(handle)
+	if err != nil {
+		return nil, fmt.Errorf("accessing network namespace %s: %w", ns.NetNS, err)
+	}
+	defer nlHandle.Delete()
+	links, err := nlHandle.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch interfaces from network namespace %s: %w", ns.NetNS, err)
+	}
+	names := make([]Interface, 0, len(links))
+	for _, link := range links {
+		attrs := link.Attrs()
+		names = append(names, Interface{Name: attrs.Name, Index: attrs.Index, NetNS: ns.NetNS})
+	}
+	return names, nil
+}
+
+// netnsLinkSubscribe subscribes to the link updates of the given network namespace
+func netnsLinkSubscribe(ns netnsPath, ch chan<- netlink.LinkUpdate, done <-chan struct{}) error {
+	handle, err := netns.GetFromPath(ns.path)
+	if err != nil {
+		return fmt.Errorf("opening network namespace %s: %w", ns.NetNS, err)
+	}
+	// the netlink socket keeps the namespace reference after the handle is closed
+	defer handle.Close()
+	return netlink.LinkSubscribeAt(handle, ch, done)
+}
+
+// interfaces returns the interfaces of the agent's namespace and of the network namespaces
+// that are selected by the discovery mode
+func (d NetNSDiscovery) interfaces() ([]Interface, error) {
+	names, err := netInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := listNetNS(d)
+	if err != nil {
+		ilog.WithError(err).Warn("can't list network namespaces. Only reporting the agent's own interfaces")
+		return names, nil
+	}
+	for _, ns := range namespaces {
+		nsNames, err := netnsInterfaces(ns)
+		if err != nil {
+			// the namespace might have been removed after being listed
+			ilog.WithError(err).Debug("can't fetch interfaces from network namespace. Ignoring")
+			continue
+		}
+		names = append(names, nsNames...)
+	}
+	return names, nil
+}
@@ -8,7 +8,8 @@ import (
 )
 
 // Poller periodically looks for the network interfaces in the system and forwards Event
-// notifications when interfaces are added or deleted.
+// notifications when interfaces are added or deleted. Depending on the NetNSDiscovery mode,
+// it also looks for the interfaces of other network namespaces.
 type Poller struct {
 	period     time.Duration
 	current    map[Interface]struct{}
@@ -16,11 +17,11 @@ type Poller struct {
 	bufLen     int
 }
 
-func NewPoller(period time.Duration, bufLen int) *Poller {
+func NewPoller(period time.Duration, bufLen int, discovery NetNSDiscovery) *Poller {
 	return &Poller{
 		period:     period,
 		bufLen:     bufLen,
-		interfaces: netInterfaces,
+		interfaces: discovery.interfaces,
 		current:    map[Interface]struct{}{},
 	}
 }
@@ -21,28 +21,28 @@ func TestPoller(t *testing.T) {
 	var fakeInterfaces = func() ([]Interface, error) {
 		if firstInvocation {
 			firstInvocation = false
-			return []Interface{{"foo", 1}, {"bar", 2}}, nil
+			return []Interface{{Name: "foo", Index: 1}, {Name: "bar", Index: 2}}, nil
 		}
-		return []Interface{{"foo", 1}, {"bae", 3}}, nil
+		return []Interface{{Name: "foo", Index: 1}, {Name: "bae", Index: 3}}, nil
 	}
-	poller := NewPoller(5*time.Millisecond, 10)
+	poller := NewPoller(5*time.Millisecond, 10, NetNSNone)
 	poller.interfaces = fakeInterfaces
 
 	updates, err := poller.Subscribe(ctx)
 	require.NoError(t, err)
 	// first poll: two interfaces are added
 	assert.Equal(t,
-		Event{Type: EventAdded, Interface: Interface{"foo", 1}},
+		Event{Type: EventAdded, Interface: Interface{Name: "foo", Index: 1}},
 		getEvent(t, updates, timeout))
 	assert.Equal(t,
-		Event{Type: EventAdded, Interface: Interface{"bar", 2}},
+		Event{Type: EventAdded, Interface: Interface{Name: "bar", Index: 2}},
 		getEvent(t, updates, timeout))
 	// second poll: one interface is added and another is removed
 	assert.Equal(t,
-		Event{Type: EventAdded, Interface: Interface{"bae", 3}},
+		Event{Type: EventAdded, Interface: Interface{Name: "bae", Index: 3}},
 		getEvent(t, updates, timeout))
 	assert.Equal(t,
-		Event{Type: EventDeleted, Interface: Interface{"bar", 2}},
+		Event{Type: EventDeleted, Interface: Interface{Name: "bar", Index: 2}},
 		getEvent(t, updates, timeout))
 	// successive polls: no more events are forwarded
 	select {
@@ -7,19 +7,34 @@ import (
 )
 
 // Registerer is an informer that wraps another informer implementation, and keeps track of
-// the currently existing interfaces in the system, accessible through the IfaceNameForIndex method.
+// the currently existing interfaces in the system, accessible through the IfaceForIndex method.
 type Registerer struct {
 	m      sync.RWMutex
 	inner  Informer
-	ifaces map[int]string
+	ifaces map[ifaceKey]Interface
 	bufLen int
+	// interfaceByIndex abstracts net.InterfaceByIndex, allowing the injection of mocks for
+	// unit testing
+	interfaceByIndex func(int) (*net.Interface, error)
+}
+
+// ifaceKey identifies an interface by its index, which is only unique within its network
+// namespace
+type ifaceKey struct {
+	netNS uint32
+	index int
+}
+
+func keyOf(iface Interface) ifaceKey {
+	return ifaceKey{netNS: iface.NetNS.Inode, index: iface.Index}
 }
 
 func NewRegisterer(inner Informer, bufLen int) *Registerer {
 	return &Registerer{
-		inner:  inner,
-		bufLen: bufLen,
-		ifaces: map[int]string{},
+		inner:            inner,
+		bufLen:           bufLen,
+		ifaces:           map[ifaceKey]Interface{},
+		interfaceByIndex: net.InterfaceByIndex,
 	}
 }
 
@@ -34,15 +49,15 @@ func (r *Registerer) Subscribe(ctx context.Context) (<-chan Event, error) {
 			switch ev.Type {
 			case EventAdded:
 				r.m.Lock()
-				r.ifaces[ev.Interface.Index] = ev.Interface.Name
+				r.ifaces[keyOf(ev.Interface)] = ev.Interface
 				r.m.Unlock()
 			case EventDeleted:
 				r.m.Lock()
-				name, ok := r.ifaces[ev.Interface.Index]
+				iface, ok := r.ifaces[keyOf(ev.Interface)]
 				// prevent removing an interface with the same index but different name
 				// e.g. due to an out-of-order add/delete signaling
-				if ok && name == ev.Interface.Name {
-					delete(r.ifaces, ev.Interface.Index)
+				if ok && iface.Name == ev.Interface.Name {
+					delete(r.ifaces, keyOf(ev.Interface))
 				}
 				r.m.Unlock()
 			}
@@ -52,22 +67,28 @@ func (r *Registerer) Subscribe(ctx context.Context) (<-chan Event, error) {
 	return out, nil
 }
 
-// IfaceNameForIndex gets the interface name given an index as recorded by the underlying
-// interfaces' informer. It backs up into the net.InterfaceByIndex function if the interface
-// has not been previously registered
-func (r *Registerer) IfaceNameForIndex(idx int) (string, bool) {
+// IfaceForIndex gets the interface given the inode of its network namespace (0 for the agent's
+// own namespace) and its index, as recorded by the underlying interfaces' informer. For the
+// agent's namespace, it backs up into the net.InterfaceByIndex function if the interface
+// has not been previously registered.
+// The cached interfaces are evicted when the informer notifies their deletion.
+func (r *Registerer) IfaceForIndex(netNS uint32, idx int) (Interface, bool) {
+	key := ifaceKey{netNS: netNS, index: idx}
 	r.m.RLock()
-	name, ok := r.ifaces[idx]
+	iface, ok := r.ifaces[key]
 	r.m.RUnlock()
 	if !ok {
-		iface, err := net.InterfaceByIndex(idx)
+		if netNS != 0 {
+			return Interface{}, false
+		}
+		netIface, err := r.interfaceByIndex(idx)
 		if err != nil {
-			return "", false
+			return Interface{}, false
 		}
-		name = iface.Name
+		iface = Interface{Name: netIface.Name, Index: idx}
 		r.m.Lock()
-		r.ifaces[idx] = name
+		r.ifaces[key] = iface
 		r.m.Unlock()
 	}
-	return name, ok
+	return iface, true
 }
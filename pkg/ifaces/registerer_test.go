@@ -2,6 +2,8 @@ package ifaces
 
 import (
 	"context"
+	"errors"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,11 +15,11 @@ func TestRegisterer(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	watcher := NewWatcher(10)
+	watcher := NewWatcher(10, NetNSNone, 0)
 	registry := NewRegisterer(watcher, 10)
 	// mock net.Interfaces and linkSubscriber to control which interfaces are discovered
 	watcher.interfaces = func() ([]Interface, error) {
-		return []Interface{{"foo", 1}, {"bar", 2}, {"baz", 3}}, nil
+		return []Interface{{Name: "foo", Index: 1}, {Name: "bar", Index: 2}, {Name: "baz", Index: 3}}, nil
 	}
 	inputLinks := make(chan netlink.LinkUpdate, 10)
 	watcher.linkSubscriber = func(ch chan<- netlink.LinkUpdate, done <-chan struct{}) error {
@@ -36,9 +38,9 @@ func TestRegisterer(t *testing.T) {
 	for i := 0; i < 3; i++ {
 		getEvent(t, outputEvents, timeout)
 	}
-	assert.Equal(t, "foo", registry.ifaces[1])
-	assert.Equal(t, "bar", registry.ifaces[2])
-	assert.Equal(t, "baz", registry.ifaces[3])
+	assert.Equal(t, "foo", registry.ifaces[ifaceKey{index: 1}].Name)
+	assert.Equal(t, "bar", registry.ifaces[ifaceKey{index: 2}].Name)
+	assert.Equal(t, "baz", registry.ifaces[ifaceKey{index: 3}].Name)
 
 	// updates
 	inputLinks <- upAndRunning("bae", 4)
@@ -47,10 +49,10 @@ func TestRegisterer(t *testing.T) {
 		getEvent(t, outputEvents, timeout)
 	}
 
-	assert.Equal(t, "foo", registry.ifaces[1])
-	assert.NotContains(t, registry.ifaces, 2)
-	assert.Equal(t, "baz", registry.ifaces[3])
-	assert.Equal(t, "bae", registry.ifaces[4])
+	assert.Equal(t, "foo", registry.ifaces[ifaceKey{index: 1}].Name)
+	assert.NotContains(t, registry.ifaces, ifaceKey{index: 2})
+	assert.Equal(t, "baz", registry.ifaces[ifaceKey{index: 3}].Name)
+	assert.Equal(t, "bae", registry.ifaces[ifaceKey{index: 4}].Name)
 
 	// repeated updates that do not involve a change in the current track of interfaces
 	// will be ignored
@@ -60,7 +62,54 @@ func TestRegisterer(t *testing.T) {
 		getEvent(t, outputEvents, timeout)
 	}
 
-	assert.Equal(t, "fiu", registry.ifaces[1])
-	assert.Equal(t, "baz", registry.ifaces[3])
-	assert.Equal(t, "bae", registry.ifaces[4])
+	assert.Equal(t, "fiu", registry.ifaces[ifaceKey{index: 1}].Name)
+	assert.Equal(t, "baz", registry.ifaces[ifaceKey{index: 3}].Name)
+	assert.Equal(t, "bae", registry.ifaces[ifaceKey{index: 4}].Name)
+}
+
+func TestRegisterer_EvictsFallbackNames(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher := NewWatcher(10, NetNSNone, 0)
+	registry := NewRegisterer(watcher, 10)
+	watcher.interfaces = func() ([]Interface, error) {
+		return nil, nil
+	}
+	inputLinks := make(chan netlink.LinkUpdate, 10)
+	watcher.linkSubscriber = func(ch chan<- netlink.LinkUpdate, done <-chan struct{}) error {
+		go func() {
+			for link := range inputLinks {
+				ch <- link
+			}
+		}()
+		return nil
+	}
+	systemIfaces := map[int]string{5: "veth5"}
+	registry.interfaceByIndex = func(idx int) (*net.Interface, error) {
+		if name, ok := systemIfaces[idx]; ok {
+			return &net.Interface{Index: idx, Name: name}, nil
+		}
+		return nil, errors.New("no such network interface")
+	}
+
+	outputEvents, err := registry.Subscribe(ctx)
+	require.NoError(t, err)
+
+	// names of interfaces that haven't been notified by the informer are looked up in the system
+	iface, ok := registry.IfaceForIndex(0, 5)
+	assert.True(t, ok)
+	assert.Equal(t, Interface{Name: "veth5", Index: 5}, iface)
+	_, ok = registry.IfaceForIndex(0, 6)
+	assert.False(t, ok)
+
+	// and evicted when the interface is deleted
+	inputLinks <- upAndRunning("veth5", 5)
+	inputLinks <- deleted("veth5", 5)
+	for i := 0; i < 2; i++ {
+		getEvent(t, outputEvents, timeout)
+	}
+	delete(systemIfaces, 5)
+	_, ok = registry.IfaceForIndex(0, 5)
+	assert.False(t, ok)
 }
@@ -3,13 +3,16 @@ package ifaces
 import (
 	"context"
 	"syscall"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 // Watcher uses system's netlink to get real-time information events about network interfaces'
-// addition or removal.
+// addition or removal. Depending on the NetNSDiscovery mode, it also watches the interfaces of
+// other network namespaces, which are periodically looked up.
 type Watcher struct {
 	bufLen     int
 	current    map[Interface]struct{}
@@ -17,14 +20,40 @@ type Watcher struct {
 	// linkSubscriber abstracts netlink.LinkSubscribe implementation, allowing the injection of
 	// mocks for unit testing
 	linkSubscriber func(ch chan<- netlink.LinkUpdate, done <-chan struct{}) error
+	netnsDiscovery NetNSDiscovery
+	netnsPeriod    time.Duration
+	// watched network namespaces, other than the agent's own, indexed by inode
+	netns map[uint32]*watchedNetNS
+	// listNetNS, netnsInterfaces and netnsLinkSubscriber abstract the access to other network
+	// namespaces, allowing the injection of mocks for unit testing
+	listNetNS           func(discovery NetNSDiscovery) ([]netnsPath, error)
+	netnsInterfaces     func(ns netnsPath) ([]Interface, error)
+	netnsLinkSubscriber func(ns netnsPath, ch chan<- netlink.LinkUpdate, done <-chan struct{}) error
 }
 
-func NewWatcher(bufLen int) *Watcher {
+type watchedNetNS struct {
+	ns   NetNS
+	done chan struct{}
+}
+
+// netnsLinkUpdate is a link update from another network namespace
+type netnsLinkUpdate struct {
+	ns     NetNS
+	update netlink.LinkUpdate
+}
+
+func NewWatcher(bufLen int, discovery NetNSDiscovery, netnsPeriod time.Duration) *Watcher {
 	return &Watcher{
-		bufLen:         bufLen,
-		current:        map[Interface]struct{}{},
-		interfaces:     netInterfaces,
-		linkSubscriber: netlink.LinkSubscribe,
+		bufLen:              bufLen,
+		current:             map[Interface]struct{}{},
+		interfaces:          netInterfaces,
+		linkSubscriber:      netlink.LinkSubscribe,
+		netnsDiscovery:      discovery,
+		netnsPeriod:         netnsPeriod,
+		netns:               map[uint32]*watchedNetNS{},
+		listNetNS:           listNetNS,
+		netnsInterfaces:     netnsInterfaces,
+		netnsLinkSubscriber: netnsLinkSubscribe,
 	}
 }
 
@@ -57,33 +86,145 @@ func (w *Watcher) sendUpdates(ctx context.Context, out chan Event) {
 		}
 	}
 
-	for link := range links {
-		attrs := link.Attrs()
-		if attrs == nil {
-			log.WithField("link", link).Debug("received link update without attributes. Ignoring")
+	// the updates from other network namespaces are forwarded to this channel
+	nsLinks := make(chan netnsLinkUpdate)
+	var rescan <-chan time.Time
+	if w.netnsDiscovery != NetNSNone {
+		ticker := time.NewTicker(w.netnsPeriod)
+		defer ticker.Stop()
+		rescan = ticker.C
+		w.updateNetNS(nsLinks, out)
+	}
+	defer w.unwatchAllNetNS()
+
+	// the links channel is closed when the context is cancelled
+	for {
+		select {
+		case link, ok := <-links:
+			if !ok {
+				return
+			}
+			w.handleUpdate(NetNS{}, link, out)
+		case link := <-nsLinks:
+			w.handleUpdate(link.ns, link.update, out)
+		case <-rescan:
+			w.updateNetNS(nsLinks, out)
+		}
+	}
+}
+
+func (w *Watcher) handleUpdate(ns NetNS, link netlink.LinkUpdate, out chan Event) {
+	log := logrus.WithField("component", "ifaces.Watcher")
+	attrs := link.Attrs()
+	if attrs == nil {
+		log.WithField("link", link).Debug("received link update without attributes. Ignoring")
+		return
+	}
+	iface := Interface{Name: attrs.Name, Index: attrs.Index, NetNS: ns}
+	// the link update of a deleted interface might still report it as up and running
+	deleted := link.Header.Type == unix.RTM_DELLINK
+	if !deleted && link.Flags&(syscall.IFF_UP|syscall.IFF_RUNNING) != 0 {
+		log.WithFields(logrus.Fields{
+			"operstate": attrs.OperState,
+			"flags":     attrs.Flags,
+			"name":      attrs.Name,
+			"netns":     ns,
+		}).Debug("Interface up and running")
+		if _, ok := w.current[iface]; !ok {
+			w.current[iface] = struct{}{}
+			out <- Event{Type: EventAdded, Interface: iface}
+		}
+	} else {
+		log.WithFields(logrus.Fields{
+			"operstate": attrs.OperState,
+			"flags":     attrs.Flags,
+			"name":      attrs.Name,
+			"netns":     ns,
+			"deleted":   deleted,
+		}).Debug("Interface deleted, down or not running")
+		if _, ok := w.current[iface]; ok {
+			delete(w.current, iface)
+			out <- Event{Type: EventDeleted, Interface: iface}
+		}
+	}
+}
+
+// updateNetNS starts watching the network namespaces that have been created since the last
+// invocation, and stops watching the namespaces that do not exist anymore, notifying the
+// deletion of their interfaces.
+func (w *Watcher) updateNetNS(nsLinks chan<- netnsLinkUpdate, out chan Event) {
+	log := logrus.WithField("component", "ifaces.Watcher")
+	namespaces, err := w.listNetNS(w.netnsDiscovery)
+	if err != nil {
+		log.WithError(err).Warn("can't list network namespaces. You might be missing flows")
+		return
+	}
+	existing := map[uint32]struct{}{}
+	for _, ns := range namespaces {
+		existing[ns.Inode] = struct{}{}
+		if _, ok := w.netns[ns.Inode]; ok {
 			continue
 		}
-		iface := Interface{Name: attrs.Name, Index: attrs.Index}
-		if link.Flags&(syscall.IFF_UP|syscall.IFF_RUNNING) != 0 {
-			log.WithFields(logrus.Fields{
-				"operstate": attrs.OperState,
-				"flags":     attrs.Flags,
-				"name":      attrs.Name,
-			}).Debug("Interface up and running")
-			if _, ok := w.current[iface]; !ok {
-				w.current[iface] = struct{}{}
-				out <- Event{Type: EventAdded, Interface: iface}
-			}
-		} else {
-			log.WithFields(logrus.Fields{
-				"operstate": attrs.OperState,
-				"flags":     attrs.Flags,
-				"name":      attrs.Name,
-			}).Debug("Interface down or not running")
-			if _, ok := w.current[iface]; ok {
+		if err := w.watchNetNS(ns, nsLinks, out); err != nil {
+			// the namespace might have been removed after being listed
+			log.WithError(err).WithField("netns", ns.NetNS).
+				Debug("can't watch network namespace. Ignoring")
+		}
+	}
+	for inode, watched := range w.netns {
+		if _, ok := existing[inode]; ok {
+			continue
+		}
+		log.WithField("netns", watched.ns).Debug("network namespace removed")
+		close(watched.done)
+		delete(w.netns, inode)
+		for iface := range w.current {
+			if iface.NetNS == watched.ns {
 				delete(w.current, iface)
 				out <- Event{Type: EventDeleted, Interface: iface}
 			}
 		}
 	}
 }
+
+// watchNetNS subscribes to the link updates of a network namespace and sends the events
+// of its existing interfaces.
+func (w *Watcher) watchNetNS(ns netnsPath, nsLinks chan<- netnsLinkUpdate, out chan Event) error {
+	watched := &watchedNetNS{ns: ns.NetNS, done: make(chan struct{})}
+	links := make(chan netlink.LinkUpdate)
+	if err := w.netnsLinkSubscriber(ns, links, watched.done); err != nil {
+		return err
+	}
+	w.netns[ns.Inode] = watched
+	go func() {
+		// the links channel must be drained until the subscription closes it
+		for link := range links {
+			select {
+			case nsLinks <- netnsLinkUpdate{ns: ns.NetNS, update: link}:
+			case <-watched.done:
+			}
+		}
+	}()
+	names, err := w.netnsInterfaces(ns)
+	if err != nil {
+		close(watched.done)
+		delete(w.netns, ns.Inode)
+		return err
+	}
+	logrus.WithField("component", "ifaces.Watcher").WithField("netns", ns.NetNS).
+		Debug("watching network namespace")
+	for _, iface := range names {
+		if _, ok := w.current[iface]; !ok {
+			w.current[iface] = struct{}{}
+			out <- Event{Type: EventAdded, Interface: iface}
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) unwatchAllNetNS() {
+	for inode, watched := range w.netns {
+		close(watched.done)
+		delete(w.netns, inode)
+	}
+}
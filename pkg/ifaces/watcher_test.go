@@ -2,8 +2,10 @@ package ifaces
 
 import (
 	"context"
+	"sync"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,10 +18,10 @@ func TestWatcher(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	watcher := NewWatcher(10)
+	watcher := NewWatcher(10, NetNSNone, 0)
 	// mock net.Interfaces and linkSubscriber to control which interfaces are discovered
 	watcher.interfaces = func() ([]Interface, error) {
-		return []Interface{{"foo", 1}, {"bar", 2}, {"baz", 3}}, nil
+		return []Interface{{Name: "foo", Index: 1}, {Name: "bar", Index: 2}, {Name: "baz", Index: 3}}, nil
 	}
 	inputLinks := make(chan netlink.LinkUpdate, 10)
 	watcher.linkSubscriber = func(ch chan<- netlink.LinkUpdate, done <-chan struct{}) error {
@@ -36,23 +38,29 @@ func TestWatcher(t *testing.T) {
 
 	// initial set of fetched elements
 	assert.Equal(t,
-		Event{Type: EventAdded, Interface: Interface{"foo", 1}},
+		Event{Type: EventAdded, Interface: Interface{Name: "foo", Index: 1}},
 		getEvent(t, outputEvents, timeout))
 	assert.Equal(t,
-		Event{Type: EventAdded, Interface: Interface{"bar", 2}},
+		Event{Type: EventAdded, Interface: Interface{Name: "bar", Index: 2}},
 		getEvent(t, outputEvents, timeout))
 	assert.Equal(t,
-		Event{Type: EventAdded, Interface: Interface{"baz", 3}},
+		Event{Type: EventAdded, Interface: Interface{Name: "baz", Index: 3}},
 		getEvent(t, outputEvents, timeout))
 
 	// updates
 	inputLinks <- upAndRunning("bae", 4)
 	inputLinks <- down("bar", 2)
 	assert.Equal(t,
-		Event{Type: EventAdded, Interface: Interface{"bae", 4}},
+		Event{Type: EventAdded, Interface: Interface{Name: "bae", Index: 4}},
 		getEvent(t, outputEvents, timeout))
 	assert.Equal(t,
-		Event{Type: EventDeleted, Interface: Interface{"bar", 2}},
+		Event{Type: EventDeleted, Interface: Interface{Name: "bar", Index: 2}},
+		getEvent(t, outputEvents, timeout))
+
+	// deleted interfaces are notified even if their last link update reports them as running
+	inputLinks <- deleted("baz", 3)
+	assert.Equal(t,
+		Event{Type: EventDeleted, Interface: Interface{Name: "baz", Index: 3}},
 		getEvent(t, outputEvents, timeout))
 
 	// repeated updates that do not involve a change in the current track of interfaces
@@ -70,6 +78,79 @@ func TestWatcher(t *testing.T) {
 	}
 }
 
+func TestWatcher_NetNS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ns1 := NetNS{Name: "ns1", Inode: 1001}
+	ns2 := NetNS{Name: "net:[1002]", Inode: 1002}
+	watcher := NewWatcher(10, NetNSAll, 5*time.Millisecond)
+	watcher.interfaces = func() ([]Interface, error) {
+		return []Interface{{Name: "eth0", Index: 2}}, nil
+	}
+	watcher.linkSubscriber = func(ch chan<- netlink.LinkUpdate, done <-chan struct{}) error {
+		return nil
+	}
+	var mt sync.Mutex
+	namespaces := []netnsPath{{NetNS: ns1}, {NetNS: ns2}}
+	watcher.listNetNS = func(_ NetNSDiscovery) ([]netnsPath, error) {
+		mt.Lock()
+		defer mt.Unlock()
+		return namespaces, nil
+	}
+	watcher.netnsInterfaces = func(ns netnsPath) ([]Interface, error) {
+		return []Interface{{Name: "eth0", Index: 2, NetNS: ns.NetNS}}, nil
+	}
+	nsLinks := map[uint32]chan netlink.LinkUpdate{
+		ns1.Inode: make(chan netlink.LinkUpdate, 10),
+		ns2.Inode: make(chan netlink.LinkUpdate, 10),
+	}
+	watcher.netnsLinkSubscriber = func(ns netnsPath, ch chan<- netlink.LinkUpdate, done <-chan struct{}) error {
+		go func() {
+			for link := range nsLinks[ns.Inode] {
+				ch <- link
+			}
+		}()
+		return nil
+	}
+
+	outputEvents, err := watcher.Subscribe(ctx)
+	require.NoError(t, err)
+
+	// interfaces with the same index in different namespaces are reported separately
+	assert.Equal(t,
+		Event{Type: EventAdded, Interface: Interface{Name: "eth0", Index: 2}},
+		getEvent(t, outputEvents, timeout))
+	assert.Equal(t,
+		Event{Type: EventAdded, Interface: Interface{Name: "eth0", Index: 2, NetNS: ns1}},
+		getEvent(t, outputEvents, timeout))
+	assert.Equal(t,
+		Event{Type: EventAdded, Interface: Interface{Name: "eth0", Index: 2, NetNS: ns2}},
+		getEvent(t, outputEvents, timeout))
+
+	// updates from the namespaces are tagged with them
+	nsLinks[ns2.Inode] <- upAndRunning("veth3", 3)
+	assert.Equal(t,
+		Event{Type: EventAdded, Interface: Interface{Name: "veth3", Index: 3, NetNS: ns2}},
+		getEvent(t, outputEvents, timeout))
+
+	// the interfaces of a removed namespace are notified as deleted
+	mt.Lock()
+	namespaces = namespaces[:1]
+	mt.Unlock()
+	deletions := []Event{getEvent(t, outputEvents, timeout), getEvent(t, outputEvents, timeout)}
+	assert.ElementsMatch(t, []Event{
+		{Type: EventDeleted, Interface: Interface{Name: "eth0", Index: 2, NetNS: ns2}},
+		{Type: EventDeleted, Interface: Interface{Name: "veth3", Index: 3, NetNS: ns2}},
+	}, deletions)
+
+	// while the interfaces from the remaining namespaces are still watched
+	nsLinks[ns1.Inode] <- down("eth0", 2)
+	assert.Equal(t,
+		Event{Type: EventDeleted, Interface: Interface{Name: "eth0", Index: 2, NetNS: ns1}},
+		getEvent(t, outputEvents, timeout))
+}
+
 func upAndRunning(name string, index int) netlink.LinkUpdate {
 	return netlink.LinkUpdate{
 		IfInfomsg: nl.IfInfomsg{IfInfomsg: unix.IfInfomsg{Flags: syscall.IFF_UP | syscall.IFF_RUNNING}},
@@ -77,6 +158,12 @@ func upAndRunning(name string, index int) netlink.LinkUpdate {
 	}
 }
 
+func deleted(name string, index int) netlink.LinkUpdate {
+	update := upAndRunning(name, index)
+	update.Header.Type = unix.RTM_DELLINK
+	return update
+}
+
 func down(name string, index int) netlink.LinkUpdate {
 	return netlink.LinkUpdate{
 		Link: &netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Name: name, Index: index}},
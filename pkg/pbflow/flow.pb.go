@@ -9,6 +9,7 @@ package pbflow
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
 	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
@@ -69,6 +70,179 @@ func (Direction) EnumDescriptor() ([]byte, []int) {
 	return file_proto_flow_proto_rawDescGZIP(), []int{0}
 }
 
+type TunnelType int32
+
+const (
+	TunnelType_NO_TUNNEL TunnelType = 0
+	TunnelType_VXLAN     TunnelType = 1
+	TunnelType_GENEVE    TunnelType = 2
+	TunnelType_GRE       TunnelType = 3
+	TunnelType_NVGRE     TunnelType = 4
+	// IPv4 in IPv4 or IPv6
+	TunnelType_IPIP TunnelType = 5
+	// IPv6 in IPv4 (6in4) or IPv6
+	TunnelType_SIT TunnelType = 6
+)
+
+// Enum value maps for TunnelType.
+var (
+	TunnelType_name = map[int32]string{
+		0: "NO_TUNNEL",
+		1: "VXLAN",
+		2: "GENEVE",
+		3: "GRE",
+		4: "NVGRE",
+		5: "IPIP",
+		6: "SIT",
+	}
+	TunnelType_value = map[string]int32{
+		"NO_TUNNEL": 0,
+		"VXLAN":     1,
+		"GENEVE":    2,
+		"GRE":       3,
+		"NVGRE":     4,
+		"IPIP":      5,
+		"SIT":       6,
+	}
+)
+
+func (x TunnelType) Enum() *TunnelType {
+	p := new(TunnelType)
+	*p = x
+	return p
+}
+
+func (x TunnelType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TunnelType) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_flow_proto_enumTypes[1].Descriptor()
+}
+
+func (TunnelType) Type() protoreflect.EnumType {
+	return &file_proto_flow_proto_enumTypes[1]
+}
+
+func (x TunnelType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TunnelType.Descriptor instead.
+func (TunnelType) EnumDescriptor() ([]byte, []int) {
+	return file_proto_flow_proto_rawDescGZIP(), []int{1}
+}
+
+type ConnectionEvent int32
+
+const (
+	ConnectionEvent_NO_CONNECTION_EVENT ConnectionEvent = 0
+	ConnectionEvent_CONNECTION_START    ConnectionEvent = 1
+	ConnectionEvent_CONNECTION_UPDATE   ConnectionEvent = 2
+	ConnectionEvent_CONNECTION_END      ConnectionEvent = 3
+)
+
+// Enum value maps for ConnectionEvent.
+var (
+	ConnectionEvent_name = map[int32]string{
+		0: "NO_CONNECTION_EVENT",
+		1: "CONNECTION_START",
+		2: "CONNECTION_UPDATE",
+		3: "CONNECTION_END",
+	}
+	ConnectionEvent_value = map[string]int32{
+		"NO_CONNECTION_EVENT": 0,
+		"CONNECTION_START":    1,
+		"CONNECTION_UPDATE":   2,
+		"CONNECTION_END":      3,
+	}
+)
+
+func (x ConnectionEvent) Enum() *ConnectionEvent {
+	p := new(ConnectionEvent)
+	*p = x
+	return p
+}
+
+func (x ConnectionEvent) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ConnectionEvent) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_flow_proto_enumTypes[2].Descriptor()
+}
+
+func (ConnectionEvent) Type() protoreflect.EnumType {
+	return &file_proto_flow_proto_enumTypes[2]
+}
+
+func (x ConnectionEvent) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ConnectionEvent.Descriptor instead.
+func (ConnectionEvent) EnumDescriptor() ([]byte, []int) {
+	return file_proto_flow_proto_rawDescGZIP(), []int{2}
+}
+
+// as defined by field 136 in
+// https://www.iana.org/assignments/ipfix/ipfix.xhtml
+type FlowEndReason int32
+
+const (
+	// the record starts a connection, or the connection is not tracked
+	FlowEndReason_NO_END_REASON        FlowEndReason = 0
+	FlowEndReason_IDLE_TIMEOUT         FlowEndReason = 1
+	FlowEndReason_ACTIVE_TIMEOUT       FlowEndReason = 2
+	FlowEndReason_END_OF_FLOW_DETECTED FlowEndReason = 3
+	FlowEndReason_FORCED_END           FlowEndReason = 4
+)
+
+// Enum value maps for FlowEndReason.
+var (
+	FlowEndReason_name = map[int32]string{
+		0: "NO_END_REASON",
+		1: "IDLE_TIMEOUT",
+		2: "ACTIVE_TIMEOUT",
+		3: "END_OF_FLOW_DETECTED",
+		4: "FORCED_END",
+	}
+	FlowEndReason_value = map[string]int32{
+		"NO_END_REASON":        0,
+		"IDLE_TIMEOUT":         1,
+		"ACTIVE_TIMEOUT":       2,
+		"END_OF_FLOW_DETECTED": 3,
+		"FORCED_END":           4,
+	}
+)
+
+func (x FlowEndReason) Enum() *FlowEndReason {
+	p := new(FlowEndReason)
+	*p = x
+	return p
+}
+
+func (x FlowEndReason) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FlowEndReason) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_flow_proto_enumTypes[3].Descriptor()
+}
+
+func (FlowEndReason) Type() protoreflect.EnumType {
+	return &file_proto_flow_proto_enumTypes[3]
+}
+
+func (x FlowEndReason) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FlowEndReason.Descriptor instead.
+func (FlowEndReason) EnumDescriptor() ([]byte, []int) {
+	return file_proto_flow_proto_rawDescGZIP(), []int{3}
+}
+
 // intentionally empty
 type CollectorReply struct {
 	state         protoimpl.MessageState
@@ -180,6 +354,55 @@ type Record struct {
 	AgentIp *IP    `protobuf:"bytes,12,opt,name=agent_ip,json=agentIp,proto3" json:"agent_ip,omitempty"`
 	Flags   uint32 `protobuf:"varint,13,opt,name=flags,proto3" json:"flags,omitempty"`
 	Icmp    *Icmp  `protobuf:"bytes,14,opt,name=icmp,proto3" json:"icmp,omitempty"`
+	// TCP handshake round-trip time, as observed from the interface where the flow was captured.
+	// Unset if the flow does not belong to a TCP connection whose handshake was observed
+	TimeFlowRtt *durationpb.Duration `protobuf:"bytes,15,opt,name=time_flow_rtt,json=timeFlowRtt,proto3" json:"time_flow_rtt,omitempty"`
+	// name of the network namespace of the interface. Empty for the agent's own namespace
+	Netns string `protobuf:"bytes,16,opt,name=netns,proto3" json:"netns,omitempty"`
+	// tunnel that encapsulated the flow packets, if they have been decapsulated. Then the
+	// rest of the attributes describe the encapsulated packets. Unset otherwise
+	Tunnel *Tunnel `protobuf:"bytes,17,opt,name=tunnel,proto3" json:"tunnel,omitempty"`
+	// if true, the flow packets are non-first IP fragments whose first fragment has not been
+	// observed, so their transport header is unknown. Then the transport ports and the ICMP type
+	// and code are 0
+	NonFirstFragment bool `protobuf:"varint,18,opt,name=non_first_fragment,json=nonFirstFragment,proto3" json:"non_first_fragment,omitempty"`
+	// number of packets of the flow that are IP fragments
+	FragmentedPackets uint64 `protobuf:"varint,19,opt,name=fragmented_packets,json=fragmentedPackets,proto3" json:"fragmented_packets,omitempty"`
+	// number of TCP packets of the flow with the SYN, FIN and RST flags, if the TCP flags
+	// counting is enabled in the agent
+	SynPackets uint64 `protobuf:"varint,20,opt,name=syn_packets,json=synPackets,proto3" json:"syn_packets,omitempty"`
+	FinPackets uint64 `protobuf:"varint,21,opt,name=fin_packets,json=finPackets,proto3" json:"fin_packets,omitempty"`
+	RstPackets uint64 `protobuf:"varint,22,opt,name=rst_packets,json=rstPackets,proto3" json:"rst_packets,omitempty"`
+	// packets and bytes of the flow that have been dropped by the kernel, if the packet drops
+	// tracking is enabled in the agent
+	DroppedPackets uint64 `protobuf:"varint,23,opt,name=dropped_packets,json=droppedPackets,proto3" json:"dropped_packets,omitempty"`
+	DroppedBytes   uint64 `protobuf:"varint,24,opt,name=dropped_bytes,json=droppedBytes,proto3" json:"dropped_bytes,omitempty"`
+	// kernel reason of the last dropped packet of the flow (e.g. NETFILTER_DROP)
+	DropCause string `protobuf:"bytes,25,opt,name=drop_cause,json=dropCause,proto3" json:"drop_cause,omitempty"`
+	// last DNS message of the flow, if the DNS tracking is enabled in the agent. Unset if the flow
+	// did not carry any DNS message
+	Dns *Dns `protobuf:"bytes,26,opt,name=dns,proto3" json:"dns,omitempty"`
+	// number of TCP retransmissions of the connection of the flow, if the TCP retransmissions
+	// tracking is enabled in the agent
+	Retransmits uint64 `protobuf:"varint,27,opt,name=retransmits,proto3" json:"retransmits,omitempty"`
+	// samples of the local socket of the TCP connection, if the TCP socket sampling is enabled in
+	// the agent and the flow is sent from the local endpoint of the connection
+	TcpSocket *TcpSocket `protobuf:"bytes,28,opt,name=tcp_socket,json=tcpSocket,proto3" json:"tcp_socket,omitempty"`
+	// process that owns the local socket of the TCP connection, if the process tracking is enabled
+	// in the agent
+	Process *Process `protobuf:"bytes,29,opt,name=process,proto3" json:"process,omitempty"`
+	// sampling rate of the flow packets: only 1 out of "sampling" packets, on average, have been
+	// accounted. 1 if the packets are not sampled
+	Sampling uint32 `protobuf:"varint,30,opt,name=sampling,proto3" json:"sampling,omitempty"`
+	// metrics of the reverse direction, if the flows of both directions have been merged into a
+	// bidirectional flow (RFC 5103). In that case, the rest of the record describes the direction
+	// of the initiator of the connection
+	Reverse *Reverse `protobuf:"bytes,31,opt,name=reverse,proto3" json:"reverse,omitempty"`
+	// lifecycle event of the connection that the record reports, if the connection tracking is
+	// enabled in the agent
+	ConnectionEvent ConnectionEvent `protobuf:"varint,32,opt,name=connection_event,json=connectionEvent,proto3,enum=pbflow.ConnectionEvent" json:"connection_event,omitempty"`
+	// why the record of a tracked connection has been reported
+	FlowEndReason FlowEndReason `protobuf:"varint,33,opt,name=flow_end_reason,json=flowEndReason,proto3,enum=pbflow.FlowEndReason" json:"flow_end_reason,omitempty"`
 }
 
 func (x *Record) Reset() {
@@ -312,6 +535,139 @@ func (x *Record) GetIcmp() *Icmp {
 	return nil
 }
 
+func (x *Record) GetTimeFlowRtt() *durationpb.Duration {
+	if x != nil {
+		return x.TimeFlowRtt
+	}
+	return nil
+}
+
+func (x *Record) GetNetns() string {
+	if x != nil {
+		return x.Netns
+	}
+	return ""
+}
+
+func (x *Record) GetTunnel() *Tunnel {
+	if x != nil {
+		return x.Tunnel
+	}
+	return nil
+}
+
+func (x *Record) GetNonFirstFragment() bool {
+	if x != nil {
+		return x.NonFirstFragment
+	}
+	return false
+}
+
+func (x *Record) GetFragmentedPackets() uint64 {
+	if x != nil {
+		return x.FragmentedPackets
+	}
+	return 0
+}
+
+func (x *Record) GetSynPackets() uint64 {
+	if x != nil {
+		return x.SynPackets
+	}
+	return 0
+}
+
+func (x *Record) GetFinPackets() uint64 {
+	if x != nil {
+		return x.FinPackets
+	}
+	return 0
+}
+
+func (x *Record) GetRstPackets() uint64 {
+	if x != nil {
+		return x.RstPackets
+	}
+	return 0
+}
+
+func (x *Record) GetDroppedPackets() uint64 {
+	if x != nil {
+		return x.DroppedPackets
+	}
+	return 0
+}
+
+func (x *Record) GetDroppedBytes() uint64 {
+	if x != nil {
+		return x.DroppedBytes
+	}
+	return 0
+}
+
+func (x *Record) GetDropCause() string {
+	if x != nil {
+		return x.DropCause
+	}
+	return ""
+}
+
+func (x *Record) GetDns() *Dns {
+	if x != nil {
+		return x.Dns
+	}
+	return nil
+}
+
+func (x *Record) GetRetransmits() uint64 {
+	if x != nil {
+		return x.Retransmits
+	}
+	return 0
+}
+
+func (x *Record) GetTcpSocket() *TcpSocket {
+	if x != nil {
+		return x.TcpSocket
+	}
+	return nil
+}
+
+func (x *Record) GetProcess() *Process {
+	if x != nil {
+		return x.Process
+	}
+	return nil
+}
+
+func (x *Record) GetSampling() uint32 {
+	if x != nil {
+		return x.Sampling
+	}
+	return 0
+}
+
+func (x *Record) GetReverse() *Reverse {
+	if x != nil {
+		return x.Reverse
+	}
+	return nil
+}
+
+func (x *Record) GetConnectionEvent() ConnectionEvent {
+	if x != nil {
+		return x.ConnectionEvent
+	}
+	return ConnectionEvent_NO_CONNECTION_EVENT
+}
+
+func (x *Record) GetFlowEndReason() FlowEndReason {
+	if x != nil {
+		return x.FlowEndReason
+	}
+	return FlowEndReason_NO_END_REASON
+}
+
 type DataLink struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -319,6 +675,10 @@ type DataLink struct {
 
 	SrcMac uint64 `protobuf:"varint,1,opt,name=src_mac,json=srcMac,proto3" json:"src_mac,omitempty"`
 	DstMac uint64 `protobuf:"varint,2,opt,name=dst_mac,json=dstMac,proto3" json:"dst_mac,omitempty"`
+	// outer VLAN ID (802.1Q). 0 if the frame is not tagged
+	VlanId uint32 `protobuf:"varint,3,opt,name=vlan_id,json=vlanId,proto3" json:"vlan_id,omitempty"`
+	// inner VLAN ID of double-tagged (802.1ad QinQ) frames. 0 if the frame is not double-tagged
+	InnerVlanId uint32 `protobuf:"varint,4,opt,name=inner_vlan_id,json=innerVlanId,proto3" json:"inner_vlan_id,omitempty"`
 }
 
 func (x *DataLink) Reset() {
@@ -367,6 +727,20 @@ func (x *DataLink) GetDstMac() uint64 {
 	return 0
 }
 
+func (x *DataLink) GetVlanId() uint32 {
+	if x != nil {
+		return x.VlanId
+	}
+	return 0
+}
+
+func (x *DataLink) GetInnerVlanId() uint32 {
+	if x != nil {
+		return x.InnerVlanId
+	}
+	return 0
+}
+
 type Network struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -567,6 +941,418 @@ func (x *Transport) GetProtocol() uint32 {
 	return 0
 }
 
+type Tunnel struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type TunnelType `protobuf:"varint,1,opt,name=type,proto3,enum=pbflow.TunnelType" json:"type,omitempty"`
+	// outer IP addresses of the tunnel endpoints
+	SrcAddr *IP `protobuf:"bytes,2,opt,name=src_addr,json=srcAddr,proto3" json:"src_addr,omitempty"`
+	DstAddr *IP `protobuf:"bytes,3,opt,name=dst_addr,json=dstAddr,proto3" json:"dst_addr,omitempty"`
+	// VXLAN or Geneve Virtual Network Identifier, NVGRE Virtual Subnet ID, or GRE key.
+	// 0 for the tunnels without ID
+	Id uint32 `protobuf:"varint,4,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *Tunnel) Reset() {
+	*x = Tunnel{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_flow_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Tunnel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tunnel) ProtoMessage() {}
+
+func (x *Tunnel) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_flow_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tunnel.ProtoReflect.Descriptor instead.
+func (*Tunnel) Descriptor() ([]byte, []int) {
+	return file_proto_flow_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Tunnel) GetType() TunnelType {
+	if x != nil {
+		return x.Type
+	}
+	return TunnelType_NO_TUNNEL
+}
+
+func (x *Tunnel) GetSrcAddr() *IP {
+	if x != nil {
+		return x.SrcAddr
+	}
+	return nil
+}
+
+func (x *Tunnel) GetDstAddr() *IP {
+	if x != nil {
+		return x.DstAddr
+	}
+	return nil
+}
+
+func (x *Tunnel) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type Dns struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// transaction ID of the DNS message
+	Id uint32 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// flags of the DNS header (RFC 1035), including the QR bit and the response code
+	Flags uint32 `protobuf:"varint,2,opt,name=flags,proto3" json:"flags,omitempty"`
+	// response code (RCODE) of the DNS responses, e.g. 3 for NXDOMAIN
+	Rcode uint32 `protobuf:"varint,3,opt,name=rcode,proto3" json:"rcode,omitempty"`
+	// time between the DNS query and its response, as observed from the interface where the flow
+	// was captured. Unset if the query and the response could not be correlated
+	Latency *durationpb.Duration `protobuf:"bytes,4,opt,name=latency,proto3" json:"latency,omitempty"`
+}
+
+func (x *Dns) Reset() {
+	*x = Dns{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_flow_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Dns) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Dns) ProtoMessage() {}
+
+func (x *Dns) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_flow_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Dns.ProtoReflect.Descriptor instead.
+func (*Dns) Descriptor() ([]byte, []int) {
+	return file_proto_flow_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Dns) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Dns) GetFlags() uint32 {
+	if x != nil {
+		return x.Flags
+	}
+	return 0
+}
+
+func (x *Dns) GetRcode() uint32 {
+	if x != nil {
+		return x.Rcode
+	}
+	return 0
+}
+
+func (x *Dns) GetLatency() *durationpb.Duration {
+	if x != nil {
+		return x.Latency
+	}
+	return nil
+}
+
+type TcpSocket struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// number of samples, which are taken when the socket receives a segment
+	Samples uint32 `protobuf:"varint,1,opt,name=samples,proto3" json:"samples,omitempty"`
+	// minimum, average and maximum smoothed round-trip time, as estimated by the TCP stack
+	SrttMin *durationpb.Duration `protobuf:"bytes,2,opt,name=srtt_min,json=srttMin,proto3" json:"srtt_min,omitempty"`
+	SrttAvg *durationpb.Duration `protobuf:"bytes,3,opt,name=srtt_avg,json=srttAvg,proto3" json:"srtt_avg,omitempty"`
+	SrttMax *durationpb.Duration `protobuf:"bytes,4,opt,name=srtt_max,json=srttMax,proto3" json:"srtt_max,omitempty"`
+	// minimum, average and maximum congestion window, in segments
+	CwndMin uint32 `protobuf:"varint,5,opt,name=cwnd_min,json=cwndMin,proto3" json:"cwnd_min,omitempty"`
+	CwndAvg uint32 `protobuf:"varint,6,opt,name=cwnd_avg,json=cwndAvg,proto3" json:"cwnd_avg,omitempty"`
+	CwndMax uint32 `protobuf:"varint,7,opt,name=cwnd_max,json=cwndMax,proto3" json:"cwnd_max,omitempty"`
+	// minimum, average and maximum size of the sent segments (MSS)
+	MssMin uint32 `protobuf:"varint,8,opt,name=mss_min,json=mssMin,proto3" json:"mss_min,omitempty"`
+	MssAvg uint32 `protobuf:"varint,9,opt,name=mss_avg,json=mssAvg,proto3" json:"mss_avg,omitempty"`
+	MssMax uint32 `protobuf:"varint,10,opt,name=mss_max,json=mssMax,proto3" json:"mss_max,omitempty"`
+}
+
+func (x *TcpSocket) Reset() {
+	*x = TcpSocket{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_flow_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TcpSocket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TcpSocket) ProtoMessage() {}
+
+func (x *TcpSocket) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_flow_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TcpSocket.ProtoReflect.Descriptor instead.
+func (*TcpSocket) Descriptor() ([]byte, []int) {
+	return file_proto_flow_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *TcpSocket) GetSamples() uint32 {
+	if x != nil {
+		return x.Samples
+	}
+	return 0
+}
+
+func (x *TcpSocket) GetSrttMin() *durationpb.Duration {
+	if x != nil {
+		return x.SrttMin
+	}
+	return nil
+}
+
+func (x *TcpSocket) GetSrttAvg() *durationpb.Duration {
+	if x != nil {
+		return x.SrttAvg
+	}
+	return nil
+}
+
+func (x *TcpSocket) GetSrttMax() *durationpb.Duration {
+	if x != nil {
+		return x.SrttMax
+	}
+	return nil
+}
+
+func (x *TcpSocket) GetCwndMin() uint32 {
+	if x != nil {
+		return x.CwndMin
+	}
+	return 0
+}
+
+func (x *TcpSocket) GetCwndAvg() uint32 {
+	if x != nil {
+		return x.CwndAvg
+	}
+	return 0
+}
+
+func (x *TcpSocket) GetCwndMax() uint32 {
+	if x != nil {
+		return x.CwndMax
+	}
+	return 0
+}
+
+func (x *TcpSocket) GetMssMin() uint32 {
+	if x != nil {
+		return x.MssMin
+	}
+	return 0
+}
+
+func (x *TcpSocket) GetMssAvg() uint32 {
+	if x != nil {
+		return x.MssAvg
+	}
+	return 0
+}
+
+func (x *TcpSocket) GetMssMax() uint32 {
+	if x != nil {
+		return x.MssMax
+	}
+	return 0
+}
+
+type Process struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Pid uint32 `protobuf:"varint,1,opt,name=pid,proto3" json:"pid,omitempty"`
+	// command name of the process, truncated to 15 characters
+	Command string `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`
+	// ID of the cgroup v2 of the process, which is the inode number of its directory
+	CgroupId uint64 `protobuf:"varint,3,opt,name=cgroup_id,json=cgroupId,proto3" json:"cgroup_id,omitempty"`
+	// ID of the container where the process runs. Empty if it does not run in a container
+	ContainerId string `protobuf:"bytes,4,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+}
+
+func (x *Process) Reset() {
+	*x = Process{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_flow_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Process) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Process) ProtoMessage() {}
+
+func (x *Process) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_flow_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Process.ProtoReflect.Descriptor instead.
+func (*Process) Descriptor() ([]byte, []int) {
+	return file_proto_flow_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Process) GetPid() uint32 {
+	if x != nil {
+		return x.Pid
+	}
+	return 0
+}
+
+func (x *Process) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *Process) GetCgroupId() uint64 {
+	if x != nil {
+		return x.CgroupId
+	}
+	return 0
+}
+
+func (x *Process) GetContainerId() string {
+	if x != nil {
+		return x.ContainerId
+	}
+	return ""
+}
+
+type Reverse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// bytes and packets that are sent by the responder of the connection
+	Bytes   uint64 `protobuf:"varint,1,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Packets uint64 `protobuf:"varint,2,opt,name=packets,proto3" json:"packets,omitempty"`
+	// TCP flags of the packets that are sent by the responder
+	Flags uint32 `protobuf:"varint,3,opt,name=flags,proto3" json:"flags,omitempty"`
+}
+
+func (x *Reverse) Reset() {
+	*x = Reverse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_flow_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Reverse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Reverse) ProtoMessage() {}
+
+func (x *Reverse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_flow_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Reverse.ProtoReflect.Descriptor instead.
+func (*Reverse) Descriptor() ([]byte, []int) {
+	return file_proto_flow_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Reverse) GetBytes() uint64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *Reverse) GetPackets() uint64 {
+	if x != nil {
+		return x.Packets
+	}
+	return 0
+}
+
+func (x *Reverse) GetFlags() uint32 {
+	if x != nil {
+		return x.Flags
+	}
+	return 0
+}
+
 type Icmp struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -579,7 +1365,7 @@ type Icmp struct {
 func (x *Icmp) Reset() {
 	*x = Icmp{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_proto_flow_proto_msgTypes[7]
+		mi := &file_proto_flow_proto_msgTypes[12]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -592,7 +1378,7 @@ func (x *Icmp) String() string {
 func (*Icmp) ProtoMessage() {}
 
 func (x *Icmp) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_flow_proto_msgTypes[7]
+	mi := &file_proto_flow_proto_msgTypes[12]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -605,7 +1391,7 @@ func (x *Icmp) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Icmp.ProtoReflect.Descriptor instead.
 func (*Icmp) Descriptor() ([]byte, []int) {
-	return file_proto_flow_proto_rawDescGZIP(), []int{7}
+	return file_proto_flow_proto_rawDescGZIP(), []int{12}
 }
 
 func (x *Icmp) GetIcmpType() uint32 {
@@ -628,12 +1414,14 @@ var file_proto_flow_proto_rawDesc = []byte{
 	0x0a, 0x10, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x70, 0x72, 0x6f,
 	0x74, 0x6f, 0x12, 0x06, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67,
 	0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65,
-	0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x10, 0x0a, 0x0e, 0x43,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x64, 0x75, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x10, 0x0a, 0x0e, 0x43,
 	0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x33, 0x0a,
 	0x07, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x73, 0x12, 0x28, 0x0a, 0x07, 0x65, 0x6e, 0x74, 0x72,
 	0x69, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x70, 0x62, 0x66, 0x6c,
 	0x6f, 0x77, 0x2e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69,
-	0x65, 0x73, 0x22, 0xb6, 0x04, 0x0a, 0x06, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x21, 0x0a,
+	0x65, 0x73, 0x22, 0xc8, 0x0a, 0x0a, 0x06, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x21, 0x0a,
 	0x0c, 0x65, 0x74, 0x68, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x18, 0x01, 0x20,
 	0x01, 0x28, 0x0d, 0x52, 0x0b, 0x65, 0x74, 0x68, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c,
 	0x12, 0x2f, 0x0a, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20,
@@ -668,38 +1456,162 @@ var file_proto_flow_proto_rawDesc = []byte{
 	0x74, 0x49, 0x70, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x6c, 0x61, 0x67, 0x73, 0x18, 0x0d, 0x20, 0x01,
 	0x28, 0x0d, 0x52, 0x05, 0x66, 0x6c, 0x61, 0x67, 0x73, 0x12, 0x20, 0x0a, 0x04, 0x69, 0x63, 0x6d,
 	0x70, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77,
-	0x2e, 0x49, 0x63, 0x6d, 0x70, 0x52, 0x04, 0x69, 0x63, 0x6d, 0x70, 0x22, 0x3c, 0x0a, 0x08, 0x44,
-	0x61, 0x74, 0x61, 0x4c, 0x69, 0x6e, 0x6b, 0x12, 0x17, 0x0a, 0x07, 0x73, 0x72, 0x63, 0x5f, 0x6d,
-	0x61, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x73, 0x72, 0x63, 0x4d, 0x61, 0x63,
-	0x12, 0x17, 0x0a, 0x07, 0x64, 0x73, 0x74, 0x5f, 0x6d, 0x61, 0x63, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x04, 0x52, 0x06, 0x64, 0x73, 0x74, 0x4d, 0x61, 0x63, 0x22, 0x57, 0x0a, 0x07, 0x4e, 0x65, 0x74,
-	0x77, 0x6f, 0x72, 0x6b, 0x12, 0x25, 0x0a, 0x08, 0x73, 0x72, 0x63, 0x5f, 0x61, 0x64, 0x64, 0x72,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e,
-	0x49, 0x50, 0x52, 0x07, 0x73, 0x72, 0x63, 0x41, 0x64, 0x64, 0x72, 0x12, 0x25, 0x0a, 0x08, 0x64,
-	0x73, 0x74, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e,
-	0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x49, 0x50, 0x52, 0x07, 0x64, 0x73, 0x74, 0x41, 0x64,
-	0x64, 0x72, 0x22, 0x3d, 0x0a, 0x02, 0x49, 0x50, 0x12, 0x14, 0x0a, 0x04, 0x69, 0x70, 0x76, 0x34,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x07, 0x48, 0x00, 0x52, 0x04, 0x69, 0x70, 0x76, 0x34, 0x12, 0x14,
-	0x0a, 0x04, 0x69, 0x70, 0x76, 0x36, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x04,
-	0x69, 0x70, 0x76, 0x36, 0x42, 0x0b, 0x0a, 0x09, 0x69, 0x70, 0x5f, 0x66, 0x61, 0x6d, 0x69, 0x6c,
-	0x79, 0x22, 0x5d, 0x0a, 0x09, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x19,
-	0x0a, 0x08, 0x73, 0x72, 0x63, 0x5f, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d,
-	0x52, 0x07, 0x73, 0x72, 0x63, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x19, 0x0a, 0x08, 0x64, 0x73, 0x74,
-	0x5f, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x64, 0x73, 0x74,
-	0x50, 0x6f, 0x72, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c,
-	0x22, 0x40, 0x0a, 0x04, 0x49, 0x63, 0x6d, 0x70, 0x12, 0x1b, 0x0a, 0x09, 0x69, 0x63, 0x6d, 0x70,
-	0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x69, 0x63, 0x6d,
-	0x70, 0x54, 0x79, 0x70, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x69, 0x63, 0x6d, 0x70, 0x5f, 0x63, 0x6f,
-	0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x69, 0x63, 0x6d, 0x70, 0x43, 0x6f,
-	0x64, 0x65, 0x2a, 0x24, 0x0a, 0x09, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12,
-	0x0b, 0x0a, 0x07, 0x49, 0x4e, 0x47, 0x52, 0x45, 0x53, 0x53, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06,
-	0x45, 0x47, 0x52, 0x45, 0x53, 0x53, 0x10, 0x01, 0x32, 0x3e, 0x0a, 0x09, 0x43, 0x6f, 0x6c, 0x6c,
-	0x65, 0x63, 0x74, 0x6f, 0x72, 0x12, 0x31, 0x0a, 0x04, 0x53, 0x65, 0x6e, 0x64, 0x12, 0x0f, 0x2e,
-	0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x73, 0x1a, 0x16,
-	0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x6f,
-	0x72, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x42, 0x0a, 0x5a, 0x08, 0x2e, 0x2f, 0x70, 0x62,
-	0x66, 0x6c, 0x6f, 0x77, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x2e, 0x49, 0x63, 0x6d, 0x70, 0x52, 0x04, 0x69, 0x63, 0x6d, 0x70, 0x12, 0x3d, 0x0a, 0x0d, 0x74,
+	0x69, 0x6d, 0x65, 0x5f, 0x66, 0x6c, 0x6f, 0x77, 0x5f, 0x72, 0x74, 0x74, 0x18, 0x0f, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0b, 0x74,
+	0x69, 0x6d, 0x65, 0x46, 0x6c, 0x6f, 0x77, 0x52, 0x74, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x6e, 0x65,
+	0x74, 0x6e, 0x73, 0x18, 0x10, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6e, 0x65, 0x74, 0x6e, 0x73,
+	0x12, 0x26, 0x0a, 0x06, 0x74, 0x75, 0x6e, 0x6e, 0x65, 0x6c, 0x18, 0x11, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x0e, 0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x54, 0x75, 0x6e, 0x6e, 0x65, 0x6c,
+	0x52, 0x06, 0x74, 0x75, 0x6e, 0x6e, 0x65, 0x6c, 0x12, 0x2c, 0x0a, 0x12, 0x6e, 0x6f, 0x6e, 0x5f,
+	0x66, 0x69, 0x72, 0x73, 0x74, 0x5f, 0x66, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x18, 0x12,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x10, 0x6e, 0x6f, 0x6e, 0x46, 0x69, 0x72, 0x73, 0x74, 0x46, 0x72,
+	0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x2d, 0x0a, 0x12, 0x66, 0x72, 0x61, 0x67, 0x6d, 0x65,
+	0x6e, 0x74, 0x65, 0x64, 0x5f, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x13, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x11, 0x66, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x65, 0x64, 0x50, 0x61,
+	0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x79, 0x6e, 0x5f, 0x70, 0x61, 0x63,
+	0x6b, 0x65, 0x74, 0x73, 0x18, 0x14, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a, 0x73, 0x79, 0x6e, 0x50,
+	0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x66, 0x69, 0x6e, 0x5f, 0x70, 0x61,
+	0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x15, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a, 0x66, 0x69, 0x6e,
+	0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x73, 0x74, 0x5f, 0x70,
+	0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x16, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a, 0x72, 0x73,
+	0x74, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x64, 0x72, 0x6f, 0x70,
+	0x70, 0x65, 0x64, 0x5f, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x17, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x0e, 0x64, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74,
+	0x73, 0x12, 0x23, 0x0a, 0x0d, 0x64, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x5f, 0x62, 0x79, 0x74,
+	0x65, 0x73, 0x18, 0x18, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0c, 0x64, 0x72, 0x6f, 0x70, 0x70, 0x65,
+	0x64, 0x42, 0x79, 0x74, 0x65, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x64, 0x72, 0x6f, 0x70, 0x5f, 0x63,
+	0x61, 0x75, 0x73, 0x65, 0x18, 0x19, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x64, 0x72, 0x6f, 0x70,
+	0x43, 0x61, 0x75, 0x73, 0x65, 0x12, 0x1d, 0x0a, 0x03, 0x64, 0x6e, 0x73, 0x18, 0x1a, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x44, 0x6e, 0x73, 0x52,
+	0x03, 0x64, 0x6e, 0x73, 0x12, 0x20, 0x0a, 0x0b, 0x72, 0x65, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x6d,
+	0x69, 0x74, 0x73, 0x18, 0x1b, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x72, 0x65, 0x74, 0x72, 0x61,
+	0x6e, 0x73, 0x6d, 0x69, 0x74, 0x73, 0x12, 0x30, 0x0a, 0x0a, 0x74, 0x63, 0x70, 0x5f, 0x73, 0x6f,
+	0x63, 0x6b, 0x65, 0x74, 0x18, 0x1c, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x70, 0x62, 0x66,
+	0x6c, 0x6f, 0x77, 0x2e, 0x54, 0x63, 0x70, 0x53, 0x6f, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x09, 0x74,
+	0x63, 0x70, 0x53, 0x6f, 0x63, 0x6b, 0x65, 0x74, 0x12, 0x29, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x63,
+	0x65, 0x73, 0x73, 0x18, 0x1d, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x70, 0x62, 0x66, 0x6c,
+	0x6f, 0x77, 0x2e, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x52, 0x07, 0x70, 0x72, 0x6f, 0x63,
+	0x65, 0x73, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x61, 0x6d, 0x70, 0x6c, 0x69, 0x6e, 0x67, 0x18,
+	0x1e, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x73, 0x61, 0x6d, 0x70, 0x6c, 0x69, 0x6e, 0x67, 0x12,
+	0x29, 0x0a, 0x07, 0x72, 0x65, 0x76, 0x65, 0x72, 0x73, 0x65, 0x18, 0x1f, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x0f, 0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x52, 0x65, 0x76, 0x65, 0x72, 0x73,
+	0x65, 0x52, 0x07, 0x72, 0x65, 0x76, 0x65, 0x72, 0x73, 0x65, 0x12, 0x42, 0x0a, 0x10, 0x63, 0x6f,
+	0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x18, 0x20,
+	0x20, 0x01, 0x28, 0x0e, 0x32, 0x17, 0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x43, 0x6f,
+	0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x52, 0x0f, 0x63,
+	0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x3d,
+	0x0a, 0x0f, 0x66, 0x6c, 0x6f, 0x77, 0x5f, 0x65, 0x6e, 0x64, 0x5f, 0x72, 0x65, 0x61, 0x73, 0x6f,
+	0x6e, 0x18, 0x21, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77,
+	0x2e, 0x46, 0x6c, 0x6f, 0x77, 0x45, 0x6e, 0x64, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x52, 0x0d,
+	0x66, 0x6c, 0x6f, 0x77, 0x45, 0x6e, 0x64, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x22, 0x79, 0x0a,
+	0x08, 0x44, 0x61, 0x74, 0x61, 0x4c, 0x69, 0x6e, 0x6b, 0x12, 0x17, 0x0a, 0x07, 0x73, 0x72, 0x63,
+	0x5f, 0x6d, 0x61, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x73, 0x72, 0x63, 0x4d,
+	0x61, 0x63, 0x12, 0x17, 0x0a, 0x07, 0x64, 0x73, 0x74, 0x5f, 0x6d, 0x61, 0x63, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x06, 0x64, 0x73, 0x74, 0x4d, 0x61, 0x63, 0x12, 0x17, 0x0a, 0x07, 0x76,
+	0x6c, 0x61, 0x6e, 0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x76, 0x6c,
+	0x61, 0x6e, 0x49, 0x64, 0x12, 0x22, 0x0a, 0x0d, 0x69, 0x6e, 0x6e, 0x65, 0x72, 0x5f, 0x76, 0x6c,
+	0x61, 0x6e, 0x5f, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x69, 0x6e, 0x6e,
+	0x65, 0x72, 0x56, 0x6c, 0x61, 0x6e, 0x49, 0x64, 0x22, 0x57, 0x0a, 0x07, 0x4e, 0x65, 0x74, 0x77,
+	0x6f, 0x72, 0x6b, 0x12, 0x25, 0x0a, 0x08, 0x73, 0x72, 0x63, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x49,
+	0x50, 0x52, 0x07, 0x73, 0x72, 0x63, 0x41, 0x64, 0x64, 0x72, 0x12, 0x25, 0x0a, 0x08, 0x64, 0x73,
+	0x74, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x70,
+	0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x49, 0x50, 0x52, 0x07, 0x64, 0x73, 0x74, 0x41, 0x64, 0x64,
+	0x72, 0x22, 0x3d, 0x0a, 0x02, 0x49, 0x50, 0x12, 0x14, 0x0a, 0x04, 0x69, 0x70, 0x76, 0x34, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x07, 0x48, 0x00, 0x52, 0x04, 0x69, 0x70, 0x76, 0x34, 0x12, 0x14, 0x0a,
+	0x04, 0x69, 0x70, 0x76, 0x36, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x04, 0x69,
+	0x70, 0x76, 0x36, 0x42, 0x0b, 0x0a, 0x09, 0x69, 0x70, 0x5f, 0x66, 0x61, 0x6d, 0x69, 0x6c, 0x79,
+	0x22, 0x5d, 0x0a, 0x09, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x19, 0x0a,
+	0x08, 0x73, 0x72, 0x63, 0x5f, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x07, 0x73, 0x72, 0x63, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x19, 0x0a, 0x08, 0x64, 0x73, 0x74, 0x5f,
+	0x70, 0x6f, 0x72, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x64, 0x73, 0x74, 0x50,
+	0x6f, 0x72, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x22,
+	0x8e, 0x01, 0x0a, 0x06, 0x54, 0x75, 0x6e, 0x6e, 0x65, 0x6c, 0x12, 0x26, 0x0a, 0x04, 0x74, 0x79,
+	0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x12, 0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f,
+	0x77, 0x2e, 0x54, 0x75, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79,
+	0x70, 0x65, 0x12, 0x25, 0x0a, 0x08, 0x73, 0x72, 0x63, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x49, 0x50,
+	0x52, 0x07, 0x73, 0x72, 0x63, 0x41, 0x64, 0x64, 0x72, 0x12, 0x25, 0x0a, 0x08, 0x64, 0x73, 0x74,
+	0x5f, 0x61, 0x64, 0x64, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x70, 0x62,
+	0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x49, 0x50, 0x52, 0x07, 0x64, 0x73, 0x74, 0x41, 0x64, 0x64, 0x72,
+	0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x02, 0x69, 0x64,
+	0x22, 0x76, 0x0a, 0x03, 0x44, 0x6e, 0x73, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x02, 0x69, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x6c, 0x61, 0x67, 0x73,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x66, 0x6c, 0x61, 0x67, 0x73, 0x12, 0x14, 0x0a,
+	0x05, 0x72, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x72, 0x63,
+	0x6f, 0x64, 0x65, 0x12, 0x33, 0x0a, 0x07, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52,
+	0x07, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x22, 0xe3, 0x02, 0x0a, 0x09, 0x54, 0x63, 0x70,
+	0x53, 0x6f, 0x63, 0x6b, 0x65, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x61, 0x6d, 0x70, 0x6c, 0x65,
+	0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x73, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73,
+	0x12, 0x34, 0x0a, 0x08, 0x73, 0x72, 0x74, 0x74, 0x5f, 0x6d, 0x69, 0x6e, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x07, 0x73,
+	0x72, 0x74, 0x74, 0x4d, 0x69, 0x6e, 0x12, 0x34, 0x0a, 0x08, 0x73, 0x72, 0x74, 0x74, 0x5f, 0x61,
+	0x76, 0x67, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x52, 0x07, 0x73, 0x72, 0x74, 0x74, 0x41, 0x76, 0x67, 0x12, 0x34, 0x0a, 0x08,
+	0x73, 0x72, 0x74, 0x74, 0x5f, 0x6d, 0x61, 0x78, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x07, 0x73, 0x72, 0x74, 0x74, 0x4d,
+	0x61, 0x78, 0x12, 0x19, 0x0a, 0x08, 0x63, 0x77, 0x6e, 0x64, 0x5f, 0x6d, 0x69, 0x6e, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x63, 0x77, 0x6e, 0x64, 0x4d, 0x69, 0x6e, 0x12, 0x19, 0x0a,
+	0x08, 0x63, 0x77, 0x6e, 0x64, 0x5f, 0x61, 0x76, 0x67, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x07, 0x63, 0x77, 0x6e, 0x64, 0x41, 0x76, 0x67, 0x12, 0x19, 0x0a, 0x08, 0x63, 0x77, 0x6e, 0x64,
+	0x5f, 0x6d, 0x61, 0x78, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x63, 0x77, 0x6e, 0x64,
+	0x4d, 0x61, 0x78, 0x12, 0x17, 0x0a, 0x07, 0x6d, 0x73, 0x73, 0x5f, 0x6d, 0x69, 0x6e, 0x18, 0x08,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x6d, 0x73, 0x73, 0x4d, 0x69, 0x6e, 0x12, 0x17, 0x0a, 0x07,
+	0x6d, 0x73, 0x73, 0x5f, 0x61, 0x76, 0x67, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x6d,
+	0x73, 0x73, 0x41, 0x76, 0x67, 0x12, 0x17, 0x0a, 0x07, 0x6d, 0x73, 0x73, 0x5f, 0x6d, 0x61, 0x78,
+	0x18, 0x0a, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x6d, 0x73, 0x73, 0x4d, 0x61, 0x78, 0x22, 0x75,
+	0x0a, 0x07, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x70, 0x69, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x70, 0x69, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x63,
+	0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f,
+	0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x67, 0x72, 0x6f, 0x75, 0x70, 0x5f,
+	0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x63, 0x67, 0x72, 0x6f, 0x75, 0x70,
+	0x49, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x5f,
+	0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69,
+	0x6e, 0x65, 0x72, 0x49, 0x64, 0x22, 0x4f, 0x0a, 0x07, 0x52, 0x65, 0x76, 0x65, 0x72, 0x73, 0x65,
+	0x12, 0x14, 0x0a, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74,
+	0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73,
+	0x12, 0x14, 0x0a, 0x05, 0x66, 0x6c, 0x61, 0x67, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x05, 0x66, 0x6c, 0x61, 0x67, 0x73, 0x22, 0x40, 0x0a, 0x04, 0x49, 0x63, 0x6d, 0x70, 0x12, 0x1b,
+	0x0a, 0x09, 0x69, 0x63, 0x6d, 0x70, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x08, 0x69, 0x63, 0x6d, 0x70, 0x54, 0x79, 0x70, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x69,
+	0x63, 0x6d, 0x70, 0x5f, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08,
+	0x69, 0x63, 0x6d, 0x70, 0x43, 0x6f, 0x64, 0x65, 0x2a, 0x24, 0x0a, 0x09, 0x44, 0x69, 0x72, 0x65,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x0b, 0x0a, 0x07, 0x49, 0x4e, 0x47, 0x52, 0x45, 0x53, 0x53,
+	0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x45, 0x47, 0x52, 0x45, 0x53, 0x53, 0x10, 0x01, 0x2a, 0x59,
+	0x0a, 0x0a, 0x54, 0x75, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0d, 0x0a, 0x09,
+	0x4e, 0x4f, 0x5f, 0x54, 0x55, 0x4e, 0x4e, 0x45, 0x4c, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x56,
+	0x58, 0x4c, 0x41, 0x4e, 0x10, 0x01, 0x12, 0x0a, 0x0a, 0x06, 0x47, 0x45, 0x4e, 0x45, 0x56, 0x45,
+	0x10, 0x02, 0x12, 0x07, 0x0a, 0x03, 0x47, 0x52, 0x45, 0x10, 0x03, 0x12, 0x09, 0x0a, 0x05, 0x4e,
+	0x56, 0x47, 0x52, 0x45, 0x10, 0x04, 0x12, 0x08, 0x0a, 0x04, 0x49, 0x50, 0x49, 0x50, 0x10, 0x05,
+	0x12, 0x07, 0x0a, 0x03, 0x53, 0x49, 0x54, 0x10, 0x06, 0x2a, 0x6b, 0x0a, 0x0f, 0x43, 0x6f, 0x6e,
+	0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x17, 0x0a, 0x13,
+	0x4e, 0x4f, 0x5f, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x45, 0x56,
+	0x45, 0x4e, 0x54, 0x10, 0x00, 0x12, 0x14, 0x0a, 0x10, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54,
+	0x49, 0x4f, 0x4e, 0x5f, 0x53, 0x54, 0x41, 0x52, 0x54, 0x10, 0x01, 0x12, 0x15, 0x0a, 0x11, 0x43,
+	0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x55, 0x50, 0x44, 0x41, 0x54, 0x45,
+	0x10, 0x02, 0x12, 0x12, 0x0a, 0x0e, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x49, 0x4f, 0x4e,
+	0x5f, 0x45, 0x4e, 0x44, 0x10, 0x03, 0x2a, 0x72, 0x0a, 0x0d, 0x46, 0x6c, 0x6f, 0x77, 0x45, 0x6e,
+	0x64, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x11, 0x0a, 0x0d, 0x4e, 0x4f, 0x5f, 0x45, 0x4e,
+	0x44, 0x5f, 0x52, 0x45, 0x41, 0x53, 0x4f, 0x4e, 0x10, 0x00, 0x12, 0x10, 0x0a, 0x0c, 0x49, 0x44,
+	0x4c, 0x45, 0x5f, 0x54, 0x49, 0x4d, 0x45, 0x4f, 0x55, 0x54, 0x10, 0x01, 0x12, 0x12, 0x0a, 0x0e,
+	0x41, 0x43, 0x54, 0x49, 0x56, 0x45, 0x5f, 0x54, 0x49, 0x4d, 0x45, 0x4f, 0x55, 0x54, 0x10, 0x02,
+	0x12, 0x18, 0x0a, 0x14, 0x45, 0x4e, 0x44, 0x5f, 0x4f, 0x46, 0x5f, 0x46, 0x4c, 0x4f, 0x57, 0x5f,
+	0x44, 0x45, 0x54, 0x45, 0x43, 0x54, 0x45, 0x44, 0x10, 0x03, 0x12, 0x0e, 0x0a, 0x0a, 0x46, 0x4f,
+	0x52, 0x43, 0x45, 0x44, 0x5f, 0x45, 0x4e, 0x44, 0x10, 0x04, 0x32, 0x3e, 0x0a, 0x09, 0x43, 0x6f,
+	0x6c, 0x6c, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x12, 0x31, 0x0a, 0x04, 0x53, 0x65, 0x6e, 0x64, 0x12,
+	0x0f, 0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x73,
+	0x1a, 0x16, 0x2e, 0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x2e, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63,
+	0x74, 0x6f, 0x72, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x42, 0x0a, 0x5a, 0x08, 0x2e, 0x2f,
+	0x70, 0x62, 0x66, 0x6c, 0x6f, 0x77, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -714,39 +1626,63 @@ func file_proto_flow_proto_rawDescGZIP() []byte {
 	return file_proto_flow_proto_rawDescData
 }
 
-var file_proto_flow_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_proto_flow_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_proto_flow_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_proto_flow_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_proto_flow_proto_goTypes = []interface{}{
 	(Direction)(0),                // 0: pbflow.Direction
-	(*CollectorReply)(nil),        // 1: pbflow.CollectorReply
-	(*Records)(nil),               // 2: pbflow.Records
-	(*Record)(nil),                // 3: pbflow.Record
-	(*DataLink)(nil),              // 4: pbflow.DataLink
-	(*Network)(nil),               // 5: pbflow.Network
-	(*IP)(nil),                    // 6: pbflow.IP
-	(*Transport)(nil),             // 7: pbflow.Transport
-	(*Icmp)(nil),                  // 8: pbflow.Icmp
-	(*timestamppb.Timestamp)(nil), // 9: google.protobuf.Timestamp
+	(TunnelType)(0),               // 1: pbflow.TunnelType
+	(ConnectionEvent)(0),          // 2: pbflow.ConnectionEvent
+	(FlowEndReason)(0),            // 3: pbflow.FlowEndReason
+	(*CollectorReply)(nil),        // 4: pbflow.CollectorReply
+	(*Records)(nil),               // 5: pbflow.Records
+	(*Record)(nil),                // 6: pbflow.Record
+	(*DataLink)(nil),              // 7: pbflow.DataLink
+	(*Network)(nil),               // 8: pbflow.Network
+	(*IP)(nil),                    // 9: pbflow.IP
+	(*Transport)(nil),             // 10: pbflow.Transport
+	(*Tunnel)(nil),                // 11: pbflow.Tunnel
+	(*Dns)(nil),                   // 12: pbflow.Dns
+	(*TcpSocket)(nil),             // 13: pbflow.TcpSocket
+	(*Process)(nil),               // 14: pbflow.Process
+	(*Reverse)(nil),               // 15: pbflow.Reverse
+	(*Icmp)(nil),                  // 16: pbflow.Icmp
+	(*timestamppb.Timestamp)(nil), // 17: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),   // 18: google.protobuf.Duration
 }
 var file_proto_flow_proto_depIdxs = []int32{
-	3,  // 0: pbflow.Records.entries:type_name -> pbflow.Record
+	6,  // 0: pbflow.Records.entries:type_name -> pbflow.Record
 	0,  // 1: pbflow.Record.direction:type_name -> pbflow.Direction
-	9,  // 2: pbflow.Record.time_flow_start:type_name -> google.protobuf.Timestamp
-	9,  // 3: pbflow.Record.time_flow_end:type_name -> google.protobuf.Timestamp
-	4,  // 4: pbflow.Record.data_link:type_name -> pbflow.DataLink
-	5,  // 5: pbflow.Record.network:type_name -> pbflow.Network
-	7,  // 6: pbflow.Record.transport:type_name -> pbflow.Transport
-	6,  // 7: pbflow.Record.agent_ip:type_name -> pbflow.IP
-	8,  // 8: pbflow.Record.icmp:type_name -> pbflow.Icmp
-	6,  // 9: pbflow.Network.src_addr:type_name -> pbflow.IP
-	6,  // 10: pbflow.Network.dst_addr:type_name -> pbflow.IP
-	2,  // 11: pbflow.Collector.Send:input_type -> pbflow.Records
-	1,  // 12: pbflow.Collector.Send:output_type -> pbflow.CollectorReply
-	12, // [12:13] is the sub-list for method output_type
-	11, // [11:12] is the sub-list for method input_type
-	11, // [11:11] is the sub-list for extension type_name
-	11, // [11:11] is the sub-list for extension extendee
-	0,  // [0:11] is the sub-list for field type_name
+	17, // 2: pbflow.Record.time_flow_start:type_name -> google.protobuf.Timestamp
+	17, // 3: pbflow.Record.time_flow_end:type_name -> google.protobuf.Timestamp
+	7,  // 4: pbflow.Record.data_link:type_name -> pbflow.DataLink
+	8,  // 5: pbflow.Record.network:type_name -> pbflow.Network
+	10, // 6: pbflow.Record.transport:type_name -> pbflow.Transport
+	9,  // 7: pbflow.Record.agent_ip:type_name -> pbflow.IP
+	16, // 8: pbflow.Record.icmp:type_name -> pbflow.Icmp
+	18, // 9: pbflow.Record.time_flow_rtt:type_name -> google.protobuf.Duration
+	11, // 10: pbflow.Record.tunnel:type_name -> pbflow.Tunnel
+	12, // 11: pbflow.Record.dns:type_name -> pbflow.Dns
+	13, // 12: pbflow.Record.tcp_socket:type_name -> pbflow.TcpSocket
+	14, // 13: pbflow.Record.process:type_name -> pbflow.Process
+	15, // 14: pbflow.Record.reverse:type_name -> pbflow.Reverse
+	2,  // 15: pbflow.Record.connection_event:type_name -> pbflow.ConnectionEvent
+	3,  // 16: pbflow.Record.flow_end_reason:type_name -> pbflow.FlowEndReason
+	9,  // 17: pbflow.Network.src_addr:type_name -> pbflow.IP
+	9,  // 18: pbflow.Network.dst_addr:type_name -> pbflow.IP
+	1,  // 19: pbflow.Tunnel.type:type_name -> pbflow.TunnelType
+	9,  // 20: pbflow.Tunnel.src_addr:type_name -> pbflow.IP
+	9,  // 21: pbflow.Tunnel.dst_addr:type_name -> pbflow.IP
+	18, // 22: pbflow.Dns.latency:type_name -> google.protobuf.Duration
+	18, // 23: pbflow.TcpSocket.srtt_min:type_name -> google.protobuf.Duration
+	18, // 24: pbflow.TcpSocket.srtt_avg:type_name -> google.protobuf.Duration
+	18, // 25: pbflow.TcpSocket.srtt_max:type_name -> google.protobuf.Duration
+	5,  // 26: pbflow.Collector.Send:input_type -> pbflow.Records
+	4,  // 27: pbflow.Collector.Send:output_type -> pbflow.CollectorReply
+	27, // [27:28] is the sub-list for method output_type
+	26, // [26:27] is the sub-list for method input_type
+	26, // [26:26] is the sub-list for extension type_name
+	26, // [26:26] is the sub-list for extension extendee
+	0,  // [0:26] is the sub-list for field type_name
 }
 
 func init() { file_proto_flow_proto_init() }
@@ -840,6 +1776,66 @@ func file_proto_flow_proto_init() {
 			}
 		}
 		file_proto_flow_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Tunnel); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_flow_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Dns); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_flow_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TcpSocket); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_flow_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Process); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_flow_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Reverse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_flow_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*Icmp); i {
 			case 0:
 				return &v.state
@@ -861,8 +1857,8 @@ func file_proto_flow_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_proto_flow_proto_rawDesc,
-			NumEnums:      1,
-			NumMessages:   8,
+			NumEnums:      4,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
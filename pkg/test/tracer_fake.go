@@ -3,6 +3,7 @@ package test
 import (
 	"bytes"
 	"encoding/binary"
+	"sync"
 
 	"github.com/cilium/ebpf/ringbuf"
 	"github.com/netobserv/netobserv-ebpf-agent/pkg/ebpf"
@@ -12,6 +13,7 @@ import (
 
 // TracerFake fakes the kernel-side eBPF map structures for testing
 type TracerFake struct {
+	mt         sync.Mutex
 	interfaces map[ifaces.Interface]struct{}
 	mapLookups chan map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics
 	ringBuf    chan ringbuf.Record
@@ -29,23 +31,52 @@ func (m *TracerFake) Close() error {
 	return nil
 }
 func (m *TracerFake) Register(iface ifaces.Interface) error {
+	m.mt.Lock()
+	defer m.mt.Unlock()
 	m.interfaces[iface] = struct{}{}
 	return nil
 }
 
-func (m *TracerFake) LookupAndDeleteMap() map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics {
+func (m *TracerFake) Unregister(iface ifaces.Interface) error {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	delete(m.interfaces, iface)
+	return nil
+}
+
+func (m *TracerFake) LookupAndDeleteMap() (map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics, error) {
 	select {
 	case r := <-m.mapLookups:
-		return r
+		return r, nil
 	default:
-		return map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics{}
+		return map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics{}, nil
 	}
 }
 
+func (m *TracerFake) LookupAndDeleteRetransmits() map[ebpf.ConnId]uint32 {
+	return nil
+}
+
+func (m *TracerFake) LookupAndDeleteTCPSockSamples() map[ebpf.ConnId][]ebpf.TcpSockSamples {
+	return nil
+}
+
+func (m *TracerFake) LookupProcesses() map[ebpf.ConnId]ebpf.OwnerProcess {
+	return nil
+}
+
 func (m *TracerFake) ReadRingBuf() (ringbuf.Record, error) {
 	return <-m.ringBuf, nil
 }
 
+func (m *TracerFake) SetSamplingScale(_ float64) error {
+	return nil
+}
+
+func (m *TracerFake) EvictionStats() ebpf.EvictionStats {
+	return ebpf.EvictionStats{Mode: ebpf.EvictionModeIterative}
+}
+
 func (m *TracerFake) AppendLookupResults(results map[ebpf.BpfFlowId][]ebpf.BpfFlowMetrics) {
 	m.mapLookups <- results
 }